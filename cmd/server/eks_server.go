@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
@@ -11,6 +12,9 @@ import (
 	"syscall"
 	"time"
 
+	"k8s-node-proxy/internal/config"
+	"k8s-node-proxy/internal/discovery"
+	"k8s-node-proxy/internal/metrics"
 	"k8s-node-proxy/internal/nodes"
 	"k8s-node-proxy/internal/proxy"
 	"k8s-node-proxy/internal/server"
@@ -34,14 +38,20 @@ type EKSServer struct {
 	awsRegion       string
 	clusterName     string
 	servicePort     int
-	portManager     *PortManager
-	nodeDiscovery   *services.EKSNodePortDiscovery
-	nodeIPDiscovery *nodes.EKSNodeDiscovery
+	portManager     *server.PortManager
+	nodeDiscovery   discovery.ServiceDiscoverer
+	nodeIPDiscovery discovery.NodeDiscoverer
 	serverInfo      *EKSServerInfo
+	reloader        *server.Reloader
+	startup         server.StartupState
+	events          *server.EventStream
+	config          server.ConfigAPI
+	cfg             *config.Config
 }
 
 // NewEKSServer creates a new EKS server
-func NewEKSServer(awsRegion, clusterName string, servicePort int) (*EKSServer, error) {
+func NewEKSServer(cfg *config.Config) (*EKSServer, error) {
+	awsRegion, clusterName, servicePort := cfg.AWSRegion, cfg.ClusterName, cfg.ServicePort
 	slog.Info("Initializing k8s-node-proxy server for EKS",
 		"region", awsRegion,
 		"cluster", clusterName,
@@ -58,73 +68,191 @@ func NewEKSServer(awsRegion, clusterName string, servicePort int) (*EKSServer, e
 		return nil, fmt.Errorf("failed to create EKS node discovery: %w", err)
 	}
 
-	server := &EKSServer{
-		awsRegion:       awsRegion,
-		clusterName:     clusterName,
-		servicePort:     servicePort,
-		nodeDiscovery:   nodePortDiscovery,
+	server := newEKSServer(cfg, nodePortDiscovery, nodeIPDiscovery)
+	slog.Info("EKS server initialization completed successfully")
+	return server, nil
+}
+
+// newEKSServer creates a server running on the given service and node discoveries
+func newEKSServer(cfg *config.Config, nodeDiscovery discovery.ServiceDiscoverer, nodeIPDiscovery discovery.NodeDiscoverer) *EKSServer {
+	return &EKSServer{
+		awsRegion:       cfg.AWSRegion,
+		clusterName:     cfg.ClusterName,
+		servicePort:     cfg.ServicePort,
+		cfg:             cfg,
+		portManager:     server.NewPortManager(cfg.Listeners),
+		nodeDiscovery:   nodeDiscovery,
 		nodeIPDiscovery: nodeIPDiscovery,
 		serverInfo:      nil, // Will be populated during Run()
 	}
-
-	// Create port manager
-	portManager := NewPortManager()
-	server.portManager = portManager
-
-	slog.Info("EKS server initialization completed successfully")
-	return server, nil
 }
 
 func (s *EKSServer) Run() error {
 	ctx := context.Background()
 
+	targetMode := s.cfg.Discovery.TargetMode
+	includeClusterIP := s.cfg.Discovery.IncludeClusterIP
+	managementPrefix := s.cfg.ManagementPathPrefix
+	var webhook *server.EventWebhook
+	if s.cfg.EventWebhookURL != "" {
+		webhook = server.NewEventWebhook(s.cfg.EventWebhookURL, s.cfg.EventWebhookTimeout)
+		defer webhook.Close()
+	}
+	var kubeEvents *server.KubeEvents
+	if s.cfg.KubeEvents {
+		kubeEvents = server.NewKubeEvents(s.nodeDiscovery.GetClientset(), s.cfg.PodNamespace, s.cfg.PodName, s.cfg.PodUID)
+		defer kubeEvents.Close()
+	}
+
 	// Collect server info
 	if err := s.collectServerInfo(ctx); err != nil {
 		return fmt.Errorf("failed to collect server info: %w", err)
 	}
 
+	if s.cfg.DryRun {
+		// Report what would be proxied, then exit without listening or monitoring
+		var selector server.InitialNodeSelector
+		if targetMode == services.TargetModeNodePort {
+			selector = s.nodeIPDiscovery
+		}
+		_, err := server.PlanDryRun(ctx, s.nodeDiscovery, selector, s.serverInfo.Services, targetMode, s.servicePort)
+		return err
+	}
+
 	// Create handlers
-	serviceHandler := s.createServiceHandler()
-	proxyHandler := proxy.NewHandler(s.nodeIPDiscovery)
+	if s.cfg.LiveUpdates {
+		s.events = server.NewEventStream(s.homepageData)
+	}
+	proxyHandler := proxy.NewHandler(s.nodeIPDiscovery, s.cfg.Proxy)
+	if targetMode == services.TargetModeClusterIP {
+		// Forward straight to ClusterIP:port - node selection is not used
+		slog.Info("Running in ClusterIP target mode, node selection disabled")
+		proxyHandler = proxy.NewClusterIPHandler(services.ClusterIPTargets(s.serverInfo.Services), s.cfg.Proxy)
+	}
+	s.config = server.ConfigAPI{
+		Config: server.Config{
+			Platform:             "aws",
+			Cluster:              s.serverInfo.ClusterName,
+			Namespace:            s.serverInfo.Namespace,
+			TargetMode:           targetMode,
+			IncludeClusterIP:     includeClusterIP,
+			ServicePort:          s.servicePort,
+			ManagementPathPrefix: managementPrefix,
+			LiveUpdates:          s.cfg.LiveUpdates,
+			MaxListeners:         s.cfg.MaxListeners,
+			HostRoutingDomain:    s.cfg.HostRoutingDomain,
+			HostRoutingPort:      s.cfg.HostRoutingPort,
+			EventWebhookURL:      webhook.RedactedURL(),
+			KubeEvents:           kubeEvents != nil,
+			AdminToken:           server.RedactSecret(s.cfg.AdminToken),
+		},
+		Ports: s.portManager,
+		Proxy: proxyHandler,
+	}
+	if targetMode == services.TargetModeNodePort {
+		s.config.Nodes = s.nodeIPDiscovery
+	}
+	serviceHandler := s.createServiceHandler(targetMode)
+	proxyHandler.SetServiceNames(services.ServiceNamesByPort(s.serverInfo.Services))
+	if managementPrefix != "" {
+		// The service port proxies too, with management moved under the prefix
+		slog.Info("Serving management under a path prefix, proxying the rest of the service port", "prefix", managementPrefix)
+		serviceHandler = server.ShareServicePort(managementPrefix, serviceHandler, proxyHandler)
+	}
 
-	// Start the configured service port for homepage
+	// SIGHUP re-discovers services and nodes, reusing the proxy handler
+	var reselector server.NodeReselector
+	if targetMode == services.TargetModeNodePort {
+		reselector = s.nodeIPDiscovery
+	}
+	s.reloader = server.NewReloader(s.portManager, s.nodeDiscovery, reselector, proxyHandler, s.servicePort, s.serverInfo.Services)
+	s.reloader.LimitListeners(s.cfg.MaxListeners)
+	if s.cfg.HostRoutingDomain != "" {
+		slog.Info("Routing services by Host on a single listener", "port", s.cfg.HostRoutingPort, "domain", s.cfg.HostRoutingDomain)
+		s.reloader.RouteHosts(s.cfg.HostRoutingPort, s.cfg.HostRoutingDomain)
+	}
+	if includeClusterIP && targetMode == services.TargetModeNodePort {
+		// ClusterIP services go straight to their pods instead of through the selected node
+		slog.Info("Routing ClusterIP services to their endpoints")
+		endpoints := services.NewEndpointRouter(s.nodeDiscovery.GetClientset())
+		endpoints.SetServices(s.serverInfo.Services)
+		proxyHandler.SetEndpointResolver(endpoints)
+		s.reloader.RouteEndpoints(endpoints)
+	}
+	if webhook != nil {
+		s.reloader.OnServicesChanged(webhook.ServicesChanged)
+	}
+	if kubeEvents != nil {
+		s.reloader.OnServicesChanged(kubeEvents.ServicesChanged)
+	}
+
+	// Start the configured service port for homepage. Kubelet probes reach it
+	// directly, not through a load balancer sending PROXY headers.
+	s.portManager.ServeWithoutProxyProtocol(s.servicePort)
 	if err := s.portManager.StartPort(s.servicePort, serviceHandler); err != nil {
 		slog.Error("Failed to start homepage service port", "port", s.servicePort, "error", err)
 	}
 
-	// Trigger initial node selection (with timeout to prevent hanging)
-	nodeCtx, nodeCancel := context.WithTimeout(ctx, 10*time.Second)
-	if _, err := s.nodeIPDiscovery.GetCurrentNodeIP(nodeCtx); err != nil {
-		slog.Warn("Failed to select initial node, will retry via health monitoring", "error", err)
-	} else {
-		slog.Info("Initial node selected", "node", s.nodeIPDiscovery.GetCurrentNodeName())
-	}
-	nodeCancel()
+	// Not ready until a node is selected and the proxy listeners are up
+	s.startup.Advance(server.PhaseDiscovering)
 
-	// Start health monitoring for node IP discovery
-	s.nodeIPDiscovery.StartHealthMonitoring()
-	slog.Info("Started node health monitoring")
+	if targetMode == services.TargetModeNodePort {
+		// Subscribe before the initial selection so its event is logged too
+		go server.LogNodeEvents(s.nodeIPDiscovery.Subscribe())
+		if webhook != nil {
+			go webhook.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		if kubeEvents != nil {
+			go kubeEvents.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		if s.events != nil {
+			go s.events.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		go proxyHandler.DrainOnFailover(s.nodeIPDiscovery.Subscribe())
+
+		// Trigger initial node selection (with timeout to prevent hanging)
+		nodeCtx, nodeCancel := context.WithTimeout(ctx, 10*time.Second)
+		if _, err := s.nodeIPDiscovery.GetCurrentNodeIP(nodeCtx); err != nil {
+			slog.Warn("Failed to select initial node, will retry via health monitoring", "error", err)
+		} else {
+			slog.Info("Initial node selected", "node", s.nodeIPDiscovery.GetCurrentNodeName())
+		}
+		nodeCancel()
+
+		// Start health monitoring for node IP discovery
+		s.nodeIPDiscovery.StartHealthMonitoring()
+		slog.Info("Started node health monitoring")
+	}
 
 	// Discover NodePorts once at startup
 	ports, err := s.nodeDiscovery.DiscoverNodePorts(ctx)
 	if err != nil {
 		return err
 	}
+	ports = s.reloader.ListenPorts(ports)
+	if targetMode == services.TargetModeNodePort {
+		s.nodeIPDiscovery.SetProbePorts(server.ValidPorts(services.NodePorts(s.serverInfo.Services)))
+	}
 
 	// Start proxy ports for discovered services
 	for _, port := range ports {
-		if err := s.portManager.StartPort(port, proxyHandler); err != nil {
+		if port == s.servicePort {
+			continue // Already started above
+		}
+		if err := s.portManager.StartPort(port, s.reloader.ProxyHandler(port)); err != nil {
 			slog.Error("Failed to start proxy port", "port", port, "error", err)
 		}
 	}
 
+	s.startup.Advance(server.PhaseReady)
+
 	// Set up graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	slog.Info("k8s-node-proxy server started successfully for EKS", "service_port", s.servicePort)
 
-	<-c
+	s.reloader.ReloadUntil(ctx, c)
 	slog.Info("Shutting down EKS server...")
 
 	// Stop health monitoring
@@ -133,7 +261,9 @@ func (s *EKSServer) Run() error {
 
 	// Stop all ports
 	slog.Info("Health monitoring stopped, stopping port listeners...")
-	s.portManager.StopAll()
+	if forced := s.portManager.StopAll(); forced > 0 {
+		slog.Warn("Closed connections still active after SHUTDOWN_TIMEOUT", "connections", forced)
+	}
 
 	slog.Info("EKS server shutdown complete")
 	return nil
@@ -156,17 +286,16 @@ func (s *EKSServer) collectServerInfo(ctx context.Context) error {
 		return fmt.Errorf("failed to get all nodes: %w", err)
 	}
 
-	// Extract node IPs
-	var nodeIPs []string
-	for _, node := range allNodes {
-		nodeIPs = append(nodeIPs, node.IP)
+	nodeIPs, err := s.nodeIPDiscovery.GetAllNodeIPs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get node IPs: %w", err)
 	}
 
 	s.serverInfo = &EKSServerInfo{
 		AWSRegion:   s.awsRegion,
 		ClusterName: clusterInfo.Name,
 		K8sEndpoint: clusterInfo.Endpoint,
-		Namespace:   os.Getenv("NAMESPACE"),
+		Namespace:   s.cfg.Discovery.Namespace,
 		NodeIPs:     nodeIPs,
 		Services:    srvcs,
 		AllNodes:    allNodes,
@@ -175,9 +304,32 @@ func (s *EKSServer) collectServerInfo(ctx context.Context) error {
 	return nil
 }
 
-func (s *EKSServer) createServiceHandler() http.Handler {
+func (s *EKSServer) createServiceHandler(targetMode services.TargetMode) http.Handler {
 	mux := http.NewServeMux()
 
+	health := server.Health{Startup: &s.startup}
+	readiness := server.Readiness{Ports: s.portManager, ServicePort: s.servicePort, Startup: &s.startup}
+	if targetMode == services.TargetModeNodePort {
+		health.Nodes = s.nodeIPDiscovery
+		readiness.Nodes = s.nodeIPDiscovery
+	}
+
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/livez", server.HandleLivez)
+	mux.Handle("/readyz", readiness)
+	if targetMode == services.TargetModeNodePort {
+		mux.Handle("/api/nodes", server.NodesAPI{Nodes: s.nodeIPDiscovery})
+		mux.Handle("/admin/failover", server.RequireAdminToken(s.cfg.AdminToken, server.FailoverAPI{Nodes: s.nodeIPDiscovery}))
+		mux.Handle("/admin/nodes", server.RequireAdminToken(s.cfg.AdminToken, server.NodesAPI{Nodes: s.nodeIPDiscovery}))
+		mux.Handle("/admin/select", server.RequireAdminToken(s.cfg.AdminToken, server.SelectAPI{Nodes: s.nodeIPDiscovery}))
+	}
+	mux.Handle("/admin/drain", server.RequireAdminToken(s.cfg.AdminToken, server.DrainAPI{Ports: s.portManager, ServicePort: s.servicePort}))
+	mux.Handle("/admin/config", server.RequireAdminToken(s.cfg.AdminToken, s.config))
+	mux.Handle("/status", server.StatusAPI{Data: s.homepageData})
+	if s.events != nil {
+		mux.Handle("/events", s.events)
+	}
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 		if path == "/" {
@@ -185,7 +337,7 @@ func (s *EKSServer) createServiceHandler() http.Handler {
 			return
 		}
 		if path == "/health" {
-			s.handleHealth(w, r)
+			health.ServeHTTP(w, r)
 			return
 		}
 
@@ -193,25 +345,48 @@ func (s *EKSServer) createServiceHandler() http.Handler {
 		http.Error(w, fmt.Sprintf("Not Found - This is the management interface on port %d", s.servicePort), http.StatusNotFound)
 	})
 
-	return mux
+	return server.RequireManagementAuth(s.cfg.AdminToken, mux)
 }
 
 func (s *EKSServer) handleHomepage(w http.ResponseWriter, r *http.Request) {
-	if s.serverInfo == nil {
-		http.Error(w, "Server info not yet collected", http.StatusServiceUnavailable)
-		return
-	}
-
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	allNodes, err := s.nodeIPDiscovery.GetAllNodes(ctx)
+	data, err := s.homepageData(ctx)
+	if errors.Is(err, server.ErrServerInfoNotCollected) {
+		http.Error(w, "Server info not yet collected", http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		slog.Error("Failed to get current node data for homepage", "error", err)
 		http.Error(w, "Failed to get current node data", http.StatusInternalServerError)
 		return
 	}
 
+	tmpl, err := template.New("homepage").Parse(server.HomepageTemplate)
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, &data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// homepageData gathers the data shared by the homepage and /status
+func (s *EKSServer) homepageData(ctx context.Context) (server.HomepageData, error) {
+	if s.serverInfo == nil {
+		return server.HomepageData{}, server.ErrServerInfoNotCollected
+	}
+
+	allNodes, err := s.nodeIPDiscovery.GetAllNodes(ctx)
+	if err != nil {
+		return server.HomepageData{}, err
+	}
+
 	currentNodeName := s.nodeIPDiscovery.GetCurrentNodeName()
 	currentNodeIP, _ := s.nodeIPDiscovery.GetCurrentNodeIP(ctx)
 
@@ -231,37 +406,18 @@ func (s *EKSServer) handleHomepage(w http.ResponseWriter, r *http.Request) {
 		{Key: "Target Namespace", Value: s.serverInfo.Namespace},
 	}
 
-	data := server.HomepageData{
+	return server.HomepageData{
 		PlatformName: "Amazon EKS",
 		ClusterInfo:  clusterInfo,
 		Namespace:    s.serverInfo.Namespace,
 		CurrentNode:  currentNodeInfo,
 		AllNodes:     allNodes,
-		Services:     s.serverInfo.Services,
-	}
-
-	tmpl, err := template.New("homepage").Parse(server.HomepageTemplate)
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/html")
-	if err := tmpl.Execute(w, &data); err != nil {
-		http.Error(w, "Template execution error", http.StatusInternalServerError)
-		return
-	}
-}
-
-func (s *EKSServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	currentNodeName := s.nodeIPDiscovery.GetCurrentNodeName()
-
-	response := fmt.Sprintf(`{
-		"proxy_server": "healthy",
-		"current_node_name": "%s"
-	}`, currentNodeName)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(response))
+		Services:     s.reloader.Services(),
+
+		HealthCheckInterval: s.nodeIPDiscovery.HealthCheckInterval(),
+		FailureThreshold:    s.nodeIPDiscovery.FailureThreshold(),
+		NodesStaleSince:     s.nodeIPDiscovery.NodeListStaleSince(),
+		LiveUpdates:         s.events != nil,
+		SkippedPorts:        s.reloader.SkippedPorts(),
+	}, nil
 }
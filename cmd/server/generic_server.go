@@ -2,97 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
+	"k8s-node-proxy/internal/config"
+	"k8s-node-proxy/internal/discovery"
+	"k8s-node-proxy/internal/metrics"
 	"k8s-node-proxy/internal/nodes"
 	"k8s-node-proxy/internal/proxy"
 	"k8s-node-proxy/internal/server"
 	"k8s-node-proxy/internal/services"
 )
 
-// PortListener manages a single port listener
-type PortListener struct {
-	port     int
-	server   *http.Server
-	shutdown chan struct{}
-	done     chan struct{}
-}
-
-// PortManager manages multiple port listeners
-type PortManager struct {
-	listeners map[int]*PortListener
-}
-
-// NewPortManager creates a new port manager
-func NewPortManager() *PortManager {
-	return &PortManager{
-		listeners: make(map[int]*PortListener),
-	}
-}
-
-// StartPort starts listening on the specified port with the given handler
-func (pm *PortManager) StartPort(port int, handler http.Handler) error {
-	if _, exists := pm.listeners[port]; exists {
-		return fmt.Errorf("port %d already listening", port)
-	}
-
-	listener := &PortListener{
-		port:     port,
-		server:   &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: handler},
-		shutdown: make(chan struct{}),
-		done:     make(chan struct{}),
-	}
-
-	go listener.start()
-	pm.listeners[port] = listener
-	slog.Info("Started listening on port", "port", port)
-	return nil
-}
-
-// StopAll stops all port listeners
-func (pm *PortManager) StopAll() {
-	var wg sync.WaitGroup
-	for port, listener := range pm.listeners {
-		wg.Add(1)
-		go func(p int, l *PortListener) {
-			defer wg.Done()
-			close(l.shutdown)
-			<-l.done
-			slog.Info("Stopped listening on port", "port", p)
-		}(port, listener)
-	}
-	wg.Wait()
-	pm.listeners = make(map[int]*PortListener)
-}
-
-// start starts the port listener
-func (l *PortListener) start() {
-	defer close(l.done)
-
-	go func() {
-		if err := l.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			slog.Error("Port server error", "port", l.port, "error", err)
-		}
-	}()
-
-	<-l.shutdown
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := l.server.Shutdown(ctx); err != nil {
-		slog.Error("Port forced shutdown", "port", l.port, "error", err)
-	}
-}
-
 // ServerInfo contains information about the server and cluster
 type ServerInfo struct {
 	ProjectID       string
@@ -109,20 +37,27 @@ type ServerInfo struct {
 // GenericServer is a server implementation for generic Kubernetes clusters
 type GenericServer struct {
 	servicePort     int
-	portManager     *PortManager
-	nodeDiscovery   *services.GenericNodePortDiscovery
-	nodeIPDiscovery *nodes.GenericNodeDiscovery
+	portManager     *server.PortManager
+	nodeDiscovery   discovery.ServiceDiscoverer
+	nodeIPDiscovery discovery.NodeDiscoverer
 	serverInfo      *ServerInfo
+	reloader        *server.Reloader
+	startup         server.StartupState
+	events          *server.EventStream
+	config          server.ConfigAPI
+	cfg             *config.Config
 }
 
 // NewGenericServer creates a new generic server
-func NewGenericServer(servicePort int) (*GenericServer, error) {
+func NewGenericServer(cfg *config.Config) (*GenericServer, error) {
+	servicePort := cfg.ServicePort
 	slog.Info("Initializing k8s-node-proxy server for generic Kubernetes", "service_port", servicePort)
 
-	nodePortDiscovery, err := services.NewGenericNodePortDiscovery()
+	nodePortDiscovery, err := services.NewGenericNodePortDiscoveryWithCredentials(cfg.Kubernetes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create generic service discovery: %w", err)
 	}
+	nodePortDiscovery.SetDiscoveryOptions(cfg.Discovery)
 
 	// Get the clientset from the service discovery to pass to node discovery
 	// We need to access the private field, so we'll create the node discovery with the same clientset
@@ -131,71 +66,189 @@ func NewGenericServer(servicePort int) (*GenericServer, error) {
 		return nil, fmt.Errorf("failed to create generic node discovery: %w", err)
 	}
 
-	server := &GenericServer{
-		servicePort:     servicePort,
-		nodeDiscovery:   nodePortDiscovery,
+	server := newGenericServer(cfg, nodePortDiscovery, nodeIPDiscovery)
+	slog.Info("Generic server initialization completed successfully")
+	return server, nil
+}
+
+// newGenericServer creates a server running on the given service and node discoveries
+func newGenericServer(cfg *config.Config, nodeDiscovery discovery.ServiceDiscoverer, nodeIPDiscovery discovery.NodeDiscoverer) *GenericServer {
+	return &GenericServer{
+		servicePort:     cfg.ServicePort,
+		cfg:             cfg,
+		portManager:     server.NewPortManager(cfg.Listeners),
+		nodeDiscovery:   nodeDiscovery,
 		nodeIPDiscovery: nodeIPDiscovery,
 		serverInfo:      nil, // Will be populated during Run()
 	}
-
-	// Create port manager
-	portManager := NewPortManager()
-	server.portManager = portManager
-
-	slog.Info("Generic server initialization completed successfully")
-	return server, nil
 }
 
 func (s *GenericServer) Run() error {
 	ctx := context.Background()
 
+	targetMode := s.cfg.Discovery.TargetMode
+	includeClusterIP := s.cfg.Discovery.IncludeClusterIP
+	managementPrefix := s.cfg.ManagementPathPrefix
+	var webhook *server.EventWebhook
+	if s.cfg.EventWebhookURL != "" {
+		webhook = server.NewEventWebhook(s.cfg.EventWebhookURL, s.cfg.EventWebhookTimeout)
+		defer webhook.Close()
+	}
+	var kubeEvents *server.KubeEvents
+	if s.cfg.KubeEvents {
+		kubeEvents = server.NewKubeEvents(s.nodeDiscovery.GetClientset(), s.cfg.PodNamespace, s.cfg.PodName, s.cfg.PodUID)
+		defer kubeEvents.Close()
+	}
+
 	// Collect server info
 	if err := s.collectServerInfo(ctx); err != nil {
 		return fmt.Errorf("failed to collect server info: %w", err)
 	}
 
+	if s.cfg.DryRun {
+		// Report what would be proxied, then exit without listening or monitoring
+		var selector server.InitialNodeSelector
+		if targetMode == services.TargetModeNodePort {
+			selector = s.nodeIPDiscovery
+		}
+		_, err := server.PlanDryRun(ctx, s.nodeDiscovery, selector, s.serverInfo.Services, targetMode, s.servicePort)
+		return err
+	}
+
 	// Create handlers
-	serviceHandler := s.createServiceHandler()
-	proxyHandler := proxy.NewHandler(s.nodeIPDiscovery)
+	if s.cfg.LiveUpdates {
+		s.events = server.NewEventStream(s.homepageData)
+	}
+	proxyHandler := proxy.NewHandler(s.nodeIPDiscovery, s.cfg.Proxy)
+	if targetMode == services.TargetModeClusterIP {
+		// Forward straight to ClusterIP:port - node selection is not used
+		slog.Info("Running in ClusterIP target mode, node selection disabled")
+		proxyHandler = proxy.NewClusterIPHandler(services.ClusterIPTargets(s.serverInfo.Services), s.cfg.Proxy)
+	}
+	s.config = server.ConfigAPI{
+		Config: server.Config{
+			Platform:             "generic",
+			Cluster:              s.serverInfo.ClusterName,
+			Namespace:            s.serverInfo.Namespace,
+			TargetMode:           targetMode,
+			IncludeClusterIP:     includeClusterIP,
+			ServicePort:          s.servicePort,
+			ManagementPathPrefix: managementPrefix,
+			LiveUpdates:          s.cfg.LiveUpdates,
+			MaxListeners:         s.cfg.MaxListeners,
+			HostRoutingDomain:    s.cfg.HostRoutingDomain,
+			HostRoutingPort:      s.cfg.HostRoutingPort,
+			EventWebhookURL:      webhook.RedactedURL(),
+			KubeEvents:           kubeEvents != nil,
+			AdminToken:           server.RedactSecret(s.cfg.AdminToken),
+		},
+		Ports: s.portManager,
+		Proxy: proxyHandler,
+	}
+	if targetMode == services.TargetModeNodePort {
+		s.config.Nodes = s.nodeIPDiscovery
+	}
+	serviceHandler := s.createServiceHandler(targetMode)
+	proxyHandler.SetServiceNames(services.ServiceNamesByPort(s.serverInfo.Services))
+	if managementPrefix != "" {
+		// The service port proxies too, with management moved under the prefix
+		slog.Info("Serving management under a path prefix, proxying the rest of the service port", "prefix", managementPrefix)
+		serviceHandler = server.ShareServicePort(managementPrefix, serviceHandler, proxyHandler)
+	}
 
-	// Start the configured service port for homepage
+	// SIGHUP re-discovers services and nodes, reusing the proxy handler
+	var reselector server.NodeReselector
+	if targetMode == services.TargetModeNodePort {
+		reselector = s.nodeIPDiscovery
+	}
+	s.reloader = server.NewReloader(s.portManager, s.nodeDiscovery, reselector, proxyHandler, s.servicePort, s.serverInfo.Services)
+	s.reloader.LimitListeners(s.cfg.MaxListeners)
+	if s.cfg.HostRoutingDomain != "" {
+		slog.Info("Routing services by Host on a single listener", "port", s.cfg.HostRoutingPort, "domain", s.cfg.HostRoutingDomain)
+		s.reloader.RouteHosts(s.cfg.HostRoutingPort, s.cfg.HostRoutingDomain)
+	}
+	if includeClusterIP && targetMode == services.TargetModeNodePort {
+		// ClusterIP services go straight to their pods instead of through the selected node
+		slog.Info("Routing ClusterIP services to their endpoints")
+		endpoints := services.NewEndpointRouter(s.nodeDiscovery.GetClientset())
+		endpoints.SetServices(s.serverInfo.Services)
+		proxyHandler.SetEndpointResolver(endpoints)
+		s.reloader.RouteEndpoints(endpoints)
+	}
+	if webhook != nil {
+		s.reloader.OnServicesChanged(webhook.ServicesChanged)
+	}
+	if kubeEvents != nil {
+		s.reloader.OnServicesChanged(kubeEvents.ServicesChanged)
+	}
+
+	// Start the configured service port for homepage. Kubelet probes reach it
+	// directly, not through a load balancer sending PROXY headers.
+	s.portManager.ServeWithoutProxyProtocol(s.servicePort)
 	if err := s.portManager.StartPort(s.servicePort, serviceHandler); err != nil {
 		slog.Error("Failed to start homepage service port", "port", s.servicePort, "error", err)
 	}
 
-	// Trigger initial node selection (with timeout to prevent hanging)
-	nodeCtx, nodeCancel := context.WithTimeout(ctx, 10*time.Second)
-	if _, err := s.nodeIPDiscovery.GetCurrentNodeIP(nodeCtx); err != nil {
-		slog.Warn("Failed to select initial node, will retry via health monitoring", "error", err)
-	} else {
-		slog.Info("Initial node selected", "node", s.nodeIPDiscovery.GetCurrentNodeName())
-	}
-	nodeCancel()
+	// Not ready until a node is selected and the proxy listeners are up
+	s.startup.Advance(server.PhaseDiscovering)
 
-	// Start health monitoring for node IP discovery
-	s.nodeIPDiscovery.StartHealthMonitoring()
-	slog.Info("Started node health monitoring")
+	if targetMode == services.TargetModeNodePort {
+		// Subscribe before the initial selection so its event is logged too
+		go server.LogNodeEvents(s.nodeIPDiscovery.Subscribe())
+		if webhook != nil {
+			go webhook.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		if kubeEvents != nil {
+			go kubeEvents.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		if s.events != nil {
+			go s.events.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		go proxyHandler.DrainOnFailover(s.nodeIPDiscovery.Subscribe())
+
+		// Trigger initial node selection (with timeout to prevent hanging)
+		nodeCtx, nodeCancel := context.WithTimeout(ctx, 10*time.Second)
+		if _, err := s.nodeIPDiscovery.GetCurrentNodeIP(nodeCtx); err != nil {
+			slog.Warn("Failed to select initial node, will retry via health monitoring", "error", err)
+		} else {
+			slog.Info("Initial node selected", "node", s.nodeIPDiscovery.GetCurrentNodeName())
+		}
+		nodeCancel()
+
+		// Start health monitoring for node IP discovery
+		s.nodeIPDiscovery.StartHealthMonitoring()
+		slog.Info("Started node health monitoring")
+	}
 
 	// Discover NodePorts once at startup
 	ports, err := s.nodeDiscovery.DiscoverNodePorts(ctx)
 	if err != nil {
 		return err
 	}
+	ports = s.reloader.ListenPorts(ports)
+	if targetMode == services.TargetModeNodePort {
+		s.nodeIPDiscovery.SetProbePorts(server.ValidPorts(services.NodePorts(s.serverInfo.Services)))
+	}
 
 	// Start proxy ports for discovered services
 	for _, port := range ports {
-		if err := s.portManager.StartPort(port, proxyHandler); err != nil {
+		if port == s.servicePort {
+			continue // Already started above
+		}
+		if err := s.portManager.StartPort(port, s.reloader.ProxyHandler(port)); err != nil {
 			slog.Error("Failed to start proxy port", "port", port, "error", err)
 		}
 	}
 
+	s.startup.Advance(server.PhaseReady)
+
 	// Set up graceful shutdown
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	slog.Info("k8s-node-proxy server started successfully", "service_port", s.servicePort)
 
-	<-c
+	s.reloader.ReloadUntil(ctx, c)
 	slog.Info("Shutting down Generic server...")
 
 	// Stop health monitoring
@@ -204,7 +257,9 @@ func (s *GenericServer) Run() error {
 
 	// Stop all ports
 	slog.Info("Health monitoring stopped, stopping port listeners...")
-	s.portManager.StopAll()
+	if forced := s.portManager.StopAll(); forced > 0 {
+		slog.Warn("Closed connections still active after SHUTDOWN_TIMEOUT", "connections", forced)
+	}
 
 	slog.Info("Generic server shutdown complete")
 	return nil
@@ -227,10 +282,9 @@ func (s *GenericServer) collectServerInfo(ctx context.Context) error {
 		return fmt.Errorf("failed to get all nodes: %w", err)
 	}
 
-	// Extract node IPs
-	var nodeIPs []string
-	for _, node := range allNodes {
-		nodeIPs = append(nodeIPs, node.IP)
+	nodeIPs, err := s.nodeIPDiscovery.GetAllNodeIPs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get node IPs: %w", err)
 	}
 
 	s.serverInfo = &ServerInfo{
@@ -238,7 +292,7 @@ func (s *GenericServer) collectServerInfo(ctx context.Context) error {
 		ClusterName:     clusterInfo.Name,
 		ClusterLocation: clusterInfo.Location,
 		K8sEndpoint:     clusterInfo.Endpoint,
-		Namespace:       os.Getenv("NAMESPACE"),
+		Namespace:       s.cfg.Discovery.Namespace,
 		NodeIPs:         nodeIPs,
 		Services:        services,
 		AllNodes:        allNodes,
@@ -247,9 +301,32 @@ func (s *GenericServer) collectServerInfo(ctx context.Context) error {
 	return nil
 }
 
-func (s *GenericServer) createServiceHandler() http.Handler {
+func (s *GenericServer) createServiceHandler(targetMode services.TargetMode) http.Handler {
 	mux := http.NewServeMux()
 
+	health := server.Health{Startup: &s.startup}
+	readiness := server.Readiness{Ports: s.portManager, ServicePort: s.servicePort, Startup: &s.startup}
+	if targetMode == services.TargetModeNodePort {
+		health.Nodes = s.nodeIPDiscovery
+		readiness.Nodes = s.nodeIPDiscovery
+	}
+
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/livez", server.HandleLivez)
+	mux.Handle("/readyz", readiness)
+	if targetMode == services.TargetModeNodePort {
+		mux.Handle("/api/nodes", server.NodesAPI{Nodes: s.nodeIPDiscovery})
+		mux.Handle("/admin/failover", server.RequireAdminToken(s.cfg.AdminToken, server.FailoverAPI{Nodes: s.nodeIPDiscovery}))
+		mux.Handle("/admin/nodes", server.RequireAdminToken(s.cfg.AdminToken, server.NodesAPI{Nodes: s.nodeIPDiscovery}))
+		mux.Handle("/admin/select", server.RequireAdminToken(s.cfg.AdminToken, server.SelectAPI{Nodes: s.nodeIPDiscovery}))
+	}
+	mux.Handle("/admin/drain", server.RequireAdminToken(s.cfg.AdminToken, server.DrainAPI{Ports: s.portManager, ServicePort: s.servicePort}))
+	mux.Handle("/admin/config", server.RequireAdminToken(s.cfg.AdminToken, s.config))
+	mux.Handle("/status", server.StatusAPI{Data: s.homepageData})
+	if s.events != nil {
+		mux.Handle("/events", s.events)
+	}
+
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
 		if path == "/" {
@@ -257,7 +334,7 @@ func (s *GenericServer) createServiceHandler() http.Handler {
 			return
 		}
 		if path == "/health" {
-			s.handleHealth(w, r)
+			health.ServeHTTP(w, r)
 			return
 		}
 
@@ -265,17 +342,37 @@ func (s *GenericServer) createServiceHandler() http.Handler {
 		http.Error(w, fmt.Sprintf("Not Found - This is the management interface on port %d", s.servicePort), http.StatusNotFound)
 	})
 
-	return mux
+	return server.RequireManagementAuth(s.cfg.AdminToken, mux)
 }
 
 func (s *GenericServer) handleHomepage(w http.ResponseWriter, r *http.Request) {
-	if s.serverInfo == nil {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	data, err := s.homepageData(ctx)
+	if errors.Is(err, server.ErrServerInfoNotCollected) {
 		http.Error(w, "Server info not yet collected", http.StatusServiceUnavailable)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	tmpl, err := template.New("homepage").Parse(server.HomepageTemplate)
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, &data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// homepageData gathers the data shared by the homepage and /status
+func (s *GenericServer) homepageData(ctx context.Context) (server.HomepageData, error) {
+	if s.serverInfo == nil {
+		return server.HomepageData{}, server.ErrServerInfoNotCollected
+	}
 
 	allNodes, err := s.nodeIPDiscovery.GetAllNodes(ctx)
 	if err != nil {
@@ -304,37 +401,18 @@ func (s *GenericServer) handleHomepage(w http.ResponseWriter, r *http.Request) {
 		{Key: "Target Namespace", Value: s.serverInfo.Namespace},
 	}
 
-	data := server.HomepageData{
+	return server.HomepageData{
 		PlatformName: "Generic Kubernetes",
 		ClusterInfo:  clusterInfo,
 		Namespace:    s.serverInfo.Namespace,
 		CurrentNode:  currentNodeInfo,
 		AllNodes:     allNodes,
-		Services:     s.serverInfo.Services,
-	}
-
-	tmpl, err := template.New("homepage").Parse(server.HomepageTemplate)
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/html")
-	if err := tmpl.Execute(w, &data); err != nil {
-		http.Error(w, "Template execution error", http.StatusInternalServerError)
-		return
-	}
-}
-
-func (s *GenericServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	currentNodeName := s.nodeIPDiscovery.GetCurrentNodeName()
-
-	response := fmt.Sprintf(`{
-		"proxy_server": "healthy",
-		"current_node_name": "%s"
-	}`, currentNodeName)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(response))
+		Services:     s.reloader.Services(),
+
+		HealthCheckInterval: s.nodeIPDiscovery.HealthCheckInterval(),
+		FailureThreshold:    s.nodeIPDiscovery.FailureThreshold(),
+		NodesStaleSince:     s.nodeIPDiscovery.NodeListStaleSince(),
+		LiveUpdates:         s.events != nil,
+		SkippedPorts:        s.reloader.SkippedPorts(),
+	}, nil
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s-node-proxy/internal/config"
+	"k8s-node-proxy/internal/discovery"
+	"k8s-node-proxy/internal/services"
+)
+
+// fakeServiceDiscoverer serves a fixed set of services
+type fakeServiceDiscoverer struct {
+	services []discovery.ServiceInfo
+}
+
+func (f *fakeServiceDiscoverer) DiscoverNodePorts(context.Context) ([]int, error) {
+	return services.NodePorts(f.services), nil
+}
+
+func (f *fakeServiceDiscoverer) DiscoverServices(context.Context) ([]discovery.ServiceInfo, error) {
+	return f.services, nil
+}
+
+func (f *fakeServiceDiscoverer) GetClusterInfo() *discovery.ClusterInfo {
+	return &discovery.ClusterInfo{Name: "test"}
+}
+
+func (f *fakeServiceDiscoverer) GetClientset() kubernetes.Interface {
+	return fake.NewClientset()
+}
+
+// fakeNodeDiscoverer selects one fixed node. The methods a dry run must not
+// reach are left to the embedded nil interface and panic if called.
+type fakeNodeDiscoverer struct {
+	discovery.NodeDiscoverer
+	name, ip string
+
+	selected bool
+}
+
+func (f *fakeNodeDiscoverer) GetCurrentNodeIP(context.Context) (string, error) {
+	f.selected = true
+	return f.ip, nil
+}
+
+func (f *fakeNodeDiscoverer) GetCurrentNodeName() string {
+	if !f.selected {
+		return ""
+	}
+	return f.name
+}
+
+func (f *fakeNodeDiscoverer) GetAllNodes(context.Context) ([]discovery.NodeInfo, error) {
+	return []discovery.NodeInfo{{Name: f.name, IP: f.ip, Status: discovery.NodeHealthy}}, nil
+}
+
+func (f *fakeNodeDiscoverer) GetAllNodeIPs(context.Context) ([]string, error) {
+	return []string{f.ip}, nil
+}
+
+func TestGenericServerRun_DryRun(t *testing.T) {
+	cfg := &config.Config{
+		ServicePort: 8101,
+		DryRun:      true,
+		Discovery:   services.DiscoveryOptions{Namespace: "default", TargetMode: services.TargetModeNodePort},
+	}
+	nodeIPDiscovery := &fakeNodeDiscoverer{name: "node-1", ip: "10.0.1.1"}
+	s := newGenericServer(cfg, &fakeServiceDiscoverer{services: []discovery.ServiceInfo{
+		{Name: "web", Namespace: "default", Port: 80, NodePort: 30080, Protocol: "TCP"},
+	}}, nodeIPDiscovery)
+	defer s.portManager.StopAll()
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Expected the dry run to succeed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Dry run did not return")
+	}
+
+	if ports := s.portManager.GetListeningPorts(); len(ports) != 0 {
+		t.Errorf("Expected no listeners in a dry run, got %v", ports)
+	}
+	if s.nodeIPDiscovery.GetCurrentNodeName() != "node-1" {
+		t.Errorf("Expected the dry run to select node-1, got %q", s.nodeIPDiscovery.GetCurrentNodeName())
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// newLogger builds the logger every package logs through: text records by
+// default or JSON with LOG_FORMAT=json, filtered by LOG_LEVEL (debug, info,
+// warn or error; default info)
+func newLogger(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, fmt.Errorf("invalid LOG_LEVEL value %q: %w", value, err)
+		}
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	switch format := os.Getenv("LOG_FORMAT"); format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("invalid LOG_FORMAT value %q: must be text or json", format)
+	}
+}
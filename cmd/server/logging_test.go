@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		t.Setenv("LOG_FORMAT", "json")
+		t.Setenv("LOG_LEVEL", "warn")
+		var buf bytes.Buffer
+		logger, err := newLogger(&buf)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		logger.Info("Filtered out")
+		logger.Warn("Kept", "port", 30080)
+
+		var record map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatalf("Expected a single JSON record, got %q: %v", buf.String(), err)
+		}
+		if record["msg"] != "Kept" || record["port"] != float64(30080) {
+			t.Errorf("Unexpected record: %v", record)
+		}
+	})
+
+	t.Run("TextByDefault", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, err := newLogger(&buf)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		logger.Info("Started")
+		if !strings.Contains(buf.String(), "msg=Started") {
+			t.Errorf("Expected a text record, got %q", buf.String())
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for key, value := range map[string]string{"LOG_FORMAT": "xml", "LOG_LEVEL": "verbose"} {
+			t.Run(key, func(t *testing.T) {
+				t.Setenv(key, value)
+				if _, err := newLogger(&bytes.Buffer{}); err == nil {
+					t.Errorf("Expected error for %s=%q", key, value)
+				}
+			})
+		}
+	})
+}
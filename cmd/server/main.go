@@ -1,127 +1,99 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"os"
-	"strconv"
 
+	"k8s-node-proxy/internal/config"
 	"k8s-node-proxy/internal/platform"
 	"k8s-node-proxy/internal/server"
 )
 
 func main() {
-	// Detect cloud platform (Phase 1: environment variable-based detection)
-	detectedPlatform, err := platform.DetectPlatform()
+	// Every package, and the standard log package, writes through this logger
+	logger, err := newLogger(os.Stderr)
 	if err != nil {
-		log.Fatalf("Platform detection failed: %v", err)
+		log.Fatalf("Logging setup failed: %v", err)
 	}
+	slog.SetDefault(logger)
 
-	log.Printf("Detected platform: %s", detectedPlatform)
+	// Read and validate the configuration before connecting to any cluster
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+
+	slog.Info("Detected platform", "platform", cfg.Platform)
+
+	shutdownTracing, err := initTracing(context.Background())
+	if err != nil {
+		fatal("Tracing setup failed", "error", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
 
 	// Route to appropriate platform-specific logic
-	switch detectedPlatform {
+	switch cfg.Platform {
 	case platform.GCP:
-		runGKEMode()
+		runGKEMode(cfg)
 	case platform.AWS:
-		runEKSMode()
+		runEKSMode(cfg)
 	case platform.Generic:
-		runGenericMode()
+		runGenericMode(cfg)
 	default:
-		log.Fatalf("Unsupported platform: %s", detectedPlatform)
+		fatal("Unsupported platform", "platform", cfg.Platform)
 	}
 }
 
 // runGKEMode runs the proxy in GKE mode (existing functionality, unchanged)
-func runGKEMode() {
-	projectID := os.Getenv("PROJECT_ID")
-	if projectID == "" {
-		projectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
-	}
-	if projectID == "" {
-		log.Fatal("PROJECT_ID or GOOGLE_CLOUD_PROJECT environment variable must be set")
-	}
-
-	// Get proxy service port from environment, default to 80
-	proxyServicePort := 80
-	if portStr := os.Getenv("PROXY_SERVICE_PORT"); portStr != "" {
-		if port, err := strconv.Atoi(portStr); err != nil {
-			log.Fatalf("Invalid PROXY_SERVICE_PORT value '%s': %v", portStr, err)
-		} else {
-			proxyServicePort = port
-		}
-	}
-
-	log.Printf("Starting k8s-node-proxy for GKE project: %s, service port: %d", projectID, proxyServicePort)
+func runGKEMode(cfg *config.Config) {
+	slog.Info("Starting k8s-node-proxy for GKE", "project", cfg.ProjectID, "service_port", cfg.ServicePort)
 
-	srv, err := server.New(projectID, proxyServicePort)
+	srv, err := server.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		fatal("Failed to create server", "error", err)
 	}
 
 	if err := srv.Run(); err != nil {
-		log.Fatalf("Server error: %v", err)
+		fatal("Server error", "error", err)
 	}
 }
 
 // runGenericMode runs the proxy in Generic Kubernetes mode
-func runGenericMode() {
-	log.Printf("Generic Kubernetes platform detected!")
-
-	// Get proxy service port from environment, default to 80
-	proxyServicePort := 80
-	if portStr := os.Getenv("PROXY_SERVICE_PORT"); portStr != "" {
-		if port, err := strconv.Atoi(portStr); err != nil {
-			log.Fatalf("Invalid PROXY_SERVICE_PORT value '%s': %v", portStr, err)
-		} else {
-			proxyServicePort = port
-		}
-	}
+func runGenericMode(cfg *config.Config) {
+	slog.Info("Starting k8s-node-proxy for Generic Kubernetes", "service_port", cfg.ServicePort)
 
-	log.Printf("Starting k8s-node-proxy for Generic Kubernetes, service port: %d", proxyServicePort)
-
-	srv, err := NewGenericServer(proxyServicePort)
+	srv, err := NewGenericServer(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create generic server: %v", err)
+		fatal("Failed to create generic server", "error", err)
 	}
 
 	if err := srv.Run(); err != nil {
-		log.Fatalf("Server error: %v", err)
+		fatal("Server error", "error", err)
 	}
 }
 
 // runEKSMode runs the proxy in EKS mode
-func runEKSMode() {
-	log.Printf("AWS EKS platform detected!")
-
-	// Get required AWS environment variables
-	awsRegion := os.Getenv("AWS_REGION")
-	if awsRegion == "" {
-		log.Fatal("AWS_REGION environment variable must be set for EKS mode")
-	}
-
-	clusterName := os.Getenv("CLUSTER_NAME")
-	if clusterName == "" {
-		log.Fatal("CLUSTER_NAME environment variable must be set for EKS mode")
-	}
+func runEKSMode(cfg *config.Config) {
+	slog.Info("Starting k8s-node-proxy for EKS", "cluster", cfg.ClusterName, "region", cfg.AWSRegion, "service_port", cfg.ServicePort)
 
-	// Get proxy service port from environment, default to 80
-	proxyServicePort := 80
-	if portStr := os.Getenv("PROXY_SERVICE_PORT"); portStr != "" {
-		if port, err := strconv.Atoi(portStr); err != nil {
-			log.Fatalf("Invalid PROXY_SERVICE_PORT value '%s': %v", portStr, err)
-		} else {
-			proxyServicePort = port
-		}
-	}
-
-	log.Printf("Starting k8s-node-proxy for EKS cluster: %s in region: %s, service port: %d", clusterName, awsRegion, proxyServicePort)
-
-	srv, err := NewEKSServer(awsRegion, clusterName, proxyServicePort)
+	srv, err := NewEKSServer(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create EKS server: %v", err)
+		fatal("Failed to create EKS server", "error", err)
 	}
 
 	if err := srv.Run(); err != nil {
-		log.Fatalf("Server error: %v", err)
+		fatal("Server error", "error", err)
 	}
 }
+
+// fatal logs msg at error level, so LOG_LEVEL can't hide it, and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
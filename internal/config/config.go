@@ -0,0 +1,300 @@
+// Package config reads the proxy's process-wide settings from the environment
+// once at startup, applying defaults and validating them in one place.
+// Node selection settings stay with the node discovery; the proxy handlers'
+// settings are parsed by package proxy and carried here, so an invalid value
+// stops startup instead of quietly turning a feature off.
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s-node-proxy/internal/platform"
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+const (
+	defaultServicePort     = 80
+	defaultWebhookTimeout  = 5 * time.Second
+	defaultHostRoutingPort = 8080
+)
+
+// Config holds the settings the servers and discoveries are built from
+type Config struct {
+	// Platform is detected from the environment unless PLATFORM overrides it
+	Platform platform.Platform
+
+	// ServicePort serves the management interface (PROXY_SERVICE_PORT)
+	ServicePort int
+
+	// ProjectID is the GCP project (PROJECT_ID or GOOGLE_CLOUD_PROJECT)
+	ProjectID string
+
+	// AWSRegion and ClusterName locate an EKS cluster (AWS_REGION, CLUSTER_NAME)
+	AWSRegion   string
+	ClusterName string
+
+	// Kubernetes reaches a generic cluster (KUBECONFIG, K8S_*)
+	Kubernetes services.GenericCredentials
+
+	// Discovery selects the proxied services (NAMESPACE, TARGET_MODE, INCLUDE_CLUSTERIP)
+	Discovery services.DiscoveryOptions
+
+	// Listeners configure the sockets the proxy ports are served on
+	Listeners Listeners
+
+	// Proxy configures how requests are forwarded to the backends (timeouts,
+	// limits, TRUSTED_PROXIES, ...)
+	Proxy proxy.Settings
+
+	// DryRun logs what would be proxied and exits (DRY_RUN)
+	DryRun bool
+
+	// ManagementPathPrefix moves management under a path so the service port
+	// proxies too (MANAGEMENT_PATH_PREFIX); empty dedicates the port
+	ManagementPathPrefix string
+
+	// LiveUpdates serves /events for the homepage (HOMEPAGE_LIVE_UPDATES)
+	LiveUpdates bool
+
+	// MaxListeners caps the proxy listeners, not counting the service port
+	// (MAX_LISTENERS); 0 is no limit
+	MaxListeners int
+
+	// HostRoutingDomain serves every service on the single HostRoutingPort,
+	// routed by Host: <service>.<domain> (HOST_ROUTING_DOMAIN, HOST_ROUTING_PORT,
+	// default 8080). Empty keeps a listener per port.
+	HostRoutingDomain string
+	HostRoutingPort   int
+
+	// AdminToken enables the /admin endpoints and protects the rest of the
+	// management port (ADMIN_TOKEN)
+	AdminToken string
+
+	// EventWebhookURL receives node and service events (EVENT_WEBHOOK_URL);
+	// empty disables the webhook
+	EventWebhookURL     string
+	EventWebhookTimeout time.Duration
+
+	// KubeEvents records node and service events as Kubernetes Events on the
+	// proxy's pod (EMIT_K8S_EVENTS). The pod is named by POD_NAME (default the
+	// hostname), POD_NAMESPACE (default NAMESPACE) and POD_UID.
+	KubeEvents   bool
+	PodName      string
+	PodNamespace string
+	PodUID       string
+}
+
+// Load reads and validates the configuration. The first invalid or missing
+// setting is returned as an error naming its variable.
+func Load() (*Config, error) {
+	cfg := &Config{
+		ProjectID:   os.Getenv("PROJECT_ID"),
+		AWSRegion:   os.Getenv("AWS_REGION"),
+		ClusterName: os.Getenv("CLUSTER_NAME"),
+		Kubernetes:  services.GenericCredentialsFromEnv(),
+		AdminToken:  os.Getenv("ADMIN_TOKEN"),
+	}
+	if cfg.ProjectID == "" {
+		cfg.ProjectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+
+	var err error
+	if cfg.Platform, err = platform.DetectPlatform(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validatePlatform(); err != nil {
+		return nil, err
+	}
+
+	cfg.ServicePort = defaultServicePort
+	if value := os.Getenv("PROXY_SERVICE_PORT"); value != "" {
+		if cfg.ServicePort, err = ParsePort("PROXY_SERVICE_PORT", value); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Discovery, err = services.DiscoveryOptionsFromEnv(); err != nil {
+		return nil, err
+	}
+	if cfg.Discovery.Namespace == "" {
+		return nil, fmt.Errorf("NAMESPACE environment variable is required")
+	}
+
+	if cfg.Listeners, err = ListenersFromEnv(); err != nil {
+		return nil, err
+	}
+	if cfg.Proxy, err = proxy.SettingsFromEnv(); err != nil {
+		return nil, err
+	}
+
+	if cfg.DryRun, err = envBool("DRY_RUN", false); err != nil {
+		return nil, err
+	}
+	if cfg.LiveUpdates, err = envBool("HOMEPAGE_LIVE_UPDATES", true); err != nil {
+		return nil, err
+	}
+	if value := os.Getenv("MAX_LISTENERS"); value != "" {
+		if cfg.MaxListeners, err = strconv.Atoi(value); err != nil || cfg.MaxListeners < 0 {
+			return nil, fmt.Errorf("invalid MAX_LISTENERS value %q: must be a non-negative integer", value)
+		}
+	}
+	if err := cfg.loadHostRouting(); err != nil {
+		return nil, err
+	}
+	if cfg.ManagementPathPrefix, err = managementPathPrefix(os.Getenv("MANAGEMENT_PATH_PREFIX")); err != nil {
+		return nil, err
+	}
+	if err := cfg.loadEventWebhook(); err != nil {
+		return nil, err
+	}
+	if err := cfg.loadKubeEvents(); err != nil {
+		return nil, err
+	}
+	if err := checkForwardedFor(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validatePlatform checks the settings the detected platform can't run without
+func (c *Config) validatePlatform() error {
+	switch c.Platform {
+	case platform.GCP:
+		if c.ProjectID == "" {
+			return fmt.Errorf("PROJECT_ID or GOOGLE_CLOUD_PROJECT environment variable must be set")
+		}
+	case platform.AWS:
+		if c.AWSRegion == "" {
+			return fmt.Errorf("AWS_REGION environment variable must be set for EKS mode")
+		}
+		if c.ClusterName == "" {
+			return fmt.Errorf("CLUSTER_NAME environment variable must be set for EKS mode")
+		}
+	}
+	return nil
+}
+
+// loadHostRouting reads HOST_ROUTING_DOMAIN and HOST_ROUTING_PORT (default 8080).
+// The domain is matched case-insensitively, so it is kept in lower case.
+func (c *Config) loadHostRouting() error {
+	c.HostRoutingDomain = strings.ToLower(strings.Trim(os.Getenv("HOST_ROUTING_DOMAIN"), "."))
+	if c.HostRoutingDomain == "" {
+		return nil
+	}
+	c.HostRoutingPort = defaultHostRoutingPort
+	if value := os.Getenv("HOST_ROUTING_PORT"); value != "" {
+		var err error
+		if c.HostRoutingPort, err = ParsePort("HOST_ROUTING_PORT", value); err != nil {
+			return err
+		}
+	}
+	if c.HostRoutingPort == c.ServicePort {
+		return fmt.Errorf("invalid HOST_ROUTING_PORT value %d: the service port PROXY_SERVICE_PORT serves management", c.HostRoutingPort)
+	}
+	return nil
+}
+
+// loadEventWebhook reads EVENT_WEBHOOK_URL and EVENT_WEBHOOK_TIMEOUT (default 5s)
+func (c *Config) loadEventWebhook() error {
+	c.EventWebhookURL = os.Getenv("EVENT_WEBHOOK_URL")
+	c.EventWebhookTimeout = defaultWebhookTimeout
+	if c.EventWebhookURL == "" {
+		return nil
+	}
+	u, err := url.Parse(c.EventWebhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid EVENT_WEBHOOK_URL %q: must be an http or https URL", c.EventWebhookURL)
+	}
+	if value := os.Getenv("EVENT_WEBHOOK_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid EVENT_WEBHOOK_TIMEOUT value %q: must be a positive duration", value)
+		}
+		c.EventWebhookTimeout = timeout
+	}
+	return nil
+}
+
+// loadKubeEvents reads EMIT_K8S_EVENTS (default false) and the proxy pod's
+// identity, which the downward API provides in POD_NAME, POD_NAMESPACE and POD_UID
+func (c *Config) loadKubeEvents() error {
+	var err error
+	if c.KubeEvents, err = envBool("EMIT_K8S_EVENTS", false); err != nil || !c.KubeEvents {
+		return err
+	}
+	c.PodName = os.Getenv("POD_NAME")
+	if c.PodName == "" {
+		// A pod's hostname is its name unless the pod spec sets another
+		if c.PodName, err = os.Hostname(); err != nil {
+			return fmt.Errorf("EMIT_K8S_EVENTS requires POD_NAME: %w", err)
+		}
+	}
+	c.PodNamespace = os.Getenv("POD_NAMESPACE")
+	if c.PodNamespace == "" {
+		c.PodNamespace = c.Discovery.Namespace
+	}
+	c.PodUID = os.Getenv("POD_UID")
+	return nil
+}
+
+// checkForwardedFor rejects RATE_LIMIT_TRUST_FORWARDED_FOR, which trusted
+// X-Forwarded-For from any peer. TRUSTED_PROXIES alone decides whose
+// X-Forwarded-For is believed, so a deployment still setting the old variable,
+// alone or next to TRUSTED_PROXIES, is stopped instead of limiting by the
+// wrong address.
+func checkForwardedFor() error {
+	if os.Getenv("RATE_LIMIT_TRUST_FORWARDED_FOR") == "" {
+		return nil
+	}
+	if os.Getenv("TRUSTED_PROXIES") != "" {
+		return fmt.Errorf("RATE_LIMIT_TRUST_FORWARDED_FOR and TRUSTED_PROXIES can't both be set: RATE_LIMIT_TRUST_FORWARDED_FOR is no longer supported, unset it")
+	}
+	return fmt.Errorf("RATE_LIMIT_TRUST_FORWARDED_FOR is no longer supported: set TRUSTED_PROXIES to the load balancers in front of the proxy instead")
+}
+
+// ParsePort parses and validates the port in the environment variable name
+func ParsePort(name, value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: not a number", name, value)
+	}
+	if port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid %s value %q: port %d is out of range 1-65535", name, value, port)
+	}
+	return port, nil
+}
+
+// managementPathPrefix validates MANAGEMENT_PATH_PREFIX, the path the
+// management interface is served under when the service port also proxies,
+// e.g. "/_np/". A trailing slash is added if missing.
+func managementPathPrefix(prefix string) (string, error) {
+	if prefix == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(prefix, "/") || strings.Trim(prefix, "/") == "" {
+		return "", fmt.Errorf("invalid MANAGEMENT_PATH_PREFIX %q: must be a path below /, e.g. /_np/", prefix)
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix, nil
+}
+
+// envBool reads a boolean from the environment, returning def when unset
+func envBool(key string, def bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q: %w", key, value, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,301 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/platform"
+	"k8s-node-proxy/internal/services"
+)
+
+// setGenericEnv clears the variables Load reads and configures a minimal
+// generic platform
+func setGenericEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{
+		"PROJECT_ID", "GOOGLE_CLOUD_PROJECT", "AWS_REGION", "CLUSTER_NAME", "KUBECONFIG",
+		"PROXY_SERVICE_PORT", "TARGET_MODE", "INCLUDE_CLUSTERIP", "DRY_RUN", "HOMEPAGE_LIVE_UPDATES",
+		"MANAGEMENT_PATH_PREFIX", "ADMIN_TOKEN", "EVENT_WEBHOOK_URL", "EVENT_WEBHOOK_TIMEOUT",
+		"EMIT_K8S_EVENTS", "POD_NAME", "POD_NAMESPACE", "POD_UID", "MAX_LISTENERS",
+		"HOST_ROUTING_DOMAIN", "HOST_ROUTING_PORT", "LISTEN_ADDRESS", "PROXY_DISABLE_KEEPALIVE",
+		"PROXY_PROTOCOL", "PROXY_PROTOCOL_TRUSTED_CIDRS", "TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_PORTS",
+		"SERVER_READ_HEADER_TIMEOUT", "SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT", "SERVER_IDLE_TIMEOUT",
+		"SHUTDOWN_TIMEOUT", "PROXY_TIMEOUT", "MAX_REQUEST_BYTES", "RATE_LIMIT_RPS", "TRUSTED_PROXIES",
+	} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("PLATFORM", "generic")
+	t.Setenv("NAMESPACE", "default")
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	setGenericEnv(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Platform != platform.Generic {
+		t.Errorf("Expected the generic platform, got %s", cfg.Platform)
+	}
+	if cfg.ServicePort != 80 {
+		t.Errorf("Expected service port 80, got %d", cfg.ServicePort)
+	}
+	want := services.DiscoveryOptions{Namespace: "default", TargetMode: services.TargetModeNodePort}
+	if cfg.Discovery != want {
+		t.Errorf("Expected discovery options %+v, got %+v", want, cfg.Discovery)
+	}
+	if cfg.DryRun || !cfg.LiveUpdates || cfg.ManagementPathPrefix != "" {
+		t.Errorf("Unexpected defaults: dry run %v, live updates %v, prefix %q", cfg.DryRun, cfg.LiveUpdates, cfg.ManagementPathPrefix)
+	}
+	if cfg.EventWebhookURL != "" || cfg.EventWebhookTimeout != 5*time.Second {
+		t.Errorf("Expected no webhook with the default timeout, got %q %s", cfg.EventWebhookURL, cfg.EventWebhookTimeout)
+	}
+	if cfg.KubeEvents {
+		t.Error("Expected Kubernetes events to be off by default")
+	}
+	if cfg.MaxListeners != 0 {
+		t.Errorf("Expected no listener limit by default, got %d", cfg.MaxListeners)
+	}
+	if cfg.HostRoutingDomain != "" {
+		t.Errorf("Expected a listener per port by default, got host routing for %q", cfg.HostRoutingDomain)
+	}
+	if cfg.Listeners.Address != "" || !cfg.Listeners.KeepAlives || cfg.Listeners.ProxyProtocol != nil || cfg.Listeners.TLSCertFile != "" {
+		t.Errorf("Expected plain HTTP with keep-alive on every interface by default, got %+v", cfg.Listeners)
+	}
+	if cfg.Listeners.ReadHeaderTimeout != 10*time.Second || cfg.Listeners.ReadTimeout != 0 || cfg.Listeners.WriteTimeout != 0 ||
+		cfg.Listeners.IdleTimeout != 120*time.Second || cfg.Listeners.ShutdownTimeout != 5*time.Second {
+		t.Errorf("Unexpected default server timeouts %+v", cfg.Listeners)
+	}
+}
+
+func TestLoad_Parsing(t *testing.T) {
+	setGenericEnv(t)
+	t.Setenv("PLATFORM", "")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("CLUSTER_NAME", "prod")
+	t.Setenv("PROXY_SERVICE_PORT", "8080")
+	t.Setenv("NAMESPACE", "apps")
+	t.Setenv("TARGET_MODE", "clusterip")
+	t.Setenv("DRY_RUN", "true")
+	t.Setenv("HOMEPAGE_LIVE_UPDATES", "false")
+	t.Setenv("MANAGEMENT_PATH_PREFIX", "/_np")
+	t.Setenv("ADMIN_TOKEN", "s3cret")
+	t.Setenv("EVENT_WEBHOOK_URL", "https://hooks.example.com/notify")
+	t.Setenv("EVENT_WEBHOOK_TIMEOUT", "2s")
+	t.Setenv("EMIT_K8S_EVENTS", "true")
+	t.Setenv("POD_NAME", "k8s-node-proxy-7d9f")
+	t.Setenv("POD_UID", "0b7e6b2c")
+	t.Setenv("MAX_LISTENERS", "200")
+	t.Setenv("HOST_ROUTING_DOMAIN", "Proxy.Internal.")
+	t.Setenv("HOST_ROUTING_PORT", "9000")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Platform != platform.AWS || cfg.AWSRegion != "eu-west-1" || cfg.ClusterName != "prod" {
+		t.Errorf("Expected EKS cluster prod in eu-west-1, got %s %q %q", cfg.Platform, cfg.ClusterName, cfg.AWSRegion)
+	}
+	if cfg.ServicePort != 8080 {
+		t.Errorf("Expected service port 8080, got %d", cfg.ServicePort)
+	}
+	if cfg.Discovery.Namespace != "apps" || cfg.Discovery.TargetMode != services.TargetModeClusterIP {
+		t.Errorf("Unexpected discovery options %+v", cfg.Discovery)
+	}
+	if !cfg.DryRun || cfg.LiveUpdates {
+		t.Errorf("Expected dry run without live updates, got %v and %v", cfg.DryRun, cfg.LiveUpdates)
+	}
+	if cfg.ManagementPathPrefix != "/_np/" {
+		t.Errorf("Expected prefix /_np/, got %q", cfg.ManagementPathPrefix)
+	}
+	if cfg.AdminToken != "s3cret" {
+		t.Errorf("Expected the admin token, got %q", cfg.AdminToken)
+	}
+	if cfg.EventWebhookURL != "https://hooks.example.com/notify" || cfg.EventWebhookTimeout != 2*time.Second {
+		t.Errorf("Unexpected webhook %q %s", cfg.EventWebhookURL, cfg.EventWebhookTimeout)
+	}
+	// The pod namespace defaults to NAMESPACE
+	if !cfg.KubeEvents || cfg.PodName != "k8s-node-proxy-7d9f" || cfg.PodNamespace != "apps" || cfg.PodUID != "0b7e6b2c" {
+		t.Errorf("Unexpected Kubernetes events settings: %v %q %q %q", cfg.KubeEvents, cfg.PodNamespace, cfg.PodName, cfg.PodUID)
+	}
+	if cfg.MaxListeners != 200 {
+		t.Errorf("Expected at most 200 listeners, got %d", cfg.MaxListeners)
+	}
+	if cfg.HostRoutingDomain != "proxy.internal" || cfg.HostRoutingPort != 9000 {
+		t.Errorf("Expected host routing for proxy.internal on port 9000, got %q on %d", cfg.HostRoutingDomain, cfg.HostRoutingPort)
+	}
+}
+
+func TestLoad_GoogleCloudProject(t *testing.T) {
+	setGenericEnv(t)
+	t.Setenv("PLATFORM", "")
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "my-project")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Platform != platform.GCP || cfg.ProjectID != "my-project" {
+		t.Errorf("Expected GCP project my-project, got %s %q", cfg.Platform, cfg.ProjectID)
+	}
+}
+
+func TestLoad_ValidationErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"MissingNamespace", map[string]string{"NAMESPACE": ""}, "NAMESPACE"},
+		{"MissingProject", map[string]string{"PLATFORM": "gcp"}, "PROJECT_ID"},
+		{"MissingClusterName", map[string]string{"PLATFORM": "aws", "AWS_REGION": "eu-west-1"}, "CLUSTER_NAME"},
+		{"UnknownPlatform", map[string]string{"PLATFORM": "azure"}, "PLATFORM"},
+		{"ServicePort", map[string]string{"PROXY_SERVICE_PORT": "70000"}, "PROXY_SERVICE_PORT"},
+		{"TargetMode", map[string]string{"TARGET_MODE": "pods"}, "TARGET_MODE"},
+		{"DryRun", map[string]string{"DRY_RUN": "maybe"}, "DRY_RUN"},
+		{"LiveUpdates", map[string]string{"HOMEPAGE_LIVE_UPDATES": "sometimes"}, "HOMEPAGE_LIVE_UPDATES"},
+		{"ManagementPathPrefix", map[string]string{"MANAGEMENT_PATH_PREFIX": "/"}, "MANAGEMENT_PATH_PREFIX"},
+		{"WebhookURL", map[string]string{"EVENT_WEBHOOK_URL": "ftp://hooks.example.com"}, "EVENT_WEBHOOK_URL"},
+		{"KubeEvents", map[string]string{"EMIT_K8S_EVENTS": "often"}, "EMIT_K8S_EVENTS"},
+		{"MaxListeners", map[string]string{"MAX_LISTENERS": "-1"}, "MAX_LISTENERS"},
+		{"HostRoutingPort", map[string]string{"HOST_ROUTING_DOMAIN": "proxy.internal", "HOST_ROUTING_PORT": "http"}, "HOST_ROUTING_PORT"},
+		{"HostRoutingOnServicePort", map[string]string{"HOST_ROUTING_DOMAIN": "proxy.internal", "HOST_ROUTING_PORT": "80"}, "HOST_ROUTING_PORT"},
+		{"WebhookTimeout", map[string]string{"EVENT_WEBHOOK_URL": "https://hooks.example.com", "EVENT_WEBHOOK_TIMEOUT": "0s"}, "EVENT_WEBHOOK_TIMEOUT"},
+		{"TrustForwardedFor", map[string]string{"RATE_LIMIT_TRUST_FORWARDED_FOR": "true"}, "RATE_LIMIT_TRUST_FORWARDED_FOR"},
+		{"ListenAddress", map[string]string{"LISTEN_ADDRESS": "10.0.0.5:8080"}, "LISTEN_ADDRESS"},
+		{"DisableKeepAlive", map[string]string{"PROXY_DISABLE_KEEPALIVE": "yes please"}, "PROXY_DISABLE_KEEPALIVE"},
+		{"ProxyProtocol", map[string]string{"PROXY_PROTOCOL": "maybe"}, "PROXY_PROTOCOL"},
+		{"ProxyProtocolWithoutTrustedCIDRs", map[string]string{"PROXY_PROTOCOL": "true"}, "PROXY_PROTOCOL_TRUSTED_CIDRS"},
+		{"ProxyProtocolTrustedCIDRs", map[string]string{"PROXY_PROTOCOL": "true", "PROXY_PROTOCOL_TRUSTED_CIDRS": "10.0.0.0/33"}, "PROXY_PROTOCOL_TRUSTED_CIDRS"},
+		{"TLSKeyFileMissing", map[string]string{"TLS_CERT_FILE": "/etc/tls/tls.crt"}, "TLS_KEY_FILE"},
+		{"TLSPorts", map[string]string{"TLS_CERT_FILE": "/etc/tls/tls.crt", "TLS_KEY_FILE": "/etc/tls/tls.key", "TLS_PORTS": "https"}, "TLS_PORTS"},
+		{"ServerReadTimeout", map[string]string{"SERVER_READ_TIMEOUT": "-1s"}, "SERVER_READ_TIMEOUT"},
+		{"ServerWriteTimeout", map[string]string{"SERVER_WRITE_TIMEOUT": "bogus"}, "SERVER_WRITE_TIMEOUT"},
+		{"ShutdownTimeout", map[string]string{"SHUTDOWN_TIMEOUT": "soon"}, "SHUTDOWN_TIMEOUT"},
+		{"ProxyTimeout", map[string]string{"PROXY_TIMEOUT": "forever"}, "PROXY_TIMEOUT"},
+		{"MaxRequestBytes", map[string]string{"MAX_REQUEST_BYTES": "-1"}, "MAX_REQUEST_BYTES"},
+		{"RateLimit", map[string]string{"RATE_LIMIT_RPS": "0"}, "RATE_LIMIT_RPS"},
+		{"TrustedProxies", map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8,proxy"}, "TRUSTED_PROXIES"},
+		{"TrustForwardedForWithTrustedProxies", map[string]string{"RATE_LIMIT_TRUST_FORWARDED_FOR": "true", "TRUSTED_PROXIES": "10.0.0.0/8"}, "TRUSTED_PROXIES"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setGenericEnv(t)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := Load()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error naming %s, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestListenersFromEnv(t *testing.T) {
+	setGenericEnv(t)
+	t.Setenv("LISTEN_ADDRESS", "[::1]")
+	t.Setenv("PROXY_DISABLE_KEEPALIVE", "true")
+	t.Setenv("PROXY_PROTOCOL", "true")
+	t.Setenv("PROXY_PROTOCOL_TRUSTED_CIDRS", "10.0.0.0/8")
+	t.Setenv("TLS_CERT_FILE", "/etc/tls/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/etc/tls/tls.key")
+	t.Setenv("TLS_PORTS", "30443, 8443")
+	t.Setenv("SERVER_IDLE_TIMEOUT", "30s")
+	t.Setenv("SHUTDOWN_TIMEOUT", "0s")
+
+	listeners, err := ListenersFromEnv()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if listeners.Address != "::1" || listeners.KeepAlives {
+		t.Errorf("Expected ::1 without keep-alive, got %q %v", listeners.Address, listeners.KeepAlives)
+	}
+	if len(listeners.ProxyProtocol) != 1 || listeners.ProxyProtocol[0].String() != "10.0.0.0/8" {
+		t.Errorf("Expected PROXY headers from 10.0.0.0/8, got %v", listeners.ProxyProtocol)
+	}
+	if listeners.TLSCertFile != "/etc/tls/tls.crt" || listeners.TLSKeyFile != "/etc/tls/tls.key" ||
+		len(listeners.TLSPorts) != 2 || !listeners.TLSPorts[30443] || !listeners.TLSPorts[8443] {
+		t.Errorf("Unexpected TLS settings %q %q %v", listeners.TLSCertFile, listeners.TLSKeyFile, listeners.TLSPorts)
+	}
+	if listeners.IdleTimeout != 30*time.Second || listeners.ShutdownTimeout != 0 || listeners.ReadHeaderTimeout != 10*time.Second {
+		t.Errorf("Unexpected server timeouts %+v", listeners)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"127.0.0.1", "127.0.0.1", false},
+		{"::1", "::1", false},
+		{"[::1]", "::1", false},
+		{"proxy.internal", "proxy.internal", false},
+		{"10.0.0.5:8080", "", true},
+		{"not a host", "", true},
+	}
+	for _, tt := range tests {
+		got, err := listenAddress(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("LISTEN_ADDRESS=%q: got %q, %v", tt.value, got, err)
+		}
+	}
+}
+
+func TestParsePort(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"1", 1, false},
+		{"8080", 8080, false},
+		{"65535", 65535, false},
+		{"0", 0, true},
+		{"65536", 0, true},
+		{"70000", 0, true},
+		{"http", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParsePort("PROXY_SERVICE_PORT", tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParsePort(%q): expected error %v, got %v", tt.value, tt.wantErr, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParsePort(%q): expected %d, got %d", tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestManagementPathPrefix(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"/_np/", "/_np/", false},
+		{"/_np", "/_np/", false},
+		{"/", "", true},
+		{"_np/", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := managementPathPrefix(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected prefix %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
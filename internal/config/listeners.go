@@ -0,0 +1,177 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"k8s-node-proxy/internal/proxyproto"
+)
+
+// Listeners configure the listeners the proxy ports are served on
+type Listeners struct {
+	// Address is the host every port binds to, empty for all interfaces (LISTEN_ADDRESS)
+	Address string
+
+	// KeepAlives controls HTTP keep-alive on client connections (PROXY_DISABLE_KEEPALIVE)
+	KeepAlives bool
+
+	// ProxyProtocol takes client addresses from PROXY headers sent by the L4
+	// load balancers in these ranges (PROXY_PROTOCOL, PROXY_PROTOCOL_TRUSTED_CIDRS);
+	// nil when off
+	ProxyProtocol []netip.Prefix
+
+	// TLSCertFile and TLSKeyFile terminate client TLS when set; TLSPorts limits
+	// HTTPS to some ports, empty meaning every port (TLS_CERT_FILE, TLS_KEY_FILE, TLS_PORTS)
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSPorts    map[int]bool
+
+	// The http.Server timeouts applied to every port, zero meaning no limit
+	// (SERVER_READ_HEADER_TIMEOUT, SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT,
+	// SERVER_IDLE_TIMEOUT)
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// ShutdownTimeout is how long in-flight requests may finish when a port
+	// stops (SHUTDOWN_TIMEOUT); zero closes connections immediately
+	ShutdownTimeout time.Duration
+}
+
+// ListenersFromEnv reads the listener settings. Read and write timeouts cover
+// whole requests and responses, so they are off by default to not cut
+// long-running proxied requests short; the proxy timeout bounds those.
+func ListenersFromEnv() (Listeners, error) {
+	var l Listeners
+	var err error
+	if l.Address, err = listenAddress(os.Getenv("LISTEN_ADDRESS")); err != nil {
+		return Listeners{}, err
+	}
+	disabled, err := envBool("PROXY_DISABLE_KEEPALIVE", false)
+	if err != nil {
+		return Listeners{}, err
+	}
+	l.KeepAlives = !disabled
+	if l.ProxyProtocol, err = proxyProtocol(); err != nil {
+		return Listeners{}, err
+	}
+	if err := l.loadTLS(); err != nil {
+		return Listeners{}, err
+	}
+
+	timeouts := []struct {
+		key string
+		def time.Duration
+		dst *time.Duration
+	}{
+		{"SERVER_READ_HEADER_TIMEOUT", 10 * time.Second, &l.ReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT", 0, &l.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", 0, &l.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", 120 * time.Second, &l.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", 5 * time.Second, &l.ShutdownTimeout},
+	}
+	for _, timeout := range timeouts {
+		if *timeout.dst, err = envDuration(timeout.key, timeout.def); err != nil {
+			return Listeners{}, err
+		}
+	}
+	return l, nil
+}
+
+// listenAddress validates LISTEN_ADDRESS: an IP address or hostname to bind
+// to. Empty means all interfaces.
+func listenAddress(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	// Accept IPv6 addresses with or without brackets
+	host := strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if net.ParseIP(host) != nil || isHostname(host) {
+		return host, nil
+	}
+	return "", fmt.Errorf("invalid LISTEN_ADDRESS value %q: must be an IP address or hostname", value)
+}
+
+// isHostname reports whether s is a syntactically valid DNS hostname
+func isHostname(s string) bool {
+	if len(s) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(s, ".") {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// proxyProtocol reads PROXY_PROTOCOL and, when it is on, the load balancers
+// allowed to send headers from PROXY_PROTOCOL_TRUSTED_CIDRS, which is then
+// required so headers are never taken from just any peer
+func proxyProtocol() ([]netip.Prefix, error) {
+	enabled, err := envBool("PROXY_PROTOCOL", false)
+	if err != nil || !enabled {
+		return nil, err
+	}
+	trusted, err := proxyproto.ParseTrustedCIDRs(os.Getenv("PROXY_PROTOCOL_TRUSTED_CIDRS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY_PROTOCOL_TRUSTED_CIDRS: %w", err)
+	}
+	if len(trusted) == 0 {
+		return nil, errors.New("PROXY_PROTOCOL requires PROXY_PROTOCOL_TRUSTED_CIDRS, the addresses of the load balancers sending PROXY headers")
+	}
+	return trusted, nil
+}
+
+// loadTLS reads TLS_CERT_FILE and TLS_KEY_FILE, which must be set together,
+// and TLS_PORTS. The certificate itself is loaded by the port manager.
+func (l *Listeners) loadTLS() error {
+	l.TLSCertFile, l.TLSKeyFile = os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if l.TLSCertFile == "" && l.TLSKeyFile == "" {
+		return nil
+	}
+	if l.TLSCertFile == "" || l.TLSKeyFile == "" {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	l.TLSPorts = map[int]bool{}
+	for _, entry := range strings.Split(os.Getenv("TLS_PORTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		port, err := ParsePort("TLS_PORTS", entry)
+		if err != nil {
+			return err
+		}
+		l.TLSPorts[port] = true
+	}
+	return nil
+}
+
+// envDuration reads a non-negative duration from the environment, returning
+// def when unset
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s value %q: must be a non-negative duration", key, value)
+	}
+	return d, nil
+}
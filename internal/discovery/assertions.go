@@ -0,0 +1,18 @@
+package discovery
+
+import (
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/services"
+)
+
+// Every platform implementation satisfies the discovery interfaces the servers
+// run on, and with them NodeDiscovery and ServiceDiscovery
+var (
+	_ NodeDiscoverer = (*nodes.NodeDiscovery)(nil)
+	_ NodeDiscoverer = (*nodes.EKSNodeDiscovery)(nil)
+	_ NodeDiscoverer = (*nodes.GenericNodeDiscovery)(nil)
+
+	_ ServiceDiscoverer = (*services.NodePortDiscovery)(nil)
+	_ ServiceDiscoverer = (*services.EKSNodePortDiscovery)(nil)
+	_ ServiceDiscoverer = (*services.GenericNodePortDiscovery)(nil)
+)
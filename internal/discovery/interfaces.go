@@ -1,45 +1,35 @@
-// Package discovery defines interfaces for service and node discovery
+// Package discovery defines interfaces for service and node discovery. The
+// data types alias those of the nodes and services packages, whose
+// platform implementations satisfy these interfaces.
 package discovery
 
 import (
 	"context"
 	"time"
+
+	"k8s.io/client-go/kubernetes"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/services"
 )
 
 // ServiceInfo represents a discovered service
-type ServiceInfo struct {
-	Name       string
-	Namespace  string
-	NodePort   int32
-	TargetPort int32
-	Protocol   string
-}
+type ServiceInfo = services.ServiceInfo
 
 // ClusterInfo represents cluster information
-type ClusterInfo struct {
-	Name     string
-	Location string
-	Endpoint string
-}
+type ClusterInfo = services.ClusterInfo
 
 // NodeStatus represents the health status of a node
-type NodeStatus int
+type NodeStatus = nodes.NodeStatus
 
 const (
-	NodeHealthy NodeStatus = iota
-	NodeUnhealthy
-	NodeUnknown
+	NodeHealthy   = nodes.NodeHealthy
+	NodeUnhealthy = nodes.NodeUnhealthy
+	NodeUnknown   = nodes.NodeUnknown
 )
 
 // NodeInfo represents a discovered node
-type NodeInfo struct {
-	Name         string
-	IP           string
-	Status       NodeStatus
-	Age          time.Duration
-	CreationTime time.Time
-	LastCheck    time.Time
-}
+type NodeInfo = nodes.NodeInfo
 
 // ServiceDiscovery interface for discovering services
 type ServiceDiscovery interface {
@@ -52,7 +42,40 @@ type ServiceDiscovery interface {
 type NodeDiscovery interface {
 	GetCurrentNodeIP(ctx context.Context) (string, error)
 	GetAllNodes(ctx context.Context) ([]NodeInfo, error)
+	GetAllNodeIPs(ctx context.Context) ([]string, error)
 	StartHealthMonitoring()
 	StopHealthMonitoring()
 	GetCurrentNodeName() string
 }
+
+// ServiceDiscoverer is the service discovery a server runs on: ServiceDiscovery
+// plus the cluster client it shares with Kubernetes Events and endpoint routing
+type ServiceDiscoverer interface {
+	ServiceDiscovery
+	GetClientset() kubernetes.Interface
+}
+
+// NodeDiscoverer is the node discovery a server runs on: NodeDiscovery plus
+// the health, failover, pinning and event methods behind its management API
+type NodeDiscoverer interface {
+	NodeDiscovery
+
+	Rediscover(ctx context.Context) (string, error)
+	SetProbePorts(ports []int)
+	Subscribe() <-chan nodes.NodeEvent
+
+	GetCurrentNodeStatus() NodeStatus
+	GetHealthyNodeCount() int
+	GetUnavailableReason() string
+	GetNodeFailureScores() map[string]float64
+	NodeListStaleSince() time.Time
+
+	TriggerFailover() (string, error)
+	SelectNode(name string) error
+	ClearSelectedNode()
+	PinnedNode() string
+
+	HealthCheckInterval() time.Duration
+	FailureThreshold() int
+	SelectionSettings() nodes.SelectionSettings
+}
@@ -0,0 +1,56 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/services"
+)
+
+func TestPlatformImplementationsSatisfyInterfaces(t *testing.T) {
+	nodeDiscovery := reflect.TypeOf((*NodeDiscoverer)(nil)).Elem()
+	for _, impl := range []any{(*nodes.NodeDiscovery)(nil), (*nodes.EKSNodeDiscovery)(nil), (*nodes.GenericNodeDiscovery)(nil)} {
+		assert.True(t, reflect.TypeOf(impl).Implements(nodeDiscovery), "%T should implement discovery.NodeDiscoverer", impl)
+	}
+
+	serviceDiscovery := reflect.TypeOf((*ServiceDiscoverer)(nil)).Elem()
+	for _, impl := range []any{(*services.NodePortDiscovery)(nil), (*services.EKSNodePortDiscovery)(nil), (*services.GenericNodePortDiscovery)(nil)} {
+		assert.True(t, reflect.TypeOf(impl).Implements(serviceDiscovery), "%T should implement discovery.ServiceDiscoverer", impl)
+	}
+}
+
+// TestNodeDiscoveryThroughInterface tests that callers can select a node
+// without depending on the concrete platform type
+func TestNodeDiscoveryThroughInterface(t *testing.T) {
+	clientset := fake.NewClientset(&corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1", CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))},
+		Status: corev1.NodeStatus{
+			Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.1.1"}},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	})
+	generic, err := nodes.NewGenericNodeDiscovery(clientset)
+	require.NoError(t, err)
+
+	var d NodeDiscovery = generic
+	defer d.StopHealthMonitoring()
+
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip)
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	all, err := d.GetAllNodes(context.Background())
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, NodeHealthy, all[0].Status)
+}
@@ -0,0 +1,112 @@
+// Package metrics exposes Prometheus metrics for the proxy and node discovery
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "k8s_node_proxy"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Total number of proxied requests by status code and method.",
+	}, []string{"code", "method"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of proxied requests in seconds.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	backendErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_errors_total",
+		Help:      "Total number of failed connections to the backend node.",
+	})
+
+	failoversTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failovers_total",
+		Help:      "Total number of completed node failovers.",
+	})
+
+	nodePortRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "node_port_requests_total",
+		Help:      "Total number of proxied requests by target NodePort and service (PROXY_METRICS_NODEPORT_LABELS).",
+	}, []string{"node_port", "service"})
+
+	nodeSelectionFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "node_selection_failures_total",
+		Help:      "Total number of times no node could be selected, by reason.",
+	}, []string{"reason"})
+
+	upstreamConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "upstream_connections",
+		Help:      "Open connections to backend nodes, by state (active or idle).",
+	}, []string{"state"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestDuration,
+		backendErrorsTotal,
+		failoversTotal,
+		nodePortRequestsTotal,
+		nodeSelectionFailuresTotal,
+		upstreamConnections,
+	)
+}
+
+// Handler returns the HTTP handler serving the proxy metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a completed proxied request
+func ObserveRequest(method string, code int, duration time.Duration) {
+	requestsTotal.WithLabelValues(strconv.Itoa(code), method).Inc()
+	requestDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// IncNodePortRequests records a proxied request against its target NodePort and service
+func IncNodePortRequests(nodePort, service string) {
+	nodePortRequestsTotal.WithLabelValues(nodePort, service).Inc()
+}
+
+// IncBackendErrors records a failed connection to the backend
+func IncBackendErrors() {
+	backendErrorsTotal.Inc()
+}
+
+// IncFailovers records a completed node failover
+func IncFailovers() {
+	failoversTotal.Inc()
+}
+
+// IncNodeSelectionFailures records a failed node selection (no_nodes, no_healthy_nodes or too_few_healthy_nodes)
+func IncNodeSelectionFailures(reason string) {
+	nodeSelectionFailuresTotal.WithLabelValues(reason).Inc()
+}
+
+// SetUpstreamConnections records the backend connections serving a request and idle in the pool
+func SetUpstreamConnections(active, idle int) {
+	upstreamConnections.WithLabelValues("active").Set(float64(active))
+	upstreamConnections.WithLabelValues("idle").Set(float64(idle))
+}
@@ -0,0 +1,51 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// apiBackoff paces retries of failed Kubernetes API calls: capped, jittered
+// exponential backoff giving up after five attempts spread over about two seconds
+var apiBackoff = wait.Backoff{
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.5,
+	Steps:    5,
+	Cap:      2 * time.Second,
+}
+
+// apiListTimeoutSeconds bounds how long the API server works on a List before
+// giving up, independent of the client-side context
+const apiListTimeoutSeconds int64 = 30
+
+// isTransientAPIError reports whether a failed Kubernetes API call may succeed on retry
+func isTransientAPIError(err error) bool {
+	switch {
+	case apierrors.IsNotFound(err), apierrors.IsForbidden(err), apierrors.IsUnauthorized(err),
+		apierrors.IsBadRequest(err), apierrors.IsInvalid(err), apierrors.IsMethodNotSupported(err):
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	return true
+}
+
+// withAPIRetry calls fn, retrying transient API errors with apiBackoff until ctx is done
+func withAPIRetry(ctx context.Context, operation string, fn func() error) error {
+	attempt := 0
+	return retry.OnError(apiBackoff, func(err error) bool {
+		attempt++
+		if ctx.Err() != nil || !isTransientAPIError(err) {
+			return false
+		}
+		slog.Warn("Kubernetes API call failed, retrying", "operation", operation, "attempt", attempt, "error", err)
+		return true
+	}, fn)
+}
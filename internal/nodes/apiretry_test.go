@@ -0,0 +1,105 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// useFastAPIBackoff shortens apiBackoff for the duration of a test
+func useFastAPIBackoff(t *testing.T) {
+	t.Helper()
+	original := apiBackoff
+	apiBackoff = wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 5, Cap: 100 * time.Millisecond}
+	t.Cleanup(func() { apiBackoff = original })
+}
+
+func TestIsTransientAPIError(t *testing.T) {
+	nodes := schema.GroupResource{Resource: "nodes"}
+
+	assert.True(t, isTransientAPIError(apierrors.NewServiceUnavailable("etcd leader change")))
+	assert.True(t, isTransientAPIError(apierrors.NewTooManyRequests("slow down", 1)))
+	assert.True(t, isTransientAPIError(errors.New("connection refused")))
+
+	assert.False(t, isTransientAPIError(apierrors.NewNotFound(nodes, "node-1")))
+	assert.False(t, isTransientAPIError(apierrors.NewForbidden(nodes, "node-1", errors.New("rbac"))))
+	assert.False(t, isTransientAPIError(context.DeadlineExceeded))
+}
+
+func TestWithAPIRetry(t *testing.T) {
+	useFastAPIBackoff(t)
+
+	t.Run("RecoversFromTransientErrors", func(t *testing.T) {
+		calls := 0
+		err := withAPIRetry(context.Background(), "test", func() error {
+			calls++
+			if calls < 3 {
+				return apierrors.NewServiceUnavailable("unavailable")
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("GivesUpAfterBackoffSteps", func(t *testing.T) {
+		calls := 0
+		err := withAPIRetry(context.Background(), "test", func() error {
+			calls++
+			return apierrors.NewServiceUnavailable("unavailable")
+		})
+		assert.True(t, apierrors.IsServiceUnavailable(err))
+		assert.Equal(t, apiBackoff.Steps, calls)
+	})
+
+	t.Run("DoesNotRetryPermanentErrors", func(t *testing.T) {
+		calls := 0
+		err := withAPIRetry(context.Background(), "test", func() error {
+			calls++
+			return apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "node-1")
+		})
+		assert.True(t, apierrors.IsNotFound(err))
+		assert.Equal(t, 1, calls)
+	})
+}
+
+// TestHealthCheck_APIErrorIsNotANodeFailure tests that an unreachable API server
+// leaves the failure counter alone while a deleted node still counts
+func TestHealthCheck_APIErrorIsNotANodeFailure(t *testing.T) {
+	useFastAPIBackoff(t)
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	getErr := apierrors.NewServiceUnavailable("apiserver unavailable")
+	clientset.PrependReactor("get", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, getErr
+	})
+
+	d.performHealthCheck()
+	assert.Equal(t, 0, d.failureCount, "API errors must not count as node failures")
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	getErr = apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "node-1")
+	d.performHealthCheck()
+	assert.Equal(t, 1, d.failureCount, "a deleted node counts as a failure")
+}
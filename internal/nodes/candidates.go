@@ -0,0 +1,61 @@
+package nodes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// failoverCandidates keeps the healthy nodes, oldest first, as of the last
+// successful health check so a failover can pick its target from memory
+// instead of listing nodes at the moment the selected node has failed.
+type failoverCandidates struct {
+	mu        sync.Mutex
+	nodes     []NodeInfo
+	refreshed time.Time
+}
+
+// refresh replaces the candidates with the healthy nodes among nodes
+func (c *failoverCandidates) refresh(nodes []NodeInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nodes = healthyByAge(nodes)
+	c.refreshed = time.Now()
+}
+
+// pick returns the selector's choice among the candidates other than current,
+// dropping candidates that stillHealthy rejects. Returns nil when the
+// candidates are older than maxAge or none is left, in which case the caller
+// lists nodes itself.
+func (c *failoverCandidates) pick(selector NodeSelector, current string, maxAge time.Duration, stillHealthy func(name string) bool) *NodeInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.refreshed.IsZero() || time.Since(c.refreshed) >= maxAge {
+		return nil
+	}
+
+	for {
+		candidate := selector.Select(withoutNode(c.nodes, current))
+		if candidate == nil {
+			return nil
+		}
+		if stillHealthy(candidate.Name) {
+			return candidate
+		}
+		c.nodes = withoutNode(c.nodes, candidate.Name)
+	}
+}
+
+// nodeStillHealthy re-checks a cached failover candidate from the watcher's
+// cache (or the API before it syncs)
+func nodeStillHealthy(ctx context.Context, clientset kubernetes.Interface, w *nodeWatcher, filter nodeFilter, name string) bool {
+	node, err := getNode(ctx, clientset, w, name)
+	if err != nil {
+		return false
+	}
+	return !filter.excludes(*node) && getNodeStatus(*node) == NodeHealthy
+}
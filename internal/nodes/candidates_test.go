@@ -0,0 +1,73 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newCandidatesTestDiscovery returns a discovery serving node-1, the oldest of
+// three healthy nodes, that fails over on the first failure
+func newCandidatesTestDiscovery(t *testing.T) (*GenericNodeDiscovery, *fake.Clientset) {
+	t.Helper()
+	t.Setenv("FAILURE_THRESHOLD", "1")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-3*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-3", "10.0.1.3", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+	return d, clientset
+}
+
+// TestFailover_WarmCandidates tests that failover picks a cached candidate
+// without listing nodes
+func TestFailover_WarmCandidates(t *testing.T) {
+	d, clientset := newCandidatesTestDiscovery(t)
+
+	setNodeReady(t, clientset, "node-1", false)
+	clientset.ClearActions()
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+	assert.Equal(t, 0, countNodeLists(clientset), "failover should not list nodes when a warm candidate exists")
+}
+
+// TestFailover_SkipsUnhealthyCandidate tests that a candidate that turned
+// unhealthy since the candidates were cached is skipped
+func TestFailover_SkipsUnhealthyCandidate(t *testing.T) {
+	d, clientset := newCandidatesTestDiscovery(t)
+
+	setNodeReady(t, clientset, "node-2", false)
+	setNodeReady(t, clientset, "node-1", false)
+	clientset.ClearActions()
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-3", d.GetCurrentNodeName())
+	assert.Equal(t, 0, countNodeLists(clientset))
+}
+
+// TestFailover_StaleCandidates tests that failover lists nodes when the cached
+// candidates are older than CACHE_TTL
+func TestFailover_StaleCandidates(t *testing.T) {
+	t.Setenv("CACHE_TTL", "0s")
+	d, clientset := newCandidatesTestDiscovery(t)
+
+	setNodeReady(t, clientset, "node-1", false)
+	clientset.ClearActions()
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+	assert.Equal(t, 1, countNodeLists(clientset))
+}
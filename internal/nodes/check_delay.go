@@ -0,0 +1,40 @@
+package nodes
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	defaultFirstCheckDelay  = 5 * time.Second
+	defaultFirstCheckJitter = 2 * time.Second
+)
+
+// firstCheckDelay defers the first health check on a newly selected node so the
+// selection and node cache can settle before the node is judged.
+type firstCheckDelay struct {
+	delay  time.Duration
+	jitter time.Duration
+}
+
+// firstCheckDelayFromEnv reads HEALTH_CHECK_INITIAL_DELAY (default 5s) and
+// HEALTH_CHECK_INITIAL_JITTER (default 2s)
+func firstCheckDelayFromEnv() (firstCheckDelay, error) {
+	delay, err := envDuration("HEALTH_CHECK_INITIAL_DELAY", defaultFirstCheckDelay)
+	if err != nil {
+		return firstCheckDelay{}, err
+	}
+	jitter, err := envDuration("HEALTH_CHECK_INITIAL_JITTER", defaultFirstCheckJitter)
+	if err != nil {
+		return firstCheckDelay{}, err
+	}
+	return firstCheckDelay{delay: delay, jitter: jitter}, nil
+}
+
+// next returns the deferral for a new selection: the delay plus a random spread of up to jitter
+func (f firstCheckDelay) next() time.Duration {
+	if f.jitter <= 0 {
+		return f.delay
+	}
+	return f.delay + rand.N(f.jitter)
+}
@@ -0,0 +1,83 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFirstCheckDelay_Next(t *testing.T) {
+	t.Run("NoJitter", func(t *testing.T) {
+		delay := firstCheckDelay{delay: 3 * time.Second}
+		assert.Equal(t, 3*time.Second, delay.next())
+	})
+
+	t.Run("WithJitter", func(t *testing.T) {
+		delay := firstCheckDelay{delay: 3 * time.Second, jitter: time.Second}
+		for i := 0; i < 100; i++ {
+			d := delay.next()
+			assert.GreaterOrEqual(t, d, 3*time.Second)
+			assert.Less(t, d, 4*time.Second)
+		}
+	})
+}
+
+func TestFirstCheckDelayFromEnv(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "")
+		t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "")
+
+		delay, err := firstCheckDelayFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, defaultFirstCheckDelay, delay.delay)
+		assert.Equal(t, defaultFirstCheckJitter, delay.jitter)
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "1s")
+		t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+		delay, err := firstCheckDelayFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, delay.delay)
+		assert.Equal(t, time.Duration(0), delay.jitter)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "-1s")
+		_, err := firstCheckDelayFromEnv()
+		assert.Error(t, err)
+	})
+}
+
+// TestHealthCheck_FirstCheckDeferredAfterSelection tests that a freshly selected node
+// is not health checked until the configured delay has elapsed
+func TestHealthCheck_FirstCheckDeferredAfterSelection(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "200ms")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-time.Hour)))
+	d := newTestGenericDiscovery(t, clientset)
+
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip)
+
+	// The node goes NotReady right after selection
+	setNodeReady(t, clientset, "node-1", false)
+	clientset.ClearActions()
+
+	d.performHealthCheck()
+	assert.Empty(t, clientset.Actions(), "health check should be deferred right after selection")
+	assert.Equal(t, 0, d.failureCount)
+
+	time.Sleep(250 * time.Millisecond)
+
+	d.performHealthCheck()
+	assert.NotEmpty(t, clientset.Actions(), "health check should run once the delay has elapsed")
+	assert.Equal(t, 1, d.failureCount)
+}
@@ -1,11 +1,64 @@
 package nodes
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+
+	"k8s-node-proxy/internal/metrics"
+
 	corev1 "k8s.io/api/core/v1"
 )
 
-// getNodeStatus determines the health status from node conditions
-// This function is shared across all platform implementations (GKE, Generic, EKS)
+// Reasons reported in logs, metrics and /health when no node can be selected
+const (
+	ReasonNoNodes        = "no_nodes"
+	ReasonNoHealthyNodes = "no_healthy_nodes"
+	// ReasonTooFewHealthyNodes means fewer nodes are healthy than MIN_HEALTHY_NODES requires
+	ReasonTooFewHealthyNodes = "too_few_healthy_nodes"
+)
+
+var (
+	// ErrNoNodes is returned when the cluster has no nodes with a usable IP
+	ErrNoNodes = errors.New("no nodes found in cluster")
+	// ErrNoHealthyNodes is returned when nodes exist but none of them is healthy
+	ErrNoHealthyNodes = errors.New("no healthy nodes found")
+	// ErrTooFewHealthyNodes is returned while fewer nodes are healthy than MIN_HEALTHY_NODES
+	ErrTooFewHealthyNodes = errors.New("too few healthy nodes")
+	// ErrUnknownNode is returned by SelectNode for a node that isn't in the node list
+	ErrUnknownNode = errors.New("node not found")
+	// ErrNodeNotHealthy is returned by SelectNode for a node that isn't healthy
+	ErrNodeNotHealthy = errors.New("node is not healthy")
+)
+
+// unavailableReason classifies a node list that yielded no healthy node
+func unavailableReason(nodes []NodeInfo) string {
+	if len(nodes) == 0 {
+		return ReasonNoNodes
+	}
+	return ReasonNoHealthyNodes
+}
+
+// recordSelectionFailure logs and counts a failed node selection and returns the
+// matching error
+func recordSelectionFailure(reason string) error {
+	slog.Warn("No node available for proxying", "reason", reason)
+	metrics.IncNodeSelectionFailures(reason)
+	switch reason {
+	case ReasonNoNodes:
+		return ErrNoNodes
+	case ReasonTooFewHealthyNodes:
+		return ErrTooFewHealthyNodes
+	}
+	return ErrNoHealthyNodes
+}
+
+// getNodeStatus reports a node healthy when its Ready condition is True and
+// unhealthy for any other Ready status. A node without a Ready condition yet
+// is unknown.
 func getNodeStatus(node corev1.Node) NodeStatus {
 	for _, condition := range node.Status.Conditions {
 		if condition.Type == corev1.NodeReady {
@@ -18,15 +71,100 @@ func getNodeStatus(node corev1.Node) NodeStatus {
 	return NodeUnknown
 }
 
-// getNodeInternalIP extracts the Internal IP (matching original GCE NetworkIP behavior)
-// This function is shared across all platform implementations (GKE, Generic, EKS)
-func getNodeInternalIP(node corev1.Node) string {
-	// Get Internal IP (equivalent to GCE NetworkIP)
+// nodeIPType selects which node address traffic is forwarded to (NODE_IP_TYPE)
+type nodeIPType string
+
+const (
+	nodeIPInternal nodeIPType = "internal"
+	nodeIPExternal nodeIPType = "external"
+)
+
+// nodeIPTypeFromEnv reads NODE_IP_TYPE (internal or external, default internal)
+func nodeIPTypeFromEnv() (nodeIPType, error) {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("NODE_IP_TYPE")))
+	switch nodeIPType(value) {
+	case "", nodeIPInternal:
+		return nodeIPInternal, nil
+	case nodeIPExternal:
+		return nodeIPExternal, nil
+	default:
+		return "", fmt.Errorf("invalid NODE_IP_TYPE value %q: must be internal or external", value)
+	}
+}
+
+// nodeIPFamily restricts node addresses to one IP family on dual-stack
+// clusters (NODE_IP_FAMILY); empty accepts the first address listed
+type nodeIPFamily string
+
+const (
+	nodeIPFamilyAny  nodeIPFamily = ""
+	nodeIPFamilyIPv4 nodeIPFamily = "ipv4"
+	nodeIPFamilyIPv6 nodeIPFamily = "ipv6"
+)
+
+// nodeIPFamilyFromEnv reads NODE_IP_FAMILY (ipv4 or ipv6, default any)
+func nodeIPFamilyFromEnv() (nodeIPFamily, error) {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("NODE_IP_FAMILY")))
+	switch family := nodeIPFamily(value); family {
+	case nodeIPFamilyAny, nodeIPFamilyIPv4, nodeIPFamilyIPv6:
+		return family, nil
+	default:
+		return "", fmt.Errorf("invalid NODE_IP_FAMILY value %q: must be ipv4 or ipv6", value)
+	}
+}
+
+// matches reports whether address belongs to the family
+func (f nodeIPFamily) matches(address string) bool {
+	if f == nodeIPFamilyAny {
+		return true
+	}
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	return ip.Unmap().Is4() == (f == nodeIPFamilyIPv4)
+}
+
+// nodeAddress returns the node's address of the requested type and family,
+// IPv4 or IPv6. Internal matches the original GCE NetworkIP behavior.
+func nodeAddress(node corev1.Node, ipType nodeIPType, family nodeIPFamily) (string, error) {
+	addressType := corev1.NodeInternalIP
+	if ipType == nodeIPExternal {
+		addressType = corev1.NodeExternalIP
+	}
+
 	for _, addr := range node.Status.Addresses {
-		if addr.Type == corev1.NodeInternalIP {
-			return addr.Address
+		if addr.Type == addressType && addr.Address != "" && family.matches(addr.Address) {
+			return addr.Address, nil
 		}
 	}
+	if family != nodeIPFamilyAny {
+		return "", fmt.Errorf("node %s has no %s %s address (NODE_IP_TYPE=%s, NODE_IP_FAMILY=%s)", node.Name, family, addressType, ipType, family)
+	}
+	return "", fmt.Errorf("node %s has no %s address (NODE_IP_TYPE=%s)", node.Name, addressType, ipType)
+}
+
+// nodeStatusByName returns the cached status of the named node, or NodeUnknown
+// when no node is selected or it isn't in the cache
+func nodeStatusByName(nodes []NodeInfo, name string) NodeStatus {
+	if name == "" {
+		return NodeUnknown
+	}
+	for _, node := range nodes {
+		if node.Name == name {
+			return node.Status
+		}
+	}
+	return NodeUnknown
+}
 
-	return ""
+// countHealthyNodes returns how many nodes in the list are healthy
+func countHealthyNodes(nodes []NodeInfo) int {
+	count := 0
+	for _, node := range nodes {
+		if node.Status == NodeHealthy {
+			count++
+		}
+	}
+	return count
 }
@@ -0,0 +1,81 @@
+package nodes
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultCheckInterval    = 15 * time.Second
+	defaultFailureThreshold = 3
+	defaultCacheTTL         = 2 * time.Minute
+)
+
+// healthCheckSettings controls how often the selected node is checked and how many
+// consecutive failures trigger a failover.
+type healthCheckSettings struct {
+	interval         time.Duration
+	failureThreshold int
+}
+
+// healthCheckSettingsFromEnv reads HEALTH_CHECK_INTERVAL (default 15s) and
+// FAILURE_THRESHOLD (default 3)
+func healthCheckSettingsFromEnv() (healthCheckSettings, error) {
+	interval, err := envDuration("HEALTH_CHECK_INTERVAL", defaultCheckInterval)
+	if err != nil {
+		return healthCheckSettings{}, err
+	}
+	if interval == 0 {
+		return healthCheckSettings{}, fmt.Errorf("invalid HEALTH_CHECK_INTERVAL value %q: must be positive", os.Getenv("HEALTH_CHECK_INTERVAL"))
+	}
+
+	threshold := defaultFailureThreshold
+	if value := os.Getenv("FAILURE_THRESHOLD"); value != "" {
+		threshold, err = strconv.Atoi(value)
+		if err != nil || threshold < 1 {
+			return healthCheckSettings{}, fmt.Errorf("invalid FAILURE_THRESHOLD value %q: must be an integer >= 1", value)
+		}
+	}
+
+	return healthCheckSettings{interval: interval, failureThreshold: threshold}, nil
+}
+
+// cacheTTLFromEnv reads CACHE_TTL (default 2m): how long the node list and the
+// selected node's IP are served from memory before the cluster is asked again.
+// 0 disables caching.
+func cacheTTLFromEnv() (time.Duration, error) {
+	return envDuration("CACHE_TTL", defaultCacheTTL)
+}
+
+// envDuration reads a non-negative duration from the environment, returning def when unset
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: %w", key, value, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid %s value %q: must not be negative", key, value)
+	}
+	return d, nil
+}
+
+// envBool reads a boolean from the environment, returning def when unset
+func envBool(key string, def bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q: must be true or false", key, value)
+	}
+	return b, nil
+}
@@ -0,0 +1,201 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestHealthCheckSettingsFromEnv(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		t.Setenv("HEALTH_CHECK_INTERVAL", "")
+		t.Setenv("FAILURE_THRESHOLD", "")
+
+		settings, err := healthCheckSettingsFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, 15*time.Second, settings.interval)
+		assert.Equal(t, 3, settings.failureThreshold)
+	})
+
+	t.Run("Configured", func(t *testing.T) {
+		t.Setenv("HEALTH_CHECK_INTERVAL", "45s")
+		t.Setenv("FAILURE_THRESHOLD", "5")
+
+		settings, err := healthCheckSettingsFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, 45*time.Second, settings.interval)
+		assert.Equal(t, 5, settings.failureThreshold)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, env := range []map[string]string{
+			{"HEALTH_CHECK_INTERVAL": "0s"},
+			{"HEALTH_CHECK_INTERVAL": "-5s"},
+			{"HEALTH_CHECK_INTERVAL": "soon"},
+			{"FAILURE_THRESHOLD": "0"},
+			{"FAILURE_THRESHOLD": "three"},
+		} {
+			t.Setenv("HEALTH_CHECK_INTERVAL", "")
+			t.Setenv("FAILURE_THRESHOLD", "")
+			for key, value := range env {
+				t.Setenv(key, value)
+			}
+			_, err := healthCheckSettingsFromEnv()
+			assert.Error(t, err, "expected error for %v", env)
+		}
+	})
+}
+
+// TestHandleNodeFailure_ConfiguredThreshold tests that failover happens after
+// FAILURE_THRESHOLD consecutive failures
+func TestHandleNodeFailure_ConfiguredThreshold(t *testing.T) {
+	t.Setenv("FAILURE_THRESHOLD", "2")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+	assert.Equal(t, 2, d.FailureThreshold())
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	setNodeReady(t, clientset, "node-1", false)
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName(), "one failure is below the threshold")
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName(), "second failure should trigger failover")
+}
+
+func TestNodeAddress(t *testing.T) {
+	node := *newTestNode("node-1", "10.0.1.1", true, time.Now())
+
+	ip, err := nodeAddress(node, nodeIPInternal, nodeIPFamilyAny)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip)
+
+	_, err = nodeAddress(node, nodeIPExternal, nodeIPFamilyAny)
+	assert.ErrorContains(t, err, "node node-1 has no ExternalIP address")
+
+	node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeExternalIP, Address: "203.0.113.1"})
+	ip, err = nodeAddress(node, nodeIPExternal, nodeIPFamilyAny)
+	require.NoError(t, err)
+	assert.Equal(t, "203.0.113.1", ip)
+
+	// Dual-stack nodes list an address per family
+	node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{Type: corev1.NodeInternalIP, Address: "fd00::1"})
+	ip, err = nodeAddress(node, nodeIPInternal, nodeIPFamilyAny)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip, "the first address is used without NODE_IP_FAMILY")
+	ip, err = nodeAddress(node, nodeIPInternal, nodeIPFamilyIPv6)
+	require.NoError(t, err)
+	assert.Equal(t, "fd00::1", ip)
+	ip, err = nodeAddress(node, nodeIPInternal, nodeIPFamilyIPv4)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip)
+
+	_, err = nodeAddress(node, nodeIPExternal, nodeIPFamilyIPv6)
+	assert.ErrorContains(t, err, "node node-1 has no ipv6 ExternalIP address")
+}
+
+func TestNodeIPFamilyFromEnv(t *testing.T) {
+	for value, want := range map[string]nodeIPFamily{"": nodeIPFamilyAny, "ipv4": nodeIPFamilyIPv4, "IPv6": nodeIPFamilyIPv6} {
+		t.Setenv("NODE_IP_FAMILY", value)
+		family, err := nodeIPFamilyFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, want, family)
+	}
+
+	t.Setenv("NODE_IP_FAMILY", "dual")
+	_, err := nodeIPFamilyFromEnv()
+	assert.Error(t, err)
+}
+
+// countNodeLists returns how many times the nodes were listed through clientset
+func countNodeLists(clientset *fake.Clientset) int {
+	lists := 0
+	for _, action := range clientset.Actions() {
+		if action.Matches("list", "nodes") {
+			lists++
+		}
+	}
+	return lists
+}
+
+// allNodesGetter is the part of each platform's discovery exercised by TestCacheTTL
+type allNodesGetter interface {
+	GetAllNodes(ctx context.Context) ([]NodeInfo, error)
+}
+
+// TestCacheTTL tests that GetAllNodes serves the node list from memory for
+// CACHE_TTL, on each platform that caches it
+func TestCacheTTL(t *testing.T) {
+	platforms := map[string]func(t *testing.T, clientset *fake.Clientset) allNodesGetter{
+		"Generic": func(t *testing.T, clientset *fake.Clientset) allNodesGetter {
+			return newTestGenericDiscovery(t, clientset)
+		},
+		"EKS": func(t *testing.T, clientset *fake.Clientset) allNodesGetter {
+			d, err := NewEKSNodeDiscovery("us-west-2", "test-cluster", clientset)
+			require.NoError(t, err)
+			t.Cleanup(d.cancel)
+			return d
+		},
+	}
+
+	for name, newDiscovery := range platforms {
+		t.Run(name+"/Cached", func(t *testing.T) {
+			t.Setenv("CACHE_TTL", "1h")
+			clientset := fake.NewClientset(newTestNode("node-1", "10.0.1.1", true, time.Now()))
+			d := newDiscovery(t, clientset)
+
+			first, err := d.GetAllNodes(context.Background())
+			require.NoError(t, err)
+			require.Len(t, first, 1)
+
+			_, err = clientset.CoreV1().Nodes().Create(context.Background(), newTestNode("node-2", "10.0.1.2", true, time.Now()), metav1.CreateOptions{})
+			require.NoError(t, err)
+
+			second, err := d.GetAllNodes(context.Background())
+			require.NoError(t, err)
+			assert.Len(t, second, 1, "the new node is not seen until the cache expires")
+			assert.Equal(t, 1, countNodeLists(clientset))
+		})
+
+		t.Run(name+"/Disabled", func(t *testing.T) {
+			t.Setenv("CACHE_TTL", "0s")
+			clientset := fake.NewClientset(newTestNode("node-1", "10.0.1.1", true, time.Now()))
+			d := newDiscovery(t, clientset)
+
+			_, err := d.GetAllNodes(context.Background())
+			require.NoError(t, err)
+			_, err = d.GetAllNodes(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 2, countNodeLists(clientset))
+		})
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		t.Setenv("CACHE_TTL", "")
+		ttl, err := cacheTTLFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Minute, ttl)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("CACHE_TTL", "-1m")
+		_, err := cacheTTLFromEnv()
+		assert.Error(t, err)
+	})
+}
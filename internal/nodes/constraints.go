@@ -0,0 +1,64 @@
+package nodes
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// selectionConstraints narrow node selection beyond health: nodes past
+// MAX_NODE_AGE are avoided so old nodes can be rotated out, and no node is
+// selected while fewer than MIN_HEALTHY_NODES are healthy.
+type selectionConstraints struct {
+	maxAge     time.Duration
+	minHealthy int
+}
+
+// selectionConstraintsFromEnv reads MAX_NODE_AGE (0 disables the limit) and
+// MIN_HEALTHY_NODES (default 0, no minimum)
+func selectionConstraintsFromEnv() (selectionConstraints, error) {
+	var c selectionConstraints
+	var err error
+	if c.maxAge, err = envDuration("MAX_NODE_AGE", 0); err != nil {
+		return c, err
+	}
+	if value := os.Getenv("MIN_HEALTHY_NODES"); value != "" {
+		c.minHealthy, err = strconv.Atoi(value)
+		if err != nil || c.minHealthy < 0 {
+			return c, fmt.Errorf("invalid MIN_HEALTHY_NODES value %q: must be a non-negative integer", value)
+		}
+	}
+	return c, nil
+}
+
+// eligible returns nodes without the healthy ones older than maxAge, as long
+// as a younger healthy node remains; otherwise old nodes stay selectable
+func (c selectionConstraints) eligible(nodes []NodeInfo) []NodeInfo {
+	if c.maxAge <= 0 {
+		return nodes
+	}
+	var eligible []NodeInfo
+	youngHealthy := false
+	for _, node := range nodes {
+		if node.Status == NodeHealthy && node.Age > c.maxAge {
+			continue
+		}
+		youngHealthy = youngHealthy || node.Status == NodeHealthy
+		eligible = append(eligible, node)
+	}
+	if !youngHealthy {
+		return nodes
+	}
+	return eligible
+}
+
+// tooFewHealthy returns an error when nodes has fewer healthy nodes than
+// MIN_HEALTHY_NODES requires
+func (c selectionConstraints) tooFewHealthy(nodes []NodeInfo) error {
+	healthy := len(healthyByAge(nodes))
+	if healthy >= c.minHealthy {
+		return nil
+	}
+	return fmt.Errorf("%w: %d of %d required (MIN_HEALTHY_NODES)", ErrTooFewHealthyNodes, healthy, c.minHealthy)
+}
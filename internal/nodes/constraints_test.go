@@ -0,0 +1,85 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSelectionConstraintsFromEnv(t *testing.T) {
+	t.Setenv("MAX_NODE_AGE", "168h")
+	t.Setenv("MIN_HEALTHY_NODES", "2")
+	c, err := selectionConstraintsFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, selectionConstraints{maxAge: 168 * time.Hour, minHealthy: 2}, c)
+
+	t.Setenv("MIN_HEALTHY_NODES", "-1")
+	_, err = selectionConstraintsFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("MIN_HEALTHY_NODES", "")
+	t.Setenv("MAX_NODE_AGE", "7 days")
+	_, err = selectionConstraintsFromEnv()
+	assert.Error(t, err)
+}
+
+// TestKubeNodeDiscovery_MaxNodeAge tests that nodes older than MAX_NODE_AGE are
+// skipped while a younger healthy node exists, and used when none does
+func TestKubeNodeDiscovery_MaxNodeAge(t *testing.T) {
+	t.Setenv("MAX_NODE_AGE", "72h")
+	now := time.Now()
+
+	clientset := fake.NewClientset(
+		newTestNode("node-ancient", "10.0.1.1", true, now.Add(-30*24*time.Hour)),
+		newTestNode("node-old", "10.0.1.2", true, now.Add(-48*time.Hour)),
+		newTestNode("node-new", "10.0.1.3", true, now.Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.2", ip, "the oldest node within MAX_NODE_AGE is selected")
+
+	// Failing over from it still skips the node past the limit
+	_, err = d.TriggerFailover()
+	require.NoError(t, err)
+	assert.Equal(t, "node-new", d.GetCurrentNodeName())
+
+	// With only old nodes healthy, the age limit gives way
+	only := newTestGenericDiscovery(t, fake.NewClientset(
+		newTestNode("node-ancient", "10.0.1.1", true, now.Add(-30*24*time.Hour)),
+		newTestNode("node-new", "10.0.1.3", false, now.Add(-time.Hour)),
+	))
+	ip, err = only.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip)
+}
+
+// TestKubeNodeDiscovery_MinHealthyNodes tests that no node is selected until
+// MIN_HEALTHY_NODES nodes are healthy
+func TestKubeNodeDiscovery_MinHealthyNodes(t *testing.T) {
+	t.Setenv("MIN_HEALTHY_NODES", "2")
+	now := time.Now()
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, now.Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", false, now.Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.ErrorIs(t, err, ErrTooFewHealthyNodes)
+	assert.Contains(t, err.Error(), "1 of 2 required")
+	assert.Equal(t, ReasonTooFewHealthyNodes, d.GetUnavailableReason())
+	assert.Empty(t, d.GetCurrentNodeName())
+
+	setNodeReady(t, clientset, "node-2", true)
+	_, err = d.Rediscover(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+	assert.Empty(t, d.GetUnavailableReason())
+}
@@ -1,22 +1,12 @@
 package nodes
 
 import (
-	"context"
-	"encoding/base64"
 	"fmt"
-	"net/http"
-	"sort"
-	"sync"
 	"time"
 
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/container/v1"
-	"google.golang.org/api/option"
-	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s-node-proxy/internal/services"
+
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 )
 
 type NodeStatus int
@@ -27,6 +17,17 @@ const (
 	NodeUnknown
 )
 
+func (s NodeStatus) String() string {
+	switch s {
+	case NodeHealthy:
+		return "healthy"
+	case NodeUnhealthy:
+		return "unhealthy"
+	default:
+		return "unknown"
+	}
+}
+
 type NodeInfo struct {
 	Name         string
 	IP           string
@@ -34,355 +35,37 @@ type NodeInfo struct {
 	Age          time.Duration
 	CreationTime time.Time
 	LastCheck    time.Time
+	// Labels are the node's Kubernetes labels
+	Labels map[string]string
 }
 
+// NodeDiscovery implements node discovery for GKE clusters
 type NodeDiscovery struct {
-	projectID       string
-	containerSvc    *container.Service
-	k8sClientset    *kubernetes.Clientset
-	cachedIP        string
-	cachedNodes     []NodeInfo
-	currentNodeName string
-	cacheTime       time.Time
-	cacheTTL        time.Duration
-	mutex           sync.RWMutex
+	*KubeNodeDiscovery
 
-	// Health monitoring
-	failureCount     int
-	failureThreshold int
-	checkInterval    time.Duration
-	ctx              context.Context
-	cancel           context.CancelFunc
+	projectID string
 }
 
-func New(projectID string) (*NodeDiscovery, error) {
-	ctx := context.Background()
-
-	containerSvc, err := container.NewService(ctx, option.WithScopes(container.CloudPlatformScope))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create container service: %w", err)
-	}
-
-	// Build Kubernetes config
-	config, _, err := buildK8sConfig(ctx, containerSvc, projectID)
+// New creates a GKE node discovery on the preferred clusters, which it shares
+// with NodePort discovery so both fail over together. Unlike the EKS and
+// generic discoveries, it keeps serving the oldest node when none is healthy.
+func New(projectID string, clusters *services.GKEClusters) (*NodeDiscovery, error) {
+	cfg, err := kubeDiscoveryConfigFromEnv()
 	if err != nil {
-		return nil, fmt.Errorf("failed to build K8s config: %w", err)
+		return nil, err
 	}
 
-	k8sClientset, err := kubernetes.NewForConfig(config)
+	k8sClientset, err := kubernetes.NewForConfig(clusters.RestConfig())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create K8s clientset: %w", err)
 	}
 
-	monitorCtx, cancel := context.WithCancel(context.Background())
+	d := newKubeNodeDiscovery(k8sClientset, "gke", cfg)
+	// GKE has always kept forwarding to the oldest node when none is healthy
+	d.serveUnhealthy = true
 
 	return &NodeDiscovery{
-		projectID:        projectID,
-		containerSvc:     containerSvc,
-		k8sClientset:     k8sClientset,
-		cacheTTL:         2 * time.Minute,
-		failureThreshold: 3,
-		checkInterval:    15 * time.Second,
-		ctx:              monitorCtx,
-		cancel:           cancel,
+		KubeNodeDiscovery: d,
+		projectID:         projectID,
 	}, nil
 }
-
-func (d *NodeDiscovery) GetCurrentNodeIP(ctx context.Context) (string, error) {
-	d.mutex.RLock()
-	if d.cachedIP != "" && time.Since(d.cacheTime) < d.cacheTTL {
-		ip := d.cachedIP
-		d.mutex.RUnlock()
-		return ip, nil
-	}
-	d.mutex.RUnlock()
-
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-
-	if d.cachedIP != "" && time.Since(d.cacheTime) < d.cacheTTL {
-		return d.cachedIP, nil
-	}
-
-	ip, err := d.discoverNodeIP(ctx)
-	if err != nil {
-		return "", err
-	}
-
-	d.cachedIP = ip
-	d.cacheTime = time.Now()
-	return ip, nil
-}
-
-func (d *NodeDiscovery) discoverNodeIP(ctx context.Context) (string, error) {
-	nodeInfos, err := d.getAllNodesWithMetadata(ctx)
-	if err != nil {
-		return "", err
-	}
-
-	if len(nodeInfos) == 0 {
-		return "", fmt.Errorf("no nodes found in cluster")
-	}
-
-	oldestNode := d.findOldestHealthyNode(nodeInfos)
-	if oldestNode == nil {
-		oldestNode = &nodeInfos[0]
-	}
-
-	d.mutex.Lock()
-	d.cachedNodes = nodeInfos
-	d.currentNodeName = oldestNode.Name
-	d.mutex.Unlock()
-
-	return oldestNode.IP, nil
-}
-
-func (d *NodeDiscovery) getAllNodesWithMetadata(ctx context.Context) ([]NodeInfo, error) {
-	nodes, err := d.k8sClientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list nodes: %w", err)
-	}
-
-	var nodeInfos []NodeInfo
-	now := time.Now()
-
-	for _, node := range nodes.Items {
-		nodeIP := getNodeInternalIP(node)
-		if nodeIP == "" {
-			continue
-		}
-
-		status := getNodeStatus(node)
-
-		nodeInfo := NodeInfo{
-			Name:         node.Name,
-			IP:           nodeIP,
-			Status:       status,
-			Age:          now.Sub(node.CreationTimestamp.Time),
-			CreationTime: node.CreationTimestamp.Time,
-			LastCheck:    now,
-		}
-
-		nodeInfos = append(nodeInfos, nodeInfo)
-	}
-
-	sort.Slice(nodeInfos, func(i, j int) bool {
-		return nodeInfos[i].CreationTime.Before(nodeInfos[j].CreationTime)
-	})
-
-	return nodeInfos, nil
-}
-
-func (d *NodeDiscovery) findOldestHealthyNode(nodes []NodeInfo) *NodeInfo {
-	for i := range nodes {
-		if nodes[i].Status == NodeHealthy {
-			return &nodes[i]
-		}
-	}
-	return nil
-}
-
-func (d *NodeDiscovery) GetAllNodes(ctx context.Context) ([]NodeInfo, error) {
-	d.mutex.RLock()
-	if len(d.cachedNodes) > 0 && time.Since(d.cacheTime) < d.cacheTTL {
-		nodes := make([]NodeInfo, len(d.cachedNodes))
-		copy(nodes, d.cachedNodes)
-		d.mutex.RUnlock()
-		return nodes, nil
-	}
-	d.mutex.RUnlock()
-
-	nodes, err := d.getAllNodesWithMetadata(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	d.mutex.Lock()
-	d.cachedNodes = nodes
-	d.cacheTime = time.Now()
-	d.mutex.Unlock()
-
-	return nodes, nil
-}
-
-func findOldestNode(nodes []corev1.Node) corev1.Node {
-	if len(nodes) == 0 {
-		return corev1.Node{}
-	}
-
-	sort.Slice(nodes, func(i, j int) bool {
-		return nodes[i].CreationTimestamp.Before(&nodes[j].CreationTimestamp)
-	})
-
-	return nodes[0]
-}
-
-func buildK8sConfig(ctx context.Context, containerSvc *container.Service, projectID string) (*rest.Config, interface{}, error) {
-	clusters, err := containerSvc.Projects.Locations.Clusters.List(
-		fmt.Sprintf("projects/%s/locations/-", projectID)).Context(ctx).Do()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list clusters: %w", err)
-	}
-
-	if len(clusters.Clusters) == 0 {
-		return nil, nil, fmt.Errorf("no clusters found in project %s", projectID)
-	}
-
-	cluster := clusters.Clusters[0]
-
-	if cluster.PrivateClusterConfig == nil || cluster.PrivateClusterConfig.PrivateEndpoint == "" {
-		return nil, nil, fmt.Errorf("cluster %s does not have a private endpoint configured", cluster.Name)
-	}
-	endpoint := cluster.PrivateClusterConfig.PrivateEndpoint
-	fmt.Printf("Using private cluster endpoint: %s\n", endpoint)
-
-	caCert, err := base64.StdEncoding.DecodeString(cluster.MasterAuth.ClusterCaCertificate)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to decode cluster CA certificate: %w", err)
-	}
-
-	tokenSource, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get default token source: %w", err)
-	}
-
-	config := &rest.Config{
-		Host: "https://" + endpoint,
-		TLSClientConfig: rest.TLSClientConfig{
-			CAData: caCert,
-		},
-		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
-			return &oauth2.Transport{
-				Source: tokenSource,
-				Base:   rt,
-			}
-		},
-	}
-
-	return config, nil, nil
-}
-
-func (d *NodeDiscovery) StartHealthMonitoring() {
-	go d.healthMonitorLoop()
-}
-
-func (d *NodeDiscovery) StopHealthMonitoring() {
-	if d.cancel != nil {
-		d.cancel()
-	}
-}
-
-func (d *NodeDiscovery) healthMonitorLoop() {
-	ticker := time.NewTicker(d.checkInterval)
-	defer ticker.Stop()
-	defer fmt.Println("Health monitoring stopped")
-
-	for {
-		select {
-		case <-d.ctx.Done():
-			fmt.Println("Health monitoring received stop signal")
-			return
-		case <-ticker.C:
-			d.performHealthCheck()
-		}
-	}
-}
-
-func (d *NodeDiscovery) performHealthCheck() {
-	d.mutex.RLock()
-	currentNodeName := d.currentNodeName
-	d.mutex.RUnlock()
-
-	if currentNodeName == "" {
-		return
-	}
-
-	now := time.Now()
-	isHealthy := d.isCurrentNodeHealthy(currentNodeName)
-
-	d.updateCurrentNodeLastCheck(currentNodeName, now, isHealthy)
-
-	if isHealthy {
-		d.mutex.Lock()
-		d.failureCount = 0
-		d.mutex.Unlock()
-	} else {
-		d.handleNodeFailure()
-	}
-}
-
-func (d *NodeDiscovery) updateCurrentNodeLastCheck(nodeName string, lastCheck time.Time, isHealthy bool) {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-
-	for i := range d.cachedNodes {
-		if d.cachedNodes[i].Name == nodeName {
-			d.cachedNodes[i].LastCheck = lastCheck
-			if isHealthy {
-				d.cachedNodes[i].Status = NodeHealthy
-			} else {
-				d.cachedNodes[i].Status = NodeUnhealthy
-			}
-			break
-		}
-	}
-}
-
-func (d *NodeDiscovery) isCurrentNodeHealthy(nodeName string) bool {
-	node, err := d.k8sClientset.CoreV1().Nodes().Get(d.ctx, nodeName, metav1.GetOptions{})
-	if err != nil {
-		fmt.Printf("Failed to get node %s: %v\n", nodeName, err)
-		return false
-	}
-
-	for _, condition := range node.Status.Conditions {
-		if condition.Type == corev1.NodeReady {
-			return condition.Status == corev1.ConditionTrue
-		}
-	}
-	return false
-}
-
-func (d *NodeDiscovery) handleNodeFailure() {
-	d.mutex.Lock()
-	defer d.mutex.Unlock()
-
-	d.failureCount++
-	fmt.Printf("Node health check failed (%d/%d)\n", d.failureCount, d.failureThreshold)
-
-	if d.failureCount >= d.failureThreshold {
-		fmt.Printf("Node %s failed %d consecutive health checks, initiating failover\n",
-			d.currentNodeName, d.failureThreshold)
-		d.performFailover()
-		d.failureCount = 0
-	}
-}
-
-func (d *NodeDiscovery) performFailover() {
-	d.cachedIP = ""
-	d.cacheTime = time.Time{}
-
-	nodes, err := d.getAllNodesWithMetadata(d.ctx)
-	if err != nil {
-		fmt.Printf("Failed to get nodes for failover: %v\n", err)
-		return
-	}
-
-	for _, node := range nodes {
-		if node.Name != d.currentNodeName && node.Status == NodeHealthy {
-			d.cachedIP = node.IP
-			d.currentNodeName = node.Name
-			d.cacheTime = time.Now()
-			fmt.Printf("Failover completed: switched to node %s (%s)\n", node.Name, node.IP)
-			return
-		}
-	}
-
-	fmt.Printf("Warning: No healthy nodes found for failover\n")
-}
-
-func (d *NodeDiscovery) GetCurrentNodeName() string {
-	d.mutex.RLock()
-	defer d.mutex.RUnlock()
-	return d.currentNodeName
-}
@@ -0,0 +1,73 @@
+package nodes
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// NodeEventType identifies what happened to the node selection
+type NodeEventType string
+
+const (
+	// NodeSelected: a node was selected, initially or by rotation or rebalancing
+	NodeSelected NodeEventType = "node_selected"
+	// NodeFailover: the selected node failed its health checks and was replaced
+	NodeFailover NodeEventType = "node_failover"
+	// NodeRecovered: the selected node passed a health check after failing some
+	NodeRecovered NodeEventType = "node_recovered"
+	// NodeIPChanged: the selected node kept its name but got a new IP
+	NodeIPChanged NodeEventType = "node_ip_changed"
+)
+
+// NodeEvent describes a change to the node selection. OldNode and OldIP are
+// empty for the first selection; for NodeRecovered and NodeIPChanged both
+// names are the selected node. OldIP is the address traffic went to before the
+// change, so it is the one to drain.
+type NodeEvent struct {
+	Type    NodeEventType
+	OldNode string
+	NewNode string
+	OldIP   string
+	NewIP   string
+	Time    time.Time
+}
+
+// nodeEventBuffer is how many undelivered events a subscriber may fall behind by
+// before further events are dropped
+const nodeEventBuffer = 16
+
+// nodeEvents fans node events out to subscribers. Sends never block: a
+// subscriber whose buffer is full misses the event, so a slow consumer cannot
+// stall health checks or failover. The zero value is ready to use.
+type nodeEvents struct {
+	mu          sync.Mutex
+	subscribers []chan NodeEvent
+}
+
+// subscribe returns a new channel receiving every subsequent event
+func (e *nodeEvents) subscribe() <-chan NodeEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ch := make(chan NodeEvent, nodeEventBuffer)
+	e.subscribers = append(e.subscribers, ch)
+	return ch
+}
+
+// emit stamps event with the current time and sends it to every subscriber,
+// dropping it for full ones
+func (e *nodeEvents) emit(event NodeEvent) {
+	event.Time = time.Now()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+			slog.Warn("Dropped node event, subscriber is not keeping up", "type", event.Type, "new_node", event.NewNode)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// nextEvent returns the next event from events, failing the test if none arrives
+func nextEvent(t *testing.T, events <-chan NodeEvent) NodeEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Expected a node event")
+		return NodeEvent{}
+	}
+}
+
+// TestNodeEvents_Failover tests that three failed health checks emit a
+// NodeFailover event naming the old and new node and their addresses
+func TestNodeEvents_Failover(t *testing.T) {
+	t.Setenv("FAILURE_THRESHOLD", "3")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+	events := d.Subscribe()
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+
+	selected := nextEvent(t, events)
+	assert.Equal(t, NodeSelected, selected.Type)
+	assert.Equal(t, "", selected.OldNode)
+	assert.Equal(t, "node-1", selected.NewNode)
+
+	setNodeReady(t, clientset, "node-1", false)
+	for range 3 {
+		d.performHealthCheck()
+	}
+
+	failover := nextEvent(t, events)
+	assert.Equal(t, NodeFailover, failover.Type)
+	assert.Equal(t, "node-1", failover.OldNode)
+	assert.Equal(t, "node-2", failover.NewNode)
+	assert.Equal(t, "10.0.1.1", failover.OldIP)
+	assert.Equal(t, "10.0.1.2", failover.NewIP)
+	assert.False(t, failover.Time.IsZero())
+}
+
+// TestNodeEvents_Recovered tests that a node passing a check after failing some
+// emits NodeRecovered
+func TestNodeEvents_Recovered(t *testing.T) {
+	t.Setenv("FAILURE_THRESHOLD", "3")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(newTestNode("node-1", "10.0.1.1", true, time.Now()))
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	events := d.Subscribe()
+
+	setNodeReady(t, clientset, "node-1", false)
+	d.performHealthCheck()
+	setNodeReady(t, clientset, "node-1", true)
+	d.performHealthCheck()
+
+	recovered := nextEvent(t, events)
+	assert.Equal(t, NodeRecovered, recovered.Type)
+	assert.Equal(t, "node-1", recovered.NewNode)
+}
+
+// TestNodeEvents_DropWhenFull tests that emitting never blocks on a subscriber
+// that is not reading
+func TestNodeEvents_DropWhenFull(t *testing.T) {
+	var e nodeEvents
+	events := e.subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for range nodeEventBuffer + 5 {
+			e.emit(NodeEvent{Type: NodeSelected, OldNode: "node-1", NewNode: "node-2"})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("emit blocked on a full subscriber")
+	}
+	assert.Len(t, events, nodeEventBuffer)
+}
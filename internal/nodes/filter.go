@@ -0,0 +1,112 @@
+package nodes
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// defaultDrainAnnotation marks nodes to avoid when DRAIN_ANNOTATION is unset
+const defaultDrainAnnotation = "nodeproxy.io/drain"
+
+// Role labels marking control-plane nodes; "master" is the pre-1.20 kubeadm label
+var controlPlaneLabels = []string{
+	"node-role.kubernetes.io/control-plane",
+	"node-role.kubernetes.io/master",
+}
+
+// nodeFilter decides which cluster nodes are eligible for selection, before
+// their health is looked at.
+type nodeFilter struct {
+	// Control-plane nodes often don't run the pods backing NodePort services
+	allowControlPlane bool
+
+	// Cordoned nodes are still Ready but being drained by an operator
+	respectUnschedulable bool
+
+	// labelSelector restricts selection to a node pool (NODE_LABEL_SELECTOR); nil matches all nodes
+	labelSelector labels.Selector
+
+	// Nodes annotated with drainAnnotation=true are avoided ahead of cordoning (DRAIN_ANNOTATION)
+	drainAnnotation string
+}
+
+// nodeFilterFromEnv reads ALLOW_CONTROL_PLANE_NODES (default false),
+// RESPECT_UNSCHEDULABLE (default true), NODE_LABEL_SELECTOR (default all nodes)
+// and DRAIN_ANNOTATION (default nodeproxy.io/drain)
+func nodeFilterFromEnv() (nodeFilter, error) {
+	allowControlPlane, err := envBool("ALLOW_CONTROL_PLANE_NODES", false)
+	if err != nil {
+		return nodeFilter{}, err
+	}
+
+	respectUnschedulable, err := envBool("RESPECT_UNSCHEDULABLE", true)
+	if err != nil {
+		return nodeFilter{}, err
+	}
+
+	var labelSelector labels.Selector
+	if value := os.Getenv("NODE_LABEL_SELECTOR"); value != "" {
+		labelSelector, err = labels.Parse(value)
+		if err != nil {
+			return nodeFilter{}, fmt.Errorf("invalid NODE_LABEL_SELECTOR value %q: %w", value, err)
+		}
+	}
+
+	drainAnnotation := defaultDrainAnnotation
+	if value := strings.TrimSpace(os.Getenv("DRAIN_ANNOTATION")); value != "" {
+		if errs := validation.IsQualifiedName(value); len(errs) > 0 {
+			return nodeFilter{}, fmt.Errorf("invalid DRAIN_ANNOTATION value %q: %s", value, strings.Join(errs, "; "))
+		}
+		drainAnnotation = value
+	}
+
+	return nodeFilter{
+		allowControlPlane:    allowControlPlane,
+		respectUnschedulable: respectUnschedulable,
+		labelSelector:        labelSelector,
+		drainAnnotation:      drainAnnotation,
+	}, nil
+}
+
+// listOptions returns the options for listing candidate nodes, pushing the label
+// selector down to the API server
+func (f nodeFilter) listOptions() metav1.ListOptions {
+	timeout := apiListTimeoutSeconds
+	options := metav1.ListOptions{TimeoutSeconds: &timeout}
+	if f.labelSelector != nil {
+		options.LabelSelector = f.labelSelector.String()
+	}
+	return options
+}
+
+// excludes reports whether node must never be selected. The health checks also
+// use it, so a selected node that is cordoned, marked for drain, or relabelled
+// out of the pool, is treated as unhealthy.
+func (f nodeFilter) excludes(node corev1.Node) bool {
+	if !f.allowControlPlane && isControlPlaneNode(node) {
+		return true
+	}
+	if f.labelSelector != nil && !f.labelSelector.Matches(labels.Set(node.Labels)) {
+		return true
+	}
+	if f.drainAnnotation != "" && node.Annotations[f.drainAnnotation] == "true" {
+		return true
+	}
+	return f.respectUnschedulable && node.Spec.Unschedulable
+}
+
+// isControlPlaneNode reports whether node carries a control-plane role label
+func isControlPlaneNode(node corev1.Node) bool {
+	for _, label := range controlPlaneLabels {
+		if _, ok := node.Labels[label]; ok {
+			return true
+		}
+	}
+	return false
+}
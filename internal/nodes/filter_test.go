@@ -0,0 +1,330 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newControlPlaneNode builds a ready node carrying the given control-plane role label
+func newControlPlaneNode(name, internalIP, roleLabel string, created time.Time) *corev1.Node {
+	node := newTestNode(name, internalIP, true, created)
+	node.Labels = map[string]string{roleLabel: ""}
+	return node
+}
+
+func TestNodeFilter_Excludes(t *testing.T) {
+	worker := *newTestNode("worker", "10.0.1.1", true, time.Now())
+	controlPlane := *newControlPlaneNode("cp", "10.0.1.2", "node-role.kubernetes.io/control-plane", time.Now())
+	master := *newControlPlaneNode("master", "10.0.1.3", "node-role.kubernetes.io/master", time.Now())
+
+	filter := nodeFilter{}
+	assert.False(t, filter.excludes(worker))
+	assert.True(t, filter.excludes(controlPlane))
+	assert.True(t, filter.excludes(master))
+
+	filter = nodeFilter{allowControlPlane: true}
+	assert.False(t, filter.excludes(controlPlane))
+	assert.False(t, filter.excludes(master))
+}
+
+func TestNodeFilterFromEnv(t *testing.T) {
+	t.Setenv("ALLOW_CONTROL_PLANE_NODES", "")
+	filter, err := nodeFilterFromEnv()
+	require.NoError(t, err)
+	assert.False(t, filter.allowControlPlane)
+
+	t.Setenv("ALLOW_CONTROL_PLANE_NODES", "true")
+	filter, err = nodeFilterFromEnv()
+	require.NoError(t, err)
+	assert.True(t, filter.allowControlPlane)
+
+	t.Setenv("ALLOW_CONTROL_PLANE_NODES", "sometimes")
+	_, err = nodeFilterFromEnv()
+	assert.Error(t, err)
+}
+
+// TestControlPlaneNodesSkipped tests that an oldest-healthy control-plane node
+// loses to a worker unless ALLOW_CONTROL_PLANE_NODES=true
+func TestControlPlaneNodesSkipped(t *testing.T) {
+	newClientset := func() *fake.Clientset {
+		return fake.NewClientset(
+			newControlPlaneNode("cp-1", "10.0.0.1", "node-role.kubernetes.io/control-plane", time.Now().Add(-72*time.Hour)),
+			newControlPlaneNode("master-1", "10.0.0.2", "node-role.kubernetes.io/master", time.Now().Add(-48*time.Hour)),
+			newTestNode("worker-1", "10.0.1.1", true, time.Now().Add(-time.Hour)),
+		)
+	}
+
+	t.Run("Generic", func(t *testing.T) {
+		d := newTestGenericDiscovery(t, newClientset())
+
+		ip, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "worker-1", d.GetCurrentNodeName())
+		assert.Equal(t, "10.0.1.1", ip)
+
+		nodes, err := d.GetAllNodes(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, nodes, 1, "control-plane nodes should not be listed")
+	})
+
+	t.Run("EKS", func(t *testing.T) {
+		d, err := NewEKSNodeDiscovery("us-west-2", "test-cluster", newClientset())
+		require.NoError(t, err)
+		t.Cleanup(d.cancel)
+
+		ip, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "worker-1", d.GetCurrentNodeName())
+		assert.Equal(t, "10.0.1.1", ip)
+	})
+
+	t.Run("OnlyControlPlaneNodes", func(t *testing.T) {
+		d := newTestGenericDiscovery(t, fake.NewClientset(
+			newControlPlaneNode("cp-1", "10.0.0.1", "node-role.kubernetes.io/control-plane", time.Now()),
+		))
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		assert.ErrorIs(t, err, ErrNoNodes)
+	})
+
+	t.Run("Allowed", func(t *testing.T) {
+		t.Setenv("ALLOW_CONTROL_PLANE_NODES", "true")
+		d := newTestGenericDiscovery(t, newClientset())
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "cp-1", d.GetCurrentNodeName())
+	})
+}
+
+// setNodeUnschedulable cordons or uncordons a node in the fake clientset
+func setNodeUnschedulable(t *testing.T, clientset *fake.Clientset, name string, unschedulable bool) {
+	t.Helper()
+
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	node.Spec.Unschedulable = unschedulable
+	_, err = clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+	require.NoError(t, err)
+}
+
+// TestCordonedNodesSkipped tests that a cordoned oldest node loses to an uncordoned
+// one unless RESPECT_UNSCHEDULABLE=false
+func TestCordonedNodesSkipped(t *testing.T) {
+	newClientset := func() *fake.Clientset {
+		cordoned := newTestNode("node-cordoned", "10.0.1.1", true, time.Now().Add(-48*time.Hour))
+		cordoned.Spec.Unschedulable = true
+		return fake.NewClientset(
+			cordoned,
+			newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+		)
+	}
+
+	t.Run("Respected", func(t *testing.T) {
+		d := newTestGenericDiscovery(t, newClientset())
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "node-2", d.GetCurrentNodeName())
+	})
+
+	t.Run("Ignored", func(t *testing.T) {
+		t.Setenv("RESPECT_UNSCHEDULABLE", "false")
+		d := newTestGenericDiscovery(t, newClientset())
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "node-cordoned", d.GetCurrentNodeName())
+	})
+}
+
+// TestCordonedCurrentNodeFailsOver tests that cordoning the selected node fails over
+// like an unhealthy node would
+func TestCordonedCurrentNodeFailsOver(t *testing.T) {
+	t.Setenv("FAILURE_THRESHOLD", "1")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	setNodeUnschedulable(t, clientset, "node-1", true)
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+}
+
+// newPoolNode builds a ready node labelled with the given workload pool
+func newPoolNode(name, internalIP, pool string, created time.Time) *corev1.Node {
+	node := newTestNode(name, internalIP, true, created)
+	node.Labels = map[string]string{"workload": pool}
+	return node
+}
+
+// TestNodeLabelSelector tests that only nodes matching NODE_LABEL_SELECTOR are eligible
+func TestNodeLabelSelector(t *testing.T) {
+	newClientset := func() *fake.Clientset {
+		return fake.NewClientset(
+			newPoolNode("batch-1", "10.0.1.1", "batch", time.Now().Add(-72*time.Hour)),
+			newTestNode("unlabelled", "10.0.1.2", true, time.Now().Add(-48*time.Hour)),
+			newPoolNode("ingress-1", "10.0.1.3", "ingress", time.Now().Add(-24*time.Hour)),
+			newPoolNode("ingress-2", "10.0.1.4", "ingress", time.Now().Add(-time.Hour)),
+		)
+	}
+
+	t.Run("Generic", func(t *testing.T) {
+		t.Setenv("NODE_LABEL_SELECTOR", "workload=ingress")
+		d := newTestGenericDiscovery(t, newClientset())
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "ingress-1", d.GetCurrentNodeName())
+
+		nodes, err := d.GetAllNodes(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, nodes, 2)
+	})
+
+	t.Run("EKS", func(t *testing.T) {
+		t.Setenv("NODE_LABEL_SELECTOR", "workload in (ingress)")
+		d, err := NewEKSNodeDiscovery("us-west-2", "test-cluster", newClientset())
+		require.NoError(t, err)
+		t.Cleanup(d.cancel)
+
+		_, err = d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "ingress-1", d.GetCurrentNodeName())
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		t.Setenv("NODE_LABEL_SELECTOR", "")
+		d := newTestGenericDiscovery(t, newClientset())
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "batch-1", d.GetCurrentNodeName())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("NODE_LABEL_SELECTOR", "workload in ingress")
+		_, err := NewGenericNodeDiscovery(newClientset())
+		assert.ErrorContains(t, err, "NODE_LABEL_SELECTOR")
+	})
+}
+
+// TestRelabelledCurrentNodeFailsOver tests that the health check fails over when the
+// selected node no longer matches NODE_LABEL_SELECTOR
+func TestRelabelledCurrentNodeFailsOver(t *testing.T) {
+	t.Setenv("NODE_LABEL_SELECTOR", "workload=ingress")
+	t.Setenv("FAILURE_THRESHOLD", "1")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newPoolNode("ingress-1", "10.0.1.1", "ingress", time.Now().Add(-2*time.Hour)),
+		newPoolNode("ingress-2", "10.0.1.2", "ingress", time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "ingress-1", d.GetCurrentNodeName())
+
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), "ingress-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	node.Labels["workload"] = "batch"
+	_, err = clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	d.performHealthCheck()
+	assert.Equal(t, "ingress-2", d.GetCurrentNodeName())
+}
+
+// TestDrainAnnotatedNodesSkipped tests that an oldest node annotated for drain
+// loses to a younger one, with the default and a custom DRAIN_ANNOTATION
+func TestDrainAnnotatedNodesSkipped(t *testing.T) {
+	newClientset := func(annotation, value string) *fake.Clientset {
+		draining := newTestNode("node-draining", "10.0.1.1", true, time.Now().Add(-48*time.Hour))
+		draining.Annotations = map[string]string{annotation: value}
+		return fake.NewClientset(
+			draining,
+			newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+		)
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		d := newTestGenericDiscovery(t, newClientset("nodeproxy.io/drain", "true"))
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "node-2", d.GetCurrentNodeName())
+
+		nodes, err := d.GetAllNodes(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, nodes, 1, "nodes marked for drain should not be listed")
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		t.Setenv("DRAIN_ANNOTATION", "example.com/avoid")
+		d := newTestGenericDiscovery(t, newClientset("example.com/avoid", "true"))
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "node-2", d.GetCurrentNodeName())
+	})
+
+	t.Run("NotTrue", func(t *testing.T) {
+		d := newTestGenericDiscovery(t, newClientset("nodeproxy.io/drain", "false"))
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "node-draining", d.GetCurrentNodeName())
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("DRAIN_ANNOTATION", "not a key")
+		_, err := NewGenericNodeDiscovery(newClientset("nodeproxy.io/drain", "true"))
+		assert.ErrorContains(t, err, "DRAIN_ANNOTATION")
+	})
+}
+
+// TestDrainAnnotatedCurrentNodeFailsOver tests that annotating the selected node
+// for drain fails over like cordoning it would
+func TestDrainAnnotatedCurrentNodeFailsOver(t *testing.T) {
+	t.Setenv("FAILURE_THRESHOLD", "1")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	node.Annotations = map[string]string{"nodeproxy.io/drain": "true"}
+	_, err = clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+}
@@ -0,0 +1,43 @@
+package nodes
+
+import "time"
+
+// unhealthyGrace holds off acting on a selected node that has just turned
+// unhealthy until it has stayed unhealthy for grace, smoothing over brief
+// NotReady blips in node conditions. Its state is guarded by the owning
+// discovery's mutex.
+type unhealthyGrace struct {
+	grace time.Duration
+
+	// The node seen unhealthy and when it was first seen unhealthy
+	node  string
+	since time.Time
+}
+
+// unhealthyGraceFromEnv reads NODE_UNHEALTHY_GRACE (default 0: act on the first failed check)
+func unhealthyGraceFromEnv() (unhealthyGrace, error) {
+	grace, err := envDuration("NODE_UNHEALTHY_GRACE", 0)
+	if err != nil {
+		return unhealthyGrace{}, err
+	}
+	return unhealthyGrace{grace: grace}, nil
+}
+
+// pending records that node was seen unhealthy at now and reports whether it is
+// still within its grace window, in which case the failure is not counted
+func (g *unhealthyGrace) pending(node string, now time.Time) bool {
+	if g.grace <= 0 {
+		return false
+	}
+	if node != g.node {
+		g.node = node
+		g.since = now
+	}
+	return now.Sub(g.since) < g.grace
+}
+
+// clear ends the grace window once the node is seen healthy again
+func (g *unhealthyGrace) clear() {
+	g.node = ""
+	g.since = time.Time{}
+}
@@ -0,0 +1,78 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestUnhealthyGracePending(t *testing.T) {
+	now := time.Now()
+
+	g := unhealthyGrace{grace: time.Minute}
+	assert.True(t, g.pending("node-1", now), "first unhealthy sighting starts the window")
+	assert.True(t, g.pending("node-1", now.Add(30*time.Second)))
+	assert.False(t, g.pending("node-1", now.Add(time.Minute)), "window elapsed")
+
+	g.clear()
+	assert.True(t, g.pending("node-1", now.Add(2*time.Minute)), "recovery restarts the window")
+	assert.True(t, g.pending("node-2", now.Add(3*time.Minute)), "a different node gets its own window")
+
+	disabled := unhealthyGrace{}
+	assert.False(t, disabled.pending("node-1", now), "no grace by default")
+}
+
+// newGraceTestDiscovery returns a discovery serving the older of two healthy nodes
+// that fails over on the first counted failure
+func newGraceTestDiscovery(t *testing.T, grace string) (*GenericNodeDiscovery, *fake.Clientset) {
+	t.Helper()
+	t.Setenv("NODE_UNHEALTHY_GRACE", grace)
+	t.Setenv("FAILURE_THRESHOLD", "1")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+	return d, clientset
+}
+
+// TestUnhealthyGrace_Blip tests that a node NotReady for one check and then Ready
+// again does not fail over within the grace period
+func TestUnhealthyGrace_Blip(t *testing.T) {
+	d, clientset := newGraceTestDiscovery(t, "1h")
+
+	setNodeReady(t, clientset, "node-1", false)
+	d.performHealthCheck()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName(), "no failover within the grace period")
+	assert.Equal(t, 0, d.failureCount, "failures within the grace period are not counted")
+
+	setNodeReady(t, clientset, "node-1", true)
+	d.performHealthCheck()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+	assert.Equal(t, 0, d.failureCount)
+}
+
+// TestUnhealthyGrace_Elapsed tests that a node still unhealthy after the grace
+// period is failed over
+func TestUnhealthyGrace_Elapsed(t *testing.T) {
+	d, clientset := newGraceTestDiscovery(t, "50ms")
+
+	setNodeReady(t, clientset, "node-1", false)
+	d.performHealthCheck()
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	time.Sleep(60 * time.Millisecond)
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+}
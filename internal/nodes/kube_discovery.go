@@ -0,0 +1,1062 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s-node-proxy/internal/metrics"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// KubeNodeDiscovery selects a node to proxy to through the Kubernetes API,
+// health checks it and fails over. The platform discoveries (GKE, EKS and
+// generic) wrap it and differ only in how they build the clientset and in the
+// knobs below.
+type KubeNodeDiscovery struct {
+	k8sClientset kubernetes.Interface
+
+	// Names the platform in log messages
+	platform string
+
+	// Keep forwarding to the oldest node when none is healthy instead of failing
+	// the request; /health still reports ReasonNoHealthyNodes
+	serveUnhealthy bool
+
+	// Node selection and health monitoring. mutex guards the fields below and is
+	// never held across Kubernetes API calls.
+	mutex           sync.RWMutex
+	cachedNodes     []NodeInfo
+	cacheTime       time.Time
+	cacheTTL        time.Duration
+	currentNodeName string
+	currentNodeIP   string
+	failureCount    int
+	lastCheck       time.Time
+
+	// When the node list could first not be refreshed from the Kubernetes API;
+	// zero while cachedNodes is fresh. The stale list keeps serving meanwhile.
+	staleSince time.Time
+
+	// Serializes every change of the selected node: discovery, failover,
+	// rotation, rebalancing and pinning. Each decides from the current node and
+	// applies its choice without another change landing in between, and
+	// concurrent callers with a stale cache share one node list instead of each
+	// listing the nodes.
+	discoverMutex sync.Mutex
+
+	// Why no node could be selected (ReasonNoNodes / ReasonNoHealthyNodes /
+	// ReasonTooFewHealthyNodes), empty when serving
+	unavailableReason string
+
+	// Health monitoring
+	monitoring       bool
+	monitorCtx       context.Context
+	cancel           context.CancelFunc
+	failureThreshold int
+	checkInterval    time.Duration
+	// checkRequests wakes healthMonitorLoop to re-check the selected node; it
+	// holds one request, so changes arriving during a check coalesce into one more
+	checkRequests chan struct{}
+
+	// First health check on a newly selected node is deferred until this time
+	checkDelay          firstCheckDelay
+	checksDeferredUntil time.Time
+
+	// A node that just turned unhealthy is not counted as failed until this passes (NODE_UNHEALTHY_GRACE)
+	grace unhealthyGrace
+
+	// Dials a proxied NodePort on the selected node during health checks (ACTIVE_HEALTH_PROBE)
+	probe *activeProbe
+
+	// The selected node is rotated out once it has been selected for rotationInterval
+	rotationInterval time.Duration
+	selectedAt       time.Time
+
+	// Node chosen through SelectNode; rotation, rebalancing and the age limit
+	// leave it alone until it fails or the pin is cleared
+	pinnedNode string
+
+	// Picks a new node when the current one is missing or unhealthy (NODE_SELECTION)
+	selector NodeSelector
+
+	// Switches back to the selector's preferred node once it heals (AUTO_REBALANCE)
+	rebalance rebalancer
+
+	// Recent health-check failures per node, decaying over time
+	failureScores *failureScores
+
+	// Healthy nodes as of the last successful health check, for failing over without a List
+	candidates failoverCandidates
+
+	// Excludes nodes that must never be selected, e.g. control-plane nodes
+	filter nodeFilter
+
+	// Avoids old nodes and holds off selection until enough nodes are healthy
+	// (MAX_NODE_AGE, MIN_HEALTHY_NODES)
+	constraints selectionConstraints
+
+	// Which node address traffic is forwarded to (NODE_IP_TYPE, NODE_IP_FAMILY)
+	ipType   nodeIPType
+	ipFamily nodeIPFamily
+
+	// Informer cache of the cluster's nodes; reports changes to the selected node
+	watcher *nodeWatcher
+
+	// Selection, failover and recovery events for Subscribe
+	events nodeEvents
+}
+
+// kubeDiscoveryConfig holds the selection and health-check knobs read from the
+// environment
+type kubeDiscoveryConfig struct {
+	checkDelay       firstCheckDelay
+	grace            unhealthyGrace
+	probe            *activeProbe
+	healthCheck      healthCheckSettings
+	cacheTTL         time.Duration
+	rotationInterval time.Duration
+	scores           *failureScores
+	selector         NodeSelector
+	rebalance        rebalancer
+	filter           nodeFilter
+	constraints      selectionConstraints
+	ipType           nodeIPType
+	ipFamily         nodeIPFamily
+}
+
+// kubeDiscoveryConfigFromEnv reads the node selection and health-check settings,
+// so platforms can reject a bad value before connecting to their cluster
+func kubeDiscoveryConfigFromEnv() (kubeDiscoveryConfig, error) {
+	var cfg kubeDiscoveryConfig
+	var err error
+
+	if cfg.checkDelay, err = firstCheckDelayFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.grace, err = unhealthyGraceFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.probe, err = activeProbeFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.healthCheck, err = healthCheckSettingsFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.cacheTTL, err = cacheTTLFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.rotationInterval, err = nodeRotationIntervalFromEnv(); err != nil {
+		return cfg, err
+	}
+
+	scoreHalfLife, err := failureScoreHalfLifeFromEnv()
+	if err != nil {
+		return cfg, err
+	}
+	cfg.scores = newFailureScores(scoreHalfLife)
+
+	if cfg.selector, err = NodeSelectorFromEnv(cfg.scores); err != nil {
+		return cfg, err
+	}
+	if cfg.rebalance, err = rebalancerFromEnv(cfg.selector); err != nil {
+		return cfg, err
+	}
+	if cfg.filter, err = nodeFilterFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.constraints, err = selectionConstraintsFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.ipType, err = nodeIPTypeFromEnv(); err != nil {
+		return cfg, err
+	}
+	if cfg.ipFamily, err = nodeIPFamilyFromEnv(); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// NewKubeNodeDiscovery creates a node discovery for the cluster behind
+// k8sClientset, configured from the environment. platform names the platform
+// in log messages.
+func NewKubeNodeDiscovery(k8sClientset kubernetes.Interface, platform string) (*KubeNodeDiscovery, error) {
+	cfg, err := kubeDiscoveryConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return newKubeNodeDiscovery(k8sClientset, platform, cfg), nil
+}
+
+func newKubeNodeDiscovery(k8sClientset kubernetes.Interface, platform string, cfg kubeDiscoveryConfig) *KubeNodeDiscovery {
+	monitorCtx, cancel := context.WithCancel(context.Background())
+
+	d := &KubeNodeDiscovery{
+		k8sClientset: k8sClientset,
+		platform:     platform,
+		cacheTTL:     cfg.cacheTTL,
+		monitorCtx:   monitorCtx,
+		cancel:       cancel,
+		checkDelay:   cfg.checkDelay,
+		grace:        cfg.grace,
+		probe:        cfg.probe,
+
+		failureThreshold: cfg.healthCheck.failureThreshold,
+		checkInterval:    cfg.healthCheck.interval,
+		checkRequests:    make(chan struct{}, 1),
+		rotationInterval: cfg.rotationInterval,
+		selector:         cfg.selector,
+		rebalance:        cfg.rebalance,
+		filter:           cfg.filter,
+		constraints:      cfg.constraints,
+		ipType:           cfg.ipType,
+		ipFamily:         cfg.ipFamily,
+		failureScores:    cfg.scores,
+	}
+	// Resyncs re-check the selected node every health-check interval
+	d.watcher = newNodeWatcher(k8sClientset, cfg.filter, cfg.healthCheck.interval, d.onNodeChange)
+	return d
+}
+
+func (d *KubeNodeDiscovery) GetCurrentNodeIP(ctx context.Context) (string, error) {
+	if ip, ok := d.freshNodeIP(); ok {
+		return ip, nil
+	}
+	return d.discoverNodeIP(ctx)
+}
+
+// Rediscover lists the nodes again, bypassing the cache, and re-runs node
+// selection. The current node is kept while it is still healthy.
+func (d *KubeNodeDiscovery) Rediscover(ctx context.Context) (string, error) {
+	d.mutex.Lock()
+	d.cacheTime = time.Time{}
+	d.lastCheck = time.Time{}
+	d.mutex.Unlock()
+	return d.discoverNodeIP(ctx)
+}
+
+// freshNodeIP returns the selected node's IP while it was checked within the cache TTL
+func (d *KubeNodeDiscovery) freshNodeIP() (string, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.currentNodeIP != "" && time.Since(d.lastCheck) < d.cacheTTL {
+		return d.currentNodeIP, true
+	}
+	return "", false
+}
+
+// discoverNodeIP (re)selects a node from the node list, which it fetches at most
+// once. Only one discovery runs at a time; callers that waited for another one
+// use its result.
+func (d *KubeNodeDiscovery) discoverNodeIP(ctx context.Context) (string, error) {
+	d.discoverMutex.Lock()
+	defer d.discoverMutex.Unlock()
+
+	if ip, ok := d.freshNodeIP(); ok {
+		return ip, nil
+	}
+	return d.selectNode(ctx)
+}
+
+// selectNode keeps the current node or selects another one from the node list.
+// The caller must hold d.discoverMutex.
+func (d *KubeNodeDiscovery) selectNode(ctx context.Context) (string, error) {
+	nodes, err := d.getAllNodesWithMetadata(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	if err := d.constraints.tooFewHealthy(nodes); err != nil {
+		d.selectionFailed(ReasonTooFewHealthyNodes)
+		return "", err
+	}
+
+	d.mutex.RLock()
+	currentNodeName := d.currentNodeName
+	pinnedNode := d.pinnedNode
+	d.mutex.RUnlock()
+
+	// Keep the current node while it is healthy and young enough (or pinned),
+	// otherwise ask the selector
+	reason := ""
+	eligible := d.constraints.eligible(nodes)
+	selectedNode := healthyNodeByName(eligible, currentNodeName)
+	if selectedNode == nil && pinnedNode != "" {
+		selectedNode = healthyNodeByName(nodes, pinnedNode)
+	}
+	if selectedNode == nil {
+		selectedNode = d.selector.Select(eligible)
+	}
+	if selectedNode == nil {
+		if !d.serveUnhealthy || len(nodes) == 0 {
+			return "", d.selectionFailed(unavailableReason(nodes))
+		}
+		// Keep serving through the oldest node, but report that none is healthy
+		reason = ReasonNoHealthyNodes
+		recordSelectionFailure(reason)
+		selectedNode = &nodes[0]
+	}
+
+	d.mutex.Lock()
+	d.unavailableReason = reason
+	if selectedNode.Name != d.pinnedNode {
+		d.clearPinLocked("pinned node is no longer healthy")
+	}
+	if selectedNode.Name != d.currentNodeName {
+		d.checksDeferredUntil = time.Now().Add(d.checkDelay.next())
+		d.selectedAt = time.Now()
+		d.events.emit(NodeEvent{Type: NodeSelected, OldNode: d.currentNodeName, NewNode: selectedNode.Name,
+			OldIP: d.currentNodeIP, NewIP: selectedNode.IP})
+	}
+	d.currentNodeName = selectedNode.Name
+	d.currentNodeIP = selectedNode.IP
+	d.cacheTime = time.Now()
+	d.lastCheck = time.Now()
+	d.failureCount = 0
+	d.mutex.Unlock()
+
+	d.candidates.refresh(eligible)
+
+	slog.Info("Selected node for proxying",
+		"node", selectedNode.Name,
+		"ip", selectedNode.IP,
+		"age", selectedNode.Age)
+
+	return selectedNode.IP, nil
+}
+
+// selectionFailed records why no node could be selected
+func (d *KubeNodeDiscovery) selectionFailed(reason string) error {
+	d.mutex.Lock()
+	d.unavailableReason = reason
+	d.mutex.Unlock()
+	return recordSelectionFailure(reason)
+}
+
+// getAllNodesWithMetadata returns the cached node list, listing the nodes when
+// the cache has expired. It takes d.mutex itself, so the caller must not hold it.
+func (d *KubeNodeDiscovery) getAllNodesWithMetadata(ctx context.Context) ([]NodeInfo, error) {
+	d.mutex.RLock()
+	if len(d.cachedNodes) > 0 && time.Since(d.cacheTime) < d.cacheTTL {
+		nodes := make([]NodeInfo, len(d.cachedNodes))
+		copy(nodes, d.cachedNodes)
+		d.mutex.RUnlock()
+		return nodes, nil
+	}
+	d.mutex.RUnlock()
+
+	nodes, err := d.listNodeInfos(ctx)
+	if err != nil {
+		return d.staleNodes(err)
+	}
+	d.storeNodes(nodes)
+	return nodes, nil
+}
+
+// storeNodes replaces the cached node list with a freshly listed one
+func (d *KubeNodeDiscovery) storeNodes(nodes []NodeInfo) {
+	d.mutex.Lock()
+	d.cachedNodes = make([]NodeInfo, len(nodes))
+	copy(d.cachedNodes, nodes)
+	d.cacheTime = time.Now()
+	if !d.staleSince.IsZero() {
+		slog.Info("Node list refreshed, no longer serving stale nodes", "stale_for", time.Since(d.staleSince).Round(time.Second))
+		d.staleSince = time.Time{}
+	}
+	d.mutex.Unlock()
+
+	slog.Info("Retrieved nodes from cluster", "count", len(nodes))
+}
+
+// staleNodes falls back to the cached node list after listing the nodes failed
+// with err, so the proxy keeps serving while the Kubernetes API is unreachable.
+// The list is retried once the cache TTL passes again. Without a cached list
+// err is returned.
+func (d *KubeNodeDiscovery) staleNodes(err error) ([]NodeInfo, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if len(d.cachedNodes) == 0 {
+		return nil, err
+	}
+	if d.staleSince.IsZero() {
+		d.staleSince = time.Now()
+	}
+	d.cacheTime = time.Now()
+	slog.Warn("Failed to refresh node list, serving stale nodes",
+		"error", err,
+		"count", len(d.cachedNodes),
+		"stale_since", d.staleSince)
+
+	nodes := make([]NodeInfo, len(d.cachedNodes))
+	copy(nodes, d.cachedNodes)
+	return nodes, nil
+}
+
+// NodeListStaleSince reports since when the node list has been served from the
+// cache because the Kubernetes API was unreachable; zero while it is fresh.
+// With health monitoring running, the node watch failing makes the list stale
+// even before the cached list next expires.
+func (d *KubeNodeDiscovery) NodeListStaleSince() time.Time {
+	d.mutex.RLock()
+	since := d.staleSince
+	d.mutex.RUnlock()
+	if since.IsZero() && d.watcher != nil && d.watcher.synced() {
+		since, _ = d.watcher.failing()
+	}
+	return since
+}
+
+// listNodeInfos lists the eligible nodes, bypassing the cached node list
+func (d *KubeNodeDiscovery) listNodeInfos(ctx context.Context) ([]NodeInfo, error) {
+	nodeList, err := listNodes(ctx, d.k8sClientset, d.watcher, d.filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	var nodes []NodeInfo
+	for _, node := range nodeList {
+		if d.filter.excludes(node) {
+			continue
+		}
+		nodeInfo, err := d.nodeToNodeInfo(&node)
+		if err != nil {
+			slog.Warn("Skipping node without the requested address", "error", err)
+			continue
+		}
+		nodes = append(nodes, nodeInfo)
+	}
+
+	// Oldest first, so the first node is the one served when none is healthy
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].CreationTime.Before(nodes[j].CreationTime)
+	})
+	return nodes, nil
+}
+
+func (d *KubeNodeDiscovery) nodeToNodeInfo(node *corev1.Node) (NodeInfo, error) {
+	creationTime := node.CreationTimestamp.Time
+	age := time.Since(creationTime)
+
+	status := getNodeStatus(*node)
+
+	nodeIP, err := nodeAddress(*node, d.ipType, d.ipFamily)
+	if err != nil {
+		return NodeInfo{}, err
+	}
+
+	return NodeInfo{
+		Name:         node.Name,
+		IP:           nodeIP,
+		Status:       status,
+		Age:          age,
+		CreationTime: creationTime,
+		LastCheck:    time.Now(),
+		Labels:       node.Labels,
+	}, nil
+}
+
+func (d *KubeNodeDiscovery) GetAllNodes(ctx context.Context) ([]NodeInfo, error) {
+	return d.getAllNodesWithMetadata(ctx)
+}
+
+// GetAllNodeIPs returns the IPs of every node, oldest first, from the cached
+// node list. Nodes without an IP are skipped.
+func (d *KubeNodeDiscovery) GetAllNodeIPs(ctx context.Context) ([]string, error) {
+	nodes, err := d.getAllNodesWithMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if node.IP != "" {
+			ips = append(ips, node.IP)
+		}
+	}
+	return ips, nil
+}
+
+// GetNodeIPForSelector returns the IP of the oldest healthy node matching
+// selector, for requests routed to a subset of the nodes such as canaries.
+// Only nodes in the node list are considered, and the selected node is not
+// changed.
+func (d *KubeNodeDiscovery) GetNodeIPForSelector(ctx context.Context, selector labels.Selector) (string, error) {
+	nodes, err := d.getAllNodesWithMetadata(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	var matching []NodeInfo
+	for _, node := range nodes {
+		if selector.Matches(labels.Set(node.Labels)) {
+			matching = append(matching, node)
+		}
+	}
+	healthy := healthyByAge(matching)
+	if len(healthy) == 0 {
+		return "", fmt.Errorf("%w matching %q", ErrNoHealthyNodes, selector.String())
+	}
+	return healthy[0].IP, nil
+}
+
+func (d *KubeNodeDiscovery) StartHealthMonitoring() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.monitoring {
+		return
+	}
+
+	d.monitoring = true
+	d.watcher.start(d.monitorCtx)
+	go d.healthMonitorLoop()
+	if d.cacheTTL > 0 {
+		go d.cacheRefreshLoop()
+	}
+	slog.Info("Started node health monitoring", "platform", d.platform)
+}
+
+func (d *KubeNodeDiscovery) StopHealthMonitoring() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.monitoring {
+		return
+	}
+
+	d.monitoring = false
+	if d.cancel != nil {
+		d.cancel()
+	}
+	slog.Info("Stopped node health monitoring", "platform", d.platform)
+}
+
+// healthMonitorLoop runs the health checks the node watcher requests, and
+// checks for a due rotation every health-check interval when rotation is on.
+// Checks run here rather than in the watcher's handler, so a slow probe or
+// failover never holds up the informer's delivery of node changes.
+func (d *KubeNodeDiscovery) healthMonitorLoop() {
+	var rotation <-chan time.Time
+	if d.rotationInterval > 0 {
+		ticker := time.NewTicker(d.checkInterval)
+		defer ticker.Stop()
+		rotation = ticker.C
+	}
+	defer slog.Info("Node health monitoring loop stopped", "platform", d.platform)
+
+	for {
+		select {
+		case <-d.monitorCtx.Done():
+			return
+		case <-d.checkRequests:
+			d.performHealthCheck()
+		case <-rotation:
+			d.rotateIfDue()
+		}
+	}
+}
+
+// onNodeChange asks healthMonitorLoop to re-check the selected node whenever
+// the watcher reports a change to it. It never blocks: a check already
+// requested covers this change too.
+func (d *KubeNodeDiscovery) onNodeChange(name string) {
+	if name != d.GetCurrentNodeName() {
+		return
+	}
+	select {
+	case d.checkRequests <- struct{}{}:
+	default:
+	}
+}
+
+func (d *KubeNodeDiscovery) performHealthCheck() {
+	d.mutex.RLock()
+	nodeName := d.currentNodeName
+	deferredUntil := d.checksDeferredUntil
+	d.mutex.RUnlock()
+
+	if nodeName == "" {
+		return
+	}
+
+	if time.Now().Before(deferredUntil) {
+		// Give a freshly selected node time to settle before judging it
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(d.monitorCtx, 10*time.Second)
+	defer cancel()
+
+	node, err := getNode(ctx, d.k8sClientset, d.watcher, nodeName)
+	if apierrors.IsNotFound(err) {
+		slog.Warn("Selected node no longer exists", "node", nodeName)
+		d.handleNodeFailure()
+		return
+	}
+	if err != nil {
+		// An API outage says nothing about the node; don't count it as a failure
+		slog.Warn("Kubernetes API error during health check, not counting as a node failure", "node", nodeName, "error", err)
+		return
+	}
+	d.refreshCurrentNodeIP(node)
+
+	isHealthy := getNodeStatus(*node) == NodeHealthy
+	if isHealthy && d.filter.excludes(*node) {
+		slog.Warn("Node is cordoned, marked for drain or no longer eligible, treating as unhealthy", "node", nodeName)
+		isHealthy = false
+	}
+	if isHealthy {
+		if err := d.probeNode(ctx, *node); err != nil {
+			slog.Warn("Node is Ready but its NodePort is unreachable, treating as unhealthy", "node", nodeName, "error", err)
+			isHealthy = false
+		}
+	}
+
+	d.mutex.Lock()
+	d.updateCurrentNodeLastCheck(nodeName, time.Now(), isHealthy)
+	pending := !isHealthy && d.grace.pending(nodeName, time.Now())
+	d.mutex.Unlock()
+
+	if !isHealthy {
+		if pending {
+			slog.Info("Node is unhealthy, waiting out NODE_UNHEALTHY_GRACE before counting a failure", "node", nodeName)
+			return
+		}
+
+		slog.Warn("Node became unhealthy", "node", nodeName)
+		d.handleNodeFailure()
+	} else {
+		d.mutex.Lock()
+		d.grace.clear()
+		if d.failureCount > 0 {
+			slog.Info("Node recovered", "node", nodeName)
+			d.events.emit(NodeEvent{Type: NodeRecovered, OldNode: nodeName, NewNode: nodeName,
+				OldIP: d.currentNodeIP, NewIP: d.currentNodeIP})
+			d.failureCount = 0
+		}
+		d.unavailableReason = ""
+		d.mutex.Unlock()
+
+		d.refreshCandidates(ctx)
+		d.rebalanceIfPreferred(ctx)
+	}
+}
+
+// refreshCurrentNodeIP follows the selected node to a new address. Some
+// providers keep a node's name but give it a new IP after a reboot, and the
+// cached IP would otherwise be proxied to until the next re-selection.
+func (d *KubeNodeDiscovery) refreshCurrentNodeIP(node *corev1.Node) {
+	ip, err := nodeAddress(*node, d.ipType, d.ipFamily)
+	if err != nil {
+		// The probe and the next selection deal with a node without an address
+		return
+	}
+
+	d.mutex.Lock()
+	if node.Name != d.currentNodeName || ip == d.currentNodeIP {
+		d.mutex.Unlock()
+		return
+	}
+	oldIP := d.currentNodeIP
+	d.currentNodeIP = ip
+	for i := range d.cachedNodes {
+		if d.cachedNodes[i].Name == node.Name {
+			d.cachedNodes[i].IP = ip
+			break
+		}
+	}
+	d.events.emit(NodeEvent{Type: NodeIPChanged, OldNode: node.Name, NewNode: node.Name, OldIP: oldIP, NewIP: ip})
+	d.mutex.Unlock()
+
+	slog.Warn("Selected node's IP changed, proxying to the new address",
+		"node", node.Name,
+		"old_ip", oldIP,
+		"new_ip", ip)
+}
+
+// refreshCandidates records the currently healthy nodes as failover candidates
+func (d *KubeNodeDiscovery) refreshCandidates(ctx context.Context) {
+	nodes, err := d.getAllNodesWithMetadata(ctx)
+	if err != nil {
+		slog.Warn("Failed to refresh failover candidates", "error", err)
+		return
+	}
+	d.candidates.refresh(d.constraints.eligible(nodes))
+}
+
+// updateCurrentNodeLastCheck records a health check result for the named node.
+// The caller must hold d.mutex.
+func (d *KubeNodeDiscovery) updateCurrentNodeLastCheck(nodeName string, lastCheck time.Time, isHealthy bool) {
+	d.lastCheck = lastCheck
+	for i := range d.cachedNodes {
+		if d.cachedNodes[i].Name == nodeName {
+			d.cachedNodes[i].LastCheck = lastCheck
+			if isHealthy {
+				d.cachedNodes[i].Status = NodeHealthy
+			} else {
+				d.cachedNodes[i].Status = NodeUnhealthy
+			}
+			break
+		}
+	}
+}
+
+func (d *KubeNodeDiscovery) handleNodeFailure() {
+	d.mutex.Lock()
+	d.failureCount++
+	nodeName := d.currentNodeName
+	d.failureScores.recordFailure(nodeName)
+	failureCount := d.failureCount
+	shouldFailover := d.failureCount >= d.failureThreshold
+	d.mutex.Unlock()
+
+	slog.Warn("Node health check failed",
+		"node", nodeName,
+		"failure_count", failureCount)
+
+	if shouldFailover {
+		slog.Error("Node failed consecutive health checks, triggering failover",
+			"node", nodeName,
+			"threshold", d.failureThreshold)
+		d.performFailover(nodeName)
+	}
+}
+
+// rotateIfDue switches to the next healthy node once the current one has been
+// selected for NODE_ROTATION_INTERVAL. Only new requests go to the new node;
+// in-flight requests finish on the old one and its idle upstream connections
+// are closed by the transport's idle timeout.
+func (d *KubeNodeDiscovery) rotateIfDue() {
+	d.mutex.RLock()
+	currentNodeName := d.currentNodeName
+	due := rotationDue(d.rotationInterval, d.selectedAt) && d.pinnedNode == ""
+	d.mutex.RUnlock()
+
+	if !due {
+		return
+	}
+
+	d.discoverMutex.Lock()
+	defer d.discoverMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(d.monitorCtx, 10*time.Second)
+	defer cancel()
+
+	nodes, err := d.getAllNodesWithMetadata(ctx)
+	if err != nil {
+		slog.Error("Failed to get nodes for rotation", "error", err)
+		return
+	}
+
+	d.mutex.Lock()
+	if d.currentNodeName != currentNodeName || d.pinnedNode != "" {
+		// A failover or SelectNode already moved the selection
+		d.mutex.Unlock()
+		return
+	}
+
+	next := nextHealthyNode(d.constraints.eligible(nodes), currentNodeName)
+	if next == nil {
+		// No other healthy node; keep the current one for another interval
+		d.selectedAt = time.Now()
+		d.mutex.Unlock()
+		return
+	}
+
+	oldIP := d.currentNodeIP
+	d.currentNodeName = next.Name
+	d.currentNodeIP = next.IP
+	d.failureCount = 0
+	d.lastCheck = time.Now()
+	d.selectedAt = time.Now()
+	d.checksDeferredUntil = time.Now().Add(d.checkDelay.next())
+	d.mutex.Unlock()
+
+	d.events.emit(NodeEvent{Type: NodeSelected, OldNode: currentNodeName, NewNode: next.Name, OldIP: oldIP, NewIP: next.IP})
+	slog.Info("Rotated node",
+		"old_node", currentNodeName,
+		"new_node", next.Name,
+		"new_ip", next.IP)
+}
+
+// rebalanceIfPreferred switches back to the selector's preferred node once it has
+// stayed healthy for AUTO_REBALANCE_DELAY, e.g. the oldest node after it recovers
+// from the failure that caused a failover
+func (d *KubeNodeDiscovery) rebalanceIfPreferred(ctx context.Context) {
+	if !d.rebalance.enabled {
+		return
+	}
+
+	d.discoverMutex.Lock()
+	defer d.discoverMutex.Unlock()
+
+	// The cached node list still shows a recovered node as unhealthy
+	nodes, err := d.listNodeInfos(ctx)
+	if err != nil {
+		slog.Error("Failed to get nodes for rebalancing", "error", err)
+		return
+	}
+
+	d.mutex.Lock()
+	oldNode := d.currentNodeName
+	if d.pinnedNode != "" {
+		d.mutex.Unlock()
+		return
+	}
+	preferred := d.rebalance.next(d.selector, d.constraints.eligible(nodes), oldNode, time.Now())
+	if preferred == nil {
+		d.mutex.Unlock()
+		return
+	}
+
+	d.cachedNodes = nodes
+	d.cacheTime = time.Now()
+	oldIP := d.currentNodeIP
+	d.currentNodeName = preferred.Name
+	d.currentNodeIP = preferred.IP
+	d.failureCount = 0
+	d.lastCheck = time.Now()
+	d.selectedAt = time.Now()
+	d.checksDeferredUntil = time.Now().Add(d.checkDelay.next())
+	d.mutex.Unlock()
+
+	d.events.emit(NodeEvent{Type: NodeSelected, OldNode: oldNode, NewNode: preferred.Name, OldIP: oldIP, NewIP: preferred.IP})
+	slog.Info("Rebalanced to preferred node",
+		"old_node", oldNode,
+		"new_node", preferred.Name,
+		"new_ip", preferred.IP)
+}
+
+// TriggerFailover moves traffic off the current node to the next healthy one,
+// as repeated health-check failures would, and returns the new node's name.
+// The old node remains eligible for later selection.
+func (d *KubeNodeDiscovery) TriggerFailover() (string, error) {
+	current := d.GetCurrentNodeName()
+	slog.Info("Manual failover requested", "node", current)
+	if err := d.performFailover(current); err != nil {
+		return "", err
+	}
+	return d.GetCurrentNodeName(), nil
+}
+
+// SelectNode pins traffic to the named node, e.g. for debugging. The node must
+// exist and be healthy. Automatic selection leaves it in place until it fails
+// health checks, a failover moves traffic elsewhere or ClearSelectedNode is called.
+func (d *KubeNodeDiscovery) SelectNode(name string) error {
+	d.discoverMutex.Lock()
+	defer d.discoverMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(d.monitorCtx, 10*time.Second)
+	defer cancel()
+
+	// The cached node list may not show a recent change to the node yet
+	nodes, err := d.listNodeInfos(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get nodes: %w", err)
+	}
+	var node *NodeInfo
+	for i := range nodes {
+		if nodes[i].Name == name {
+			node = &nodes[i]
+			break
+		}
+	}
+	if node == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, name)
+	}
+	if node.Status != NodeHealthy {
+		return fmt.Errorf("%w: %s is %s", ErrNodeNotHealthy, name, node.Status)
+	}
+
+	d.mutex.Lock()
+	oldNode, oldIP := d.currentNodeName, d.currentNodeIP
+	d.pinnedNode = node.Name
+	d.unavailableReason = ""
+	d.cachedNodes = nodes
+	d.cacheTime = time.Now()
+	d.currentNodeName = node.Name
+	d.currentNodeIP = node.IP
+	d.failureCount = 0
+	d.lastCheck = time.Now()
+	d.selectedAt = time.Now()
+	if node.Name != oldNode {
+		d.checksDeferredUntil = time.Now().Add(d.checkDelay.next())
+	}
+	d.mutex.Unlock()
+
+	if node.Name != oldNode {
+		d.events.emit(NodeEvent{Type: NodeSelected, OldNode: oldNode, NewNode: node.Name, OldIP: oldIP, NewIP: node.IP})
+	}
+	slog.Info("Pinned node for proxying",
+		"old_node", oldNode,
+		"node", node.Name,
+		"ip", node.IP)
+	return nil
+}
+
+// ClearSelectedNode hands the pinned node back to automatic selection, which
+// keeps it while it stays healthy
+func (d *KubeNodeDiscovery) ClearSelectedNode() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.clearPinLocked("cleared")
+}
+
+// PinnedNode returns the node set by SelectNode, or "" when selection is automatic
+func (d *KubeNodeDiscovery) PinnedNode() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.pinnedNode
+}
+
+// clearPinLocked drops the pin, if any; the caller holds d.mutex
+func (d *KubeNodeDiscovery) clearPinLocked(why string) {
+	if d.pinnedNode == "" {
+		return
+	}
+	slog.Info("Node is no longer pinned, resuming automatic selection", "node", d.pinnedNode, "reason", why)
+	d.pinnedNode = ""
+}
+
+// performFailover switches from the failed node to another healthy node. When
+// the selection has already moved off it, e.g. a health-check failover and a
+// manual one for the same outage, there is nothing left to do, so one outage
+// fails over once. Stopping health monitoring cancels a failover in progress.
+func (d *KubeNodeDiscovery) performFailover(failed string) error {
+	d.discoverMutex.Lock()
+	defer d.discoverMutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(d.monitorCtx, 30*time.Second)
+	defer cancel()
+
+	d.mutex.RLock()
+	currentNode := d.currentNodeName
+	d.mutex.RUnlock()
+	if currentNode != failed {
+		slog.Info("Selection already moved off the failed node, skipping failover", "failed_node", failed, "node", currentNode)
+		return nil
+	}
+
+	candidate := d.candidates.pick(d.selector, currentNode, d.cacheTTL, func(name string) bool {
+		return nodeStillHealthy(ctx, d.k8sClientset, d.watcher, d.filter, name)
+	})
+	if candidate == nil {
+		// No warm candidate; list the nodes
+		nodes, err := d.getAllNodesWithMetadata(ctx)
+		if err == nil {
+			// A list interrupted by shutdown falls back to the stale nodes
+			err = ctx.Err()
+		}
+		if err != nil {
+			slog.Error("Failed to get nodes during failover", "error", err)
+			return fmt.Errorf("failed to get nodes: %w", err)
+		}
+
+		if err := d.constraints.tooFewHealthy(withoutNode(nodes, currentNode)); err != nil {
+			slog.Error("Not enough healthy replacement nodes during failover", "error", err)
+			d.selectionFailed(ReasonTooFewHealthyNodes)
+			return err
+		}
+		candidate = d.selector.Select(withoutNode(d.constraints.eligible(nodes), currentNode))
+		if candidate == nil {
+			slog.Error("No healthy replacement nodes found during failover")
+			return d.selectionFailed(unavailableReason(nodes))
+		}
+	}
+
+	d.mutex.Lock()
+	d.unavailableReason = ""
+	d.clearPinLocked("failed over")
+	oldNode, oldIP := d.currentNodeName, d.currentNodeIP
+	d.currentNodeName = candidate.Name
+	d.currentNodeIP = candidate.IP
+	d.failureCount = 0
+	d.lastCheck = time.Now()
+	d.checksDeferredUntil = time.Now().Add(d.checkDelay.next())
+	d.selectedAt = time.Now()
+	d.mutex.Unlock()
+
+	metrics.IncFailovers()
+	d.events.emit(NodeEvent{Type: NodeFailover, OldNode: oldNode, NewNode: candidate.Name, OldIP: oldIP, NewIP: candidate.IP})
+	slog.Info("Failover completed",
+		"old_node", oldNode,
+		"new_node", candidate.Name,
+		"new_ip", candidate.IP)
+	return nil
+}
+
+// Subscribe returns a channel receiving node selection, failover and recovery
+// events. Events are dropped rather than delivered late when the channel's
+// buffer is full, so subscribers must keep up.
+func (d *KubeNodeDiscovery) Subscribe() <-chan NodeEvent {
+	return d.events.subscribe()
+}
+
+func (d *KubeNodeDiscovery) GetCurrentNodeName() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.currentNodeName
+}
+
+// GetCurrentNodeStatus returns the last known status of the selected node from
+// the cached node list, without calling the Kubernetes API
+func (d *KubeNodeDiscovery) GetCurrentNodeStatus() NodeStatus {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return nodeStatusByName(d.cachedNodes, d.currentNodeName)
+}
+
+// GetHealthyNodeCount returns the number of healthy nodes in the cached node list
+func (d *KubeNodeDiscovery) GetHealthyNodeCount() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return countHealthyNodes(d.cachedNodes)
+}
+
+// GetUnavailableReason returns why no healthy node is selected (ReasonNoNodes or
+// ReasonNoHealthyNodes, ReasonTooFewHealthyNodes), or "" when a healthy node is serving
+func (d *KubeNodeDiscovery) GetUnavailableReason() string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.unavailableReason
+}
+
+// HealthCheckInterval returns how often the selected node is health checked
+func (d *KubeNodeDiscovery) HealthCheckInterval() time.Duration {
+	return d.checkInterval
+}
+
+// FailureThreshold returns how many consecutive failed checks trigger a failover
+func (d *KubeNodeDiscovery) FailureThreshold() int {
+	return d.failureThreshold
+}
+
+// GetNodeFailureScores returns the recent-failure score of each node that failed
+// health checks recently; nodes without recent failures are omitted
+func (d *KubeNodeDiscovery) GetNodeFailureScores() map[string]float64 {
+	return d.failureScores.snapshot()
+}
+
+// SetProbePorts sets the NodePorts dialed by the active health probe
+func (d *KubeNodeDiscovery) SetProbePorts(ports []int) {
+	d.probe.setPorts(ports)
+}
+
+// probeNode runs the active health probe against node's proxied address
+func (d *KubeNodeDiscovery) probeNode(ctx context.Context, node corev1.Node) error {
+	if !d.probe.enabled {
+		return nil
+	}
+	ip, err := nodeAddress(node, d.ipType, d.ipFamily)
+	if err != nil {
+		return err
+	}
+	return d.probe.check(ctx, ip)
+}
@@ -0,0 +1,762 @@
+package nodes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"k8s-node-proxy/internal/services"
+)
+
+// newTestKubeDiscovery creates a KubeNodeDiscovery backed by a fake clientset
+func newTestKubeDiscovery(t *testing.T, nodes ...runtime.Object) *KubeNodeDiscovery {
+	t.Helper()
+
+	d, err := NewKubeNodeDiscovery(fake.NewClientset(nodes...), "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+	return d
+}
+
+// TestKubeNodeDiscovery_NodeSelection tests that node list from Kubernetes API → oldest node selected
+func TestKubeNodeDiscovery_NodeSelection(t *testing.T) {
+	now := time.Now()
+	d := newTestKubeDiscovery(t,
+		newTestNode("node-middle", "10.0.1.2", true, now.Add(-12*time.Hour)),
+		newTestNode("node-newest", "10.0.1.3", true, now.Add(-1*time.Hour)),
+		newTestNode("node-oldest", "10.0.1.1", true, now.Add(-24*time.Hour)),
+		newTestNode("node-unhealthy", "10.0.1.4", false, now.Add(-48*time.Hour)), // Even older but unhealthy
+	)
+
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip)
+	assert.Equal(t, "node-oldest", d.GetCurrentNodeName())
+	assert.Equal(t, NodeHealthy, d.GetCurrentNodeStatus())
+
+	nodes, err := d.GetAllNodes(context.Background())
+	require.NoError(t, err)
+	var names []string
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	assert.Equal(t, []string{"node-unhealthy", "node-oldest", "node-middle", "node-newest"}, names, "nodes are listed oldest first")
+}
+
+// TestKubeNodeDiscovery_NoHealthyNodes tests behavior when no healthy nodes are available
+func TestKubeNodeDiscovery_NoHealthyNodes(t *testing.T) {
+	now := time.Now()
+	nodes := []runtime.Object{
+		newTestNode("node-1", "10.0.1.1", false, now.Add(-time.Hour)),
+		newTestNode("node-2", "10.0.1.2", false, now),
+	}
+
+	t.Run("FailsSelection", func(t *testing.T) {
+		d := newTestKubeDiscovery(t, nodes...)
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		assert.ErrorIs(t, err, ErrNoHealthyNodes)
+		assert.Empty(t, d.GetCurrentNodeName())
+		assert.Equal(t, ReasonNoHealthyNodes, d.GetUnavailableReason())
+	})
+
+	t.Run("ServeUnhealthy", func(t *testing.T) {
+		d := newTestKubeDiscovery(t, nodes...)
+		d.serveUnhealthy = true
+
+		// Traffic keeps going to the oldest node while the reason is still reported
+		ip, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.1.1", ip)
+		assert.Equal(t, "node-1", d.GetCurrentNodeName())
+		assert.Equal(t, ReasonNoHealthyNodes, d.GetUnavailableReason())
+	})
+}
+
+// TestKubeNodeDiscovery_EmptyNodeList tests behavior with empty node list
+func TestKubeNodeDiscovery_EmptyNodeList(t *testing.T) {
+	for _, serveUnhealthy := range []bool{false, true} {
+		d := newTestKubeDiscovery(t)
+		d.serveUnhealthy = serveUnhealthy
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		assert.ErrorIs(t, err, ErrNoNodes, "serveUnhealthy=%v", serveUnhealthy)
+		assert.Equal(t, ReasonNoNodes, d.GetUnavailableReason())
+	}
+}
+
+// TestPlatformNodeDiscoveries tests that the EKS and generic constructors wrap
+// the shared discovery
+func TestPlatformNodeDiscoveries(t *testing.T) {
+	node := newTestNode("node-1", "10.0.1.1", true, time.Now())
+
+	eks, err := NewEKSNodeDiscovery("us-west-2", "test-cluster", fake.NewClientset(node))
+	require.NoError(t, err)
+	t.Cleanup(eks.cancel)
+	assert.Equal(t, "eks", eks.platform)
+	assert.False(t, eks.serveUnhealthy)
+
+	generic, err := NewGenericNodeDiscovery(fake.NewClientset(node))
+	require.NoError(t, err)
+	t.Cleanup(generic.cancel)
+	assert.Equal(t, "generic", generic.platform)
+	assert.False(t, generic.serveUnhealthy)
+
+	for _, d := range []*KubeNodeDiscovery{eks.KubeNodeDiscovery, generic.KubeNodeDiscovery} {
+		ip, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "10.0.1.1", ip, d.platform)
+	}
+}
+
+// TestKubeNodeDiscovery_FailureThreshold tests that the EKS and generic
+// discoveries keep the selected node until it fails FAILURE_THRESHOLD
+// consecutive health checks, then fail over to the oldest remaining healthy node
+func TestKubeNodeDiscovery_FailureThreshold(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	now := time.Now()
+	newClientset := func() *fake.Clientset {
+		return fake.NewClientset(
+			newTestNode("node-newest", "10.0.1.3", true, now.Add(-1*time.Hour)),
+			newTestNode("node-oldest", "10.0.1.1", true, now.Add(-24*time.Hour)),
+			newTestNode("node-middle", "10.0.1.2", true, now.Add(-12*time.Hour)),
+		)
+	}
+	newDiscoveries := map[string]func(*fake.Clientset) (*KubeNodeDiscovery, error){
+		"eks": func(clientset *fake.Clientset) (*KubeNodeDiscovery, error) {
+			d, err := NewEKSNodeDiscovery("us-west-2", "test-cluster", clientset)
+			if err != nil {
+				return nil, err
+			}
+			return d.KubeNodeDiscovery, nil
+		},
+		"generic": func(clientset *fake.Clientset) (*KubeNodeDiscovery, error) {
+			d, err := NewGenericNodeDiscovery(clientset)
+			if err != nil {
+				return nil, err
+			}
+			return d.KubeNodeDiscovery, nil
+		},
+	}
+
+	for platform, newDiscovery := range newDiscoveries {
+		t.Run(platform, func(t *testing.T) {
+			clientset := newClientset()
+			d, err := newDiscovery(clientset)
+			require.NoError(t, err)
+			t.Cleanup(d.cancel)
+			require.Equal(t, 3, d.FailureThreshold())
+
+			_, err = d.GetCurrentNodeIP(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, "node-oldest", d.GetCurrentNodeName())
+
+			// Failures below the threshold are forgotten once the node recovers
+			setNodeReady(t, clientset, "node-oldest", false)
+			d.performHealthCheck()
+			d.performHealthCheck()
+			assert.Equal(t, "node-oldest", d.GetCurrentNodeName(), "two failures are below the threshold")
+			setNodeReady(t, clientset, "node-oldest", true)
+			d.performHealthCheck()
+
+			setNodeReady(t, clientset, "node-oldest", false)
+			d.performHealthCheck()
+			d.performHealthCheck()
+			assert.Equal(t, "node-oldest", d.GetCurrentNodeName(), "the count restarted after the recovery")
+
+			d.performHealthCheck()
+			assert.Equal(t, "node-middle", d.GetCurrentNodeName(), "the third consecutive failure fails over")
+			ip, err := d.GetCurrentNodeIP(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "10.0.1.2", ip)
+		})
+	}
+}
+
+// TestKubeNodeDiscovery_ConcurrentAccess hammers node selection, the node list and
+// health checks from many goroutines; run with -race
+func TestKubeNodeDiscovery_ConcurrentAccess(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	now := time.Now()
+	newClientset := func() *fake.Clientset {
+		return fake.NewClientset(
+			newTestNode("node-1", "10.0.1.1", true, now.Add(-2*time.Hour)),
+			newTestNode("node-2", "10.0.1.2", true, now.Add(-time.Hour)),
+			newTestNode("node-3", "10.0.1.3", true, now),
+		)
+	}
+
+	t.Run("SingleListPerDiscovery", func(t *testing.T) {
+		clientset := newClientset()
+		// A slow List keeps the first discovery in flight while the others arrive
+		clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+			time.Sleep(20 * time.Millisecond)
+			return false, nil, nil
+		})
+		d, err := NewKubeNodeDiscovery(clientset, "test")
+		require.NoError(t, err)
+		t.Cleanup(d.cancel)
+
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				ip, err := d.GetCurrentNodeIP(context.Background())
+				assert.NoError(t, err)
+				assert.Equal(t, "10.0.1.1", ip)
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		assert.Equal(t, 1, countNodeLists(clientset), "concurrent callers must share one node list")
+	})
+
+	t.Run("ExpiringCache", func(t *testing.T) {
+		// Expire the cache constantly so lookups race with re-discovery
+		t.Setenv("CACHE_TTL", "1ms")
+		clientset := newClientset()
+		d, err := NewKubeNodeDiscovery(clientset, "test")
+		require.NoError(t, err)
+		t.Cleanup(d.cancel)
+
+		valid := map[string]bool{"10.0.1.1": true, "10.0.1.2": true, "10.0.1.3": true}
+		var wg sync.WaitGroup
+		for i := range 30 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 50 {
+					switch i % 3 {
+					case 0:
+						ip, err := d.GetCurrentNodeIP(context.Background())
+						if assert.NoError(t, err) {
+							assert.True(t, valid[ip], "unexpected IP %q", ip)
+						}
+					case 1:
+						nodes, err := d.GetAllNodes(context.Background())
+						if assert.NoError(t, err) {
+							assert.Len(t, nodes, 3)
+						}
+					default:
+						d.performHealthCheck()
+						d.GetCurrentNodeStatus()
+						d.GetHealthyNodeCount()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, "node-1", d.GetCurrentNodeName(), "a healthy node must not be replaced")
+	})
+
+	t.Run("FailoverDuringDiscovery", func(t *testing.T) {
+		t.Setenv("CACHE_TTL", "1ms")
+
+		for range 20 {
+			d, err := NewKubeNodeDiscovery(newClientset(), "test")
+			require.NoError(t, err)
+			t.Cleanup(d.cancel)
+			_, err = d.GetCurrentNodeIP(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, "node-1", d.GetCurrentNodeName())
+			events := d.Subscribe()
+
+			// Requests keep re-running selection while a health-check
+			// failover and a manual one fire for the same outage
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					for range 20 {
+						_, _ = d.GetCurrentNodeIP(context.Background())
+					}
+				}()
+			}
+			for range 2 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					assert.NoError(t, d.performFailover("node-1"))
+				}()
+			}
+			close(start)
+			wg.Wait()
+
+			assert.Equal(t, "node-2", d.GetCurrentNodeName(), "a selection must not undo the failover")
+			var failovers int
+			for len(events) > 0 {
+				if event := <-events; event.Type == NodeFailover {
+					failovers++
+				}
+			}
+			assert.Equal(t, 1, failovers, "one outage fails over once")
+		}
+	})
+}
+
+// TestKubeNodeDiscovery_Rediscover tests that re-discovery bypasses the node
+// cache and only replaces the current node once it is gone
+func TestKubeNodeDiscovery_Rediscover(t *testing.T) {
+	now := time.Now()
+	clientset := fake.NewClientset(newTestNode("node-1", "10.0.1.1", true, now.Add(-time.Hour)))
+	d, err := NewKubeNodeDiscovery(clientset, "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+
+	_, err = d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+
+	// An older node joins: it is listed, but the healthy current node stays
+	_, err = clientset.CoreV1().Nodes().Create(context.Background(),
+		newTestNode("node-0", "10.0.1.0", true, now.Add(-2*time.Hour)), metav1.CreateOptions{})
+	require.NoError(t, err)
+	ip, err := d.Rediscover(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip)
+	nodes, err := d.GetAllNodes(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, nodes, 2)
+
+	// Once the current node is removed, re-discovery selects another one
+	require.NoError(t, clientset.CoreV1().Nodes().Delete(context.Background(), "node-1", metav1.DeleteOptions{}))
+	ip, err = d.Rediscover(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.0", ip)
+	assert.Equal(t, "node-0", d.GetCurrentNodeName())
+}
+
+// TestKubeNodeDiscovery_GetAllNodeIPs tests that every node's IP is listed, not
+// only the selected node's
+func TestKubeNodeDiscovery_GetAllNodeIPs(t *testing.T) {
+	now := time.Now()
+	noAddress := newTestNode("node-no-address", "", true, now.Add(-3*time.Hour))
+	noAddress.Status.Addresses = nil
+	d := newTestKubeDiscovery(t,
+		newTestNode("node-2", "10.0.1.2", true, now.Add(-time.Hour)),
+		newTestNode("node-1", "10.0.1.1", true, now.Add(-2*time.Hour)),
+		newTestNode("node-3", "10.0.1.3", false, now),
+		noAddress,
+	)
+
+	ips, err := d.GetAllNodeIPs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.1.1", "10.0.1.2", "10.0.1.3"}, ips)
+}
+
+// TestKubeNodeDiscovery_GetNodeIPForSelector tests that the oldest healthy node
+// matching the selector is returned without changing the selected node
+func TestKubeNodeDiscovery_GetNodeIPForSelector(t *testing.T) {
+	now := time.Now()
+	canary := newTestNode("node-canary", "10.0.1.2", true, now.Add(-time.Hour))
+	canary.Labels = map[string]string{"track": "canary"}
+	unhealthyCanary := newTestNode("node-canary-unhealthy", "10.0.1.3", false, now.Add(-2*time.Hour))
+	unhealthyCanary.Labels = map[string]string{"track": "canary"}
+	d := newTestKubeDiscovery(t,
+		newTestNode("node-stable", "10.0.1.1", true, now.Add(-24*time.Hour)),
+		canary,
+		unhealthyCanary,
+	)
+
+	ip, err := d.GetNodeIPForSelector(context.Background(), labels.SelectorFromSet(labels.Set{"track": "canary"}))
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.2", ip)
+
+	nodes, err := d.GetAllNodes(context.Background())
+	require.NoError(t, err)
+	for _, node := range nodes {
+		if node.Name == "node-canary" {
+			assert.Equal(t, map[string]string{"track": "canary"}, node.Labels)
+		}
+	}
+
+	_, err = d.GetNodeIPForSelector(context.Background(), labels.SelectorFromSet(labels.Set{"track": "beta"}))
+	assert.ErrorIs(t, err, ErrNoHealthyNodes)
+
+	ip, err = d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip, "the selected node is unaffected")
+}
+
+// TestKubeNodeDiscovery_TriggerFailover tests that a manual failover moves to
+// another healthy node and fails when there is none
+func TestKubeNodeDiscovery_TriggerFailover(t *testing.T) {
+	now := time.Now()
+	d := newTestKubeDiscovery(t,
+		newTestNode("node-1", "10.0.1.1", true, now.Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, now.Add(-time.Hour)),
+		newTestNode("node-3", "10.0.1.3", false, now),
+	)
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+
+	node, err := d.TriggerFailover()
+	require.NoError(t, err)
+	assert.Equal(t, "node-2", node)
+
+	alone := newTestKubeDiscovery(t, newTestNode("node-1", "10.0.1.1", true, now))
+	_, err = alone.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+
+	_, err = alone.TriggerFailover()
+	assert.ErrorIs(t, err, ErrNoHealthyNodes)
+	assert.Equal(t, "node-1", alone.GetCurrentNodeName(), "the current node is kept without a replacement")
+}
+
+// TestKubeNodeDiscovery_NodeIPChanged tests that a health check follows the
+// selected node to a new IP when it keeps its name
+func TestKubeNodeDiscovery_NodeIPChanged(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	now := time.Now()
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, now.Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, now.Add(-time.Hour)),
+	)
+	d, err := NewKubeNodeDiscovery(clientset, "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+	events := d.Subscribe()
+
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "10.0.1.1", ip)
+	<-events // the initial selection
+
+	// node-1 reboots and comes back under the same name with a new address
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), "node-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.1.9"}}
+	_, err = clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	d.performHealthCheck()
+
+	ip, err = d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.9", ip, "the cached IP follows the node")
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	select {
+	case event := <-events:
+		assert.Equal(t, NodeIPChanged, event.Type)
+		assert.Equal(t, "node-1", event.NewNode)
+	default:
+		t.Error("Expected a NodeIPChanged event")
+	}
+
+	// An unchanged IP emits nothing
+	d.performHealthCheck()
+	select {
+	case event := <-events:
+		t.Errorf("Expected no event for an unchanged IP, got %s", event.Type)
+	default:
+	}
+}
+
+// TestKubeNodeDiscovery_ServeStale tests that the cached node keeps serving
+// while the Kubernetes API is unreachable
+func TestKubeNodeDiscovery_ServeStale(t *testing.T) {
+	useFastAPIBackoff(t)
+	t.Setenv("CACHE_TTL", "1ms")
+
+	now := time.Now()
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, now.Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, now.Add(-time.Hour)),
+	)
+	d, err := NewKubeNodeDiscovery(clientset, "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+
+	// Prime the cache
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "10.0.1.1", ip)
+	assert.True(t, d.NodeListStaleSince().IsZero())
+
+	// The API goes down
+	var apiDown atomic.Bool
+	apiDown.Store(true)
+	clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if apiDown.Load() {
+			return true, nil, apierrors.NewServiceUnavailable("apiserver down")
+		}
+		return false, nil, nil
+	})
+	time.Sleep(5 * time.Millisecond)
+
+	ip, err = d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip, "the last healthy node keeps serving")
+
+	nodes, err := d.GetAllNodes(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, nodes, 2)
+	assert.False(t, d.NodeListStaleSince().IsZero(), "the node list is flagged as stale")
+
+	// The API recovers
+	apiDown.Store(false)
+	time.Sleep(5 * time.Millisecond)
+	_, err = d.GetAllNodes(context.Background())
+	require.NoError(t, err)
+	assert.True(t, d.NodeListStaleSince().IsZero(), "a fresh list clears the stale flag")
+}
+
+// TestKubeNodeDiscovery_ServeStaleWhileWatching tests that the node list is
+// flagged as stale when the node watch fails under running health monitoring,
+// even though the watcher's cache keeps answering
+func TestKubeNodeDiscovery_ServeStaleWhileWatching(t *testing.T) {
+	useFastAPIBackoff(t)
+	t.Setenv("CACHE_TTL", "1ms")
+	t.Setenv("HEALTH_CHECK_INTERVAL", "1h") // no resync during the test
+
+	now := time.Now()
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, now.Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, now.Add(-time.Hour)),
+	)
+	var apiDown atomic.Bool
+	watches := make(chan *watch.RaceFreeFakeWatcher, 10)
+	clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if apiDown.Load() {
+			return true, nil, apierrors.NewServiceUnavailable("apiserver down")
+		}
+		return false, nil, nil
+	})
+	clientset.PrependWatchReactor("nodes", func(k8stesting.Action) (bool, watch.Interface, error) {
+		if apiDown.Load() {
+			return true, nil, apierrors.NewServiceUnavailable("apiserver down")
+		}
+		w := watch.NewRaceFreeFake()
+		select {
+		case watches <- w:
+		default:
+		}
+		return true, w, nil
+	})
+	d, err := NewKubeNodeDiscovery(clientset, "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "10.0.1.1", ip)
+
+	d.StartHealthMonitoring()
+	t.Cleanup(d.StopHealthMonitoring)
+	require.Eventually(t, d.watcher.synced, time.Second, 10*time.Millisecond)
+	current := <-watches
+
+	_, err = d.GetAllNodes(context.Background())
+	require.NoError(t, err)
+	assert.True(t, d.NodeListStaleSince().IsZero())
+
+	// The API goes down and takes the open watch with it
+	apiDown.Store(true)
+	current.Stop()
+	require.Eventually(t, func() bool { return !d.NodeListStaleSince().IsZero() },
+		5*time.Second, 10*time.Millisecond, "a failing watch flags the node list as stale")
+
+	ip, err = d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip, "the last healthy node keeps serving")
+	assert.False(t, d.NodeListStaleSince().IsZero())
+
+	// The API recovers and the watcher lists and watches again
+	apiDown.Store(false)
+	assert.Eventually(t, func() bool {
+		_, err := d.GetAllNodes(context.Background())
+		return err == nil && d.NodeListStaleSince().IsZero()
+	}, 10*time.Second, 50*time.Millisecond, "a recovered watch clears the stale flag")
+}
+
+// TestKubeNodeDiscovery_ServeStaleWithoutCache tests that a failed first list is an error
+func TestKubeNodeDiscovery_ServeStaleWithoutCache(t *testing.T) {
+	useFastAPIBackoff(t)
+
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("apiserver down")
+	})
+	d, err := NewKubeNodeDiscovery(clientset, "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+
+	_, err = d.GetCurrentNodeIP(context.Background())
+	assert.Error(t, err)
+	assert.True(t, d.NodeListStaleSince().IsZero())
+}
+
+// TestKubeNodeDiscovery_ListForbidden tests that a missing nodes.list permission
+// fails without retries and with an error naming the permission and the account
+func TestKubeNodeDiscovery_ListForbidden(t *testing.T) {
+	useFastAPIBackoff(t)
+
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "",
+			errors.New(`User "system:serviceaccount:default:k8s-node-proxy" cannot list resource "nodes" in API group "" at the cluster scope`))
+	})
+	d, err := NewKubeNodeDiscovery(clientset, "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+
+	_, err = d.GetCurrentNodeIP(context.Background())
+	require.Error(t, err)
+
+	var permissionErr *services.PermissionError
+	require.ErrorAs(t, err, &permissionErr)
+	assert.Equal(t, "list", permissionErr.Verb)
+	assert.Equal(t, "nodes", permissionErr.Resource)
+	assert.Empty(t, permissionErr.Namespace)
+	assert.Equal(t, "system:serviceaccount:default:k8s-node-proxy", permissionErr.User)
+	assert.Contains(t, err.Error(), `missing RBAC permission: "system:serviceaccount:default:k8s-node-proxy" cannot list nodes at the cluster scope`)
+	assert.True(t, apierrors.IsForbidden(err), "the API error stays inspectable")
+	assert.Equal(t, 1, countNodeLists(clientset), "Forbidden is not retried")
+}
+
+// TestKubeNodeDiscovery_StopCancelsFailover tests that stopping health
+// monitoring interrupts a failover stuck retrying the Kubernetes API
+func TestKubeNodeDiscovery_StopCancelsFailover(t *testing.T) {
+	t.Setenv("CACHE_TTL", "1ms")
+
+	now := time.Now()
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, now.Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, now.Add(-time.Hour)),
+	)
+	d, err := NewKubeNodeDiscovery(clientset, "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+
+	_, err = d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+
+	// The API goes down: every call fails slowly and is retried with apiBackoff
+	failSlowly := func(k8stesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(20 * time.Millisecond)
+		return true, nil, apierrors.NewServiceUnavailable("apiserver down")
+	}
+	clientset.PrependReactor("list", "nodes", failSlowly)
+	clientset.PrependReactor("get", "nodes", failSlowly)
+	d.StartHealthMonitoring()
+	time.Sleep(5 * time.Millisecond)
+
+	result := make(chan error, 1)
+	go func() { result <- d.performFailover("node-1") }()
+
+	time.Sleep(100 * time.Millisecond)
+	stopped := time.Now()
+	d.StopHealthMonitoring()
+
+	select {
+	case err := <-result:
+		assert.Error(t, err)
+		assert.Less(t, time.Since(stopped), 500*time.Millisecond, "failover should return promptly once monitoring stops")
+	case <-time.After(5 * time.Second):
+		t.Fatal("failover did not return after monitoring stopped")
+	}
+	assert.Equal(t, "node-1", d.GetCurrentNodeName(), "a cancelled failover keeps the current node")
+}
+
+func TestNodeFilter_ListTimeout(t *testing.T) {
+	options := nodeFilter{}.listOptions()
+	require.NotNil(t, options.TimeoutSeconds)
+	assert.Equal(t, apiListTimeoutSeconds, *options.TimeoutSeconds)
+}
+
+// TestKubeNodeDiscovery_SelectNode tests that a pinned node survives rotation
+// and re-discovery, and that a failover away from it clears the pin
+func TestKubeNodeDiscovery_SelectNode(t *testing.T) {
+	t.Setenv("NODE_ROTATION_INTERVAL", "1ms")
+	d, clientset := newCandidatesTestDiscovery(t)
+
+	require.NoError(t, d.SelectNode("node-3"))
+	assert.Equal(t, "node-3", d.GetCurrentNodeName())
+	assert.Equal(t, "node-3", d.PinnedNode())
+
+	time.Sleep(5 * time.Millisecond)
+	d.rotateIfDue()
+	_, err := d.Rediscover(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "node-3", d.GetCurrentNodeName(), "automatic selection must not move a pinned node")
+
+	require.ErrorIs(t, d.SelectNode("node-9"), ErrUnknownNode)
+	setNodeReady(t, clientset, "node-2", false)
+	require.ErrorIs(t, d.SelectNode("node-2"), ErrNodeNotHealthy)
+	assert.Equal(t, "node-3", d.GetCurrentNodeName())
+
+	// The pinned node dying still fails over
+	setNodeReady(t, clientset, "node-3", false)
+	d.performHealthCheck()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+	assert.Empty(t, d.PinnedNode())
+}
+
+// TestKubeNodeDiscovery_PaginatedList tests that a node list served in pages
+// is followed through its Continue tokens to the last node
+func TestKubeNodeDiscovery_PaginatedList(t *testing.T) {
+	now := time.Now()
+	var nodes []corev1.Node
+	for i := range 1200 {
+		nodes = append(nodes, *newTestNode(fmt.Sprintf("node-%d", i), fmt.Sprintf("10.0.%d.%d", i/250, i%250+1), true, now.Add(-time.Duration(i)*time.Minute)))
+	}
+
+	// The fake clientset ignores Limit and Continue, so serve the pages in turn
+	clientset := fake.NewClientset()
+	var page int
+	clientset.PrependReactor("list", "nodes", func(k8stesting.Action) (bool, runtime.Object, error) {
+		start := page * int(services.ListPageSize)
+		end := min(start+int(services.ListPageSize), len(nodes))
+		list := &corev1.NodeList{Items: nodes[start:end]}
+		if page++; end < len(nodes) {
+			list.Continue = fmt.Sprintf("page-%d", page)
+		} else {
+			page = 0
+		}
+		return true, list, nil
+	})
+	d, err := NewKubeNodeDiscovery(clientset, "test")
+	require.NoError(t, err)
+	t.Cleanup(d.cancel)
+
+	ips, err := d.GetAllNodeIPs(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, ips, len(nodes), "every page's nodes are discovered")
+	assert.Equal(t, 3, countNodeLists(clientset), "1200 nodes are listed in pages of 500")
+
+	// The oldest node is on the last page
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.4.200", ip)
+}
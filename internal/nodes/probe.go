@@ -0,0 +1,173 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultActiveProbeTimeout = 2 * time.Second
+
+// activeProbe checks that the selected node actually accepts connections on a
+// proxied NodePort, catching nodes that report Ready while kube-proxy or the
+// NodePort path is broken (ACTIVE_HEALTH_PROBE). A failed probe counts as a
+// failed health check. With a path configured (ACTIVE_HEALTH_PATH) the probe
+// is an HTTP GET checking the application behind the NodePort, not just the
+// connection.
+type activeProbe struct {
+	enabled bool
+	timeout time.Duration
+
+	// path is requested over HTTP instead of only connecting; empty dials only
+	path string
+	// expected holds the accepted response statuses for path
+	expected statusRanges
+	client   *http.Client
+
+	mu    sync.Mutex
+	ports []int
+}
+
+// activeProbeFromEnv reads ACTIVE_HEALTH_PROBE (default false),
+// ACTIVE_HEALTH_PROBE_TIMEOUT (default 2s), ACTIVE_HEALTH_PATH and
+// ACTIVE_HEALTH_EXPECTED_STATUS (default 200-299). Setting ACTIVE_HEALTH_PATH
+// enables the probe.
+func activeProbeFromEnv() (*activeProbe, error) {
+	enabled, err := envBool("ACTIVE_HEALTH_PROBE", false)
+	if err != nil {
+		return nil, err
+	}
+
+	path := os.Getenv("ACTIVE_HEALTH_PATH")
+	if path != "" {
+		if !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid ACTIVE_HEALTH_PATH value %q: must start with /", path)
+		}
+		enabled = true
+	}
+
+	expected := statusRanges{{200, 299}}
+	if value := os.Getenv("ACTIVE_HEALTH_EXPECTED_STATUS"); value != "" {
+		if expected, err = parseStatusRanges(value); err != nil {
+			return nil, fmt.Errorf("invalid ACTIVE_HEALTH_EXPECTED_STATUS value %q: %w", value, err)
+		}
+	}
+
+	timeout, err := envDuration("ACTIVE_HEALTH_PROBE_TIMEOUT", defaultActiveProbeTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if timeout == 0 {
+		return nil, fmt.Errorf("invalid ACTIVE_HEALTH_PROBE_TIMEOUT value %q: must be positive", os.Getenv("ACTIVE_HEALTH_PROBE_TIMEOUT"))
+	}
+
+	return &activeProbe{
+		enabled:  enabled,
+		timeout:  timeout,
+		path:     path,
+		expected: expected,
+		// Redirects are answers too; whether they pass is up to expected
+		client: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}, nil
+}
+
+// setPorts sets the NodePorts the probe may dial
+func (p *activeProbe) setPorts(ports []int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ports = append([]int(nil), ports...)
+}
+
+// check dials the first proxied NodePort on ip, or requests the health path on
+// it. It passes when probing is disabled or no NodePorts are known yet.
+func (p *activeProbe) check(ctx context.Context, ip string) error {
+	if !p.enabled {
+		return nil
+	}
+
+	p.mu.Lock()
+	if len(p.ports) == 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	port := p.ports[0]
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	address := net.JoinHostPort(ip, strconv.Itoa(port))
+	if p.path != "" {
+		return p.checkPath(ctx, address)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("NodePort probe failed: %w", err)
+	}
+	return conn.Close()
+}
+
+// checkPath requests the health path on address and checks the response status
+func (p *activeProbe) checkPath(ctx context.Context, address string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+address+p.path, nil)
+	if err != nil {
+		return fmt.Errorf("NodePort health path probe failed: %w", err)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("NodePort health path probe failed: %w", err)
+	}
+	resp.Body.Close()
+	if !p.expected.contains(resp.StatusCode) {
+		return fmt.Errorf("NodePort health path %s returned status %d", p.path, resp.StatusCode)
+	}
+	return nil
+}
+
+// statusRanges is a set of inclusive HTTP status ranges
+type statusRanges [][2]int
+
+// parseStatusRanges parses a comma-separated list of statuses and ranges, e.g. "200-299,301"
+func parseStatusRanges(value string) (statusRanges, error) {
+	var ranges statusRanges
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		low, high, isRange := strings.Cut(part, "-")
+		if !isRange {
+			high = low
+		}
+		from, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a status or range", part)
+		}
+		to, err := strconv.Atoi(strings.TrimSpace(high))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a status or range", part)
+		}
+		if from < 100 || to > 599 || from > to {
+			return nil, fmt.Errorf("%q is not within 100-599", part)
+		}
+		ranges = append(ranges, [2]int{from, to})
+	}
+	return ranges, nil
+}
+
+// contains reports whether status falls in one of the ranges
+func (r statusRanges) contains(status int) bool {
+	for _, span := range r {
+		if status >= span[0] && status <= span[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package nodes
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newProbeTestDiscovery returns a discovery serving node-1 at 127.0.0.1 that
+// probes port and fails over to node-2 on the first failure
+func newProbeTestDiscovery(t *testing.T, port int) *GenericNodeDiscovery {
+	t.Helper()
+	t.Setenv("ACTIVE_HEALTH_PROBE", "true")
+	t.Setenv("ACTIVE_HEALTH_PROBE_TIMEOUT", "500ms")
+	t.Setenv("FAILURE_THRESHOLD", "1")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "127.0.0.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "127.0.0.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+	d.SetProbePorts([]int{port})
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+	return d
+}
+
+// TestActiveProbe_RefusedNodePort tests that a Ready node whose NodePort refuses
+// connections is failed over
+func TestActiveProbe_RefusedNodePort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close() // nothing listens on the NodePort now
+
+	d := newProbeTestDiscovery(t, port)
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+}
+
+// TestActiveProbe_ReachableNodePort tests that a Ready node accepting connections
+// on its NodePort stays selected
+func TestActiveProbe_ReachableNodePort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	d := newProbeTestDiscovery(t, listener.Addr().(*net.TCPAddr).Port)
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+	assert.Equal(t, 0, d.failureCount)
+}
+
+func TestActiveProbe_Disabled(t *testing.T) {
+	t.Setenv("ACTIVE_HEALTH_PROBE", "")
+	probe, err := activeProbeFromEnv()
+	require.NoError(t, err)
+	probe.setPorts([]int{1})
+
+	assert.NoError(t, probe.check(context.Background(), "127.0.0.1"), "a disabled probe always passes")
+}
+
+// newHealthPathBackend serves path with status on a NodePort of node-1 (127.0.0.1)
+func newHealthPathBackend(t *testing.T, path string, status int) int {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(backend.Close)
+	return backend.Listener.Addr().(*net.TCPAddr).Port
+}
+
+// TestActiveProbe_HealthPathFailing tests that a node whose health path returns
+// 500 is failed over even though it accepts connections
+func TestActiveProbe_HealthPathFailing(t *testing.T) {
+	t.Setenv("ACTIVE_HEALTH_PATH", "/healthz")
+	d := newProbeTestDiscovery(t, newHealthPathBackend(t, "/healthz", http.StatusInternalServerError))
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+}
+
+// TestActiveProbe_HealthPathHealthy tests that a 2xx health path keeps the node selected
+func TestActiveProbe_HealthPathHealthy(t *testing.T) {
+	t.Setenv("ACTIVE_HEALTH_PATH", "/healthz")
+	d := newProbeTestDiscovery(t, newHealthPathBackend(t, "/healthz", http.StatusNoContent))
+
+	d.performHealthCheck()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+	assert.Equal(t, 0, d.failureCount)
+}
+
+func TestActiveProbeFromEnv_HealthPath(t *testing.T) {
+	t.Run("PathEnablesProbe", func(t *testing.T) {
+		t.Setenv("ACTIVE_HEALTH_PROBE", "")
+		t.Setenv("ACTIVE_HEALTH_PATH", "/healthz")
+		probe, err := activeProbeFromEnv()
+		require.NoError(t, err)
+		assert.True(t, probe.enabled)
+		assert.True(t, probe.expected.contains(204))
+		assert.False(t, probe.expected.contains(301))
+	})
+
+	t.Run("ExpectedStatus", func(t *testing.T) {
+		t.Setenv("ACTIVE_HEALTH_PATH", "/healthz")
+		t.Setenv("ACTIVE_HEALTH_EXPECTED_STATUS", "200, 300-399")
+		probe, err := activeProbeFromEnv()
+		require.NoError(t, err)
+		assert.True(t, probe.expected.contains(200))
+		assert.True(t, probe.expected.contains(302))
+		assert.False(t, probe.expected.contains(204))
+	})
+
+	for _, tt := range []struct{ name, path, expected string }{
+		{"RelativePath", "healthz", ""},
+		{"NotAStatus", "/healthz", "ok"},
+		{"OutOfRange", "/healthz", "200-700"},
+		{"Reversed", "/healthz", "299-200"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ACTIVE_HEALTH_PATH", tt.path)
+			t.Setenv("ACTIVE_HEALTH_EXPECTED_STATUS", tt.expected)
+			_, err := activeProbeFromEnv()
+			assert.Error(t, err)
+		})
+	}
+}
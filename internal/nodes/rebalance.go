@@ -0,0 +1,72 @@
+package nodes
+
+import (
+	"log/slog"
+	"os"
+	"time"
+)
+
+const defaultRebalanceDelay = time.Minute
+
+// rebalancer switches back to the selector's preferred node after a failover
+// once that node has healed (AUTO_REBALANCE). The preferred node must stay
+// preferred and healthy across checks spanning delay before the switch, so a
+// node that flaps between Ready and NotReady does not drag traffic back and forth.
+// Its state is guarded by the owning discovery's mutex.
+type rebalancer struct {
+	enabled bool
+	delay   time.Duration
+
+	// The preferred node seen on recent checks and when it was first seen
+	candidate string
+	since     time.Time
+}
+
+// rebalancerFromEnv reads AUTO_REBALANCE (default false) and AUTO_REBALANCE_DELAY
+// (default 1m). Rebalancing stays off for selectors without a PreferenceOrder.
+func rebalancerFromEnv(selector NodeSelector) (rebalancer, error) {
+	enabled, err := envBool("AUTO_REBALANCE", false)
+	if err != nil {
+		return rebalancer{}, err
+	}
+
+	delay, err := envDuration("AUTO_REBALANCE_DELAY", defaultRebalanceDelay)
+	if err != nil {
+		return rebalancer{}, err
+	}
+
+	if _, ok := selector.(PreferenceOrder); enabled && !ok {
+		slog.Warn("AUTO_REBALANCE has no effect with this NODE_SELECTION strategy", "node_selection", os.Getenv("NODE_SELECTION"))
+		enabled = false
+	}
+
+	return rebalancer{enabled: enabled, delay: delay}, nil
+}
+
+// next returns the node to switch to, or nil to stay on current. The selector's
+// choice must be strictly preferred over current and have been so since at
+// least delay before now.
+func (r *rebalancer) next(selector NodeSelector, nodes []NodeInfo, current string, now time.Time) *NodeInfo {
+	order, ok := selector.(PreferenceOrder)
+	if !r.enabled || !ok {
+		return nil
+	}
+
+	currentNode := healthyNodeByName(nodes, current)
+	preferred := selector.Select(nodes)
+	if currentNode == nil || preferred == nil || preferred.Name == current || !order.Prefers(*preferred, *currentNode) {
+		r.candidate = ""
+		return nil
+	}
+
+	if preferred.Name != r.candidate {
+		r.candidate = preferred.Name
+		r.since = now
+	}
+	if now.Sub(r.since) < r.delay {
+		return nil
+	}
+
+	r.candidate = ""
+	return preferred
+}
@@ -0,0 +1,109 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRebalancerNext(t *testing.T) {
+	now := time.Now()
+	nodes := []NodeInfo{
+		{Name: "node-old", Status: NodeHealthy, CreationTime: now.Add(-3 * time.Hour)},
+		{Name: "node-new", Status: NodeHealthy, CreationTime: now.Add(-1 * time.Hour)},
+	}
+
+	t.Run("WaitsForDelay", func(t *testing.T) {
+		r := rebalancer{enabled: true, delay: time.Minute}
+
+		assert.Nil(t, r.next(OldestHealthy{}, nodes, "node-new", now), "first sighting starts the delay")
+		assert.Nil(t, r.next(OldestHealthy{}, nodes, "node-new", now.Add(30*time.Second)))
+
+		preferred := r.next(OldestHealthy{}, nodes, "node-new", now.Add(time.Minute))
+		require.NotNil(t, preferred)
+		assert.Equal(t, "node-old", preferred.Name)
+	})
+
+	t.Run("FlappingRestartsDelay", func(t *testing.T) {
+		r := rebalancer{enabled: true, delay: time.Minute}
+		flapped := []NodeInfo{{Name: "node-old", Status: NodeUnhealthy, CreationTime: nodes[0].CreationTime}, nodes[1]}
+
+		assert.Nil(t, r.next(OldestHealthy{}, nodes, "node-new", now))
+		assert.Nil(t, r.next(OldestHealthy{}, flapped, "node-new", now.Add(30*time.Second)))
+		assert.Nil(t, r.next(OldestHealthy{}, nodes, "node-new", now.Add(time.Minute)), "delay restarts after the node flaps")
+		assert.NotNil(t, r.next(OldestHealthy{}, nodes, "node-new", now.Add(2*time.Minute)))
+	})
+
+	t.Run("RespectsSelector", func(t *testing.T) {
+		r := rebalancer{enabled: true}
+		assert.Nil(t, r.next(OldestHealthy{}, nodes, "node-old", now), "already on the preferred node")
+		assert.Nil(t, r.next(NewestHealthy{}, nodes, "node-new", now), "newest selection prefers the current node")
+		assert.Nil(t, r.next(RandomHealthy{}, nodes, "node-new", now), "random selection has no preferred node")
+
+		preferred := r.next(NewestHealthy{}, nodes, "node-old", now)
+		require.NotNil(t, preferred)
+		assert.Equal(t, "node-new", preferred.Name)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		r := rebalancer{}
+		assert.Nil(t, r.next(OldestHealthy{}, nodes, "node-new", now))
+	})
+}
+
+func TestRebalancerFromEnv(t *testing.T) {
+	t.Setenv("AUTO_REBALANCE", "true")
+
+	r, err := rebalancerFromEnv(OldestHealthy{})
+	require.NoError(t, err)
+	assert.True(t, r.enabled)
+	assert.Equal(t, defaultRebalanceDelay, r.delay)
+
+	r, err = rebalancerFromEnv(RandomHealthy{})
+	require.NoError(t, err)
+	assert.False(t, r.enabled, "random selection cannot rebalance")
+
+	t.Setenv("AUTO_REBALANCE", "sometimes")
+	_, err = rebalancerFromEnv(OldestHealthy{})
+	assert.Error(t, err)
+}
+
+// TestAutoRebalance tests that the discovery fails over away from the oldest node
+// and switches back once it is healthy again
+func TestAutoRebalance(t *testing.T) {
+	t.Setenv("AUTO_REBALANCE", "true")
+	t.Setenv("AUTO_REBALANCE_DELAY", "0s")
+	t.Setenv("FAILURE_THRESHOLD", "1")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	setNodeReady(t, clientset, "node-1", false)
+	d.performHealthCheck()
+	require.Equal(t, "node-2", d.GetCurrentNodeName(), "expected failover away from the unhealthy oldest node")
+
+	// node-2 is healthy but node-1 is still NotReady
+	d.performHealthCheck()
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+
+	setNodeReady(t, clientset, "node-1", true)
+	d.performHealthCheck()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName(), "expected rebalance back to the recovered oldest node")
+
+	ip, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.1", ip)
+}
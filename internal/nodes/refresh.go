@@ -0,0 +1,78 @@
+package nodes
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// refreshAhead returns how old the node list may get before the background
+// refresher lists the nodes again: four fifths of CACHE_TTL, so the cache is
+// renewed before requests find it expired
+func (d *KubeNodeDiscovery) refreshAhead() time.Duration {
+	return d.cacheTTL - d.cacheTTL/5
+}
+
+// cacheRefreshLoop warms the node list and the selected node up as soon as
+// monitoring starts and refreshes them shortly before CACHE_TTL expires, so
+// GetCurrentNodeIP is served from memory instead of waiting on the Kubernetes
+// API. A failed refresh is retried after a health-check interval; requests
+// then fall back to refreshing the cache themselves once it expires.
+func (d *KubeNodeDiscovery) cacheRefreshLoop() {
+	timer := time.NewTimer(d.untilCacheRefresh())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-d.monitorCtx.Done():
+			return
+		case <-timer.C:
+			wait := d.checkInterval
+			if err := d.refreshCache(); err != nil {
+				slog.Warn("Background node cache refresh failed", "platform", d.platform, "error", err)
+			} else {
+				wait = d.untilCacheRefresh()
+			}
+			timer.Reset(wait)
+		}
+	}
+}
+
+// untilCacheRefresh returns how long until the node list is due for a
+// background refresh; 0 while nothing is cached yet
+func (d *KubeNodeDiscovery) untilCacheRefresh() time.Duration {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if len(d.cachedNodes) == 0 {
+		return 0
+	}
+	return max(time.Until(d.cacheTime.Add(d.refreshAhead())), 0)
+}
+
+// refreshCache lists the nodes and re-runs node selection on the new list,
+// which keeps the current node while it is healthy. It shares discoverMutex
+// with request-driven discovery, and skips the list when a request, a
+// Rediscover or a health check renewed the cache in the meantime.
+func (d *KubeNodeDiscovery) refreshCache() error {
+	d.discoverMutex.Lock()
+	defer d.discoverMutex.Unlock()
+
+	d.mutex.RLock()
+	due := len(d.cachedNodes) == 0 || time.Since(d.cacheTime) >= d.refreshAhead()
+	d.mutex.RUnlock()
+	if !due {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(d.monitorCtx, 10*time.Second)
+	defer cancel()
+
+	nodes, err := d.listNodeInfos(ctx)
+	if err != nil {
+		return err
+	}
+	d.storeNodes(nodes)
+
+	_, err = d.selectNode(ctx)
+	return err
+}
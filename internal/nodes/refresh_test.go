@@ -0,0 +1,42 @@
+package nodes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKubeNodeDiscovery_BackgroundCacheRefresh tests that monitoring warms the
+// cache up and renews it before CACHE_TTL expires, without any request asking
+// for a node
+func TestKubeNodeDiscovery_BackgroundCacheRefresh(t *testing.T) {
+	const ttl = 500 * time.Millisecond
+	t.Setenv("CACHE_TTL", ttl.String())
+	d := newTestKubeDiscovery(t, newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-time.Hour)))
+
+	cacheTime := func() time.Time {
+		d.mutex.RLock()
+		defer d.mutex.RUnlock()
+		return d.cacheTime
+	}
+
+	d.StartHealthMonitoring()
+	defer d.StopHealthMonitoring()
+
+	require.Eventually(t, func() bool {
+		_, fresh := d.freshNodeIP()
+		return fresh
+	}, 2*time.Second, 10*time.Millisecond, "the selected node is warmed up without a request")
+	warmedAt := cacheTime()
+
+	require.Eventually(t, func() bool {
+		return cacheTime().After(warmedAt)
+	}, 2*time.Second, 10*time.Millisecond, "the node list is refreshed in the background")
+	assert.Less(t, cacheTime().Sub(warmedAt), ttl, "the refresh happens before the cache expires")
+
+	ip, fresh := d.freshNodeIP()
+	assert.True(t, fresh, "GetCurrentNodeIP is served from the cache")
+	assert.Equal(t, "10.0.1.1", ip)
+}
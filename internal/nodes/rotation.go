@@ -0,0 +1,58 @@
+package nodes
+
+import (
+	"sort"
+	"time"
+)
+
+// nodeRotationIntervalFromEnv reads NODE_ROTATION_INTERVAL: how long a node stays
+// selected before the health loop rotates to the next healthy node (0 disables rotation)
+func nodeRotationIntervalFromEnv() (time.Duration, error) {
+	return envDuration("NODE_ROTATION_INTERVAL", 0)
+}
+
+// rotationDue reports whether the node selected at selectedAt should be rotated out
+func rotationDue(interval time.Duration, selectedAt time.Time) bool {
+	return interval > 0 && !selectedAt.IsZero() && time.Since(selectedAt) >= interval
+}
+
+// nextHealthyNode returns the healthy node that follows current in age order,
+// wrapping around, so repeated rotations cycle through every healthy node.
+// Returns nil when no other healthy node exists.
+func nextHealthyNode(nodes []NodeInfo, current string) *NodeInfo {
+	ordered := make([]NodeInfo, len(nodes))
+	copy(ordered, nodes)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].CreationTime.Before(ordered[j].CreationTime)
+	})
+
+	start := 0
+	for i, node := range ordered {
+		if node.Name == current {
+			start = i + 1
+			break
+		}
+	}
+
+	for i := 0; i < len(ordered); i++ {
+		node := ordered[(start+i)%len(ordered)]
+		if node.Name != current && node.Status == NodeHealthy {
+			return &node
+		}
+	}
+	return nil
+}
+
+// healthyNodeByName returns the named node if it is in the list and healthy, so
+// periodic re-discovery keeps the current node instead of undoing a failover or rotation
+func healthyNodeByName(nodes []NodeInfo, name string) *NodeInfo {
+	if name == "" {
+		return nil
+	}
+	for i := range nodes {
+		if nodes[i].Name == name && nodes[i].Status == NodeHealthy {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
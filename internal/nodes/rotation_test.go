@@ -0,0 +1,101 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNextHealthyNode(t *testing.T) {
+	now := time.Now()
+	nodes := []NodeInfo{
+		{Name: "node-3", Status: NodeHealthy, CreationTime: now.Add(-1 * time.Hour)},
+		{Name: "node-1", Status: NodeHealthy, CreationTime: now.Add(-3 * time.Hour)},
+		{Name: "node-2", Status: NodeUnhealthy, CreationTime: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		current string
+		want    string
+	}{
+		{"node-1", "node-3"}, // skips unhealthy node-2
+		{"node-3", "node-1"}, // wraps around
+		{"", "node-1"},       // no selection yet starts from the oldest
+	}
+	for _, tt := range tests {
+		next := nextHealthyNode(nodes, tt.current)
+		require.NotNil(t, next, "current %q", tt.current)
+		assert.Equal(t, tt.want, next.Name, "current %q", tt.current)
+	}
+
+	assert.Nil(t, nextHealthyNode(nodes[1:2], "node-1"), "no other healthy node")
+}
+
+// TestRotateIfDue tests that the selected node changes once the rotation interval
+// elapses when multiple healthy nodes exist
+func TestRotateIfDue(t *testing.T) {
+	t.Setenv("NODE_ROTATION_INTERVAL", "100ms")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-3*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-3", "10.0.1.3", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	d.rotateIfDue()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName(), "rotation should wait for the interval")
+
+	for _, want := range []string{"node-2", "node-3", "node-1"} {
+		time.Sleep(120 * time.Millisecond)
+		d.rotateIfDue()
+		assert.Equal(t, want, d.GetCurrentNodeName())
+
+		ip, err := d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, d.currentNodeIP, ip, "proxy traffic should follow the rotation")
+	}
+}
+
+func TestRotateIfDue_Disabled(t *testing.T) {
+	t.Setenv("NODE_ROTATION_INTERVAL", "")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+
+	d.selectedAt = time.Now().Add(-24 * time.Hour)
+	d.rotateIfDue()
+	assert.Equal(t, "node-1", d.GetCurrentNodeName())
+}
+
+// TestDiscoverNodeIP_KeepsHealthyCurrentNode tests that re-discovery after the cache
+// expires doesn't move the selection back to the oldest node
+func TestDiscoverNodeIP_KeepsHealthyCurrentNode(t *testing.T) {
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	d.currentNodeName = "node-2"
+	d.currentNodeIP = "10.0.1.2"
+
+	ip, err := d.discoverNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.1.2", ip)
+	assert.Equal(t, "node-2", d.GetCurrentNodeName())
+}
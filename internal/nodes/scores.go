@@ -0,0 +1,93 @@
+package nodes
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const defaultFailureScoreHalfLife = 10 * time.Minute
+
+// FailureScorer reports how much a node has failed health checks recently
+type FailureScorer interface {
+	FailureScore(name string) float64
+}
+
+// failureScores tracks a recent-failure score per node. Each failed health check
+// adds 1 and the score halves every halfLife, so a flaky node's score fades once
+// it stays healthy.
+type failureScores struct {
+	mu       sync.Mutex
+	halfLife time.Duration
+	entries  map[string]failureScore
+	now      func() time.Time
+}
+
+type failureScore struct {
+	value   float64
+	updated time.Time
+}
+
+func newFailureScores(halfLife time.Duration) *failureScores {
+	return &failureScores{
+		halfLife: halfLife,
+		entries:  make(map[string]failureScore),
+		now:      time.Now,
+	}
+}
+
+// failureScoreHalfLifeFromEnv reads FAILURE_SCORE_HALF_LIFE (default 10m)
+func failureScoreHalfLifeFromEnv() (time.Duration, error) {
+	halfLife, err := envDuration("FAILURE_SCORE_HALF_LIFE", defaultFailureScoreHalfLife)
+	if err != nil {
+		return 0, err
+	}
+	if halfLife == 0 {
+		return defaultFailureScoreHalfLife, nil
+	}
+	return halfLife, nil
+}
+
+// recordFailure adds a failed health check to the node's score
+func (s *failureScores) recordFailure(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.entries[name] = failureScore{value: s.decayed(s.entries[name], now) + 1, updated: now}
+}
+
+// FailureScore returns the node's decayed score; 0 means no recent failures
+func (s *failureScores) FailureScore(name string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.decayed(s.entries[name], s.now())
+}
+
+// snapshot returns the decayed score of every node that has failed recently
+func (s *failureScores) snapshot() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	scores := make(map[string]float64, len(s.entries))
+	for name, entry := range s.entries {
+		score := s.decayed(entry, now)
+		if score < 0.01 {
+			// Fully recovered; forget the node
+			delete(s.entries, name)
+			continue
+		}
+		scores[name] = score
+	}
+	return scores
+}
+
+func (s *failureScores) decayed(entry failureScore, now time.Time) float64 {
+	if entry.value == 0 {
+		return 0
+	}
+	elapsed := now.Sub(entry.updated)
+	return entry.value * math.Pow(0.5, elapsed.Seconds()/s.halfLife.Seconds())
+}
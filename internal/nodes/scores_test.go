@@ -0,0 +1,95 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestFailureScores_Decay(t *testing.T) {
+	now := time.Now()
+	scores := newFailureScores(time.Minute)
+	scores.now = func() time.Time { return now }
+
+	scores.recordFailure("node-1")
+	scores.recordFailure("node-1")
+	assert.InDelta(t, 2.0, scores.FailureScore("node-1"), 0.001)
+	assert.Zero(t, scores.FailureScore("node-2"))
+
+	now = now.Add(time.Minute)
+	assert.InDelta(t, 1.0, scores.FailureScore("node-1"), 0.001, "score halves every half-life")
+
+	scores.recordFailure("node-1")
+	assert.InDelta(t, 2.0, scores.FailureScore("node-1"), 0.001)
+
+	now = now.Add(time.Hour)
+	assert.Empty(t, scores.snapshot(), "recovered nodes are dropped")
+}
+
+func TestFailureScoreHalfLifeFromEnv(t *testing.T) {
+	t.Setenv("FAILURE_SCORE_HALF_LIFE", "")
+	halfLife, err := failureScoreHalfLifeFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, defaultFailureScoreHalfLife, halfLife)
+
+	t.Setenv("FAILURE_SCORE_HALF_LIFE", "30s")
+	halfLife, err = failureScoreHalfLifeFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, halfLife)
+
+	t.Setenv("FAILURE_SCORE_HALF_LIFE", "soon")
+	_, err = failureScoreHalfLifeFromEnv()
+	assert.Error(t, err)
+}
+
+// TestWeightedHealthy tests that a node with recent failures is picked proportionally
+// less often than a clean node of the same age
+func TestWeightedHealthy(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	nodes := []NodeInfo{
+		{Name: "node-flaky", Status: NodeHealthy, CreationTime: created},
+		{Name: "node-clean", Status: NodeHealthy, CreationTime: created},
+	}
+
+	scores := newFailureScores(time.Hour)
+	for i := 0; i < 3; i++ {
+		scores.recordFailure("node-flaky")
+	}
+	selector := WeightedHealthy{Scores: scores}
+
+	const picks = 10000
+	counts := map[string]int{}
+	for i := 0; i < picks; i++ {
+		selected := selector.Select(nodes)
+		require.NotNil(t, selected)
+		counts[selected.Name]++
+	}
+
+	// Weights are 1/(1+3) and 1/(1+0): the flaky node should get about 20% of picks
+	assert.InDelta(t, 0.2, float64(counts["node-flaky"])/picks, 0.03)
+	assert.Nil(t, selector.Select(nodes[:0]))
+}
+
+func TestHandleNodeFailure_RecordsFailureScore(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, d.GetNodeFailureScores())
+
+	setNodeReady(t, clientset, "node-1", false)
+	d.performHealthCheck()
+
+	assert.InDelta(t, 1.0, d.GetNodeFailureScores()["node-1"], 0.01)
+}
@@ -0,0 +1,162 @@
+package nodes
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NodeSelector picks the node to proxy to from a list of nodes.
+// Implementations return nil when no node in the list is healthy.
+type NodeSelector interface {
+	Select(nodes []NodeInfo) *NodeInfo
+}
+
+// PreferenceOrder is implemented by selectors that rank nodes in a stable order.
+// Only these selectors take part in AUTO_REBALANCE: random, weighted and
+// round-robin selection have no preferred node to return to.
+type PreferenceOrder interface {
+	Prefers(a, b NodeInfo) bool
+}
+
+// OldestHealthy selects the healthy node with the earliest creation time (default)
+type OldestHealthy struct{}
+
+// Prefers reports whether a is strictly older than b
+func (OldestHealthy) Prefers(a, b NodeInfo) bool {
+	return a.CreationTime.Before(b.CreationTime)
+}
+
+func (OldestHealthy) Select(nodes []NodeInfo) *NodeInfo {
+	healthy := healthyByAge(nodes)
+	if len(healthy) == 0 {
+		return nil
+	}
+	return &healthy[0]
+}
+
+// NewestHealthy selects the healthy node with the latest creation time
+type NewestHealthy struct{}
+
+// Prefers reports whether a is strictly newer than b
+func (NewestHealthy) Prefers(a, b NodeInfo) bool {
+	return a.CreationTime.After(b.CreationTime)
+}
+
+func (NewestHealthy) Select(nodes []NodeInfo) *NodeInfo {
+	healthy := healthyByAge(nodes)
+	if len(healthy) == 0 {
+		return nil
+	}
+	return &healthy[len(healthy)-1]
+}
+
+// RandomHealthy selects a uniformly random healthy node
+type RandomHealthy struct{}
+
+func (RandomHealthy) Select(nodes []NodeInfo) *NodeInfo {
+	healthy := healthyByAge(nodes)
+	if len(healthy) == 0 {
+		return nil
+	}
+	return &healthy[rand.N(len(healthy))]
+}
+
+// WeightedHealthy selects a random healthy node, weighting each by 1/(1+failure score)
+// so nodes that recently failed health checks receive proportionally less traffic
+type WeightedHealthy struct {
+	Scores FailureScorer
+}
+
+func (s WeightedHealthy) Select(nodes []NodeInfo) *NodeInfo {
+	healthy := healthyByAge(nodes)
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	weights := make([]float64, len(healthy))
+	total := 0.0
+	for i, node := range healthy {
+		weights[i] = 1 / (1 + s.Scores.FailureScore(node.Name))
+		total += weights[i]
+	}
+
+	pick := rand.Float64() * total
+	for i := range healthy {
+		pick -= weights[i]
+		if pick < 0 {
+			return &healthy[i]
+		}
+	}
+	return &healthy[len(healthy)-1]
+}
+
+// RoundRobin cycles through the healthy nodes in age order, one per selection
+type RoundRobin struct {
+	mu   sync.Mutex
+	last string
+}
+
+func (r *RoundRobin) Select(nodes []NodeInfo) *NodeInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	selected := nextHealthyNode(nodes, r.last)
+	if selected == nil {
+		// The last node is the only healthy one left
+		selected = healthyNodeByName(nodes, r.last)
+	}
+	if selected != nil {
+		r.last = selected.Name
+	}
+	return selected
+}
+
+// NodeSelectorFromEnv returns the selector named by NODE_SELECTION:
+// oldest (default), newest, random, weighted or round-robin. The weighted
+// selector reads recent failures from scores.
+func NodeSelectorFromEnv(scores FailureScorer) (NodeSelector, error) {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("NODE_SELECTION")))
+	switch value {
+	case "", "oldest":
+		return OldestHealthy{}, nil
+	case "newest":
+		return NewestHealthy{}, nil
+	case "random":
+		return RandomHealthy{}, nil
+	case "weighted":
+		return WeightedHealthy{Scores: scores}, nil
+	case "round-robin", "roundrobin":
+		return &RoundRobin{}, nil
+	default:
+		return nil, fmt.Errorf("invalid NODE_SELECTION value %q: must be one of oldest, newest, random, weighted, round-robin", value)
+	}
+}
+
+// healthyByAge returns the healthy nodes sorted oldest first
+func healthyByAge(nodes []NodeInfo) []NodeInfo {
+	var healthy []NodeInfo
+	for _, node := range nodes {
+		if node.Status == NodeHealthy {
+			healthy = append(healthy, node)
+		}
+	}
+	sort.SliceStable(healthy, func(i, j int) bool {
+		return healthy[i].CreationTime.Before(healthy[j].CreationTime)
+	})
+	return healthy
+}
+
+// withoutNode returns nodes minus the node with the given name, used to pick failover candidates
+func withoutNode(nodes []NodeInfo, name string) []NodeInfo {
+	var remaining []NodeInfo
+	for _, node := range nodes {
+		if node.Name != name {
+			remaining = append(remaining, node)
+		}
+	}
+	return remaining
+}
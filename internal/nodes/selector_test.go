@@ -0,0 +1,117 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestOldestHealthy(t *testing.T) {
+	selected := OldestHealthy{}.Select(newSelectionTestNodes())
+
+	// The older unhealthy node is passed over
+	require.NotNil(t, selected)
+	assert.Equal(t, "node-oldest", selected.Name)
+	assert.Equal(t, "10.0.1.1", selected.IP)
+	assert.Equal(t, NodeHealthy, selected.Status)
+}
+
+func TestNewestHealthy(t *testing.T) {
+	selected := NewestHealthy{}.Select(newSelectionTestNodes())
+
+	require.NotNil(t, selected)
+	assert.Equal(t, "node-newest", selected.Name)
+}
+
+func TestRandomHealthy(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		selected := RandomHealthy{}.Select(newSelectionTestNodes())
+		require.NotNil(t, selected)
+		assert.Equal(t, NodeHealthy, selected.Status)
+		seen[selected.Name] = true
+	}
+
+	assert.Len(t, seen, 3, "expected every healthy node to be picked at least once")
+}
+
+func TestRoundRobin(t *testing.T) {
+	nodes := newSelectionTestNodes()
+	selector := &RoundRobin{}
+
+	var names []string
+	for i := 0; i < 4; i++ {
+		selected := selector.Select(nodes)
+		require.NotNil(t, selected)
+		names = append(names, selected.Name)
+	}
+
+	// Age order, skipping the unhealthy node, then wrapping around
+	assert.Equal(t, []string{"node-oldest", "node-middle", "node-newest", "node-oldest"}, names)
+}
+
+func TestRoundRobin_SingleHealthyNode(t *testing.T) {
+	nodes := newSelectionTestNodes()[:1]
+	selector := &RoundRobin{}
+
+	for i := 0; i < 2; i++ {
+		selected := selector.Select(nodes)
+		require.NotNil(t, selected)
+		assert.Equal(t, "node-oldest", selected.Name)
+	}
+}
+
+func TestSelectors_NoHealthyNodes(t *testing.T) {
+	unhealthy := []NodeInfo{
+		{Name: "node-1", IP: "10.0.1.1", Status: NodeUnhealthy},
+		{Name: "node-2", IP: "10.0.1.2", Status: NodeUnknown},
+	}
+
+	for _, selector := range []NodeSelector{OldestHealthy{}, NewestHealthy{}, RandomHealthy{}, &RoundRobin{}} {
+		assert.Nil(t, selector.Select(unhealthy), "%T", selector)
+		assert.Nil(t, selector.Select(nil), "%T", selector)
+	}
+}
+
+func TestNodeSelectorFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  NodeSelector
+	}{
+		{"", OldestHealthy{}},
+		{"oldest", OldestHealthy{}},
+		{"newest", NewestHealthy{}},
+		{"Random", RandomHealthy{}},
+		{"weighted", WeightedHealthy{}},
+		{"round-robin", &RoundRobin{}},
+	}
+	for _, tt := range tests {
+		t.Setenv("NODE_SELECTION", tt.value)
+		selector, err := NodeSelectorFromEnv(newFailureScores(time.Minute))
+		require.NoError(t, err, "value %q", tt.value)
+		assert.IsType(t, tt.want, selector, "value %q", tt.value)
+	}
+
+	t.Setenv("NODE_SELECTION", "fastest")
+	_, err := NodeSelectorFromEnv(newFailureScores(time.Minute))
+	assert.Error(t, err)
+}
+
+// TestGenericNodeDiscovery_NodeSelectionStrategy tests that discovery uses the
+// configured selector for its initial selection
+func TestGenericNodeDiscovery_NodeSelectionStrategy(t *testing.T) {
+	t.Setenv("NODE_SELECTION", "newest")
+	clientset := fake.NewClientset(
+		newTestNode("node-oldest", "10.0.1.1", true, time.Now().Add(-24*time.Hour)),
+		newTestNode("node-newest", "10.0.1.3", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "node-newest", d.GetCurrentNodeName())
+}
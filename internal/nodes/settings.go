@@ -0,0 +1,80 @@
+package nodes
+
+import "fmt"
+
+// SelectionSettings are the node selection and health-check settings a
+// discovery runs with, after defaults were applied. Durations are formatted
+// like the environment variables they come from, e.g. "15s".
+type SelectionSettings struct {
+	Strategy             string `json:"strategy"`
+	FailureThreshold     int    `json:"failure_threshold"`
+	HealthCheckInterval  string `json:"health_check_interval"`
+	InitialCheckDelay    string `json:"health_check_initial_delay"`
+	InitialCheckJitter   string `json:"health_check_initial_jitter"`
+	UnhealthyGrace       string `json:"node_unhealthy_grace"`
+	CacheTTL             string `json:"cache_ttl"`
+	RotationInterval     string `json:"node_rotation_interval"`
+	MaxNodeAge           string `json:"max_node_age"`
+	MinHealthyNodes      int    `json:"min_healthy_nodes"`
+	AutoRebalance        bool   `json:"auto_rebalance"`
+	AutoRebalanceDelay   string `json:"auto_rebalance_delay"`
+	ActiveProbe          bool   `json:"active_health_probe"`
+	ActiveProbePath      string `json:"active_health_path,omitempty"`
+	AllowControlPlane    bool   `json:"allow_control_plane_nodes"`
+	RespectUnschedulable bool   `json:"respect_unschedulable"`
+	LabelSelector        string `json:"node_label_selector,omitempty"`
+	DrainAnnotation      string `json:"drain_annotation"`
+	IPType               string `json:"node_ip_type"`
+	IPFamily             string `json:"node_ip_family,omitempty"`
+	ServeUnhealthy       bool   `json:"serve_unhealthy"`
+}
+
+// SelectionSettings reports the settings d was configured with
+func (d *KubeNodeDiscovery) SelectionSettings() SelectionSettings {
+	settings := SelectionSettings{
+		Strategy:             selectorName(d.selector),
+		FailureThreshold:     d.failureThreshold,
+		HealthCheckInterval:  d.checkInterval.String(),
+		InitialCheckDelay:    d.checkDelay.delay.String(),
+		InitialCheckJitter:   d.checkDelay.jitter.String(),
+		UnhealthyGrace:       d.grace.grace.String(),
+		CacheTTL:             d.cacheTTL.String(),
+		RotationInterval:     d.rotationInterval.String(),
+		MaxNodeAge:           d.constraints.maxAge.String(),
+		MinHealthyNodes:      d.constraints.minHealthy,
+		AutoRebalance:        d.rebalance.enabled,
+		AutoRebalanceDelay:   d.rebalance.delay.String(),
+		AllowControlPlane:    d.filter.allowControlPlane,
+		RespectUnschedulable: d.filter.respectUnschedulable,
+		DrainAnnotation:      d.filter.drainAnnotation,
+		IPType:               string(d.ipType),
+		IPFamily:             string(d.ipFamily),
+		ServeUnhealthy:       d.serveUnhealthy,
+	}
+	if d.probe != nil {
+		settings.ActiveProbe = d.probe.enabled
+		settings.ActiveProbePath = d.probe.path
+	}
+	if d.filter.labelSelector != nil {
+		settings.LabelSelector = d.filter.labelSelector.String()
+	}
+	return settings
+}
+
+// selectorName returns the NODE_SELECTION value that configures selector
+func selectorName(selector NodeSelector) string {
+	switch selector.(type) {
+	case OldestHealthy:
+		return "oldest"
+	case NewestHealthy:
+		return "newest"
+	case RandomHealthy:
+		return "random"
+	case WeightedHealthy:
+		return "weighted"
+	case *RoundRobin:
+		return "round-robin"
+	default:
+		return fmt.Sprintf("%T", selector)
+	}
+}
@@ -0,0 +1,124 @@
+package nodes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeStatus_String(t *testing.T) {
+	assert.Equal(t, "healthy", NodeHealthy.String())
+	assert.Equal(t, "unhealthy", NodeUnhealthy.String())
+	assert.Equal(t, "unknown", NodeUnknown.String())
+}
+
+// TestGetCurrentNodeStatus tests that the selected node's status follows health checks
+// and is served from the cache
+func TestGetCurrentNodeStatus(t *testing.T) {
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+		newTestNode("node-3", "10.0.1.3", false, time.Now()),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	assert.Equal(t, NodeUnknown, d.GetCurrentNodeStatus(), "no node selected yet")
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, NodeHealthy, d.GetCurrentNodeStatus())
+	assert.Equal(t, 2, d.GetHealthyNodeCount())
+
+	setNodeReady(t, clientset, "node-1", false)
+	d.performHealthCheck()
+
+	clientset.ClearActions()
+	assert.Equal(t, NodeUnhealthy, d.GetCurrentNodeStatus())
+	assert.Equal(t, 1, d.GetHealthyNodeCount())
+	assert.Empty(t, clientset.Actions(), "status must come from the cache")
+}
+
+// TestNodeSelection_UnavailableReasons tests that an empty cluster and a cluster with
+// only unhealthy nodes produce distinct errors, reasons and metrics
+func TestNodeSelection_UnavailableReasons(t *testing.T) {
+	tests := []struct {
+		name      string
+		nodes     []runtime.Object
+		wantErr   error
+		wantLabel string
+	}{
+		{
+			name:      "NoNodes",
+			wantErr:   ErrNoNodes,
+			wantLabel: ReasonNoNodes,
+		},
+		{
+			name: "NoHealthyNodes",
+			nodes: []runtime.Object{
+				newTestNode("node-1", "10.0.1.1", false, time.Now().Add(-time.Hour)),
+				newTestNode("node-2", "10.0.1.2", false, time.Now()),
+			},
+			wantErr:   ErrNoHealthyNodes,
+			wantLabel: ReasonNoHealthyNodes,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTestGenericDiscovery(t, fake.NewClientset(tt.nodes...))
+			series := `k8s_node_proxy_node_selection_failures_total{reason="` + tt.wantLabel + `"}`
+			before := scrapeCounter(t, series)
+
+			_, err := d.GetCurrentNodeIP(context.Background())
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantLabel, d.GetUnavailableReason())
+			assert.Equal(t, before+1, scrapeCounter(t, series))
+		})
+	}
+
+	t.Run("ClearedOnSelection", func(t *testing.T) {
+		clientset := fake.NewClientset(newTestNode("node-1", "10.0.1.1", false, time.Now()))
+		d := newTestGenericDiscovery(t, clientset)
+
+		_, err := d.GetCurrentNodeIP(context.Background())
+		require.ErrorIs(t, err, ErrNoHealthyNodes)
+
+		setNodeReady(t, clientset, "node-1", true)
+		d.cacheTime = time.Time{} // expire the node cache
+
+		_, err = d.GetCurrentNodeIP(context.Background())
+		require.NoError(t, err)
+		assert.Empty(t, d.GetUnavailableReason())
+	})
+}
+
+// scrapeCounter returns the value of series from the metrics endpoint, or 0 if absent
+func scrapeCounter(t *testing.T, series string) float64 {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if value, found := strings.CutPrefix(line, series+" "); found {
+			v, err := strconv.ParseFloat(value, 64)
+			require.NoError(t, err)
+			return v
+		}
+	}
+	return 0
+}
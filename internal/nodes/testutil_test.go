@@ -0,0 +1,98 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestNode builds a corev1.Node with an internal IP and Ready condition
+func newTestNode(name, internalIP string, ready bool, created time.Time) *corev1.Node {
+	readyStatus := corev1.ConditionTrue
+	if !ready {
+		readyStatus = corev1.ConditionFalse
+	}
+
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Status: corev1.NodeStatus{
+			Addresses: []corev1.NodeAddress{
+				{Type: corev1.NodeInternalIP, Address: internalIP},
+			},
+			Conditions: []corev1.NodeCondition{
+				{Type: corev1.NodeReady, Status: readyStatus},
+			},
+		},
+	}
+}
+
+// setNodeReady flips the Ready condition of a node in the fake clientset
+func setNodeReady(t *testing.T, clientset *fake.Clientset, name string, ready bool) {
+	t.Helper()
+
+	node, err := clientset.CoreV1().Nodes().Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Failed to get node %s: %v", name, err)
+	}
+
+	status := corev1.ConditionTrue
+	if !ready {
+		status = corev1.ConditionFalse
+	}
+	node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}
+
+	if _, err := clientset.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("Failed to update node %s: %v", name, err)
+	}
+}
+
+// newTestGenericDiscovery creates a GenericNodeDiscovery backed by a fake clientset
+func newTestGenericDiscovery(t *testing.T, clientset *fake.Clientset) *GenericNodeDiscovery {
+	t.Helper()
+
+	d, err := NewGenericNodeDiscovery(clientset)
+	if err != nil {
+		t.Fatalf("Failed to create discovery: %v", err)
+	}
+	t.Cleanup(d.cancel)
+	return d
+}
+
+// newSelectionTestNodes returns three healthy nodes of different ages plus an
+// older unhealthy node, in no particular order
+func newSelectionTestNodes() []NodeInfo {
+	now := time.Now()
+	return []NodeInfo{
+		{
+			Name:         "node-oldest",
+			IP:           "10.0.1.1",
+			Status:       NodeHealthy,
+			CreationTime: now.Add(-24 * time.Hour), // 24 hours ago
+		},
+		{
+			Name:         "node-middle",
+			IP:           "10.0.1.2",
+			Status:       NodeHealthy,
+			CreationTime: now.Add(-12 * time.Hour), // 12 hours ago
+		},
+		{
+			Name:         "node-newest",
+			IP:           "10.0.1.3",
+			Status:       NodeHealthy,
+			CreationTime: now.Add(-1 * time.Hour), // 1 hour ago
+		},
+		{
+			Name:         "node-unhealthy",
+			IP:           "10.0.1.4",
+			Status:       NodeUnhealthy,
+			CreationTime: now.Add(-48 * time.Hour), // Even older but unhealthy
+		},
+	}
+}
@@ -0,0 +1,170 @@
+package nodes
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s-node-proxy/internal/services"
+)
+
+// nodeWatcher keeps an informer-backed cache of the cluster's nodes and calls
+// onChange with the name of every node that is added, updated or deleted.
+// Informer resyncs replay every node each resync period, so a node that stays
+// unhealthy keeps being re-checked and counted toward the failure threshold.
+// It also records when its list and watch requests start failing, since the
+// cache keeps answering from memory while the Kubernetes API is unreachable.
+type nodeWatcher struct {
+	informer cache.SharedIndexInformer
+	lister   corelisters.NodeLister
+
+	mu sync.Mutex
+	// failingSince is when list or watch requests started failing; zero while they succeed
+	failingSince time.Time
+	lastErr      error
+}
+
+func newNodeWatcher(clientset kubernetes.Interface, filter nodeFilter, resync time.Duration, onChange func(name string)) *nodeWatcher {
+	w := &nodeWatcher{}
+	listWatch := &cache.ListWatch{
+		ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = filter.listOptions().LabelSelector
+			list, err := clientset.CoreV1().Nodes().List(ctx, options)
+			w.observe(err)
+			return list, err
+		},
+		WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = filter.listOptions().LabelSelector
+			watcher, err := clientset.CoreV1().Nodes().Watch(ctx, options)
+			w.observe(err)
+			return watcher, err
+		},
+	}
+	informer := cache.NewSharedIndexInformer(listWatch, &corev1.Node{}, resync, cache.Indexers{})
+	// A watch that breaks with an error is followed by a new list and watch;
+	// count the API as failing until one of them succeeds
+	informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		w.observe(err)
+	})
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				onChange(node.Name)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if node, ok := obj.(*corev1.Node); ok {
+				onChange(node.Name)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			// Nodes are cluster-scoped, so the key is the node name
+			if name, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj); err == nil {
+				onChange(name)
+			}
+		},
+	})
+
+	w.informer = informer
+	w.lister = corelisters.NewNodeLister(informer.GetIndexer())
+	return w
+}
+
+// observe records the outcome of a list or watch request
+func (w *nodeWatcher) observe(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		if w.failingSince.IsZero() {
+			slog.Warn("Node watch failing, the node cache is going stale", "error", err)
+			w.failingSince = time.Now()
+		}
+		w.lastErr = err
+		return
+	}
+	if !w.failingSince.IsZero() {
+		slog.Info("Node watch recovered", "failed_for", time.Since(w.failingSince).Round(time.Second))
+		w.failingSince = time.Time{}
+		w.lastErr = nil
+	}
+}
+
+// failing reports since when list and watch requests have been failing and
+// the last error; a zero time while they succeed
+func (w *nodeWatcher) failing() (time.Time, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.failingSince, w.lastErr
+}
+
+// start runs the informer until ctx is done
+func (w *nodeWatcher) start(ctx context.Context) {
+	go w.informer.Run(ctx.Done())
+}
+
+// synced reports whether the cache holds a full node list
+func (w *nodeWatcher) synced() bool {
+	return w.informer.HasSynced()
+}
+
+// getNode returns the named node from the watcher's cache once it has synced,
+// otherwise from the API, retrying transient API errors
+func getNode(ctx context.Context, clientset kubernetes.Interface, w *nodeWatcher, name string) (*corev1.Node, error) {
+	if w != nil && w.synced() {
+		return w.lister.Get(name)
+	}
+
+	var node *corev1.Node
+	err := withAPIRetry(ctx, "get node", func() error {
+		var err error
+		node, err = clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		return err
+	})
+	return node, services.CheckPermission(err, "get", "nodes", "")
+}
+
+// listNodes returns the nodes matching filter's label selector, from the watcher's
+// cache once it has synced, otherwise from the API in pages, retrying transient API errors.
+// While the watcher's requests fail, the cache is stale and an error is returned.
+func listNodes(ctx context.Context, clientset kubernetes.Interface, w *nodeWatcher, filter nodeFilter) ([]corev1.Node, error) {
+	if w != nil && w.synced() {
+		// The cache is only as fresh as the watch feeding it
+		if since, err := w.failing(); !since.IsZero() {
+			return nil, fmt.Errorf("node watch failing since %s: %w", since.Format(time.RFC3339), err)
+		}
+		// The informer already applies the label selector
+		cached, err := w.lister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		nodes := make([]corev1.Node, 0, len(cached))
+		for _, node := range cached {
+			nodes = append(nodes, *node)
+		}
+		return nodes, nil
+	}
+
+	var nodes []corev1.Node
+	err := withAPIRetry(ctx, "list nodes", func() error {
+		var err error
+		nodes, err = services.ListAll(ctx, filter.listOptions(), clientset.CoreV1().Nodes().List,
+			func(page *corev1.NodeList) []corev1.Node { return page.Items })
+		return err
+	})
+	if err != nil {
+		return nil, services.CheckPermission(err, "list", "nodes", "")
+	}
+	return nodes, nil
+}
@@ -0,0 +1,96 @@
+package nodes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// TestWatcherFailover tests that a Ready condition flip on the selected node fails
+// over within a second, without waiting for a polling interval
+func TestWatcherFailover(t *testing.T) {
+	t.Setenv("FAILURE_THRESHOLD", "1")
+	t.Setenv("HEALTH_CHECK_INTERVAL", "1h") // no resync during the test
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "node-1", d.GetCurrentNodeName())
+
+	d.StartHealthMonitoring()
+	t.Cleanup(d.StopHealthMonitoring)
+	require.Eventually(t, d.watcher.synced, time.Second, 10*time.Millisecond)
+
+	setNodeReady(t, clientset, "node-1", false)
+
+	assert.Eventually(t, func() bool {
+		return d.GetCurrentNodeName() == "node-2"
+	}, time.Second, 10*time.Millisecond, "expected failover within a second of the Ready flip")
+}
+
+// TestWatcherFailover_Threshold tests that the failure threshold debounces a
+// Ready flip: one event alone does not fail over
+func TestWatcherFailover_Threshold(t *testing.T) {
+	t.Setenv("FAILURE_THRESHOLD", "2")
+	t.Setenv("HEALTH_CHECK_INTERVAL", "1h")
+	t.Setenv("HEALTH_CHECK_INITIAL_DELAY", "0s")
+	t.Setenv("HEALTH_CHECK_INITIAL_JITTER", "0s")
+
+	clientset := fake.NewClientset(
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	d := newTestGenericDiscovery(t, clientset)
+
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+
+	d.StartHealthMonitoring()
+	t.Cleanup(d.StopHealthMonitoring)
+	require.Eventually(t, d.watcher.synced, time.Second, 10*time.Millisecond)
+
+	setNodeReady(t, clientset, "node-1", false)
+	require.Eventually(t, func() bool {
+		d.mutex.RLock()
+		defer d.mutex.RUnlock()
+		return d.failureCount == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "node-1", d.GetCurrentNodeName(), "one failure is below the threshold")
+
+	// The next update while still NotReady reaches the threshold
+	setNodeUnschedulable(t, clientset, "node-1", true)
+	assert.Eventually(t, func() bool {
+		return d.GetCurrentNodeName() == "node-2"
+	}, time.Second, 10*time.Millisecond)
+}
+
+// TestOnNodeChange_QueuesOneCheck tests that node changes only request a health
+// check from the monitoring loop: the informer's handler never runs the check,
+// and changes arriving before the loop picks the request up coalesce into it
+func TestOnNodeChange_QueuesOneCheck(t *testing.T) {
+	d := newTestKubeDiscovery(t,
+		newTestNode("node-1", "10.0.1.1", true, time.Now().Add(-2*time.Hour)),
+		newTestNode("node-2", "10.0.1.2", true, time.Now().Add(-time.Hour)),
+	)
+	_, err := d.GetCurrentNodeIP(context.Background())
+	require.NoError(t, err)
+
+	d.onNodeChange("node-2")
+	assert.Empty(t, d.checkRequests, "changes to other nodes don't request a check")
+
+	for range 3 {
+		d.onNodeChange("node-1")
+	}
+	assert.Len(t, d.checkRequests, 1)
+}
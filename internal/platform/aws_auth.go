@@ -3,18 +3,106 @@ package platform
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"os"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 )
 
+// Credential sources reported by LoadAWSConfig
+const (
+	// CredentialSourceWebIdentity is IAM Roles for Service Accounts: the pod's
+	// projected service account token exchanged via AssumeRoleWithWebIdentity
+	CredentialSourceWebIdentity = "web-identity"
+	// CredentialSourceEnvironment is static keys from AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY
+	CredentialSourceEnvironment = "environment"
+	// CredentialSourceDefaultChain is whatever the SDK default chain resolves
+	// (shared config files, node instance profile, ...)
+	CredentialSourceDefaultChain = "default-chain"
+)
+
+// defaultRoleSessionName names IRSA sessions when AWS_ROLE_SESSION_NAME is unset
+const defaultRoleSessionName = "k8s-node-proxy"
+
+// assumeRoleExpiryWindow re-assumes EKS_ASSUME_ROLE_ARN this long before the
+// assumed credentials expire, so a token is never signed with credentials
+// that lapse before the API server verifies it
+const assumeRoleExpiryWindow = 5 * time.Minute
+
+// LoadAWSConfig loads the AWS configuration and reports where its credentials
+// come from. When the EKS pod identity webhook has injected AWS_ROLE_ARN and
+// AWS_WEB_IDENTITY_TOKEN_FILE, credentials are obtained explicitly through the
+// web identity provider so IRSA takes precedence over the node's instance role.
+func LoadAWSConfig(ctx context.Context) (aws.Config, string, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return aws.Config{}, "", fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	source := CredentialSourceDefaultChain
+	roleARN := os.Getenv("AWS_ROLE_ARN")
+	tokenFile := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	switch {
+	case roleARN != "" && tokenFile != "":
+		sessionName := os.Getenv("AWS_ROLE_SESSION_NAME")
+		if sessionName == "" {
+			sessionName = defaultRoleSessionName
+		}
+		provider := stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(cfg), roleARN, stscreds.IdentityTokenFile(tokenFile), func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = sessionName
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+		source = CredentialSourceWebIdentity
+		slog.Info("Using AWS credentials", "source", source, "role_arn", roleARN, "token_file", tokenFile)
+	case os.Getenv("AWS_ACCESS_KEY_ID") != "":
+		source = CredentialSourceEnvironment
+		slog.Info("Using AWS credentials", "source", source)
+	default:
+		slog.Info("Using AWS credentials", "source", source)
+	}
+
+	return cfg, source, nil
+}
+
+// assumeRole returns cfg with credentials for roleARN, assumed with cfg's own
+// credentials. The assumed credentials are cached and re-assumed before they expire.
+func assumeRole(cfg aws.Config, roleARN string) aws.Config {
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = defaultRoleSessionName
+	})
+	assumed := cfg.Copy()
+	assumed.Credentials = aws.NewCredentialsCache(provider, func(o *aws.CredentialsCacheOptions) {
+		o.ExpiryWindow = assumeRoleExpiryWindow
+	})
+	return assumed
+}
+
+// loadTokenConfig loads the AWS configuration used to sign EKS tokens. With
+// EKS_ASSUME_ROLE_ARN set, the proxy assumes that role first so it can reach a
+// cluster in another account.
+func loadTokenConfig(ctx context.Context) (aws.Config, error) {
+	cfg, _, err := LoadAWSConfig(ctx)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if roleARN := os.Getenv("EKS_ASSUME_ROLE_ARN"); roleARN != "" {
+		slog.Info("Assuming role for EKS authentication", "role_arn", roleARN)
+		cfg = assumeRole(cfg, roleARN)
+	}
+	return cfg, nil
+}
+
 // GenerateK8sToken generates an AWS IAM authenticator token for Kubernetes API authentication
 func GenerateK8sToken() (string, error) {
 	// Load AWS configuration
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := loadTokenConfig(context.TODO())
 	if err != nil {
-		return "", fmt.Errorf("failed to load AWS config: %w", err)
+		return "", err
 	}
 
 	// Create STS client for token generation
@@ -1,10 +1,17 @@
 package platform
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s-node-proxy/test/mocks"
 )
 
 // TestGenerateK8sToken_ValidFormat tests token generation returns valid format (T032)
@@ -65,3 +72,117 @@ func TestGenerateK8sToken_Integration(t *testing.T) {
 	assert.Equal(t, "k8s-aws-v1", parts[0])
 	assert.NotEmpty(t, parts[1], "Token should have base64 data after prefix")
 }
+
+// irsaEnv points the SDK at the STS mock and sets the variables the EKS pod
+// identity webhook injects for IAM Roles for Service Accounts
+func irsaEnv(t *testing.T, stsURL string) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("projected-service-account-token"), 0o600))
+
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_ENDPOINT_URL_STS", stsURL)
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/k8s-node-proxy")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+}
+
+// TestLoadAWSConfig_WebIdentity tests IRSA credentials come from AssumeRoleWithWebIdentity
+func TestLoadAWSConfig_WebIdentity(t *testing.T) {
+	sts := mocks.NewSTSAPI()
+	defer sts.Close()
+	irsaEnv(t, sts.URL())
+
+	cfg, source, err := LoadAWSConfig(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, CredentialSourceWebIdentity, source)
+
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, mocks.MockWebIdentityAccessKeyID, creds.AccessKeyID)
+	assert.Equal(t, 1, sts.Calls("AssumeRoleWithWebIdentity"))
+
+	form := sts.LastRequest("AssumeRoleWithWebIdentity")
+	assert.Equal(t, "arn:aws:iam::123456789012:role/k8s-node-proxy", form.Get("RoleArn"))
+	assert.Equal(t, "projected-service-account-token", form.Get("WebIdentityToken"))
+	assert.Equal(t, defaultRoleSessionName, form.Get("RoleSessionName"))
+}
+
+// TestLoadAWSConfig_CredentialSource tests the reported source without IRSA
+func TestLoadAWSConfig_CredentialSource(t *testing.T) {
+	sts := mocks.NewSTSAPI()
+	defer sts.Close()
+	irsaEnv(t, sts.URL())
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+
+	_, source, err := LoadAWSConfig(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, CredentialSourceDefaultChain, source)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIASTATICKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "static-secret")
+	cfg, source, err := LoadAWSConfig(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, CredentialSourceEnvironment, source)
+
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "AKIASTATICKEY", creds.AccessKeyID)
+	assert.Zero(t, sts.Calls("AssumeRoleWithWebIdentity"))
+}
+
+// TestLoadTokenConfig_AssumeRole tests EKS_ASSUME_ROLE_ARN credentials come
+// from AssumeRole and are re-assumed once they near expiry
+func TestLoadTokenConfig_AssumeRole(t *testing.T) {
+	sts := mocks.NewSTSAPI()
+	defer sts.Close()
+	irsaEnv(t, sts.URL())
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIASTATICKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "static-secret")
+	t.Setenv("EKS_ASSUME_ROLE_ARN", "arn:aws:iam::210987654321:role/cluster-reader")
+
+	cfg, err := loadTokenConfig(context.Background())
+	require.NoError(t, err)
+
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, mocks.MockAssumedAccessKeyID, creds.AccessKeyID)
+	assert.Equal(t, "arn:aws:iam::210987654321:role/cluster-reader", sts.LastRequest("AssumeRole").Get("RoleArn"))
+
+	// Fresh credentials are cached
+	_, err = cfg.Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, sts.Calls("AssumeRole"))
+
+	// Credentials inside the expiry window are assumed again
+	sts.SetCredentialLifetime(time.Minute)
+	cfg, err = loadTokenConfig(context.Background())
+	require.NoError(t, err)
+	for range 2 {
+		_, err = cfg.Credentials.Retrieve(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, sts.Calls("AssumeRole"))
+}
+
+// TestGenerateK8sToken_AssumeRole tests tokens are signed with the assumed role
+func TestGenerateK8sToken_AssumeRole(t *testing.T) {
+	sts := mocks.NewSTSAPI()
+	defer sts.Close()
+	irsaEnv(t, sts.URL())
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIASTATICKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "static-secret")
+	t.Setenv("EKS_ASSUME_ROLE_ARN", "arn:aws:iam::210987654321:role/cluster-reader")
+
+	tok, err := GenerateK8sToken()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(tok, "k8s-aws-v1."))
+	assert.Equal(t, 1, sts.Calls("AssumeRole"))
+}
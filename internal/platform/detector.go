@@ -3,6 +3,7 @@ package platform
 import (
 	"fmt"
 	"os"
+	"strings"
 )
 
 // Platform represents the cloud platform where the proxy is running
@@ -33,8 +34,24 @@ func (p Platform) String() string {
 	}
 }
 
+// ParsePlatform converts a platform name (gcp, aws, generic) into a Platform.
+// Matching is case-insensitive.
+func ParsePlatform(name string) (Platform, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "gcp":
+		return GCP, nil
+	case "aws":
+		return AWS, nil
+	case "generic":
+		return Generic, nil
+	default:
+		return Unknown, fmt.Errorf("invalid PLATFORM value %q: must be one of gcp, aws, generic", name)
+	}
+}
+
 // DetectPlatform determines the cloud platform based on environment variables
 // It checks in the following order:
+// 0. PLATFORM override (gcp, aws, generic) → requested platform
 // 1. PROJECT_ID or GOOGLE_CLOUD_PROJECT → GCP
 // 2. AWS_REGION → AWS
 // 3. KUBECONFIG or K8S_* env vars → Generic
@@ -43,6 +60,11 @@ func (p Platform) String() string {
 // This is a simple, happy-path implementation for Phase 1.
 // Metadata service detection will be added in Phase 4.
 func DetectPlatform() (Platform, error) {
+	// Explicit override short-circuits all auto-detection
+	if override := os.Getenv("PLATFORM"); override != "" {
+		return ParsePlatform(override)
+	}
+
 	// Check for GCP first (PROJECT_ID takes precedence)
 	projectID := os.Getenv("PROJECT_ID")
 	if projectID != "" {
@@ -70,7 +92,13 @@ func DetectPlatform() (Platform, error) {
 	// Check for alternative K8S_* environment variables
 	k8sEndpoint := os.Getenv("K8S_ENDPOINT")
 	k8sToken := os.Getenv("K8S_TOKEN")
+	if k8sToken == "" {
+		k8sToken = os.Getenv("K8S_TOKEN_FILE")
+	}
 	k8sCACert := os.Getenv("K8S_CA_CERT")
+	if k8sCACert == "" {
+		k8sCACert = os.Getenv("K8S_CA_CERT_FILE")
+	}
 	if k8sEndpoint != "" && k8sToken != "" && k8sCACert != "" {
 		return Generic, nil
 	}
@@ -2,6 +2,7 @@ package platform
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -284,6 +285,76 @@ func TestDetectPlatform_Error(t *testing.T) {
 	}
 }
 
+// TestDetectPlatform_Override tests that PLATFORM short-circuits auto-detection
+func TestDetectPlatform_Override(t *testing.T) {
+	originalPlatform := os.Getenv("PLATFORM")
+	originalProjectID := os.Getenv("PROJECT_ID")
+	originalAWSRegion := os.Getenv("AWS_REGION")
+	defer func() {
+		restoreEnv("PLATFORM", originalPlatform)
+		restoreEnv("PROJECT_ID", originalProjectID)
+		restoreEnv("AWS_REGION", originalAWSRegion)
+	}()
+
+	tests := []struct {
+		name         string
+		platform     string
+		wantPlatform Platform
+		wantErr      bool
+	}{
+		{
+			name:         "PLATFORM=gcp",
+			platform:     "gcp",
+			wantPlatform: GCP,
+		},
+		{
+			name:         "PLATFORM=aws overrides PROJECT_ID",
+			platform:     "aws",
+			wantPlatform: AWS,
+		},
+		{
+			name:         "PLATFORM=generic overrides PROJECT_ID and AWS_REGION",
+			platform:     "generic",
+			wantPlatform: Generic,
+		},
+		{
+			name:         "PLATFORM is case-insensitive",
+			platform:     "AWS",
+			wantPlatform: AWS,
+		},
+		{
+			name:         "invalid PLATFORM value",
+			platform:     "azure",
+			wantPlatform: Unknown,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// GCP and AWS vars are set so any fall-through would be visible
+			os.Setenv("PROJECT_ID", "my-gcp-project")
+			os.Setenv("AWS_REGION", "us-west-2")
+			os.Setenv("PLATFORM", tt.platform)
+
+			platform, err := DetectPlatform()
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DetectPlatform() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if err != nil && !strings.Contains(err.Error(), "invalid PLATFORM value") {
+				t.Errorf("Expected invalid PLATFORM error, got '%s'", err.Error())
+			}
+
+			if platform != tt.wantPlatform {
+				t.Errorf("DetectPlatform() = %v, want %v", platform, tt.wantPlatform)
+			}
+		})
+	}
+}
+
 // TestPlatformString tests Platform.String() method
 func TestPlatformString(t *testing.T) {
 	tests := []struct {
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// accessEntry collects the details of one proxied request for its access log record
+type accessEntry struct {
+	clientIP       string
+	nodeIP         string
+	port           string
+	service        string
+	upstreamStatus int
+	status         int
+	bytes          int64
+	duration       time.Duration
+}
+
+// accessLogFromEnv reads ACCESS_LOG (default true)
+func accessLogFromEnv() (bool, error) {
+	value := os.Getenv("ACCESS_LOG")
+	if value == "" {
+		return true, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return true, fmt.Errorf("invalid ACCESS_LOG value %q: %w", value, err)
+	}
+	return enabled, nil
+}
+
+// logAccess writes one structured record per request at info level, so
+// LOG_LEVEL=warn or ACCESS_LOG=false silences it
+func logAccess(logger *slog.Logger, r *http.Request, entry accessEntry) {
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("host", r.Host),
+		slog.String("client_ip", entry.clientIP),
+		slog.String("node_ip", entry.nodeIP),
+		slog.String("node_port", entry.port),
+		slog.String("service", entry.service),
+		slog.Int("status", entry.status),
+		slog.Duration("duration", entry.duration),
+		slog.Int64("bytes", entry.bytes),
+	}
+	if entry.upstreamStatus != 0 {
+		attrs = append(attrs, slog.Int("upstream_status", entry.upstreamStatus))
+	}
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "Proxied request", attrs...)
+}
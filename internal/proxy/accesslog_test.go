@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// captureSlog routes the default slog logger into a JSON buffer for the test
+func captureSlog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+// accessRecords decodes the "Proxied request" records from captured slog output
+func accessRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	return logRecords(t, buf, "Proxied request")
+}
+
+// logRecords decodes the records with the given message from captured slog output
+func logRecords(t *testing.T, buf *bytes.Buffer, msg string) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to decode log record %q: %v", line, err)
+		}
+		if record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestServeHTTP_AccessLog(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	t.Run("Enabled", func(t *testing.T) {
+		buf := captureSlog(t)
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "http://"+backendURL.Host+"/items?id=1", nil))
+
+		records := accessRecords(t, buf)
+		if len(records) != 1 {
+			t.Fatalf("Expected one access log record, got %d: %s", len(records), buf.String())
+		}
+		record := records[0]
+		want := map[string]any{
+			"method":          "POST",
+			"path":            "/items",
+			"host":            backendURL.Host,
+			"node_ip":         "127.0.0.1",
+			"node_port":       backendURL.Port(),
+			"service":         "-",
+			"status":          float64(http.StatusCreated),
+			"upstream_status": float64(http.StatusCreated),
+			"bytes":           float64(len("hello")),
+		}
+		for key, value := range want {
+			if record[key] != value {
+				t.Errorf("Expected %s=%v, got %v", key, value, record[key])
+			}
+		}
+		if _, ok := record["duration"]; !ok {
+			t.Error("Expected duration in the access log record")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Setenv("ACCESS_LOG", "false")
+		buf := captureSlog(t)
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil))
+
+		if records := accessRecords(t, buf); len(records) != 0 {
+			t.Errorf("Expected no access log records with ACCESS_LOG=false, got %d", len(records))
+		}
+	})
+}
+
+func TestServeHTTP_InjectedLogger(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	var buf bytes.Buffer
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	handler.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	defaultLog := captureSlog(t)
+
+	req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/orders", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	records := accessRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 JSON access record from the injected logger, got %d: %s", len(records), buf.String())
+	}
+	if records[0]["path"] != "/orders" {
+		t.Errorf("Expected path /orders, got %v", records[0]["path"])
+	}
+	if defaultLog.Len() != 0 {
+		t.Errorf("Expected nothing on the default logger, got %s", defaultLog.String())
+	}
+}
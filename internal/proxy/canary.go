@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// canaryRouting sends requests carrying a header (CANARY_HEADER) to canary
+// backends instead of the selected node: the healthy nodes matching a label
+// selector, another NodePort, or both. Other requests are routed as usual.
+type canaryRouting struct {
+	header string
+	// value the header must have; "" matches any non-empty value
+	value string
+	// selector picks the canary nodes; nil keeps the selected node
+	selector labels.Selector
+	// port replaces the request's target port; "" keeps it
+	port string
+}
+
+// labeledNodeDiscovery is implemented by node discoveries that can pick a
+// node by its labels
+type labeledNodeDiscovery interface {
+	GetNodeIPForSelector(ctx context.Context, selector labels.Selector) (string, error)
+}
+
+// canaryFromEnv reads the canary routing rule:
+//   - CANARY_HEADER: request header marking canary requests, e.g. "X-Canary"
+//   - CANARY_HEADER_VALUE: value the header must have; any value when unset
+//   - CANARY_NODE_SELECTOR: label selector of the canary nodes, e.g. "track=canary"
+//   - CANARY_PORT: NodePort canary requests are sent to instead of their own
+//
+// It returns nil when CANARY_HEADER is unset. With a header, at least one of
+// CANARY_NODE_SELECTOR and CANARY_PORT is required.
+func canaryFromEnv() (*canaryRouting, error) {
+	header := strings.TrimSpace(os.Getenv("CANARY_HEADER"))
+	if header == "" {
+		return nil, nil
+	}
+	canary := &canaryRouting{
+		header: http.CanonicalHeaderKey(header),
+		value:  os.Getenv("CANARY_HEADER_VALUE"),
+	}
+
+	if value := os.Getenv("CANARY_NODE_SELECTOR"); value != "" {
+		selector, err := labels.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CANARY_NODE_SELECTOR value %q: %w", value, err)
+		}
+		canary.selector = selector
+	}
+
+	if value := os.Getenv("CANARY_PORT"); value != "" {
+		if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid CANARY_PORT value %q: must be a port between 1 and 65535", value)
+		}
+		canary.port = value
+	}
+
+	if canary.selector == nil && canary.port == "" {
+		return nil, fmt.Errorf("CANARY_HEADER %s requires CANARY_NODE_SELECTOR or CANARY_PORT", canary.header)
+	}
+	return canary, nil
+}
+
+// matches reports whether r is a canary request
+func (c *canaryRouting) matches(r *http.Request) bool {
+	if c == nil {
+		return false
+	}
+	value := r.Header.Get(c.header)
+	if c.value == "" {
+		return value != ""
+	}
+	return value == c.value
+}
+
+// supportCanaryNodes drops the canary node selector when the handler's target
+// can't be picked by node labels, e.g. in TARGET_MODE=clusterip; canary
+// requests then only change port, or are routed as usual
+func (h *Handler) supportCanaryNodes() {
+	if h.canary == nil || h.canary.selector == nil {
+		return
+	}
+	if _, ok := h.nodeDiscovery.(labeledNodeDiscovery); ok {
+		return
+	}
+	slog.Warn("CANARY_NODE_SELECTOR needs node discovery by label, ignoring it",
+		"selector", h.canary.selector.String())
+	if h.canary.port == "" {
+		h.canary = nil
+		return
+	}
+	h.canary.selector = nil
+}
+
+// resolveRequestUpstream returns the host and port r goes to: the canary
+// backends for canary requests, otherwise those resolveUpstream picks for port
+func (h *Handler) resolveRequestUpstream(ctx context.Context, r *http.Request, port string) (host, upstreamPort string, canary bool, err error) {
+	if !h.canary.matches(r) {
+		host, upstreamPort, err = h.resolveUpstream(ctx, port)
+		return host, upstreamPort, false, err
+	}
+
+	upstreamPort = port
+	if h.canary.port != "" {
+		upstreamPort = h.canary.port
+	}
+	if h.canary.selector != nil {
+		host, err = h.nodeDiscovery.(labeledNodeDiscovery).GetNodeIPForSelector(ctx, h.canary.selector)
+	} else {
+		host, err = h.resolveTarget(ctx, port)
+	}
+	return host, upstreamPort, true, err
+}
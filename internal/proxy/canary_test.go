@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// labeledDiscovery selects currentIP and picks the first node whose labels
+// match for canary requests
+type labeledDiscovery struct {
+	currentIP string
+	nodes     []labeledNode
+}
+
+type labeledNode struct {
+	ip     string
+	labels map[string]string
+}
+
+func (d labeledDiscovery) GetCurrentNodeIP(context.Context) (string, error) { return d.currentIP, nil }
+
+func (d labeledDiscovery) GetNodeIPForSelector(_ context.Context, selector labels.Selector) (string, error) {
+	for _, node := range d.nodes {
+		if selector.Matches(labels.Set(node.labels)) {
+			return node.ip, nil
+		}
+	}
+	return "", fmt.Errorf("no healthy nodes found matching %q", selector.String())
+}
+
+func TestCanaryFromEnv(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantNil      bool
+		wantErr      bool
+		wantHeader   string
+		wantSelector string
+		wantPort     string
+	}{
+		{name: "unset", wantNil: true},
+		{
+			name:         "node selector",
+			env:          map[string]string{"CANARY_HEADER": "x-canary", "CANARY_NODE_SELECTOR": "track=canary"},
+			wantHeader:   "X-Canary",
+			wantSelector: "track=canary",
+		},
+		{
+			name:       "port",
+			env:        map[string]string{"CANARY_HEADER": "X-Canary", "CANARY_PORT": "30081"},
+			wantHeader: "X-Canary",
+			wantPort:   "30081",
+		},
+		{name: "no target", env: map[string]string{"CANARY_HEADER": "X-Canary"}, wantErr: true},
+		{name: "invalid selector", env: map[string]string{"CANARY_HEADER": "X-Canary", "CANARY_NODE_SELECTOR": "track in canary"}, wantErr: true},
+		{name: "invalid port", env: map[string]string{"CANARY_HEADER": "X-Canary", "CANARY_PORT": "70000"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"CANARY_HEADER", "CANARY_HEADER_VALUE", "CANARY_NODE_SELECTOR", "CANARY_PORT"} {
+				t.Setenv(key, tt.env[key])
+			}
+
+			canary, err := canaryFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %+v", canary)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.wantNil {
+				if canary != nil {
+					t.Errorf("Expected no canary routing, got %+v", canary)
+				}
+				return
+			}
+			if canary.header != tt.wantHeader {
+				t.Errorf("Expected header %q, got %q", tt.wantHeader, canary.header)
+			}
+			selector := ""
+			if canary.selector != nil {
+				selector = canary.selector.String()
+			}
+			if selector != tt.wantSelector {
+				t.Errorf("Expected selector %q, got %q", tt.wantSelector, selector)
+			}
+			if canary.port != tt.wantPort {
+				t.Errorf("Expected port %q, got %q", tt.wantPort, canary.port)
+			}
+		})
+	}
+}
+
+func TestServeHTTP_CanaryRouting(t *testing.T) {
+	// The backend answers with the host it was reached through, which is the node the proxy picked
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.Host)
+		io.WriteString(w, host)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	t.Run("node selector", func(t *testing.T) {
+		t.Setenv("CANARY_HEADER", "X-Canary")
+		t.Setenv("CANARY_HEADER_VALUE", "true")
+		t.Setenv("CANARY_NODE_SELECTOR", "track=canary")
+
+		handler := NewHandler(labeledDiscovery{
+			currentIP: "localhost",
+			nodes: []labeledNode{
+				{ip: "localhost", labels: map[string]string{"track": "stable"}},
+				{ip: "127.0.0.1", labels: map[string]string{"track": "canary"}},
+			},
+		}, settingsFromEnv(t))
+
+		tests := []struct {
+			name   string
+			header string
+			want   string
+		}{
+			{name: "canary header", header: "true", want: "127.0.0.1"},
+			{name: "no header", want: "localhost"},
+			{name: "other header value", header: "false", want: "localhost"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil)
+				if tt.header != "" {
+					req.Header.Set("X-Canary", tt.header)
+				}
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+
+				if rr.Code != http.StatusOK {
+					t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+				}
+				if rr.Body.String() != tt.want {
+					t.Errorf("Expected the request to reach node %s, got %s", tt.want, rr.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("port", func(t *testing.T) {
+		canaryBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "canary")
+		}))
+		defer canaryBackend.Close()
+		canaryURL, _ := url.Parse(canaryBackend.URL)
+
+		t.Setenv("CANARY_HEADER", "X-Canary")
+		t.Setenv("CANARY_PORT", canaryURL.Port())
+
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+		req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil)
+		req.Header.Set("X-Canary", "1")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Body.String() != "canary" {
+			t.Errorf("Expected the canary request on port %s, got %q", canaryURL.Port(), rr.Body.String())
+		}
+
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil))
+		if rr.Body.String() != "127.0.0.1" {
+			t.Errorf("Expected other requests on their own port, got %q", rr.Body.String())
+		}
+	})
+
+	t.Run("selector without node discovery", func(t *testing.T) {
+		t.Setenv("CANARY_HEADER", "X-Canary")
+		t.Setenv("CANARY_NODE_SELECTOR", "track=canary")
+
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+		if handler.canary != nil {
+			t.Errorf("Expected canary routing disabled without label-aware discovery, got %+v", handler.canary)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+
+	"k8s-node-proxy/internal/proxyproto"
+)
+
+// trustedProxies are the address ranges of load balancers in front of the
+// proxy (TRUSTED_PROXIES). Only they may tell us the client's address through
+// X-Forwarded-For; anyone else could put any address there.
+type trustedProxies []netip.Prefix
+
+// trustedProxiesFromEnv reads TRUSTED_PROXIES, comma-separated CIDRs or
+// single addresses, e.g. "10.0.0.0/8,192.168.1.5"
+func trustedProxiesFromEnv() (trustedProxies, error) {
+	proxies, err := proxyproto.ParseTrustedCIDRs(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	return proxies, nil
+}
+
+// trusts reports whether ip belongs to a trusted proxy
+func (t trustedProxies) trusts(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client behind r. When the peer is a
+// trusted proxy, X-Forwarded-For is walked from the right, skipping the
+// trusted proxies that appended to it; the first other address is the client.
+// Entries left of it were written by the client and are ignored, so the client
+// can't pose as someone else. Otherwise the peer address is the client.
+func (t trustedProxies) clientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	if !t.trusts(peer) {
+		return peer
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		client = hops[i]
+		if !t.trusts(client) {
+			break
+		}
+	}
+	return client
+}
+
+// remoteIP returns the peer address of r without its port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.5")
+	trusted, err := trustedProxiesFromEnv()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expectedIP   string
+	}{
+		{"UntrustedPeer", "203.0.113.9:5000", "198.51.100.1", "203.0.113.9"},
+		{"TrustedPeer", "10.0.0.1:5000", "198.51.100.1", "198.51.100.1"},
+		{"TrustedSingleAddress", "192.168.1.5:5000", "198.51.100.1", "198.51.100.1"},
+		{"SpoofedEntriesIgnored", "10.0.0.1:5000", "1.2.3.4, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"AllHopsTrusted", "10.0.0.1:5000", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"TrustedPeerWithoutHeader", "10.0.0.1:5000", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if ip := trusted.clientIP(req); ip != tt.expectedIP {
+				t.Errorf("Expected client IP %s, got %s", tt.expectedIP, ip)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,not-an-ip")
+		if _, err := trustedProxiesFromEnv(); err == nil {
+			t.Error("Expected error for an invalid entry")
+		}
+	})
+}
+
+func TestServeHTTP_TrustedProxies(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	t.Setenv("RATE_LIMIT_RPS", "1")
+	t.Setenv("RATE_LIMIT_BURST", "1")
+	buf := captureSlog(t)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	send := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Clients behind the same load balancer get their own buckets
+	if code := send("10.0.0.1:5000", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if code := send("10.0.0.1:5000", "198.51.100.2"); code != http.StatusOK {
+		t.Errorf("Expected a second client behind the proxy to be allowed, got %d", code)
+	}
+	if code := send("10.0.0.1:5000", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the first client to be limited, got %d", code)
+	}
+
+	// An untrusted peer is limited by its own address whatever it claims
+	if code := send("203.0.113.9:5000", "198.51.100.3"); code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", code)
+	}
+	if code := send("203.0.113.9:5000", "198.51.100.4"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected an untrusted peer to be limited by its address, got %d", code)
+	}
+
+	records := accessRecords(t, buf)
+	if len(records) == 0 {
+		t.Fatal("Expected access log records")
+	}
+	if ip := records[0]["client_ip"]; ip != "198.51.100.1" {
+		t.Errorf("Expected client_ip 198.51.100.1, got %v", ip)
+	}
+}
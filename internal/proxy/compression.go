@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultCompressionMinBytes is the smallest known-length body worth compressing;
+// below it the gzip framing can outweigh the savings
+const defaultCompressionMinBytes = 1024
+
+// compressedContentTypes are already compressed; gzipping them again wastes CPU
+var compressedContentTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/pdf":              true,
+	"application/octet-stream":     true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+	// Event streams stay uncompressed so every event reaches the client as it is sent
+	"text/event-stream": true,
+}
+
+// responseCompression compresses backend responses for clients that accept it
+type responseCompression struct {
+	minBytes int64
+}
+
+// compressionFromEnv reads ENABLE_COMPRESSION (default false) and
+// COMPRESSION_MIN_BYTES, the smallest known-length body compressed (default
+// 1024). It returns nil, leaving responses untouched, when compression is off.
+func compressionFromEnv() (*responseCompression, error) {
+	value := os.Getenv("ENABLE_COMPRESSION")
+	if value == "" {
+		return nil, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ENABLE_COMPRESSION value %q: %w", value, err)
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	minBytes := int64(defaultCompressionMinBytes)
+	if value := os.Getenv("COMPRESSION_MIN_BYTES"); value != "" {
+		minBytes, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || minBytes < 0 {
+			return nil, fmt.Errorf("invalid COMPRESSION_MIN_BYTES value %q: must be a non-negative integer", value)
+		}
+	}
+	return &responseCompression{minBytes: minBytes}, nil
+}
+
+// compressible reports whether resp may be compressed for some client: the
+// backend hasn't encoded it, it has a body, and its type and size are worth it.
+// A nil responseCompression compresses nothing.
+func (c *responseCompression) compressible(r *http.Request, resp *http.Response) bool {
+	if c == nil || r.Method == http.MethodHead {
+		return false
+	}
+	switch {
+	case resp.StatusCode < http.StatusOK,
+		resp.StatusCode == http.StatusNoContent,
+		resp.StatusCode == http.StatusPartialContent,
+		resp.StatusCode == http.StatusNotModified:
+		return false
+	}
+	if resp.Header.Get("Content-Encoding") != "" || resp.Header.Get("Content-Range") != "" {
+		return false
+	}
+	if resp.ContentLength >= 0 && resp.ContentLength < c.minBytes {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		// Without a usable Content-Type there is no telling whether it compresses
+		return false
+	}
+	if strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml" {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "audio/") ||
+		strings.HasPrefix(mediaType, "application/grpc") {
+		return false
+	}
+	return !compressedContentTypes[mediaType]
+}
+
+// negotiateEncoding picks gzip or deflate from the client's Accept-Encoding,
+// preferring gzip. It returns "" when the client accepts neither.
+func negotiateEncoding(r *http.Request) string {
+	accepted := map[string]bool{}
+	wildcard := false
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, entry := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(entry, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			ok := acceptable(params)
+			if name == "*" {
+				wildcard = ok
+				continue
+			}
+			accepted[name] = ok
+		}
+	}
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		if ok, listed := accepted[encoding]; listed {
+			if ok {
+				return encoding
+			}
+			continue
+		}
+		if wildcard {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// acceptable reports whether an Accept-Encoding entry's parameters leave it
+// enabled; only an explicit q=0 refuses the encoding
+func acceptable(params string) bool {
+	for _, param := range strings.Split(params, ";") {
+		key, value, found := strings.Cut(strings.TrimSpace(param), "=")
+		if !found || !strings.EqualFold(key, "q") {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return err == nil && q > 0
+	}
+	return true
+}
+
+// prepareCompressedHeaders rewrites the headers already copied to w for a body
+// sent with encoding: the backend's length no longer applies, and a strong
+// ETag would wrongly claim the bytes are identical to the uncompressed body
+func prepareCompressedHeaders(header http.Header, encoding string) {
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", encoding)
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// addVaryAcceptEncoding tells caches the body depends on Accept-Encoding
+func addVaryAcceptEncoding(header http.Header) {
+	for _, value := range header.Values("Vary") {
+		for _, token := range strings.Split(value, ",") {
+			token = strings.TrimSpace(token)
+			if token == "*" || strings.EqualFold(token, "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	header.Add("Vary", "Accept-Encoding")
+}
+
+// compressWriter compresses everything written to the client. Flushing pushes
+// the compressed bytes buffered so far, so streamed responses still arrive as
+// they are produced.
+type compressWriter struct {
+	http.ResponseWriter
+	encoder interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func newCompressWriter(w http.ResponseWriter, encoding string) *compressWriter {
+	cw := &compressWriter{ResponseWriter: w}
+	if encoding == "deflate" {
+		// flate.NewWriter only fails for an invalid level
+		cw.encoder, _ = flate.NewWriter(w, flate.DefaultCompression)
+	} else {
+		cw.encoder = gzip.NewWriter(w)
+	}
+	return cw
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	return cw.encoder.Write(b)
+}
+
+// FlushError is used by http.ResponseController, which copyResponseBody flushes through
+func (cw *compressWriter) FlushError() error {
+	if err := cw.encoder.Flush(); err != nil {
+		return err
+	}
+	if err := http.NewResponseController(cw.ResponseWriter).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// Close writes the end of the compressed stream; it must run before trailers are set
+func (cw *compressWriter) Close() error {
+	return cw.encoder.Close()
+}
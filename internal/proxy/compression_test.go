@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestServeHTTP_Compression(t *testing.T) {
+	t.Setenv("ENABLE_COMPRESSION", "true")
+	page := strings.Repeat("<p>hello from the backend</p>\n", 100)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("tiny"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(page))
+		case "/stream":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("first chunk\n"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("second chunk\n"))
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte(page))
+		}
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	send := func(path, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+path, nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	gunzip := func(t *testing.T, body io.Reader) string {
+		t.Helper()
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatalf("Expected a gzip body: %v", err)
+		}
+		decoded, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Failed to decompress body: %v", err)
+		}
+		return string(decoded)
+	}
+
+	t.Run("GzipClient", func(t *testing.T) {
+		w := send("/", "gzip, deflate, br")
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+		}
+		if w.Header().Get("Content-Length") != "" {
+			t.Errorf("Expected no Content-Length on a compressed body, got %s", w.Header().Get("Content-Length"))
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("Expected Vary: Accept-Encoding, got %q", got)
+		}
+		if got := w.Header().Get("ETag"); got != `W/"v1"` {
+			t.Errorf("Expected the ETag to be weakened, got %q", got)
+		}
+		if w.Body.Len() >= len(page) {
+			t.Errorf("Expected fewer than %d bytes, got %d", len(page), w.Body.Len())
+		}
+		if got := gunzip(t, w.Body); got != page {
+			t.Error("Decompressed body does not match the backend body")
+		}
+	})
+
+	t.Run("NonAcceptingClient", func(t *testing.T) {
+		w := send("/", "")
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Expected no Content-Encoding, got %q", got)
+		}
+		if w.Body.String() != page {
+			t.Error("Expected the uncompressed backend body")
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("Expected Vary: Accept-Encoding so caches keep the variants apart, got %q", got)
+		}
+	})
+
+	t.Run("GzipRefused", func(t *testing.T) {
+		w := send("/", "gzip;q=0, identity")
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Expected no Content-Encoding, got %q", got)
+		}
+	})
+
+	t.Run("Deflate", func(t *testing.T) {
+		w := send("/", "deflate")
+		if got := w.Header().Get("Content-Encoding"); got != "deflate" {
+			t.Errorf("Expected Content-Encoding deflate, got %q", got)
+		}
+	})
+
+	t.Run("SkipsSmallBodies", func(t *testing.T) {
+		w := send("/small", "gzip")
+		if got := w.Header().Get("Content-Encoding"); got != "" || w.Body.String() != "tiny" {
+			t.Errorf("Expected the small body uncompressed, got encoding %q body %q", got, w.Body.String())
+		}
+	})
+
+	t.Run("SkipsCompressedTypes", func(t *testing.T) {
+		w := send("/image", "gzip")
+		if got := w.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Expected image/png to pass through, got encoding %q", got)
+		}
+	})
+
+	t.Run("Streaming", func(t *testing.T) {
+		w := send("/stream", "gzip")
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("Expected a streamed body of unknown length to be gzipped, got %q", got)
+		}
+		if got := gunzip(t, w.Body); got != "first chunk\nsecond chunk\n" {
+			t.Errorf("Unexpected decompressed body %q", got)
+		}
+	})
+}
+
+func TestCompressionFromEnv(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		c, err := compressionFromEnv()
+		if err != nil || c != nil {
+			t.Errorf("Expected compression off by default, got %v, %v", c, err)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("ENABLE_COMPRESSION", "true")
+		t.Setenv("COMPRESSION_MIN_BYTES", "-1")
+		if _, err := compressionFromEnv(); err == nil {
+			t.Error("Expected an error for a negative COMPRESSION_MIN_BYTES")
+		}
+	})
+}
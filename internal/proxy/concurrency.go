@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// Behaviors for requests beyond MAX_CONCURRENT_UPSTREAM
+const (
+	// upstreamLimitQueue waits for a slot until the request times out
+	upstreamLimitQueue = "queue"
+	// upstreamLimitReject answers 503 straight away
+	upstreamLimitReject = "reject"
+)
+
+// upstreamLimiter bounds the number of requests in flight to the backends
+type upstreamLimiter struct {
+	slots *semaphore.Weighted
+	limit int64
+	// queue waits for a free slot instead of rejecting the request
+	queue bool
+}
+
+// upstreamLimiterFromEnv reads MAX_CONCURRENT_UPSTREAM, the most requests
+// forwarded at once, and MAX_CONCURRENT_UPSTREAM_BEHAVIOR, what happens to
+// requests beyond it: "queue" (default) or "reject". It returns nil, disabling
+// the limit, when MAX_CONCURRENT_UPSTREAM is unset or 0.
+func upstreamLimiterFromEnv() (*upstreamLimiter, error) {
+	value := os.Getenv("MAX_CONCURRENT_UPSTREAM")
+	if value == "" {
+		return nil, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		return nil, fmt.Errorf("invalid MAX_CONCURRENT_UPSTREAM value %q: must be a non-negative integer", value)
+	}
+	if limit == 0 {
+		return nil, nil
+	}
+
+	queue := true
+	switch behavior := os.Getenv("MAX_CONCURRENT_UPSTREAM_BEHAVIOR"); behavior {
+	case "", upstreamLimitQueue:
+	case upstreamLimitReject:
+		queue = false
+	default:
+		return nil, fmt.Errorf("invalid MAX_CONCURRENT_UPSTREAM_BEHAVIOR value %q: must be %q or %q", behavior, upstreamLimitQueue, upstreamLimitReject)
+	}
+
+	return &upstreamLimiter{slots: semaphore.NewWeighted(limit), limit: limit, queue: queue}, nil
+}
+
+// acquire takes a slot for one upstream request, queueing until ctx is done
+// when configured to. It returns the function releasing the slot, or false
+// when no slot was free. A nil upstreamLimiter admits everything.
+func (l *upstreamLimiter) acquire(ctx context.Context) (func(), bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	if l.queue {
+		if err := l.slots.Acquire(ctx, 1); err != nil {
+			return nil, false
+		}
+	} else if !l.slots.TryAcquire(1) {
+		return nil, false
+	}
+	return func() { l.slots.Release(1) }, true
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingBackend holds every request until release is closed and records the
+// highest number of requests it served at once
+func blockingBackend(t *testing.T) (host string, inflight, peak *atomic.Int32, release chan struct{}) {
+	inflight, peak = &atomic.Int32{}, &atomic.Int32{}
+	release = make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+	}))
+	t.Cleanup(backend.Close)
+	backendURL, _ := url.Parse(backend.URL)
+	return backendURL.Host, inflight, peak, release
+}
+
+// waitFor polls cond until it holds or a second passes
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestServeHTTP_MaxConcurrentUpstream(t *testing.T) {
+	t.Run("Reject", func(t *testing.T) {
+		t.Setenv("MAX_CONCURRENT_UPSTREAM", "2")
+		t.Setenv("MAX_CONCURRENT_UPSTREAM_BEHAVIOR", "reject")
+		host, inflight, _, release := blockingBackend(t)
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+		codes := make(chan int, 2)
+		for range 2 {
+			go func() {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+				codes <- w.Code
+			}()
+		}
+		waitFor(t, func() bool { return inflight.Load() == 2 })
+
+		// Both slots are taken, so further requests are shed
+		for range 3 {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected 503 beyond the limit, got %d", w.Code)
+			}
+		}
+
+		close(release)
+		for range 2 {
+			if code := <-codes; code != http.StatusOK {
+				t.Errorf("Expected 200 within the limit, got %d", code)
+			}
+		}
+	})
+
+	t.Run("Queue", func(t *testing.T) {
+		t.Setenv("MAX_CONCURRENT_UPSTREAM", "2")
+		host, inflight, peak, release := blockingBackend(t)
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+		var wg sync.WaitGroup
+		codes := make(chan int, 6)
+		for range 6 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+				codes <- w.Code
+			}()
+		}
+		waitFor(t, func() bool { return inflight.Load() == 2 })
+		// Give queued requests a chance to (wrongly) reach the backend
+		time.Sleep(20 * time.Millisecond)
+
+		close(release)
+		wg.Wait()
+		close(codes)
+		for code := range codes {
+			if code != http.StatusOK {
+				t.Errorf("Expected queued requests to succeed, got %d", code)
+			}
+		}
+		if got := peak.Load(); got != 2 {
+			t.Errorf("Expected at most 2 concurrent upstream requests, got %d", got)
+		}
+	})
+
+	t.Run("QueueTimesOut", func(t *testing.T) {
+		t.Setenv("MAX_CONCURRENT_UPSTREAM", "1")
+		host, inflight, _, release := blockingBackend(t)
+		defer close(release)
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+		go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+		waitFor(t, func() bool { return inflight.Load() == 1 })
+
+		// The client gives up while queued
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequestWithContext(ctx, http.MethodGet, "http://"+host+"/", nil))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 once the queued request timed out, got %d", w.Code)
+		}
+	})
+}
+
+func TestUpstreamLimiterFromEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    string
+		behavior string
+		wantNil  bool
+		wantErr  bool
+	}{
+		{"Unset", "", "", true, false},
+		{"Zero", "0", "", true, false},
+		{"Queue", "10", "", false, false},
+		{"Reject", "10", "reject", false, false},
+		{"Negative", "-1", "", true, true},
+		{"NotANumber", "many", "", true, true},
+		{"UnknownBehavior", "10", "drop", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_CONCURRENT_UPSTREAM", tt.limit)
+			t.Setenv("MAX_CONCURRENT_UPSTREAM_BEHAVIOR", tt.behavior)
+			limiter, err := upstreamLimiterFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (limiter == nil) != tt.wantNil {
+				t.Errorf("Expected nil limiter %v, got %v", tt.wantNil, limiter)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"k8s-node-proxy/internal/metrics"
+	"k8s-node-proxy/internal/proxyproto"
+)
+
+// connectFromEnv reads ENABLE_CONNECT (default false), which lets clients open
+// TCP tunnels to the selected node with HTTP CONNECT
+func connectFromEnv() (bool, error) {
+	value := os.Getenv("ENABLE_CONNECT")
+	if value == "" {
+		return false, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid ENABLE_CONNECT value %q: %w", value, err)
+	}
+	return enabled, nil
+}
+
+// serveConnect handles CONNECT host:port by tunnelling raw bytes to the
+// selected node at port. The requested host is ignored; like every proxied
+// request, the tunnel goes to the current target. Only ports of discovered
+// services may be reached, so CONNECT can't open e.g. the kubelet or SSH port.
+func (h *Handler) serveConnect(w http.ResponseWriter, r *http.Request) {
+	if !h.connect {
+		w.Header().Set("Allow", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		http.Error(w, "CONNECT is disabled", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.rateLimit.allow(r) {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	_, port, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		http.Error(w, "CONNECT target must be host:port", http.StatusBadRequest)
+		return
+	}
+	names := h.serviceNames.Load()
+	if names == nil {
+		http.Error(w, "CONNECT is only allowed to service ports", http.StatusForbidden)
+		return
+	}
+	service, ok := (*names)[port]
+	if !ok {
+		http.Error(w, "CONNECT is only allowed to service ports", http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeouts.Dial+5*time.Second)
+	nodeIP, upstreamPort, _, err := h.resolveRequestUpstream(ctx, r, port)
+	if err != nil {
+		cancel()
+		h.logger.Error("Failed to discover node IP", "error", err)
+		h.writeTargetUnavailable(w, err)
+		return
+	}
+	var dial proxyproto.DialFunc = (&net.Dialer{Timeout: h.timeouts.Dial}).DialContext
+	if h.upstreamProxyProtocol != 0 {
+		dial = proxyproto.WrapDial(h.upstreamProxyProtocol, dial)
+		ctx = withClientAddrs(ctx, r)
+	}
+	upstream, err := dial(ctx, "tcp", net.JoinHostPort(nodeIP, upstreamPort))
+	cancel()
+	if err != nil {
+		h.logger.Error("Failed to open CONNECT tunnel", "node_ip", nodeIP, "port", upstreamPort, "error", err)
+		metrics.IncBackendErrors()
+		http.Error(w, "Failed to connect to backend", http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	client, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// HTTP/2 connections can't be taken over
+		http.Error(w, "CONNECT requires HTTP/1.1", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	defer client.Close()
+
+	// The connection is ours now: the server's read and write deadlines no longer apply
+	client.SetDeadline(time.Time{})
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+	// Bytes the client sent right after the request may already sit in the server's buffer
+	if n := buffered.Reader.Buffered(); n > 0 {
+		early, _ := buffered.Reader.Peek(n)
+		if _, err := upstream.Write(early); err != nil {
+			return
+		}
+	}
+
+	// A failover lets the tunnel run on the old node until the drain timeout
+	drainCtx, done := h.inflight.begin(nodeIP)
+	defer done()
+	stopDrain := context.AfterFunc(drainCtx, func() {
+		client.Close()
+		upstream.Close()
+	})
+	defer stopDrain()
+
+	start := time.Now()
+	h.logger.Info("Opened CONNECT tunnel", "client", r.RemoteAddr, "node_ip", nodeIP, "port", port, "service", service)
+	sent, received := splice(client, upstream)
+	h.logger.Info("Closed CONNECT tunnel",
+		"client", r.RemoteAddr,
+		"node_ip", nodeIP,
+		"port", port,
+		"bytes_sent", sent,
+		"bytes_received", received,
+		"duration", time.Since(start))
+}
+
+// splice copies bytes both ways between client and upstream until both
+// directions are done. When one side stops sending, the other side's write
+// half is closed so it sees EOF while still able to answer.
+func splice(client, upstream net.Conn) (sent, received int64) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		sent, _ = io.Copy(upstream, client)
+		closeWrite(upstream)
+	}()
+	go func() {
+		defer wg.Done()
+		received, _ = io.Copy(client, upstream)
+		closeWrite(client)
+	}()
+	wg.Wait()
+	return sent, received
+}
+
+// closeWrite half-closes conn when it supports it, and closes it otherwise
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// tcpEchoBackend echoes every byte back on each connection
+func tcpEchoBackend(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// sendConnect opens a connection to proxyAddr and sends CONNECT target
+func sendConnect(t *testing.T, proxyAddr, target string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", proxyAddr)
+	if err != nil {
+		t.Fatalf("Failed to dial proxy: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, "CONNECT "+target+" HTTP/1.1\r\nHost: "+target+"\r\n\r\n"); err != nil {
+		t.Fatalf("Failed to send CONNECT: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatalf("Failed to read CONNECT response: %v", err)
+	}
+	return conn, reader, resp
+}
+
+func TestServeConnect(t *testing.T) {
+	t.Setenv("ENABLE_CONNECT", "true")
+	echoPort := tcpEchoBackend(t)
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	handler.SetServiceNames(map[int]string{echoPort: "default/echo"})
+	proxyServer := httptest.NewServer(handler)
+	defer proxyServer.Close()
+	proxyAddr := proxyServer.Listener.Addr().String()
+
+	t.Run("TunnelsRawBytes", func(t *testing.T) {
+		// The host is ignored; the tunnel always goes to the selected node
+		conn, reader, resp := sendConnect(t, proxyAddr, "echo.example:"+strconv.Itoa(echoPort))
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+
+		payload := []byte("\x00\x01raw bytes, not HTTP\r\n\xff")
+		if _, err := conn.Write(payload); err != nil {
+			t.Fatalf("Failed to write through the tunnel: %v", err)
+		}
+		echoed := make([]byte, len(payload))
+		if _, err := io.ReadFull(reader, echoed); err != nil {
+			t.Fatalf("Failed to read through the tunnel: %v", err)
+		}
+		if string(echoed) != string(payload) {
+			t.Errorf("Expected %q echoed, got %q", payload, echoed)
+		}
+	})
+
+	t.Run("RejectsUnknownPorts", func(t *testing.T) {
+		_, _, resp := sendConnect(t, proxyAddr, "127.0.0.1:22")
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403 for a port without a service, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestServeConnect_Disabled(t *testing.T) {
+	echoPort := tcpEchoBackend(t)
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	handler.SetServiceNames(map[int]string{echoPort: "default/echo"})
+	proxyServer := httptest.NewServer(handler)
+	defer proxyServer.Close()
+
+	_, _, resp := sendConnect(t, proxyServer.Listener.Addr().String(), "127.0.0.1:"+strconv.Itoa(echoPort))
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 without ENABLE_CONNECT, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s-node-proxy/internal/metrics"
+)
+
+// upstreamKeepAlive tunes how backend connections are kept for reuse; nil
+// fields leave the transport's defaults
+type upstreamKeepAlive struct {
+	maxIdleConnsPerHost *int
+	idleConnTimeout     *time.Duration
+}
+
+// upstreamKeepAliveFromEnv reads:
+//   - UPSTREAM_MAX_IDLE_CONNS_PER_HOST: idle connections kept per node (Go's default is 2,
+//     which churns connections when all traffic goes to one node)
+//   - UPSTREAM_IDLE_CONN_TIMEOUT: how long an idle connection is kept (default 90s)
+func upstreamKeepAliveFromEnv() (upstreamKeepAlive, error) {
+	var keepAlive upstreamKeepAlive
+	if value := os.Getenv("UPSTREAM_MAX_IDLE_CONNS_PER_HOST"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return upstreamKeepAlive{}, fmt.Errorf("invalid UPSTREAM_MAX_IDLE_CONNS_PER_HOST value %q: must be a non-negative integer", value)
+		}
+		keepAlive.maxIdleConnsPerHost = &n
+	}
+	if value := os.Getenv("UPSTREAM_IDLE_CONN_TIMEOUT"); value != "" {
+		timeout, err := parseTimeout("UPSTREAM_IDLE_CONN_TIMEOUT", value)
+		if err != nil {
+			return upstreamKeepAlive{}, err
+		}
+		keepAlive.idleConnTimeout = &timeout
+	}
+	return keepAlive, nil
+}
+
+func (k upstreamKeepAlive) apply(transport *http.Transport) {
+	if k.maxIdleConnsPerHost != nil {
+		transport.MaxIdleConnsPerHost = *k.maxIdleConnsPerHost
+	}
+	if k.idleConnTimeout != nil {
+		transport.IdleConnTimeout = *k.idleConnTimeout
+	}
+}
+
+// upstreamConn is a backend connection tracked from dial to close
+type upstreamConn struct {
+	net.Conn
+	tracker *connTracker
+	host    string
+	// inUse counts the requests using the connection (several for HTTP/2); guarded by tracker.mu
+	inUse int
+}
+
+func (c *upstreamConn) Close() error {
+	c.tracker.remove(c)
+	return c.Conn.Close()
+}
+
+// connTracker follows backend connections through their lifecycle - dialled,
+// used by a request, idle in the pool, closed - so the counts of active and
+// idle connections can be exported, and so connections to a drained node are
+// closed instead of being reused.
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[*upstreamConn]struct{}
+	// draining holds the hosts whose connections are closed once idle
+	draining map[string]bool
+}
+
+// wrapDial returns a dial function registering every connection dial makes
+func (t *connTracker) wrapDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		c := &upstreamConn{Conn: conn, tracker: t, host: host}
+
+		t.mu.Lock()
+		if t.conns == nil {
+			t.conns = make(map[*upstreamConn]struct{})
+		}
+		t.conns[c] = struct{}{}
+		t.updateMetricsLocked()
+		t.mu.Unlock()
+		return c, nil
+	}
+}
+
+// track marks the connection a request gets as active until the returned
+// function runs. Call it once the response body has been closed, so an
+// HTTP/1.1 connection is back in the pool by then.
+func (t *connTracker) track(ctx context.Context) (context.Context, func()) {
+	var current atomic.Pointer[upstreamConn]
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c := t.lookup(info.Conn)
+			if c == nil {
+				return
+			}
+			t.mu.Lock()
+			c.inUse++
+			t.updateMetricsLocked()
+			t.mu.Unlock()
+			// The transport retries some failed requests on a fresh connection
+			if previous := current.Swap(c); previous != nil {
+				t.release(previous)
+			}
+		},
+	}
+	return httptrace.WithClientTrace(ctx, trace), func() {
+		if c := current.Swap(nil); c != nil {
+			t.release(c)
+		}
+	}
+}
+
+// lookup finds the tracked connection under conn, unwrapping TLS
+func (t *connTracker) lookup(conn net.Conn) *upstreamConn {
+	for conn != nil {
+		if c, ok := conn.(*upstreamConn); ok {
+			return c
+		}
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil
+		}
+		conn = wrapper.NetConn()
+	}
+	return nil
+}
+
+// release ends one request's use of c, closing c if it is now idle and its host is draining
+func (t *connTracker) release(c *upstreamConn) {
+	t.mu.Lock()
+	c.inUse--
+	closeNow := c.inUse == 0 && t.draining[c.host]
+	t.updateMetricsLocked()
+	t.mu.Unlock()
+
+	if closeNow {
+		c.Close()
+	}
+}
+
+func (t *connTracker) remove(c *upstreamConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.conns[c]; !ok {
+		return
+	}
+	delete(t.conns, c)
+	if t.draining[c.host] && t.hostConnsLocked(c.host) == 0 {
+		delete(t.draining, c.host)
+	}
+	t.updateMetricsLocked()
+}
+
+// drainHost stops reusing connections to host: idle ones are closed now,
+// active ones as soon as their requests finish. Connections to other hosts are
+// left alone. It returns the number of idle connections closed.
+func (t *connTracker) drainHost(host string) int {
+	t.mu.Lock()
+	var idle []*upstreamConn
+	for c := range t.conns {
+		if c.host != host {
+			continue
+		}
+		if t.draining == nil {
+			t.draining = make(map[string]bool)
+		}
+		t.draining[host] = true
+		if c.inUse == 0 {
+			idle = append(idle, c)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, c := range idle {
+		c.Close()
+	}
+	return len(idle)
+}
+
+// isDraining reports whether connections to host are closed once idle
+func (t *connTracker) isDraining(host string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.draining[host]
+}
+
+// counts returns the number of backend connections serving a request and idle in the pool
+func (t *connTracker) counts() (active, idle int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.countsLocked()
+}
+
+func (t *connTracker) countsLocked() (active, idle int) {
+	for c := range t.conns {
+		if c.inUse > 0 {
+			active++
+		} else {
+			idle++
+		}
+	}
+	return active, idle
+}
+
+func (t *connTracker) hostConnsLocked(host string) int {
+	n := 0
+	for c := range t.conns {
+		if c.host == host {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *connTracker) updateMetricsLocked() {
+	metrics.SetUpstreamConnections(t.countsLocked())
+}
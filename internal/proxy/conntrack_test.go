@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+// connStateBackend counts the connections the backend has seen opened and closed
+func connStateBackend(t *testing.T, handler http.HandlerFunc) (host string, opened, closed *atomic.Int32) {
+	opened, closed = &atomic.Int32{}, &atomic.Int32{}
+	backend := httptest.NewUnstartedServer(handler)
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			opened.Add(1)
+		case http.StateClosed:
+			closed.Add(1)
+		}
+	}
+	backend.Start()
+	t.Cleanup(backend.Close)
+	backendURL, _ := url.Parse(backend.URL)
+	return backendURL.Host, opened, closed
+}
+
+func TestConnTracker_DrainClosesIdleConnections(t *testing.T) {
+	host, opened, closed := connStateBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+	}
+	if active, idle := handler.conns.counts(); active != 0 || idle != 1 {
+		t.Fatalf("Expected one reused idle connection, got active=%d idle=%d", active, idle)
+	}
+
+	// Draining another host leaves the node's connections alone
+	if n := handler.conns.drainHost("10.0.1.2"); n != 0 {
+		t.Errorf("Expected no connections closed for another host, got %d", n)
+	}
+
+	if n := handler.conns.drainHost("127.0.0.1"); n != 1 {
+		t.Errorf("Expected the idle connection to be closed, got %d", n)
+	}
+	waitFor(t, func() bool { return closed.Load() == 1 })
+	if active, idle := handler.conns.counts(); active != 0 || idle != 0 {
+		t.Errorf("Expected no tracked connections after draining, got active=%d idle=%d", active, idle)
+	}
+
+	// The next request opens a fresh connection instead of reusing the closed one
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+	if opened.Load() != 2 {
+		t.Errorf("Expected a new connection after draining, got %d opened", opened.Load())
+	}
+}
+
+func TestConnTracker_DrainClosesActiveConnectionWhenDone(t *testing.T) {
+	release := make(chan struct{})
+	host, _, closed := connStateBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("ok"))
+	})
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	finished := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil))
+		finished <- w.Code
+	}()
+	waitFor(t, func() bool {
+		active, _ := handler.conns.counts()
+		return active == 1
+	})
+
+	// The busy connection survives the drain so its request can finish
+	if n := handler.conns.drainHost("127.0.0.1"); n != 0 {
+		t.Errorf("Expected no idle connections to close, got %d", n)
+	}
+	close(release)
+	if code := <-finished; code != http.StatusOK {
+		t.Errorf("Expected the in-flight request to finish with 200, got %d", code)
+	}
+
+	waitFor(t, func() bool { return closed.Load() == 1 })
+	if active, idle := handler.conns.counts(); active != 0 || idle != 0 {
+		t.Errorf("Expected the connection closed instead of pooled, got active=%d idle=%d", active, idle)
+	}
+}
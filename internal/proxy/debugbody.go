@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultDebugBodyMaxBytes caps each logged body when DEBUG_BODY_MAX_BYTES is unset
+const defaultDebugBodyMaxBytes = 4096
+
+// debugBodies logs the start of request and response bodies for requests whose
+// path matches one of the prefixes (DEBUG_BODY_PATHS). Bodies are copied as
+// they stream through, so nothing is buffered beyond maxBytes per body.
+type debugBodies struct {
+	prefixes []string
+	maxBytes int
+}
+
+// debugBodiesFromEnv reads DEBUG_BODY_PATHS, comma-separated path prefixes,
+// and DEBUG_BODY_MAX_BYTES (default 4096). It returns nil when no path is set.
+func debugBodiesFromEnv() (*debugBodies, error) {
+	var prefixes []string
+	for _, prefix := range strings.Split(os.Getenv("DEBUG_BODY_PATHS"), ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+
+	maxBytes := defaultDebugBodyMaxBytes
+	if value := os.Getenv("DEBUG_BODY_MAX_BYTES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid DEBUG_BODY_MAX_BYTES value %q: must be a positive integer", value)
+		}
+		maxBytes = n
+	}
+	return &debugBodies{prefixes: prefixes, maxBytes: maxBytes}, nil
+}
+
+// matches reports whether the bodies of a request for path are logged
+func (d *debugBodies) matches(path string) bool {
+	if d == nil {
+		return false
+	}
+	for _, prefix := range d.prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyCapture keeps the first max bytes written to it and counts the rest
+type bodyCapture struct {
+	max   int
+	head  []byte
+	total int64
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	c.total += int64(len(p))
+	if c.head == nil {
+		c.head = make([]byte, 0, c.max)
+	}
+	if room := c.max - len(c.head); room > 0 {
+		c.head = append(c.head, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// attrs describes the captured body under the given key prefix
+func (c *bodyCapture) attrs(key string) []slog.Attr {
+	return []slog.Attr{
+		slog.String(key, string(c.head)),
+		slog.Int64(key+"_bytes", c.total),
+		slog.Bool(key+"_truncated", c.total > int64(len(c.head))),
+	}
+}
+
+// teeBody copies what is read from body into a new capture
+func (d *debugBodies) teeBody(body io.Reader) (io.Reader, *bodyCapture) {
+	capture := &bodyCapture{max: d.maxBytes}
+	return io.TeeReader(body, capture), capture
+}
+
+// captureRequest makes r's body copy itself into a capture as it is read
+func (d *debugBodies) captureRequest(r *http.Request) *bodyCapture {
+	if r.Body == nil || r.Body == http.NoBody {
+		return &bodyCapture{max: d.maxBytes}
+	}
+	tee, capture := d.teeBody(r.Body)
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{tee, r.Body}
+	return capture
+}
+
+// logDebugBodies writes the captured bodies of one request; response is nil
+// when the backend never answered
+func logDebugBodies(logger *slog.Logger, r *http.Request, status int, request, response *bodyCapture) {
+	attrs := []slog.Attr{
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("status", status),
+	}
+	attrs = append(attrs, request.attrs("request_body")...)
+	if response != nil {
+		attrs = append(attrs, response.attrs("response_body")...)
+	}
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "Debug request and response bodies", attrs...)
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestServeHTTP_DebugBodies(t *testing.T) {
+	t.Setenv("DEBUG_BODY_PATHS", "/api/, /debug")
+	t.Setenv("DEBUG_BODY_MAX_BYTES", "8")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("echo:" + string(body)))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	buf := captureSlog(t)
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://"+backendURL.Host+path, strings.NewReader(body)))
+		return w
+	}
+
+	// The client still gets the whole response, however much is logged
+	w := send("/api/orders", "order-12345")
+	if w.Body.String() != "echo:order-12345" {
+		t.Errorf("Expected the full response, got %q", w.Body.String())
+	}
+	send("/other", "not logged")
+
+	records := logRecords(t, buf, "Debug request and response bodies")
+	if len(records) != 1 {
+		t.Fatalf("Expected one body record for the matching path, got %d: %s", len(records), buf.String())
+	}
+	record := records[0]
+	want := map[string]any{
+		"path":                    "/api/orders",
+		"request_body":            "order-12",
+		"request_body_bytes":      float64(11),
+		"request_body_truncated":  true,
+		"response_body":           "echo:ord",
+		"response_body_bytes":     float64(16),
+		"response_body_truncated": true,
+		"status":                  float64(http.StatusOK),
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, record[key])
+		}
+	}
+}
+
+func TestBodyCapture_CapsBuffer(t *testing.T) {
+	capture := &bodyCapture{max: 4}
+	for _, chunk := range []string{"ab", "cdef", "gh"} {
+		if n, err := capture.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Expected the whole chunk accepted, got %d, %v", n, err)
+		}
+	}
+	if string(capture.head) != "abcd" || capture.total != 8 || cap(capture.head) != 4 {
+		t.Errorf("Expected head abcd of 8 bytes, got %q of %d (cap %d)", capture.head, capture.total, cap(capture.head))
+	}
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// blackholePort returns a loopback port whose SYNs go unanswered: a listener
+// with a full backlog that never accepts makes Linux drop new connections, as
+// a dead node does
+func blackholePort(t *testing.T) int {
+	t.Helper()
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	t.Cleanup(func() { syscall.Close(fd) })
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatalf("Failed to bind: %v", err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatalf("Failed to get socket address: %v", err)
+	}
+	port := addr.(*syscall.SockaddrInet4).Port
+
+	// Fill the backlog; once a dial times out, further ones will too
+	for range 8 {
+		conn, err := net.DialTimeout("tcp", "127.0.0.1:"+strconv.Itoa(port), 200*time.Millisecond)
+		if err != nil {
+			return port
+		}
+		t.Cleanup(func() { conn.Close() })
+	}
+	t.Skip("Backlog never filled; cannot simulate an unreachable backend")
+	return 0
+}
+
+// TestServeHTTP_DialTimeout tests that an unreachable node fails within
+// BACKEND_DIAL_TIMEOUT rather than the full request timeout
+func TestServeHTTP_DialTimeout(t *testing.T) {
+	t.Setenv("BACKEND_DIAL_TIMEOUT", "300ms")
+	t.Setenv("PROXY_TIMEOUT", "10s")
+
+	port := blackholePort(t)
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	req := httptest.NewRequest(http.MethodGet, "http://127.0.0.1:"+strconv.Itoa(port)+"/", nil)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(w, req)
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502, got %d", w.Code)
+	}
+	if elapsed < 300*time.Millisecond {
+		t.Errorf("Expected the dial to wait for the dial timeout, failed after %v", elapsed)
+	}
+	if elapsed > 3*time.Second {
+		t.Errorf("Expected failure within the dial timeout, took %v", elapsed)
+	}
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// defaultDrainTimeout is how long requests in flight to a failed-over node may
+// keep running before they are cancelled
+const defaultDrainTimeout = 30 * time.Second
+
+// drainTimeoutFromEnv reads PROXY_DRAIN_TIMEOUT (default 30s)
+func drainTimeoutFromEnv() (time.Duration, error) {
+	value := os.Getenv("PROXY_DRAIN_TIMEOUT")
+	if value == "" {
+		return defaultDrainTimeout, nil
+	}
+	return parseTimeout("PROXY_DRAIN_TIMEOUT", value)
+}
+
+// targetRequests tracks the requests in flight to one upstream host
+type targetRequests struct {
+	wg    sync.WaitGroup
+	count atomic.Int64
+
+	// Cancelled when a drain times out, aborting the requests still running
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// inflightTracker tracks in-flight requests per upstream host so a failover can
+// let the old node's requests finish instead of cutting them off
+type inflightTracker struct {
+	mu      sync.Mutex
+	targets map[string]*targetRequests
+}
+
+// begin registers a request to host. The returned context is cancelled if the
+// host is drained and the request outlives the drain timeout; call done when
+// the request finishes.
+func (t *inflightTracker) begin(host string) (context.Context, func()) {
+	t.mu.Lock()
+	if t.targets == nil {
+		t.targets = make(map[string]*targetRequests)
+	}
+	target, ok := t.targets[host]
+	if !ok {
+		target = &targetRequests{}
+		target.ctx, target.cancel = context.WithCancel(context.Background())
+		t.targets[host] = target
+	}
+	target.wg.Add(1)
+	target.count.Add(1)
+	t.mu.Unlock()
+
+	return target.ctx, func() {
+		target.count.Add(-1)
+		target.wg.Done()
+	}
+}
+
+// drainHost waits up to timeout for the requests in flight to host, then
+// cancels those still running. Requests to other hosts are left alone. New
+// requests to a drained host are tracked afresh.
+func (t *inflightTracker) drainHost(host string, timeout time.Duration, logger *slog.Logger) {
+	t.mu.Lock()
+	target, ok := t.targets[host]
+	delete(t.targets, host)
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+	defer target.cancel()
+
+	if n := target.count.Load(); n > 0 {
+		logger.Info("Draining in-flight requests", "host", host, "requests", n)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		target.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(timeout):
+		logger.Warn("Drain timeout, cancelling in-flight requests", "host", host, "requests", target.count.Load())
+	}
+}
+
+// DrainOnFailover drains requests in flight to the old node after each
+// failover, or to the old address after the selected node's IP changed: new
+// requests already go to the new target, in-flight ones get
+// PROXY_DRAIN_TIMEOUT to finish before they are cancelled. Only the old node's
+// address is drained; requests to canary nodes, pods and ClusterIPs never went
+// through it and keep running. Run it in its own goroutine with a channel from
+// the node discovery's Subscribe.
+func (h *Handler) DrainOnFailover(events <-chan nodes.NodeEvent) {
+	for event := range events {
+		if event.Type != nodes.NodeFailover && event.Type != nodes.NodeIPChanged {
+			continue
+		}
+		if event.OldIP == "" || event.OldIP == event.NewIP {
+			continue
+		}
+
+		// Requests routed just before the failover could still reuse idle keep-alive
+		// connections to the old node; close them now, and busy ones once they finish
+		if n := h.conns.drainHost(event.OldIP); n > 0 {
+			h.logger.Info("Closed idle connections to the drained node", "host", event.OldIP, "connections", n)
+		}
+		h.inflight.drainHost(event.OldIP, h.drainTimeout, h.logger)
+		h.client.CloseIdleConnections()
+		h.h2cClient.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// podEndpoint routes one listen port to a pod address
+type podEndpoint struct {
+	port    int
+	address string
+}
+
+func (p podEndpoint) ResolveEndpoint(_ context.Context, port int) (string, bool, error) {
+	return p.address, port == p.port, nil
+}
+
+// TestDrainOnFailover tests that a failover drains only the old node's
+// requests, leaving those routed straight to pods running
+func TestDrainOnFailover(t *testing.T) {
+	t.Setenv("PROXY_DRAIN_TIMEOUT", "50ms")
+
+	nodeHost, nodeInflight, _, releaseNode := blockingBackend(t)
+	defer close(releaseNode)
+
+	podInflight := make(chan struct{}, 1)
+	releasePod := make(chan struct{})
+	podListener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	}
+	pod := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		podInflight <- struct{}{}
+		<-releasePod
+		w.Write([]byte("pod"))
+	}))
+	pod.Listener.Close()
+	pod.Listener = podListener
+	pod.Start()
+	defer pod.Close()
+
+	// The pod's service is served on a port nothing else listens on
+	const podServicePort = 30999
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	handler.SetEndpointResolver(podEndpoint{port: podServicePort, address: podListener.Addr().String()})
+
+	serve := func(url string) <-chan int {
+		code := make(chan int, 1)
+		go func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+			code <- w.Code
+		}()
+		return code
+	}
+	nodeCode := serve("http://" + nodeHost + "/")
+	podCode := serve("http://proxy:" + strconv.Itoa(podServicePort) + "/")
+	waitFor(t, func() bool { return nodeInflight.Load() == 1 })
+	<-podInflight
+
+	events := make(chan nodes.NodeEvent, 1)
+	go handler.DrainOnFailover(events)
+	defer close(events)
+	events <- nodes.NodeEvent{Type: nodes.NodeFailover, OldNode: "node-1", NewNode: "node-2", OldIP: "127.0.0.1", NewIP: "10.0.1.2"}
+
+	// The old node's request is cancelled once the drain times out
+	select {
+	case code := <-nodeCode:
+		if code == http.StatusOK {
+			t.Errorf("Expected the old node's request to be cancelled, got %d", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the old node's request to be cancelled")
+	}
+
+	// The pod's request never went through the old node and keeps running
+	select {
+	case code := <-podCode:
+		t.Fatalf("Expected the pod's request to survive the failover, it finished with %d", code)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(releasePod)
+	if code := <-podCode; code != http.StatusOK {
+		t.Errorf("Expected the pod's request to finish with 200, got %d", code)
+	}
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strconv"
+)
+
+// EndpointResolver picks a ready pod for ports whose ClusterIP service is
+// routed to its endpoints rather than through a node (INCLUDE_CLUSTERIP).
+// routed is false for every other port.
+type EndpointResolver interface {
+	ResolveEndpoint(ctx context.Context, port int) (address string, routed bool, err error)
+}
+
+// SetEndpointResolver routes the ports endpoints resolves straight to pods;
+// call it before the handler serves requests
+func (h *Handler) SetEndpointResolver(endpoints EndpointResolver) {
+	h.endpoints = endpoints
+}
+
+// resolveUpstream returns the host and port a request arriving on port goes
+// to: a pod IP and target port for endpoint-routed services, otherwise the
+// target host on the same port
+func (h *Handler) resolveUpstream(ctx context.Context, port string) (host, upstreamPort string, err error) {
+	if h.endpoints != nil {
+		if listenPort, err := strconv.Atoi(port); err == nil {
+			address, routed, err := h.endpoints.ResolveEndpoint(ctx, listenPort)
+			if err != nil {
+				return "", "", err
+			}
+			if routed {
+				return net.SplitHostPort(address)
+			}
+		}
+	}
+	host, err = h.resolveTarget(ctx, port)
+	return host, port, err
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+
+	"k8s-node-proxy/internal/services"
+)
+
+func TestServeHTTP_EndpointRouting(t *testing.T) {
+	pod := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "pod")
+	}))
+	defer pod.Close()
+	podURL, _ := url.Parse(pod.URL)
+	podIP, podPort, _ := net.SplitHostPort(podURL.Host)
+	targetPort, _ := strconv.Atoi(podPort)
+
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "api-abc12",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "api"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{podIP}, Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(true)}},
+		},
+		Ports: []discoveryv1.EndpointPort{{Name: ptr.To("http"), Port: ptr.To(int32(targetPort))}},
+	}
+	router := services.NewEndpointRouter(fake.NewClientset(slice))
+	defer router.Stop()
+
+	// Nothing listens on the service port, so only the pod can answer
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closed.Close()
+	servicePort := closed.Addr().(*net.TCPAddr).Port
+
+	router.SetServices([]services.ServiceInfo{
+		{Name: "api", Namespace: "default", Port: int32(servicePort), PortName: "http", Endpoints: true},
+	})
+	waitFor(t, func() bool {
+		_, _, err := router.ResolveEndpoint(context.Background(), servicePort)
+		return err == nil
+	})
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	handler.SetEndpointResolver(router)
+
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://proxy/", nil)
+	req = req.WithContext(WithListenerPort(req.Context(), servicePort))
+	handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "pod" {
+		t.Errorf("Expected the pod's response, got %d %q", recorder.Code, recorder.Body.String())
+	}
+}
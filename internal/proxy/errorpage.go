@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// errorPage replaces the body of backend error responses whose status is in the
+// configured set, keeping the status code
+type errorPage struct {
+	statuses map[int]bool
+
+	// body is served instead of the backend body; empty means the default text page
+	body        []byte
+	contentType string
+}
+
+// errorPageFromEnv reads the error page configuration:
+//   - PROXY_SUPPRESS_BACKEND_ERROR_BODY: comma-separated status codes, e.g. "502,503,504"
+//   - PROXY_ERROR_PAGE_FILE: optional HTML file served in place of the backend body
+func errorPageFromEnv() (errorPage, error) {
+	page := errorPage{statuses: map[int]bool{}}
+
+	value := os.Getenv("PROXY_SUPPRESS_BACKEND_ERROR_BODY")
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		status, err := strconv.Atoi(entry)
+		if err != nil || status < 400 || status > 599 {
+			return errorPage{}, fmt.Errorf("invalid PROXY_SUPPRESS_BACKEND_ERROR_BODY status %q: must be 400-599", entry)
+		}
+		page.statuses[status] = true
+	}
+
+	if path := os.Getenv("PROXY_ERROR_PAGE_FILE"); path != "" {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return errorPage{}, fmt.Errorf("failed to read PROXY_ERROR_PAGE_FILE: %w", err)
+		}
+		page.body = body
+		page.contentType = "text/html; charset=utf-8"
+	}
+
+	return page, nil
+}
+
+// suppresses reports whether the backend body for status is replaced
+func (p errorPage) suppresses(status int) bool {
+	return p.statuses[status]
+}
+
+// write sends the error page with the backend's status in place of the backend body.
+// Backend headers already copied to w that describe the original body are dropped.
+func (p errorPage) write(w http.ResponseWriter, status int) {
+	header := w.Header()
+	for key := range header {
+		if strings.HasPrefix(key, "Content-") || key == "Etag" || key == "Last-Modified" {
+			header.Del(key)
+		}
+	}
+
+	body, contentType := p.body, p.contentType
+	if len(body) == 0 {
+		body = []byte(fmt.Sprintf("%d %s\n", status, http.StatusText(status)))
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"testing"
+)
+
+func TestErrorPageFromEnv(t *testing.T) {
+	t.Run("Unset", func(t *testing.T) {
+		t.Setenv("PROXY_SUPPRESS_BACKEND_ERROR_BODY", "")
+		page, err := errorPageFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if page.suppresses(502) {
+			t.Error("Expected nothing suppressed when unset")
+		}
+	})
+
+	t.Run("StatusSet", func(t *testing.T) {
+		t.Setenv("PROXY_SUPPRESS_BACKEND_ERROR_BODY", "502, 504")
+		page, err := errorPageFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !page.suppresses(502) || !page.suppresses(504) || page.suppresses(503) {
+			t.Errorf("Unexpected status set: %v", page.statuses)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, value := range []string{"abc", "200", "600"} {
+			t.Setenv("PROXY_SUPPRESS_BACKEND_ERROR_BODY", value)
+			if _, err := errorPageFromEnv(); err == nil {
+				t.Errorf("Expected error for %q", value)
+			}
+		}
+	})
+
+	t.Run("MissingPageFile", func(t *testing.T) {
+		t.Setenv("PROXY_SUPPRESS_BACKEND_ERROR_BODY", "502")
+		t.Setenv("PROXY_ERROR_PAGE_FILE", "/nonexistent/error.html")
+		if _, err := errorPageFromEnv(); err == nil {
+			t.Error("Expected error for missing page file")
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// isGRPC reports whether r is a gRPC call, which must reach the backend over HTTP/2
+func isGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// newH2CTransport returns a copy of base that speaks HTTP/2 without TLS (h2c
+// with prior knowledge) to http:// backends. HTTPS backends negotiate HTTP/2
+// through ALPN on the regular transport.
+func newH2CTransport(base *http.Transport) *http.Transport {
+	transport := base.Clone()
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	transport.Protocols = &protocols
+	return transport
+}
+
+// acceptsTrailers reports whether the client sent "TE: trailers". TE is
+// hop-by-hop, but gRPC backends expect this one value to be passed on.
+func acceptsTrailers(r *http.Request) bool {
+	for _, value := range r.Header.Values("Te") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copyResponseBody copies the backend body to the client. Streamed responses
+// (gRPC, or bodies of unknown length) are flushed after every read so messages
+// aren't held back in the response buffer.
+func copyResponseBody(w http.ResponseWriter, body io.Reader, stream bool) error {
+	if !stream {
+		_, err := io.Copy(w, body)
+		return err
+	}
+
+	rc := http.NewResponseController(w)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, writeErr := w.Write(buf[:n]); writeErr != nil {
+				return writeErr
+			}
+			if flushErr := rc.Flush(); flushErr != nil && !errors.Is(flushErr, http.ErrNotSupported) {
+				return flushErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copyTrailers sends the backend's trailers (e.g. grpc-status) after the body
+func copyTrailers(w http.ResponseWriter, trailer http.Header) {
+	for key, values := range trailer {
+		for _, value := range values {
+			w.Header().Add(http.TrailerPrefix+key, value)
+		}
+	}
+}
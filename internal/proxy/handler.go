@@ -4,13 +4,29 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"k8s-node-proxy/internal/metrics"
+	"k8s-node-proxy/internal/proxyproto"
 )
 
+// expectContinueTimeout bounds how long an upstream request carrying
+// Expect: 100-continue waits for the backend before sending its body
+const expectContinueTimeout = 1 * time.Second
+
 type NodeDiscoveryInterface interface {
 	GetCurrentNodeIP(ctx context.Context) (string, error)
 }
@@ -18,47 +34,358 @@ type NodeDiscoveryInterface interface {
 type Handler struct {
 	nodeDiscovery NodeDiscoveryInterface
 	client        *http.Client
+	timeouts      TimeoutConfig
+
+	// h2cClient carries gRPC calls to http:// backends over cleartext HTTP/2
+	h2cClient *http.Client
+
+	// responseHeaderAllowlist restricts copied response headers when non-nil
+	responseHeaderAllowlist map[string]bool
+	// stripResponseHeaders are never copied to the client (STRIP_RESPONSE_HEADERS)
+	stripResponseHeaders map[string]bool
+
+	// preserveHost sends the client's Host to the backend instead of the node IP (PRESERVE_HOST)
+	preserveHost bool
+
+	// upstreamTLS lists the ports whose backends are reached over HTTPS
+	upstreamTLS upstreamTLS
+
+	// errorPage replaces backend error bodies for the configured statuses
+	errorPage errorPage
+
+	// resolveTarget returns the upstream host for a request arriving on port
+	resolveTarget func(ctx context.Context, port string) (string, error)
+
+	// serviceNames maps target ports to "namespace/name" for access logs and
+	// metrics; it is replaced whole so a reload can update it while serving.
+	// Like the other state below, it is shared with the handler's per-port copies.
+	serviceNames *atomic.Pointer[map[string]string]
+
+	// clusterIPs maps ports to their ClusterIP in TARGET_MODE=clusterip
+	clusterIPs *atomic.Pointer[map[string]string]
+
+	// canary sends requests carrying CANARY_HEADER to canary backends; nil when unset
+	canary *canaryRouting
+
+	// endpoints routes ClusterIP services to their pods (INCLUDE_CLUSTERIP); nil when unused
+	endpoints EndpointResolver
+
+	// nodePortMetrics labels request metrics by target NodePort (PROXY_METRICS_NODEPORT_LABELS)
+	nodePortMetrics bool
+
+	// inflight tracks requests per upstream host so failovers can drain the old node
+	inflight     *inflightTracker
+	drainTimeout time.Duration
+
+	// conns tracks backend connections so a drained node's are not reused
+	conns *connTracker
+
+	// maxRequestBytes caps request bodies (MAX_REQUEST_BYTES); 0 means no limit
+	maxRequestBytes int64
+
+	// rateLimit caps requests per client IP; nil when RATE_LIMIT_RPS is unset
+	rateLimit *rateLimiter
+
+	// trustedProxies may report the client's address in X-Forwarded-For (TRUSTED_PROXIES)
+	trustedProxies trustedProxies
+
+	// upstreamLimit caps requests in flight to the backends; nil when
+	// MAX_CONCURRENT_UPSTREAM is unset
+	upstreamLimit *upstreamLimiter
+
+	// compression gzips or deflates responses for clients that accept it; nil
+	// when ENABLE_COMPRESSION is off
+	compression *responseCompression
+
+	// connect allows TCP tunnels through HTTP CONNECT (ENABLE_CONNECT)
+	connect bool
+
+	// upstreamProxyProtocol is the PROXY protocol version sent to backends
+	// (PROXY_PROTOCOL_UPSTREAM); 0 sends none
+	upstreamProxyProtocol proxyproto.Version
+
+	// accessLog writes a structured record per proxied request (ACCESS_LOG)
+	accessLog bool
+
+	// debugBodies logs capped request and response bodies for chosen paths;
+	// nil unless DEBUG_BODY_PATHS is set
+	debugBodies *debugBodies
+
+	// tracer records a span per proxied request (no-op unless tracing is configured)
+	tracer trace.Tracer
+
+	// logger receives the handler's records; slog.Default() unless SetLogger is called
+	logger *slog.Logger
+}
+
+func NewHandler(nodeDiscovery NodeDiscoveryInterface, settings Settings) *Handler {
+	h := newHandler(settings)
+	h.nodeDiscovery = nodeDiscovery
+	h.resolveTarget = func(ctx context.Context, _ string) (string, error) {
+		return nodeDiscovery.GetCurrentNodeIP(ctx)
+	}
+	h.supportCanaryNodes()
+	return h
+}
+
+// NewClusterIPHandler creates a handler that forwards each port to the ClusterIP
+// registered for it instead of to a selected node (TARGET_MODE=clusterip)
+func NewClusterIPHandler(targets map[int]string, settings Settings) *Handler {
+	h := newHandler(settings)
+	h.SetClusterIPTargets(targets)
+	h.resolveTarget = func(_ context.Context, port string) (string, error) {
+		clusterIP, ok := (*h.clusterIPs.Load())[port]
+		if !ok {
+			return "", fmt.Errorf("no ClusterIP service registered for port %s", port)
+		}
+		return clusterIP, nil
+	}
+	h.supportCanaryNodes()
+	return h
 }
 
-func NewHandler(nodeDiscovery NodeDiscoveryInterface) *Handler {
+func newHandler(s Settings) *Handler {
+	// supportCanaryNodes may narrow the rule to what the discovery supports
+	var canary *canaryRouting
+	if s.canary != nil {
+		rule := *s.canary
+		canary = &rule
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	conns := &connTracker{}
+	// Connecting gets its own short deadline; the request timeout still covers the response
+	var dial proxyproto.DialFunc = (&net.Dialer{Timeout: s.timeouts.Dial, KeepAlive: 30 * time.Second}).DialContext
+	s.keepAlive.apply(transport)
+	if s.upstreamProxyProtocol != 0 {
+		// Each backend connection starts with a PROXY header naming one client,
+		// so it can't be reused for the requests of others
+		dial = proxyproto.WrapDial(s.upstreamProxyProtocol, dial)
+		transport.DisableKeepAlives = true
+	}
+	transport.DialContext = conns.wrapDial(dial)
+	// The transport stops reading a response whose headers pass the limit and
+	// fails the request, which the client sees as 502 Bad Gateway; the h2c
+	// transport is cloned from this one and shares the limit
+	transport.MaxResponseHeaderBytes = s.maxResponseHeaderBytes
+	// How long to wait for the backend's 100 Continue before sending the body anyway
+	transport.ExpectContinueTimeout = expectContinueTimeout
+	// HTTP and HTTPS backends share the transport; its connection pools are kept per scheme and host
+	if s.upstreamTLS.config != nil {
+		transport.TLSClientConfig = s.upstreamTLS.config
+	}
+
 	return &Handler{
-		nodeDiscovery: nodeDiscovery,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		// Per-request deadlines come from the resolved timeout on the request context
+		client:                  &http.Client{Transport: transport, CheckRedirect: passRedirect},
+		h2cClient:               &http.Client{Transport: newH2CTransport(transport), CheckRedirect: passRedirect},
+		timeouts:                s.timeouts,
+		responseHeaderAllowlist: s.responseHeaderAllowlist,
+		stripResponseHeaders:    s.stripResponseHeaders,
+		preserveHost:            s.preserveHost,
+		upstreamTLS:             s.upstreamTLS,
+		errorPage:               s.errorPage,
+		serviceNames:            new(atomic.Pointer[map[string]string]),
+		clusterIPs:              new(atomic.Pointer[map[string]string]),
+		nodePortMetrics:         s.nodePortMetrics,
+		inflight:                &inflightTracker{},
+		drainTimeout:            s.drainTimeout,
+		conns:                   conns,
+		maxRequestBytes:         s.maxRequestBytes,
+		rateLimit:               s.rateLimit.fresh(s.trustedProxies),
+		trustedProxies:          s.trustedProxies,
+		upstreamLimit:           s.upstreamLimit.fresh(),
+		compression:             s.compression,
+		connect:                 s.connect,
+		upstreamProxyProtocol:   s.upstreamProxyProtocol,
+		accessLog:               s.accessLog,
+		debugBodies:             s.debugBodies,
+		canary:                  canary,
+		tracer:                  newTracer(),
+		logger:                  slog.Default(),
 	}
 }
 
+// passRedirect hands backend redirects to the client instead of following them
+func passRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// SetServiceNames registers the service behind each target port so access logs and
+// metrics can name it. It may be called again while the handler serves requests.
+func (h *Handler) SetServiceNames(names map[int]string) {
+	h.serviceNames.Store(portKeys(names))
+}
+
+// Timeouts returns the upstream timeouts in effect
+func (h *Handler) Timeouts() TimeoutConfig {
+	return h.timeouts
+}
+
+// SetLogger sends the handler's access logs and errors to logger instead of
+// the default logger; call it before the handler serves requests
+func (h *Handler) SetLogger(logger *slog.Logger) {
+	h.logger = logger
+}
+
+// SetClusterIPTargets replaces the ClusterIP each port forwards to; only
+// handlers created by NewClusterIPHandler use them
+func (h *Handler) SetClusterIPTargets(targets map[int]string) {
+	h.clusterIPs.Store(portKeys(targets))
+}
+
+// portKeys re-keys a per-port map by the port string found in request hosts
+func portKeys(byPort map[int]string) *map[string]string {
+	keyed := make(map[string]string, len(byPort))
+	for port, value := range byPort {
+		keyed[strconv.Itoa(port)] = value
+	}
+	return &keyed
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		h.serveConnect(w, r)
+		return
+	}
 	if r.URL.Path == "/health" {
 		h.handleHealth(w, r)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	// The span covers node resolution and the upstream request, continuing the
+	// client's trace when it sent trace context headers
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := h.tracer.Start(ctx, "proxy "+r.Method, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	port := h.requestPort(r)
+	scheme := h.upstreamTLS.scheme(port)
+	var service string
+	var knownPort bool
+	if names := h.serviceNames.Load(); names != nil {
+		service, knownPort = (*names)[port]
+	}
+
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	entry := accessEntry{port: port, service: service, clientIP: h.trustedProxies.clientIP(r)}
+	defer func() {
+		metrics.ObserveRequest(r.Method, recorder.status, time.Since(start))
+		if h.nodePortMetrics {
+			// Only registered ports become label values, keeping cardinality bounded
+			if knownPort {
+				metrics.IncNodePortRequests(port, service)
+			} else {
+				metrics.IncNodePortRequests("other", "unknown")
+			}
+		}
+		if h.accessLog {
+			entry.status, entry.bytes, entry.duration = recorder.status, recorder.bytes, time.Since(start)
+			logAccess(h.logger, r, entry)
+		}
+	}()
+	defer func() {
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	}()
+	w = recorder
+	if !knownPort {
+		entry.service = "-"
+	}
+
+	if !h.rateLimit.allow(r) {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+
+	if !limitRequestBody(w, r, h.maxRequestBytes) {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Bodies are copied for the log as they stream through, up to the cap
+	debugBody := h.debugBodies.matches(r.URL.Path)
+	var responseCapture *bodyCapture
+	if debugBody {
+		requestCapture := h.debugBodies.captureRequest(r)
+		defer func() {
+			logDebugBodies(h.logger, r, recorder.status, requestCapture, responseCapture)
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeouts.Resolve(scheme, port))
 	defer cancel()
 
-	nodeIP, err := h.nodeDiscovery.GetCurrentNodeIP(ctx)
-	if err != nil {
-		log.Printf("Failed to discover node IP: %v", err)
-		http.Error(w, "Failed to discover target node", http.StatusServiceUnavailable)
+	// Queued requests wait at most until their own timeout
+	release, ok := h.upstreamLimit.acquire(ctx)
+	if !ok {
+		h.logger.Warn("Too many concurrent upstream requests", "limit", h.upstreamLimit.limit, "port", port)
+		http.Error(w, "Too many concurrent upstream requests", http.StatusServiceUnavailable)
 		return
 	}
+	defer release()
 
-	port := h.extractPort(r.Host)
-	targetURL := fmt.Sprintf("http://%s:%s%s", nodeIP, port, r.URL.Path)
-	if r.URL.RawQuery != "" {
-		targetURL += "?" + r.URL.RawQuery
+	nodeIP, upstreamPort, canary, err := h.resolveRequestUpstream(ctx, r, port)
+	if canary {
+		span.SetAttributes(attribute.Bool("proxy.canary", true))
 	}
+	if err != nil {
+		h.logger.Error("Failed to discover node IP", "error", err)
+		span.RecordError(err)
+		h.writeTargetUnavailable(w, err)
+		return
+	}
+
+	entry.nodeIP = nodeIP
+
+	// A failover lets this request finish on the old node unless it outlives the drain timeout
+	drainCtx, done := h.inflight.begin(nodeIP)
+	defer done()
+	stopDrain := context.AfterFunc(drainCtx, cancel)
+	defer stopDrain()
 
-	log.Printf("Proxying %s %s -> %s", r.Method, r.URL.String(), targetURL)
+	scheme = h.upstreamTLS.resolveScheme(ctx, port, net.JoinHostPort(nodeIP, upstreamPort), h.timeouts.Dial)
+	targetURL := upstreamURL(scheme, nodeIP, upstreamPort, r.URL)
 
+	span.SetAttributes(attribute.String("node.ip", nodeIP), attribute.String("url.full", targetURL))
+	if nodeName := h.currentNodeName(); nodeName != "" {
+		span.SetAttributes(attribute.String("node.name", nodeName))
+	}
+
+	if h.upstreamProxyProtocol != 0 {
+		// The PROXY header of the backend connection names this request's client
+		ctx = withClientAddrs(ctx, r)
+	}
 	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL, r.Body)
 	if err != nil {
-		log.Printf("Failed to create proxy request: %v", err)
+		h.logger.Error("Failed to create proxy request", "error", err)
 		http.Error(w, "Failed to create proxy request", http.StatusInternalServerError)
 		return
 	}
+	// Keep the client's framing instead of re-chunking the body
+	proxyReq.ContentLength = r.ContentLength
+	// Request trailers are filled in once the body has been read
+	proxyReq.Trailer = r.Trailer
+	if h.preserveHost {
+		// Still dials the node; only the Host header changes
+		proxyReq.Host = originalHost(r.Host)
+	}
+	if h.conns.isDraining(nodeIP) {
+		// The node was failed away from while this request was being routed
+		proxyReq.Close = true
+	}
+	// Released after the response body is closed, when the connection is idle again
+	traceCtx, releaseConn := h.conns.track(proxyReq.Context())
+	proxyReq = proxyReq.WithContext(traceCtx)
+	defer releaseConn()
+
+	// Expect: 100-continue is forwarded with the other headers. The transport holds
+	// the body until the backend answers 100 Continue, and our first read of r.Body
+	// is what makes net/http send 100 Continue to the client. If the backend
+	// answers with a final status instead, the client's body is never requested.
 
 	for key, values := range r.Header {
 		if !h.shouldSkipHeader(key) {
@@ -67,30 +394,115 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}
+	if acceptsTrailers(r) {
+		proxyReq.Header.Set("Te", "trailers")
+	}
+
+	// Replaces any incoming trace context with this span's so the backend's spans nest under it
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(proxyReq.Header))
+
+	client := h.client
+	grpc := isGRPC(r)
+	if grpc && scheme == "http" {
+		client = h.h2cClient
+	}
 
-	resp, err := h.client.Do(proxyReq)
+	resp, err := client.Do(proxyReq)
+	h.upstreamTLS.recordResult(port, err != nil && !isBodyTooLarge(err))
+	if isBodyTooLarge(err) {
+		h.logger.Warn("Request body exceeds MAX_REQUEST_BYTES", "limit", h.maxRequestBytes, "target", targetURL)
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
-		log.Printf("Failed to proxy request: %v", err)
+		h.logger.Error("Failed to proxy request", "target", targetURL, "error", err)
+		span.RecordError(err)
+		metrics.IncBackendErrors()
 		http.Error(w, "Failed to proxy request", http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
+	entry.upstreamStatus = resp.StatusCode
 
+	// Hop-by-hop headers describe the backend connection, not ours: a backend
+	// Connection: close must not close a keep-alive client and vice versa
 	for key, values := range resp.Header {
+		if h.shouldSkipHeader(key) || !h.allowResponseHeader(key) {
+			continue
+		}
 		for _, value := range values {
+			if key == "Location" || key == "Content-Location" {
+				value = rewriteTargetURL(value, nodeIP, upstreamPort, r)
+			}
 			w.Header().Add(key, value)
 		}
 	}
 
+	if r.Close {
+		// The client sent Connection: close (or is HTTP/1.0 without keep-alive);
+		// net/http closes the connection after this response
+		w.Header().Set("Connection", "close")
+	}
+
+	if h.errorPage.suppresses(resp.StatusCode) {
+		h.errorPage.write(w, resp.StatusCode)
+		return
+	}
+
+	var encoding string
+	if h.compression.compressible(r, resp) {
+		addVaryAcceptEncoding(w.Header())
+		if encoding = negotiateEncoding(r); encoding != "" {
+			prepareCompressedHeaders(w.Header(), encoding)
+		}
+	}
+
+	var body io.Reader = resp.Body
+	if debugBody {
+		body, responseCapture = h.debugBodies.teeBody(resp.Body)
+	}
+
 	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
+	stream := grpc || resp.ContentLength == -1
+	if encoding == "" {
+		copyResponseBody(w, body, stream)
+	} else {
+		cw := newCompressWriter(w, encoding)
+		copyResponseBody(cw, body, stream)
+		cw.Close()
+	}
+	copyTrailers(w, resp.Trailer)
+}
+
+// statusRecorder captures the status code and body size written to the client
+// for metrics and access logs
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer to flush streamed responses
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
 }
 
 func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	nodeIP, err := h.nodeDiscovery.GetCurrentNodeIP(ctx)
+	nodeIP, _, err := h.resolveUpstream(ctx, h.requestPort(r))
 	if err != nil {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		fmt.Fprintf(w, "UNHEALTHY: %v\n", err)
@@ -101,6 +513,31 @@ func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "OK: Forwarding to node %s\n", nodeIP)
 }
 
+// upstreamURL builds the backend URL for a request; IPv6 hosts are bracketed.
+// It runs on every request, so the URL is written into a single allocation.
+func upstreamURL(scheme, host, port string, u *url.URL) string {
+	ipv6 := strings.IndexByte(host, ':') >= 0
+	var b strings.Builder
+	b.Grow(len(scheme) + len("://[]:?") + len(host) + len(port) + len(u.Path) + len(u.RawQuery))
+	b.WriteString(scheme)
+	b.WriteString("://")
+	if ipv6 {
+		b.WriteByte('[')
+	}
+	b.WriteString(host)
+	if ipv6 {
+		b.WriteByte(']')
+	}
+	b.WriteByte(':')
+	b.WriteString(port)
+	b.WriteString(u.Path)
+	if u.RawQuery != "" {
+		b.WriteByte('?')
+		b.WriteString(u.RawQuery)
+	}
+	return b.String()
+}
+
 func (h *Handler) extractPort(host string) string {
 	if strings.Contains(host, ":") {
 		_, port, err := parseHostPort(host)
@@ -130,5 +567,5 @@ func parseHostPort(hostPort string) (host, port string, err error) {
 
 func (h *Handler) shouldSkipHeader(key string) bool {
 	key = strings.ToLower(key)
-	return key == "connection" || key == "upgrade" || key == "proxy-connection" || key == "proxy-authenticate" || key == "proxy-authorization" || key == "te" || key == "trailers" || key == "transfer-encoding"
+	return key == "connection" || key == "keep-alive" || key == "upgrade" || key == "proxy-connection" || key == "proxy-authenticate" || key == "proxy-authorization" || key == "te" || key == "trailers" || key == "transfer-encoding"
 }
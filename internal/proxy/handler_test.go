@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// The benchmarks cover the per-request work of building the upstream
+// request; compare allocs/op with go test -bench . -benchmem
+
+func BenchmarkRequestPort(b *testing.B) {
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(b))
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	req = req.WithContext(WithListenerPort(req.Context(), 30080))
+
+	b.ReportAllocs()
+	for b.Loop() {
+		handler.requestPort(req)
+	}
+}
+
+func BenchmarkUpstreamURL(b *testing.B) {
+	u, _ := url.Parse("/api/users?page=2")
+
+	b.ReportAllocs()
+	for b.Loop() {
+		upstreamURL("http", "10.0.1.1", "30080", u)
+	}
+}
+
+func BenchmarkServeHTTP(b *testing.B) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(b))
+	handler.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := WithListenerPort(context.Background(), port)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "http://app.example.com/api/users?page=2", nil)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// requiredResponseHeaders always pass the allowlist so clients can still
+// interpret the body
+var requiredResponseHeaders = []string{"Content-Type", "Content-Length", "Content-Encoding"}
+
+// responseHeaderAllowlistFromEnv reads PROXY_RESPONSE_HEADER_ALLOWLIST, a comma-separated
+// list of response headers to pass to the client. Returns nil when unset, meaning
+// all response headers are copied.
+func responseHeaderAllowlistFromEnv() map[string]bool {
+	value := os.Getenv("PROXY_RESPONSE_HEADER_ALLOWLIST")
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	allowlist := make(map[string]bool)
+	for _, key := range requiredResponseHeaders {
+		allowlist[key] = true
+	}
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			allowlist[http.CanonicalHeaderKey(key)] = true
+		}
+	}
+	return allowlist
+}
+
+// stripResponseHeadersFromEnv reads STRIP_RESPONSE_HEADERS, a comma-separated
+// list of response headers never passed to the client (e.g. Server). Returns nil
+// when unset.
+func stripResponseHeadersFromEnv() map[string]bool {
+	value := os.Getenv("STRIP_RESPONSE_HEADERS")
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	strip := make(map[string]bool)
+	for _, key := range strings.Split(value, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			strip[http.CanonicalHeaderKey(key)] = true
+		}
+	}
+	return strip
+}
+
+// allowResponseHeader reports whether a backend response header is passed to the client
+func (h *Handler) allowResponseHeader(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	if h.stripResponseHeaders[key] {
+		return false
+	}
+	if h.responseHeaderAllowlist == nil {
+		return true
+	}
+	return h.responseHeaderAllowlist[key]
+}
+
+// rewriteTargetURL points a Location or Content-Location value that names the
+// upstream target (targetIP, optionally with targetPort) back at the host the
+// client used, so redirects never send clients to a node IP. Other values,
+// including relative ones, are returned unchanged.
+func rewriteTargetURL(value, targetIP, targetPort string, r *http.Request) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || u.Hostname() != targetIP {
+		return value
+	}
+	if port := u.Port(); port != "" && port != targetPort {
+		return value
+	}
+
+	u.Host = r.Host
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
+
+// preserveHostFromEnv reads PRESERVE_HOST (default false): when set, the backend
+// sees the client's Host instead of the node IP
+func preserveHostFromEnv() (bool, error) {
+	value := os.Getenv("PRESERVE_HOST")
+	if value == "" {
+		return false, nil
+	}
+	preserve, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid PRESERVE_HOST value %q: must be true or false", value)
+	}
+	return preserve, nil
+}
+
+// originalHost returns the client's Host without the port, which only selected
+// the NodePort to forward to
+func originalHost(host string) string {
+	if hostname, _, err := parseHostPort(host); err == nil {
+		return hostname
+	}
+	return host
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestServeHTTP_PreserveHost(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	receivedHost := func(t *testing.T) string {
+		t.Helper()
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		// The port still selects the NodePort; the name is the virtual host
+		req.Host = "shop.example.com:" + backendURL.Port()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		return w.Body.String()
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		t.Setenv("PRESERVE_HOST", "true")
+		if host := receivedHost(t); host != "shop.example.com" {
+			t.Errorf("Expected the backend to see Host shop.example.com, got %q", host)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		if host := receivedHost(t); host != "127.0.0.1:"+backendURL.Port() {
+			t.Errorf("Expected the backend to see the node address, got %q", host)
+		}
+	})
+}
+
+func TestOriginalHost(t *testing.T) {
+	tests := map[string]string{
+		"shop.example.com:30080": "shop.example.com",
+		"shop.example.com":       "shop.example.com",
+		"[2001:db8::1]:30080":    "[2001:db8::1]",
+	}
+	for host, want := range tests {
+		if got := originalHost(host); got != want {
+			t.Errorf("originalHost(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestServeHTTP_StripResponseHeaders(t *testing.T) {
+	t.Setenv("STRIP_RESPONSE_HEADERS", "server, x-powered-by")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25.3")
+		w.Header().Set("X-Powered-By", "Express")
+		w.Header().Set("X-Request-Id", "abc123")
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	for _, key := range []string{"Server", "X-Powered-By"} {
+		if value := w.Header().Get(key); value != "" {
+			t.Errorf("Expected %s to be stripped, got %q", key, value)
+		}
+	}
+	if value := w.Header().Get("X-Request-Id"); value != "abc123" {
+		t.Errorf("Expected X-Request-Id to pass, got %q", value)
+	}
+}
+
+func TestServeHTTP_RewritesRedirectToNode(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Backends build absolute redirects from the Host they see: the node IP
+		w.Header().Set("Content-Location", "http://"+r.Host+"/login.html")
+		http.Redirect(w, r, "http://"+r.Host+"/login?next=%2F", http.StatusFound)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "proxy.example.com:" + backendURL.Port()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected 302, got %d", w.Code)
+	}
+	if want := "http://proxy.example.com:" + backendURL.Port() + "/login?next=%2F"; w.Header().Get("Location") != want {
+		t.Errorf("Expected Location %s, got %s", want, w.Header().Get("Location"))
+	}
+	if want := "http://proxy.example.com:" + backendURL.Port() + "/login.html"; w.Header().Get("Content-Location") != want {
+		t.Errorf("Expected Content-Location %s, got %s", want, w.Header().Get("Content-Location"))
+	}
+}
+
+func TestRewriteTargetURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "proxy.example.com:30080"
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"NodeIPAndPort", "http://10.0.1.1:30080/a?b=c", "http://proxy.example.com:30080/a?b=c"},
+		{"NodeIPWithoutPort", "http://10.0.1.1/a", "http://proxy.example.com:30080/a"},
+		{"IPv6Node", "http://[fd00::1]:30080/a", "http://[fd00::1]:30080/a"},
+		{"OtherPort", "http://10.0.1.1:9090/a", "http://10.0.1.1:9090/a"},
+		{"OtherHost", "https://accounts.example.com/login", "https://accounts.example.com/login"},
+		{"Relative", "/login", "/login"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriteTargetURL(tt.value, "10.0.1.1", "30080", req); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if got := rewriteTargetURL("http://[fd00::1]:30080/a", "fd00::1", "30080", req); got != "http://proxy.example.com:30080/a" {
+		t.Errorf("Expected the IPv6 node URL to be rewritten, got %s", got)
+	}
+}
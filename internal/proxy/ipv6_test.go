@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestUpstreamURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		scheme string
+		host   string
+		target string
+		want   string
+	}{
+		{"IPv4", "http", "10.0.1.1", "/api/users", "http://10.0.1.1:30080/api/users"},
+		{"IPv6", "http", "fd00::1", "/api/users", "http://[fd00::1]:30080/api/users"},
+		{"IPv6WithQuery", "https", "2001:db8::10", "/search?q=x&page=2", "https://[2001:db8::10]:30080/search?q=x&page=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := upstreamURL(tt.scheme, tt.host, "30080", u)
+			if got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+			if _, err := url.Parse(got); err != nil {
+				t.Errorf("Expected a well-formed URL, got %v", err)
+			}
+		})
+	}
+}
+
+func TestServeHTTP_IPv6Backend(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+
+	var receivedHost string
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHost = r.Host
+		w.Write([]byte("hello over IPv6"))
+	}))
+	backend.Listener.Close()
+	backend.Listener = listener
+	backend.Start()
+	defer backend.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	handler := NewHandler(namedNodeDiscovery{ip: "::1", name: "node-1"}, settingsFromEnv(t))
+
+	req := httptest.NewRequest(http.MethodGet, "http://proxy:"+port+"/hello", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if body, _ := io.ReadAll(w.Body); string(body) != "hello over IPv6" {
+		t.Errorf("Unexpected body %q", body)
+	}
+	if want := "[::1]:" + port; receivedHost != want {
+		t.Errorf("Expected backend Host %s, got %s", want, receivedHost)
+	}
+}
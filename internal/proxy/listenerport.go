@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// listenerPortKey carries the local port a request was accepted on
+type listenerPortKey struct{}
+
+// listenerPort is the value stored under listenerPortKey. The port is also
+// kept formatted, once per listener, so requests don't format it again.
+type listenerPort struct {
+	number int
+	key    string
+}
+
+// WithListenerPort records the port a listener serves on ctx. Listeners set it
+// as their base context so the handler routes by the port the client actually
+// connected to, even when a load balancer or ingress rewrote the Host header.
+func WithListenerPort(ctx context.Context, port int) context.Context {
+	return context.WithValue(ctx, listenerPortKey{}, listenerPort{number: port, key: strconv.Itoa(port)})
+}
+
+// ListenerPort returns the port recorded by WithListenerPort
+func ListenerPort(ctx context.Context) (int, bool) {
+	port, ok := ctx.Value(listenerPortKey{}).(listenerPort)
+	return port.number, ok
+}
+
+// requestPort is the port a request is routed by: the port of the listener that
+// accepted it, falling back to the port in the Host header
+func (h *Handler) requestPort(r *http.Request) string {
+	if port, ok := r.Context().Value(listenerPortKey{}).(listenerPort); ok {
+		return port.key
+	}
+	return h.extractPort(r.Host)
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestServeHTTP_RoutesByListenerPort(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("routed"))
+	}))
+	defer backend.Close()
+	port := backend.Listener.Addr().(*net.TCPAddr).Port
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	handler.SetServiceNames(map[int]string{port: "default/web"})
+
+	for _, host := range []string{"app.example.com", "app.example.com:443", "proxy:" + strconv.Itoa(port+1)} {
+		t.Run(host, func(t *testing.T) {
+			// The Host header lacks the NodePort; the listener knows it
+			req := httptest.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+			req = req.WithContext(WithListenerPort(req.Context(), port))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK || w.Body.String() != "routed" {
+				t.Errorf("Expected the request to reach the NodePort backend, got %d %q", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequestPort_FallsBackToHost(t *testing.T) {
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	req := httptest.NewRequest(http.MethodGet, "http://proxy:30080/", nil)
+	if got := handler.requestPort(req); got != "30080" {
+		t.Errorf("Expected the Host port without a listener port, got %s", got)
+	}
+}
@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"time"
+)
+
+// Service annotations that override the proxy settings for the service's ports
+const (
+	// AnnotationTimeout is the upstream timeout, e.g. "120s"
+	AnnotationTimeout = "nodeproxy.io/timeout"
+	// AnnotationUpstreamTLS is "true" to reach the backend over HTTPS, "false" for HTTP
+	AnnotationUpstreamTLS = "nodeproxy.io/upstream-tls"
+	// AnnotationRateLimitRPS is the requests per second allowed per client IP
+	AnnotationRateLimitRPS = "nodeproxy.io/rate-limit-rps"
+	// AnnotationRateLimitBurst is the burst allowed on top of the rate limit
+	AnnotationRateLimitBurst = "nodeproxy.io/rate-limit-burst"
+)
+
+// PortConfig overrides the handler's settings for the listener of one port,
+// read from the annotations of the service that owns it. Zero fields keep the
+// settings from the environment.
+type PortConfig struct {
+	// Timeout replaces the upstream timeout, including PROXY_PORT_TIMEOUTS
+	Timeout time.Duration
+	// UpstreamScheme is "https" or "http" to reach the backend with, instead
+	// of TLS_UPSTREAM_PORTS and TLS_UPSTREAM_AUTODETECT
+	UpstreamScheme string
+	// RateLimitRPS limits requests per client IP on this port only
+	RateLimitRPS float64
+	// RateLimitBurst defaults to RateLimitRPS rounded up
+	RateLimitBurst int
+}
+
+// PortConfigFromAnnotations reads a PortConfig from a service's annotations;
+// every annotation is optional
+func PortConfigFromAnnotations(annotations map[string]string) (PortConfig, error) {
+	var cfg PortConfig
+
+	if value, ok := annotations[AnnotationTimeout]; ok {
+		timeout, err := parseTimeout(AnnotationTimeout, value)
+		if err != nil {
+			return PortConfig{}, err
+		}
+		cfg.Timeout = timeout
+	}
+
+	if value, ok := annotations[AnnotationUpstreamTLS]; ok {
+		upstreamTLS, err := strconv.ParseBool(value)
+		if err != nil {
+			return PortConfig{}, fmt.Errorf("invalid %s value %q: %w", AnnotationUpstreamTLS, value, err)
+		}
+		cfg.UpstreamScheme = "http"
+		if upstreamTLS {
+			cfg.UpstreamScheme = "https"
+		}
+	}
+
+	if value, ok := annotations[AnnotationRateLimitRPS]; ok {
+		rps, err := strconv.ParseFloat(value, 64)
+		if err != nil || rps <= 0 {
+			return PortConfig{}, fmt.Errorf("invalid %s value %q: must be a positive number", AnnotationRateLimitRPS, value)
+		}
+		cfg.RateLimitRPS = rps
+	}
+
+	if value, ok := annotations[AnnotationRateLimitBurst]; ok {
+		if cfg.RateLimitRPS == 0 {
+			return PortConfig{}, errors.New(AnnotationRateLimitBurst + " requires " + AnnotationRateLimitRPS)
+		}
+		burst, err := strconv.Atoi(value)
+		if err != nil || burst < 1 {
+			return PortConfig{}, fmt.Errorf("invalid %s value %q: must be a positive integer", AnnotationRateLimitBurst, value)
+		}
+		cfg.RateLimitBurst = burst
+	}
+
+	return cfg, nil
+}
+
+// ForPort returns a handler for the listener of port that applies cfg on top
+// of h's settings, or h itself when cfg overrides nothing. The copy shares
+// h's clients, node discovery, service names and in-flight tracking, so
+// reloads and failover draining through h reach it too; create it after h is
+// fully set up, as later SetLogger and SetEndpointResolver calls don't.
+func (h *Handler) ForPort(port int, cfg PortConfig) *Handler {
+	if cfg == (PortConfig{}) {
+		return h
+	}
+	handler := *h
+	key := strconv.Itoa(port)
+
+	if cfg.Timeout > 0 {
+		handler.timeouts.Ports = maps.Clone(h.timeouts.Ports)
+		if handler.timeouts.Ports == nil {
+			handler.timeouts.Ports = map[string]time.Duration{}
+		}
+		handler.timeouts.Ports[key] = cfg.Timeout
+	}
+
+	if cfg.UpstreamScheme != "" {
+		// The scheme is known, so there is nothing left to detect
+		handler.upstreamTLS.ports = map[string]bool{key: cfg.UpstreamScheme == "https"}
+		handler.upstreamTLS.detector = nil
+	}
+
+	if cfg.RateLimitRPS > 0 {
+		burst := cfg.RateLimitBurst
+		if burst == 0 {
+			burst = defaultRateLimitBurst(cfg.RateLimitRPS)
+		}
+		limiter := newRateLimiter(cfg.RateLimitRPS, burst)
+		limiter.trusted = h.trustedProxies
+		handler.rateLimit = limiter
+	}
+
+	return &handler
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPortConfigFromAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        PortConfig
+		wantErr     bool
+	}{
+		{"None", nil, PortConfig{}, false},
+		{"Unrelated", map[string]string{"team": "payments"}, PortConfig{}, false},
+		{"Timeout", map[string]string{AnnotationTimeout: "2m"}, PortConfig{Timeout: 2 * time.Minute}, false},
+		{"UpstreamTLS", map[string]string{AnnotationUpstreamTLS: "true"}, PortConfig{UpstreamScheme: "https"}, false},
+		{"UpstreamPlain", map[string]string{AnnotationUpstreamTLS: "false"}, PortConfig{UpstreamScheme: "http"}, false},
+		{"RateLimit", map[string]string{AnnotationRateLimitRPS: "2.5"}, PortConfig{RateLimitRPS: 2.5}, false},
+		{"RateLimitBurst", map[string]string{AnnotationRateLimitRPS: "5", AnnotationRateLimitBurst: "10"}, PortConfig{RateLimitRPS: 5, RateLimitBurst: 10}, false},
+		{"InvalidTimeout", map[string]string{AnnotationTimeout: "soon"}, PortConfig{}, true},
+		{"NegativeTimeout", map[string]string{AnnotationTimeout: "-1s"}, PortConfig{}, true},
+		{"InvalidUpstreamTLS", map[string]string{AnnotationUpstreamTLS: "maybe"}, PortConfig{}, true},
+		{"InvalidRateLimit", map[string]string{AnnotationRateLimitRPS: "0"}, PortConfig{}, true},
+		{"BurstWithoutRateLimit", map[string]string{AnnotationRateLimitBurst: "10"}, PortConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PortConfigFromAnnotations(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestForPort_Timeouts tests that two ports configured with different
+// timeouts each time out by their own
+func TestForPort_Timeouts(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	})
+	shortBackend := httptest.NewServer(slow)
+	defer shortBackend.Close()
+	longBackend := httptest.NewServer(slow)
+	defer longBackend.Close()
+
+	base := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	send := func(backend *httptest.Server, timeout time.Duration) int {
+		backendURL, _ := url.Parse(backend.URL)
+		port, _ := strconv.Atoi(backendURL.Port())
+		handler := base.ForPort(port, PortConfig{Timeout: timeout})
+
+		req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := send(shortBackend, 50*time.Millisecond); code != http.StatusBadGateway {
+		t.Errorf("Expected the 50ms port to time out with 502, got %d", code)
+	}
+	if code := send(longBackend, 5*time.Second); code != http.StatusOK {
+		t.Errorf("Expected the 5s port to wait for the backend, got %d", code)
+	}
+	if got := base.Timeouts().Resolve("http", "30080"); got != defaultTimeout {
+		t.Errorf("Expected the shared handler to keep the %v timeout, got %v", defaultTimeout, got)
+	}
+}
+
+func TestForPort(t *testing.T) {
+	t.Setenv("TLS_UPSTREAM_PORTS", "30443")
+	base := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	t.Run("NoOverrides", func(t *testing.T) {
+		if handler := base.ForPort(30080, PortConfig{}); handler != base {
+			t.Error("Expected the shared handler for a port without overrides")
+		}
+	})
+
+	t.Run("UpstreamScheme", func(t *testing.T) {
+		if scheme := base.ForPort(30080, PortConfig{UpstreamScheme: "https"}).upstreamTLS.scheme("30080"); scheme != "https" {
+			t.Errorf("Expected https, got %s", scheme)
+		}
+		if scheme := base.ForPort(30443, PortConfig{UpstreamScheme: "http"}).upstreamTLS.scheme("30443"); scheme != "http" {
+			t.Errorf("Expected http to replace TLS_UPSTREAM_PORTS, got %s", scheme)
+		}
+		if scheme := base.upstreamTLS.scheme("30080"); scheme != "http" {
+			t.Errorf("Expected the shared handler to keep http, got %s", scheme)
+		}
+	})
+
+	t.Run("RateLimit", func(t *testing.T) {
+		handler := base.ForPort(30080, PortConfig{RateLimitRPS: 1, RateLimitBurst: 2})
+		req := httptest.NewRequest(http.MethodGet, "http://127.0.0.1:30080/", nil)
+		for i := 0; i < 2; i++ {
+			if !handler.rateLimit.allow(req) {
+				t.Fatalf("Request %d within the burst was limited", i+1)
+			}
+		}
+		if handler.rateLimit.allow(req) {
+			t.Error("Expected the request after the burst to be limited")
+		}
+		if base.rateLimit != nil {
+			t.Error("Expected the shared handler to stay unlimited")
+		}
+	})
+
+	t.Run("SharesServiceNames", func(t *testing.T) {
+		handler := base.ForPort(30080, PortConfig{Timeout: time.Minute})
+		base.SetServiceNames(map[int]string{30080: "default/api"})
+		if names := handler.serviceNames.Load(); names == nil || (*names)["30080"] != "default/api" {
+			t.Errorf("Expected service names set on the shared handler to reach the port's handler, got %v", names)
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+
+	"k8s-node-proxy/internal/proxyproto"
+)
+
+// upstreamProxyProtocolFromEnv reads PROXY_PROTOCOL_UPSTREAM, the PROXY
+// protocol version ("v1" or "v2") sent to backends at the start of every
+// connection; 0 when unset
+func upstreamProxyProtocolFromEnv() (proxyproto.Version, error) {
+	value := os.Getenv("PROXY_PROTOCOL_UPSTREAM")
+	if value == "" {
+		return 0, nil
+	}
+	return proxyproto.ParseVersion(value)
+}
+
+// clientConnKey carries the client connection a request arrived on
+type clientConnKey struct{}
+
+// WithClientConn records the client connection on ctx. Listeners set it as
+// their ConnContext so the PROXY header sent to backends (PROXY_PROTOCOL_UPSTREAM)
+// names the client's addresses, including those from an incoming PROXY header.
+func WithClientConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, clientConnKey{}, conn)
+}
+
+// withClientAddrs records the addresses of r's client connection for the
+// PROXY header of the backend connection dialed for r
+func withClientAddrs(ctx context.Context, r *http.Request) context.Context {
+	if conn, ok := r.Context().Value(clientConnKey{}).(net.Conn); ok {
+		return proxyproto.WithAddrs(ctx, conn.RemoteAddr(), conn.LocalAddr())
+	}
+	// Without the connection, fall back to what the server tells the request
+	var src net.Addr
+	if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		src = net.TCPAddrFromAddrPort(addr)
+	}
+	dst, _ := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return proxyproto.WithAddrs(ctx, src, dst)
+}
@@ -0,0 +1,66 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+
+	"k8s-node-proxy/internal/proxyproto"
+)
+
+// TestServeHTTP_UpstreamProxyProtocol tests that backend connections start
+// with a PROXY header naming the client, one connection per request
+func TestServeHTTP_UpstreamProxyProtocol(t *testing.T) {
+	t.Setenv("PROXY_PROTOCOL_UPSTREAM", "v1")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	clients := make(chan string, 2)
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clients <- r.RemoteAddr
+	}))
+	backend.Listener.Close()
+	backend.Listener = proxyproto.NewListener(listener, 0, []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")})
+	backend.Start()
+	defer backend.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	// The server reports the address the client connected to
+	local := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 30080}
+	ctx := context.WithValue(context.Background(), http.LocalAddrContextKey, local)
+	for _, client := range []string{"198.51.100.4:50000", "198.51.100.5:50001"} {
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "http://proxy:"+strconv.Itoa(port)+"/", nil)
+		req.RemoteAddr = client
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", w.Code)
+		}
+		if got := <-clients; got != client {
+			t.Errorf("Expected the backend to see client %s, got %s", client, got)
+		}
+	}
+}
+
+func TestUpstreamProxyProtocolFromEnv(t *testing.T) {
+	t.Setenv("PROXY_PROTOCOL_UPSTREAM", "")
+	if version, err := upstreamProxyProtocolFromEnv(); err != nil || version != 0 {
+		t.Errorf("Expected no PROXY header by default, got %v, %v", version, err)
+	}
+	t.Setenv("PROXY_PROTOCOL_UPSTREAM", "v2")
+	if version, err := upstreamProxyProtocolFromEnv(); err != nil || version != proxyproto.V2 {
+		t.Errorf("Expected v2, got %v, %v", version, err)
+	}
+	t.Setenv("PROXY_PROTOCOL_UPSTREAM", "yes")
+	if _, err := upstreamProxyProtocolFromEnv(); err == nil {
+		t.Error("Expected an error for an unknown version")
+	}
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitIdleTTL is how long a client's limiter is kept after its last request
+const rateLimitIdleTTL = 3 * time.Minute
+
+// rateLimiter applies a token bucket per client IP
+type rateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	// trusted limits which peers' X-Forwarded-For is believed (TRUSTED_PROXIES)
+	trusted trustedProxies
+
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+	lastGC  time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiterFromEnv reads RATE_LIMIT_RPS (requests per second per client IP)
+// and RATE_LIMIT_BURST (default RATE_LIMIT_RPS rounded up). It returns nil,
+// disabling rate limiting, when RATE_LIMIT_RPS is unset.
+func rateLimiterFromEnv() (*rateLimiter, error) {
+	value := os.Getenv("RATE_LIMIT_RPS")
+	if value == "" {
+		return nil, nil
+	}
+	rps, err := strconv.ParseFloat(value, 64)
+	if err != nil || rps <= 0 {
+		return nil, fmt.Errorf("invalid RATE_LIMIT_RPS value %q: must be a positive number", value)
+	}
+
+	burst := defaultRateLimitBurst(rps)
+	if value := os.Getenv("RATE_LIMIT_BURST"); value != "" {
+		burst, err = strconv.Atoi(value)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_BURST value %q: must be a positive integer", value)
+		}
+	}
+
+	return newRateLimiter(rps, burst), nil
+}
+
+// newRateLimiter allows each client rps requests per second with bursts of burst
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:   rate.Limit(rps),
+		burst:   burst,
+		clients: map[string]*clientLimiter{},
+	}
+}
+
+// defaultRateLimitBurst is the burst used when none is configured: rps rounded up
+func defaultRateLimitBurst(rps float64) int {
+	burst := int(rps)
+	if float64(burst) < rps {
+		burst++
+	}
+	return burst
+}
+
+// allow reports whether the client behind r may send another request. A nil
+// rateLimiter allows everything.
+func (l *rateLimiter) allow(r *http.Request) bool {
+	if l == nil {
+		return true
+	}
+	ip := l.clientIP(r)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastGC) >= rateLimitIdleTTL {
+		for key, client := range l.clients {
+			if now.Sub(client.lastSeen) >= rateLimitIdleTTL {
+				delete(l.clients, key)
+			}
+		}
+		l.lastGC = now
+	}
+
+	client, ok := l.clients[ip]
+	if !ok {
+		client = &clientLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = client
+	}
+	client.lastSeen = now
+	return client.limiter.AllowN(now, 1)
+}
+
+// clientIP returns the IP requests are limited by: the client address
+// reported by a trusted proxy with TRUSTED_PROXIES, otherwise the peer address
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	return l.trusted.clientIP(r)
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestServeHTTP_RateLimit(t *testing.T) {
+	t.Setenv("RATE_LIMIT_RPS", "1")
+	t.Setenv("RATE_LIMIT_BURST", "3")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	send := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := send("192.0.2.1:40000"); code != http.StatusOK {
+			t.Fatalf("Request %d within the burst: expected 200, got %d", i+1, code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if code := send("192.0.2.1:40001"); code != http.StatusTooManyRequests {
+			t.Errorf("Request after the burst: expected 429, got %d", code)
+		}
+	}
+
+	if code := send("192.0.2.2:40000"); code != http.StatusOK {
+		t.Errorf("Expected another client to have its own bucket, got %d", code)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("DisabledWhenUnset", func(t *testing.T) {
+		limiter, err := rateLimiterFromEnv()
+		if err != nil || limiter != nil {
+			t.Fatalf("Expected no limiter, got %v, %v", limiter, err)
+		}
+		if !limiter.allow(httptest.NewRequest(http.MethodGet, "/", nil)) {
+			t.Error("Expected a nil limiter to allow every request")
+		}
+	})
+
+	t.Run("DefaultBurst", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_RPS", "2.5")
+		limiter, err := rateLimiterFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if limiter.burst != 3 {
+			t.Errorf("Expected burst 3, got %d", limiter.burst)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for key, value := range map[string]string{"RATE_LIMIT_RPS": "0", "RATE_LIMIT_BURST": "-1"} {
+			t.Run(key, func(t *testing.T) {
+				if key != "RATE_LIMIT_RPS" {
+					t.Setenv("RATE_LIMIT_RPS", "10")
+				}
+				t.Setenv(key, value)
+				if _, err := rateLimiterFromEnv(); err == nil {
+					t.Errorf("Expected error for %s=%q", key, value)
+				}
+			})
+		}
+	})
+
+	t.Run("ForwardedFor", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+
+		if ip := (&rateLimiter{}).clientIP(req); ip != "10.0.0.1" {
+			t.Errorf("Expected the peer address when X-Forwarded-For is untrusted, got %s", ip)
+		}
+		trusted := trustedProxies{netip.MustParsePrefix("10.0.0.0/8")}
+		if ip := (&rateLimiter{trusted: trusted}).clientIP(req); ip != "203.0.113.7" {
+			t.Errorf("Expected the client reported by the trusted proxy, got %s", ip)
+		}
+
+		// A spoofed left-most entry doesn't change the limited client
+		req.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7")
+		if ip := (&rateLimiter{trusted: trusted}).clientIP(req); ip != "203.0.113.7" {
+			t.Errorf("Expected the right-most untrusted X-Forwarded-For entry, got %s", ip)
+		}
+	})
+
+	t.Run("IdleClientsCollected", func(t *testing.T) {
+		limiter := &rateLimiter{limit: 1, burst: 1, clients: map[string]*clientLimiter{}}
+		limiter.clients["198.51.100.1"] = &clientLimiter{lastSeen: time.Now().Add(-2 * rateLimitIdleTTL)}
+
+		limiter.allow(httptest.NewRequest(http.MethodGet, "/", nil))
+		if _, ok := limiter.clients["198.51.100.1"]; ok {
+			t.Error("Expected the idle client's limiter to be removed")
+		}
+	})
+}
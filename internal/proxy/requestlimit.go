@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// maxRequestBytesFromEnv reads MAX_REQUEST_BYTES, the largest request body
+// passed to the backend. 0 (the default) means no limit.
+func maxRequestBytesFromEnv() (int64, error) {
+	value := os.Getenv("MAX_REQUEST_BYTES")
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid MAX_REQUEST_BYTES value %q: must be a non-negative integer", value)
+	}
+	return limit, nil
+}
+
+// maxResponseHeaderBytesFromEnv reads MAX_RESPONSE_HEADER_BYTES, the most
+// response header bytes read from a backend. 0 (the default) leaves Go's
+// transport limit of 10 MiB.
+func maxResponseHeaderBytesFromEnv() (int64, error) {
+	value := os.Getenv("MAX_RESPONSE_HEADER_BYTES")
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid MAX_RESPONSE_HEADER_BYTES value %q: must be a non-negative integer", value)
+	}
+	return limit, nil
+}
+
+// limitRequestBody caps r.Body at limit bytes without buffering it. It returns
+// false when the declared Content-Length already exceeds the limit; bodies of
+// unknown length fail with *http.MaxBytesError once they pass it.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if limit <= 0 {
+		return true
+	}
+	if r.ContentLength > limit {
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// isBodyTooLarge reports whether err came from exceeding the request body limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestServeHTTP_MaxRequestBytes(t *testing.T) {
+	t.Setenv("MAX_REQUEST_BYTES", "16")
+
+	var received string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = string(body)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+	send := func(body io.Reader, contentLength int64) int {
+		req := httptest.NewRequest(http.MethodPost, "http://"+backendURL.Host+"/upload", body)
+		req.ContentLength = contentLength
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		if code := send(strings.NewReader("small body"), 10); code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", code)
+		}
+		if received != "small body" {
+			t.Errorf("Expected the backend to receive the body, got %q", received)
+		}
+	})
+
+	t.Run("DeclaredLengthTooLarge", func(t *testing.T) {
+		if code := send(strings.NewReader(strings.Repeat("x", 64)), 64); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected 413, got %d", code)
+		}
+	})
+
+	t.Run("StreamedBodyTooLarge", func(t *testing.T) {
+		// Unknown length: the limit trips while the body streams to the backend
+		body := io.MultiReader(strings.NewReader(strings.Repeat("x", 64)))
+		if code := send(body, -1); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected 413, got %d", code)
+		}
+	})
+}
+
+func TestMaxRequestBytesFromEnv(t *testing.T) {
+	if limit, err := maxRequestBytesFromEnv(); err != nil || limit != 0 {
+		t.Errorf("Expected no limit when unset, got %d, %v", limit, err)
+	}
+
+	t.Setenv("MAX_REQUEST_BYTES", "1048576")
+	if limit, err := maxRequestBytesFromEnv(); err != nil || limit != 1048576 {
+		t.Errorf("Expected 1048576, got %d, %v", limit, err)
+	}
+
+	for _, value := range []string{"-1", "1MB"} {
+		t.Setenv("MAX_REQUEST_BYTES", value)
+		if _, err := maxRequestBytesFromEnv(); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+}
+
+func TestServeHTTP_MaxResponseHeaderBytes(t *testing.T) {
+	t.Setenv("MAX_RESPONSE_HEADER_BYTES", "4096")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oversized" {
+			w.Header().Set("X-Padding", strings.Repeat("a", 8192))
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	t.Run("WithinLimit", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil))
+		if w.Code != http.StatusOK || w.Body.String() != "ok" {
+			t.Errorf("Expected 200 ok, got %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("OverLimit", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/oversized", nil))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("Expected 502, got %d", w.Code)
+		}
+		if w.Header().Get("X-Padding") != "" {
+			t.Error("Expected the oversized header not to reach the client")
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+
+	"k8s-node-proxy/internal/proxyproto"
+)
+
+// Settings configure how handlers proxy requests. They are read once at startup
+// by SettingsFromEnv, so a handler never meets an invalid value.
+type Settings struct {
+	timeouts    TimeoutConfig
+	errorPage   errorPage
+	upstreamTLS upstreamTLS
+
+	nodePortMetrics bool
+	drainTimeout    time.Duration
+
+	maxRequestBytes        int64
+	maxResponseHeaderBytes int64
+
+	trustedProxies trustedProxies
+	rateLimit      *rateLimiter
+	upstreamLimit  *upstreamLimiter
+	keepAlive      upstreamKeepAlive
+
+	compression  *responseCompression
+	connect      bool
+	accessLog    bool
+	preserveHost bool
+	debugBodies  *debugBodies
+	canary       *canaryRouting
+
+	upstreamProxyProtocol proxyproto.Version
+
+	responseHeaderAllowlist map[string]bool
+	stripResponseHeaders    map[string]bool
+}
+
+// SettingsFromEnv reads the handler settings. The first invalid value is
+// returned as an error naming its variable.
+func SettingsFromEnv() (Settings, error) {
+	var s Settings
+	var err error
+	if s.timeouts, err = LoadTimeoutConfigFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.errorPage, err = errorPageFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.upstreamTLS, err = upstreamTLSFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if value := os.Getenv("PROXY_METRICS_NODEPORT_LABELS"); value != "" {
+		if s.nodePortMetrics, err = strconv.ParseBool(value); err != nil {
+			return Settings{}, fmt.Errorf("invalid PROXY_METRICS_NODEPORT_LABELS value %q: must be a boolean", value)
+		}
+	}
+	if s.drainTimeout, err = drainTimeoutFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.maxRequestBytes, err = maxRequestBytesFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.maxResponseHeaderBytes, err = maxResponseHeaderBytesFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.trustedProxies, err = trustedProxiesFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.rateLimit, err = rateLimiterFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.upstreamLimit, err = upstreamLimiterFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.keepAlive, err = upstreamKeepAliveFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.compression, err = compressionFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.connect, err = connectFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.accessLog, err = accessLogFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.preserveHost, err = preserveHostFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.debugBodies, err = debugBodiesFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.canary, err = canaryFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	if s.upstreamProxyProtocol, err = upstreamProxyProtocolFromEnv(); err != nil {
+		return Settings{}, err
+	}
+	s.responseHeaderAllowlist = responseHeaderAllowlistFromEnv()
+	s.stripResponseHeaders = stripResponseHeadersFromEnv()
+	return s, nil
+}
+
+// fresh returns an unused limiter with the limits of l, so handlers
+// built from the same settings don't share client state. A nil l stays nil.
+func (l *rateLimiter) fresh(trusted trustedProxies) *rateLimiter {
+	if l == nil {
+		return nil
+	}
+	limiter := newRateLimiter(float64(l.limit), l.burst)
+	limiter.trusted = trusted
+	return limiter
+}
+
+// fresh returns a limiter with the limit of l and all slots free. A nil l stays nil.
+func (l *upstreamLimiter) fresh() *upstreamLimiter {
+	if l == nil {
+		return nil
+	}
+	return &upstreamLimiter{slots: semaphore.NewWeighted(l.limit), limit: l.limit, queue: l.queue}
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import "testing"
+
+// settingsFromEnv reads the handler settings the test's environment configures
+func settingsFromEnv(t testing.TB) Settings {
+	t.Helper()
+	settings, err := SettingsFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to read the proxy settings: %v", err)
+	}
+	return settings
+}
+
+func TestSettingsFromEnv(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		settings := settingsFromEnv(t)
+		if settings.timeouts.Global != defaultTimeout {
+			t.Errorf("Expected the default proxy timeout, got %v", settings.timeouts.Global)
+		}
+		if settings.drainTimeout != defaultDrainTimeout {
+			t.Errorf("Expected the default drain timeout, got %v", settings.drainTimeout)
+		}
+		if !settings.accessLog {
+			t.Error("Expected access logging on by default")
+		}
+	})
+
+	// Invalid values are errors instead of silently turning a feature off
+	invalid := []struct {
+		key, value string
+	}{
+		{"PROXY_METRICS_NODEPORT_LABELS", "sometimes"},
+		{"PROXY_DRAIN_TIMEOUT", "soon"},
+		{"MAX_REQUEST_BYTES", "-1"},
+		{"TRUSTED_PROXIES", "10.0.0.0/33"},
+		{"RATE_LIMIT_RPS", "0"},
+		{"UPSTREAM_MAX_IDLE_CONNS_PER_HOST", "many"},
+		{"ACCESS_LOG", "loud"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := SettingsFromEnv(); err == nil {
+				t.Errorf("Expected an error for %s=%s", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestNewHandler_FreshLimiters(t *testing.T) {
+	t.Setenv("RATE_LIMIT_RPS", "1")
+	t.Setenv("MAX_CONCURRENT_UPSTREAM", "1")
+	settings := settingsFromEnv(t)
+
+	// Handlers built from the same settings keep their own client and slot state
+	a := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settings)
+	b := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settings)
+	if a.rateLimit == b.rateLimit || a.upstreamLimit == b.upstreamLimit {
+		t.Error("Expected each handler to get its own limiters")
+	}
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultTimeout is the global upstream timeout used when nothing more specific applies
+	defaultTimeout = 30 * time.Second
+
+	// defaultTLSHandshakeAllowance is added on top of the global timeout for HTTPS
+	// backends so the TLS handshake doesn't eat into the response budget
+	defaultTLSHandshakeAllowance = 10 * time.Second
+
+	// defaultDialTimeout bounds connecting to a backend, so a dead node fails fast
+	// instead of holding the request for the whole upstream timeout
+	defaultDialTimeout = 2 * time.Second
+)
+
+// TimeoutConfig resolves the upstream request timeout for a backend.
+// Precedence is per-port > per-scheme > global. Dial bounds only establishing
+// the connection, within the request timeout.
+type TimeoutConfig struct {
+	Global  time.Duration
+	Schemes map[string]time.Duration
+	Ports   map[string]time.Duration
+	Dial    time.Duration
+}
+
+// DefaultTimeoutConfig returns the built-in timeouts: 30s for HTTP backends and
+// 40s for HTTPS backends.
+func DefaultTimeoutConfig() TimeoutConfig {
+	return TimeoutConfig{
+		Global: defaultTimeout,
+		Schemes: map[string]time.Duration{
+			"https": defaultTimeout + defaultTLSHandshakeAllowance,
+		},
+		Ports: map[string]time.Duration{},
+		Dial:  defaultDialTimeout,
+	}
+}
+
+// Resolve returns the timeout for a backend reached via scheme on port
+func (c TimeoutConfig) Resolve(scheme, port string) time.Duration {
+	if timeout, ok := c.Ports[port]; ok {
+		return timeout
+	}
+	if timeout, ok := c.Schemes[strings.ToLower(scheme)]; ok {
+		return timeout
+	}
+	if c.Global > 0 {
+		return c.Global
+	}
+	return defaultTimeout
+}
+
+// LoadTimeoutConfigFromEnv builds a TimeoutConfig from environment variables:
+//   - PROXY_TIMEOUT: global timeout (default 30s)
+//   - PROXY_HTTP_TIMEOUT / PROXY_HTTPS_TIMEOUT: per-scheme timeouts
+//     (HTTPS defaults to the global timeout plus a 10s handshake allowance)
+//   - PROXY_PORT_TIMEOUTS: per-port overrides, e.g. "30001=60s,30002=5s"
+//   - BACKEND_DIAL_TIMEOUT: connecting to the backend (default 2s)
+func LoadTimeoutConfigFromEnv() (TimeoutConfig, error) {
+	cfg := TimeoutConfig{
+		Global:  defaultTimeout,
+		Schemes: map[string]time.Duration{},
+		Ports:   map[string]time.Duration{},
+		Dial:    defaultDialTimeout,
+	}
+
+	if value := os.Getenv("BACKEND_DIAL_TIMEOUT"); value != "" {
+		timeout, err := parseTimeout("BACKEND_DIAL_TIMEOUT", value)
+		if err != nil {
+			return TimeoutConfig{}, err
+		}
+		cfg.Dial = timeout
+	}
+
+	if value := os.Getenv("PROXY_TIMEOUT"); value != "" {
+		timeout, err := parseTimeout("PROXY_TIMEOUT", value)
+		if err != nil {
+			return TimeoutConfig{}, err
+		}
+		cfg.Global = timeout
+	}
+
+	cfg.Schemes["https"] = cfg.Global + defaultTLSHandshakeAllowance
+
+	for scheme, key := range map[string]string{"http": "PROXY_HTTP_TIMEOUT", "https": "PROXY_HTTPS_TIMEOUT"} {
+		if value := os.Getenv(key); value != "" {
+			timeout, err := parseTimeout(key, value)
+			if err != nil {
+				return TimeoutConfig{}, err
+			}
+			cfg.Schemes[scheme] = timeout
+		}
+	}
+
+	if value := os.Getenv("PROXY_PORT_TIMEOUTS"); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			port, rawTimeout, found := strings.Cut(entry, "=")
+			if !found {
+				return TimeoutConfig{}, fmt.Errorf("invalid PROXY_PORT_TIMEOUTS entry %q: expected port=duration", entry)
+			}
+			port = strings.TrimSpace(port)
+			if _, err := strconv.Atoi(port); err != nil {
+				return TimeoutConfig{}, fmt.Errorf("invalid PROXY_PORT_TIMEOUTS port %q: %w", port, err)
+			}
+			timeout, err := parseTimeout("PROXY_PORT_TIMEOUTS", strings.TrimSpace(rawTimeout))
+			if err != nil {
+				return TimeoutConfig{}, err
+			}
+			cfg.Ports[port] = timeout
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseTimeout(key, value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: %w", key, value, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s value %q: must be positive", key, value)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeoutConfig_ResolvePrecedence(t *testing.T) {
+	cfg := TimeoutConfig{
+		Global: 30 * time.Second,
+		Schemes: map[string]time.Duration{
+			"https": 45 * time.Second,
+		},
+		Ports: map[string]time.Duration{
+			"30001": 5 * time.Second,
+		},
+	}
+
+	tests := []struct {
+		name   string
+		scheme string
+		port   string
+		want   time.Duration
+	}{
+		{"per-port beats per-scheme", "https", "30001", 5 * time.Second},
+		{"per-port beats global", "http", "30001", 5 * time.Second},
+		{"per-scheme beats global", "https", "30002", 45 * time.Second},
+		{"scheme match is case-insensitive", "HTTPS", "30002", 45 * time.Second},
+		{"global when nothing else matches", "http", "30002", 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cfg.Resolve(tt.scheme, tt.port); got != tt.want {
+				t.Errorf("Resolve(%q, %q) = %v, want %v", tt.scheme, tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutConfig_ZeroValueFallsBackToDefault(t *testing.T) {
+	var cfg TimeoutConfig
+	if got := cfg.Resolve("http", "80"); got != defaultTimeout {
+		t.Errorf("Expected default timeout %v, got %v", defaultTimeout, got)
+	}
+}
+
+func TestDefaultTimeoutConfig_HTTPSLongerThanHTTP(t *testing.T) {
+	cfg := DefaultTimeoutConfig()
+
+	httpTimeout := cfg.Resolve("http", "30001")
+	httpsTimeout := cfg.Resolve("https", "30001")
+
+	if httpTimeout != 30*time.Second {
+		t.Errorf("Expected HTTP default of 30s, got %v", httpTimeout)
+	}
+	if httpsTimeout <= httpTimeout {
+		t.Errorf("Expected HTTPS default (%v) to exceed HTTP default (%v)", httpsTimeout, httpTimeout)
+	}
+}
+
+func TestLoadTimeoutConfigFromEnv(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		t.Setenv("PROXY_TIMEOUT", "")
+		t.Setenv("PROXY_HTTP_TIMEOUT", "")
+		t.Setenv("PROXY_HTTPS_TIMEOUT", "")
+		t.Setenv("PROXY_PORT_TIMEOUTS", "")
+
+		cfg, err := LoadTimeoutConfigFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := cfg.Resolve("http", "30001"); got != 30*time.Second {
+			t.Errorf("Expected 30s for HTTP, got %v", got)
+		}
+		if got := cfg.Resolve("https", "30001"); got != 40*time.Second {
+			t.Errorf("Expected 40s for HTTPS, got %v", got)
+		}
+		if cfg.Dial != 2*time.Second {
+			t.Errorf("Expected a 2s dial timeout, got %v", cfg.Dial)
+		}
+	})
+
+	t.Run("DialTimeout", func(t *testing.T) {
+		t.Setenv("BACKEND_DIAL_TIMEOUT", "500ms")
+
+		cfg, err := LoadTimeoutConfigFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cfg.Dial != 500*time.Millisecond {
+			t.Errorf("Expected a 500ms dial timeout, got %v", cfg.Dial)
+		}
+		if got := cfg.Resolve("http", "30001"); got != 30*time.Second {
+			t.Errorf("Expected the request timeout to stay 30s, got %v", got)
+		}
+	})
+
+	t.Run("GlobalShiftsHTTPSDefault", func(t *testing.T) {
+		t.Setenv("PROXY_TIMEOUT", "10s")
+		t.Setenv("PROXY_HTTP_TIMEOUT", "")
+		t.Setenv("PROXY_HTTPS_TIMEOUT", "")
+		t.Setenv("PROXY_PORT_TIMEOUTS", "")
+
+		cfg, err := LoadTimeoutConfigFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := cfg.Resolve("http", "30001"); got != 10*time.Second {
+			t.Errorf("Expected 10s for HTTP, got %v", got)
+		}
+		if got := cfg.Resolve("https", "30001"); got != 20*time.Second {
+			t.Errorf("Expected 20s for HTTPS, got %v", got)
+		}
+	})
+
+	t.Run("AllLevels", func(t *testing.T) {
+		t.Setenv("PROXY_TIMEOUT", "15s")
+		t.Setenv("PROXY_HTTP_TIMEOUT", "20s")
+		t.Setenv("PROXY_HTTPS_TIMEOUT", "1m")
+		t.Setenv("PROXY_PORT_TIMEOUTS", "30001=2m, 30002=3s")
+
+		cfg, err := LoadTimeoutConfigFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		tests := []struct {
+			scheme string
+			port   string
+			want   time.Duration
+		}{
+			{"http", "30001", 2 * time.Minute},
+			{"https", "30002", 3 * time.Second},
+			{"http", "30003", 20 * time.Second},
+			{"https", "30003", time.Minute},
+			{"ftp", "30003", 15 * time.Second},
+		}
+		for _, tt := range tests {
+			if got := cfg.Resolve(tt.scheme, tt.port); got != tt.want {
+				t.Errorf("Resolve(%q, %q) = %v, want %v", tt.scheme, tt.port, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("InvalidValues", func(t *testing.T) {
+		invalid := []struct {
+			key   string
+			value string
+		}{
+			{"PROXY_TIMEOUT", "soon"},
+			{"PROXY_HTTPS_TIMEOUT", "-5s"},
+			{"PROXY_PORT_TIMEOUTS", "30001"},
+			{"PROXY_PORT_TIMEOUTS", "abc=5s"},
+			{"BACKEND_DIAL_TIMEOUT", "0s"},
+		}
+		for _, tt := range invalid {
+			t.Run(tt.key+"="+tt.value, func(t *testing.T) {
+				t.Setenv("PROXY_TIMEOUT", "")
+				t.Setenv("PROXY_HTTP_TIMEOUT", "")
+				t.Setenv("PROXY_HTTPS_TIMEOUT", "")
+				t.Setenv("PROXY_PORT_TIMEOUTS", "")
+				t.Setenv("BACKEND_DIAL_TIMEOUT", "")
+				t.Setenv(tt.key, tt.value)
+
+				if _, err := LoadTimeoutConfigFromEnv(); err == nil {
+					t.Errorf("Expected error for %s=%s", tt.key, tt.value)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the proxy's spans; the global tracer provider is a
+// no-op unless tracing was configured at startup
+const tracerName = "k8s-node-proxy/internal/proxy"
+
+// nodeNameProvider is implemented by node discoveries that can name the selected node
+type nodeNameProvider interface {
+	GetCurrentNodeName() string
+}
+
+func newTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+// currentNodeName names the node a request was sent to, or "" when the
+// handler does not target a selected node
+func (h *Handler) currentNodeName() string {
+	if named, ok := h.nodeDiscovery.(nodeNameProvider); ok {
+		return named.GetCurrentNodeName()
+	}
+	return ""
+}
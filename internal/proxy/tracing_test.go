@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type namedNodeDiscovery struct {
+	ip, name string
+}
+
+func (d namedNodeDiscovery) GetCurrentNodeIP(context.Context) (string, error) { return d.ip, nil }
+func (d namedNodeDiscovery) GetCurrentNodeName() string                       { return d.name }
+
+// useInMemoryTracing installs a tracer provider recording into the returned exporter
+func useInMemoryTracing(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return exporter
+}
+
+func TestServeHTTP_RecordsSpanPerRequest(t *testing.T) {
+	exporter := useInMemoryTracing(t)
+
+	var backendTraceparent string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendTraceparent = r.Header.Get("Traceparent")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	const incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/api", nil)
+		req.Header.Set("Traceparent", "00-"+incomingTraceID+"-00f067aa0ba902b7-01")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected one span per request, got %d", len(spans))
+	}
+
+	attrs := map[string]string{}
+	for _, kv := range spans[0].Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["node.name"] != "node-1" {
+		t.Errorf("Expected node.name attribute node-1, got %q", attrs["node.name"])
+	}
+	if attrs["url.full"] != "http://"+backendURL.Host+"/api" {
+		t.Errorf("Unexpected url.full attribute %q", attrs["url.full"])
+	}
+	if attrs["http.response.status_code"] != "418" {
+		t.Errorf("Expected status code attribute 418, got %q", attrs["http.response.status_code"])
+	}
+
+	if got := spans[0].SpanContext.TraceID().String(); got != incomingTraceID {
+		t.Errorf("Expected span to continue incoming trace %s, got %s", incomingTraceID, got)
+	}
+	if !strings.Contains(backendTraceparent, incomingTraceID) || !strings.Contains(backendTraceparent, spans[1].SpanContext.SpanID().String()) {
+		t.Errorf("Expected backend traceparent to carry the proxy span, got %q", backendTraceparent)
+	}
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// defaultRetryAfter is suggested to clients when the node discovery does not
+// report its health-check interval; it matches the default HEALTH_CHECK_INTERVAL
+const defaultRetryAfter = 15 * time.Second
+
+// healthCheckIntervalProvider is implemented by node discoveries that re-check
+// nodes periodically; a new node can be expected within one interval
+type healthCheckIntervalProvider interface {
+	HealthCheckInterval() time.Duration
+}
+
+// unavailableResponse is the JSON body sent when no target could be resolved
+type unavailableResponse struct {
+	Error             string `json:"error"`
+	Message           string `json:"message"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+}
+
+// writeTargetUnavailable answers 503 for a request whose target could not be
+// resolved, telling the client why and when to retry
+func (h *Handler) writeTargetUnavailable(w http.ResponseWriter, err error) {
+	body := unavailableResponse{
+		Error:             "target_unavailable",
+		Message:           "Failed to discover target node",
+		RetryAfterSeconds: h.retryAfterSeconds(),
+	}
+	switch {
+	case errors.Is(err, nodes.ErrNoNodes):
+		body.Error = nodes.ReasonNoNodes
+		body.Message = "The cluster has no nodes to forward to"
+	case errors.Is(err, nodes.ErrNoHealthyNodes):
+		body.Error = nodes.ReasonNoHealthyNodes
+		body.Message = "Nodes exist but none of them is healthy"
+	case errors.Is(err, nodes.ErrTooFewHealthyNodes):
+		body.Error = nodes.ReasonTooFewHealthyNodes
+		body.Message = "Fewer nodes are healthy than MIN_HEALTHY_NODES requires"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(body.RetryAfterSeconds))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(body)
+}
+
+// retryAfterSeconds is the node discovery's health-check interval in whole
+// seconds, rounded up and at least 1
+func (h *Handler) retryAfterSeconds() int {
+	interval := defaultRetryAfter
+	if provider, ok := h.nodeDiscovery.(healthCheckIntervalProvider); ok && provider.HealthCheckInterval() > 0 {
+		interval = provider.HealthCheckInterval()
+	}
+	return max(1, int(math.Ceil(interval.Seconds())))
+}
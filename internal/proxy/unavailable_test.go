@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// failingNodeDiscovery fails every lookup with err
+type failingNodeDiscovery struct {
+	err      error
+	interval time.Duration
+}
+
+func (d failingNodeDiscovery) GetCurrentNodeIP(context.Context) (string, error) { return "", d.err }
+func (d failingNodeDiscovery) HealthCheckInterval() time.Duration               { return d.interval }
+
+func TestServeHTTP_TargetUnavailable(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		interval       time.Duration
+		wantError      string
+		wantRetryAfter string
+	}{
+		{"NoHealthyNodes", fmt.Errorf("failed to get nodes: %w", nodes.ErrNoHealthyNodes), 15 * time.Second, nodes.ReasonNoHealthyNodes, "15"},
+		{"NoNodes", nodes.ErrNoNodes, 10 * time.Second, nodes.ReasonNoNodes, "10"},
+		{"TooFewHealthyNodes", fmt.Errorf("%w: 1 of 2 required (MIN_HEALTHY_NODES)", nodes.ErrTooFewHealthyNodes), 10 * time.Second, nodes.ReasonTooFewHealthyNodes, "10"},
+		{"SubSecondInterval", nodes.ErrNoHealthyNodes, 1500 * time.Millisecond, nodes.ReasonNoHealthyNodes, "2"},
+		{"OtherError", errors.New("connection refused"), 0, "target_unavailable", "15"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewHandler(failingNodeDiscovery{err: tt.err, interval: tt.interval}, settingsFromEnv(t))
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://proxy:30080/", nil))
+
+			if w.Code != http.StatusServiceUnavailable {
+				t.Fatalf("Expected 503, got %d", w.Code)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Expected Retry-After %s, got %q", tt.wantRetryAfter, got)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected application/json, got %q", ct)
+			}
+
+			var body unavailableResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to decode body %q: %v", w.Body.String(), err)
+			}
+			if body.Error != tt.wantError {
+				t.Errorf("Expected error %q, got %q", tt.wantError, body.Error)
+			}
+			if body.Message == "" {
+				t.Error("Expected a message describing the condition")
+			}
+			if fmt.Sprint(body.RetryAfterSeconds) != tt.wantRetryAfter {
+				t.Errorf("Expected retry_after_seconds %s, got %d", tt.wantRetryAfter, body.RetryAfterSeconds)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// schemeDetectionFailures is how many requests to a port may fail in a row
+// before its detected scheme is forgotten and the backend probed again
+const schemeDetectionFailures = 3
+
+// schemeDetector finds out whether the backend of a port outside
+// TLS_UPSTREAM_PORTS speaks TLS (TLS_UPSTREAM_AUTODETECT). The first request
+// to a port probes the backend with a TLS handshake; the answer is kept per
+// port until requests to it keep failing, e.g. because the service behind the
+// NodePort changed.
+type schemeDetector struct {
+	mu    sync.Mutex
+	ports map[string]*detectedScheme
+}
+
+type detectedScheme struct {
+	scheme string
+	// failures counts the requests that failed in a row since the last success
+	failures int
+}
+
+func newSchemeDetector() *schemeDetector {
+	return &schemeDetector{ports: map[string]*detectedScheme{}}
+}
+
+// cached returns the scheme detected for port, if any
+func (d *schemeDetector) cached(port string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	detected, ok := d.ports[port]
+	if !ok {
+		return "", false
+	}
+	return detected.scheme, true
+}
+
+// detect returns the scheme of the backend of port, probing address when the
+// port wasn't detected yet. A backend that can't be reached is assumed to
+// speak HTTP and probed again on the next request.
+func (d *schemeDetector) detect(ctx context.Context, port, address string, dialTimeout time.Duration) string {
+	if scheme, ok := d.cached(port); ok {
+		return scheme
+	}
+
+	scheme, err := probeScheme(ctx, address, dialTimeout)
+	if err != nil {
+		slog.Warn("Failed to detect backend protocol, trying HTTP", "address", address, "error", err)
+		return "http"
+	}
+
+	d.mu.Lock()
+	d.ports[port] = &detectedScheme{scheme: scheme}
+	d.mu.Unlock()
+	slog.Info("Detected backend protocol", "port", port, "scheme", scheme)
+	return scheme
+}
+
+// recordResult counts a failed request to port and forgets the detected
+// scheme after schemeDetectionFailures failures in a row; a successful
+// request resets the count
+func (d *schemeDetector) recordResult(port string, failed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	detected, ok := d.ports[port]
+	if !ok {
+		return
+	}
+	if !failed {
+		detected.failures = 0
+		return
+	}
+	detected.failures++
+	if detected.failures >= schemeDetectionFailures {
+		delete(d.ports, port)
+		slog.Warn("Requests keep failing, detecting the backend protocol again", "port", port, "scheme", detected.scheme)
+	}
+}
+
+// probeScheme attempts a TLS handshake with address. The certificate is not
+// verified here; that is left to the proxied requests. A handshake that
+// completes, or that the backend rejects with a TLS alert, means HTTPS. A
+// reply that is not TLS, a closed connection or no reply at all means HTTP.
+func probeScheme(ctx context.Context, address string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	client := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	err = client.HandshakeContext(ctx)
+	var alert tls.AlertError
+	if err == nil || errors.As(err, &alert) {
+		return "https", nil
+	}
+	return "http", nil
+}
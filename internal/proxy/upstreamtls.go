@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// upstreamTLS marks the target ports whose backends terminate TLS themselves
+// and how their certificates are verified
+type upstreamTLS struct {
+	ports  map[string]bool
+	config *tls.Config
+
+	// detector probes the other ports for TLS; nil unless TLS_UPSTREAM_AUTODETECT is on
+	detector *schemeDetector
+}
+
+// upstreamTLSFromEnv reads the upstream TLS configuration:
+//   - TLS_UPSTREAM_PORTS: comma-separated target ports proxied over HTTPS, e.g. "30443,31443"
+//   - TLS_UPSTREAM_CA_FILE: PEM bundle trusted for backend certificates instead of the system roots
+//   - TLS_UPSTREAM_SERVER_NAME: name checked against backend certificates; nodes are dialed by IP
+//   - TLS_UPSTREAM_INSECURE_SKIP_VERIFY: skip certificate verification for self-signed backends
+//   - TLS_UPSTREAM_AUTODETECT: probe the backends of the other ports for TLS
+func upstreamTLSFromEnv() (upstreamTLS, error) {
+	upstream := upstreamTLS{ports: map[string]bool{}, config: &tls.Config{MinVersion: tls.VersionTLS12}}
+
+	for _, entry := range strings.Split(os.Getenv("TLS_UPSTREAM_PORTS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if port, err := strconv.Atoi(entry); err != nil || port < 1 || port > 65535 {
+			return upstreamTLS{}, fmt.Errorf("invalid TLS_UPSTREAM_PORTS port %q", entry)
+		}
+		upstream.ports[entry] = true
+	}
+
+	if path := os.Getenv("TLS_UPSTREAM_CA_FILE"); path != "" {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return upstreamTLS{}, fmt.Errorf("failed to read TLS_UPSTREAM_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return upstreamTLS{}, fmt.Errorf("no certificates found in TLS_UPSTREAM_CA_FILE %s", path)
+		}
+		upstream.config.RootCAs = pool
+	}
+
+	upstream.config.ServerName = os.Getenv("TLS_UPSTREAM_SERVER_NAME")
+
+	if value := os.Getenv("TLS_UPSTREAM_INSECURE_SKIP_VERIFY"); value != "" {
+		skip, err := strconv.ParseBool(value)
+		if err != nil {
+			return upstreamTLS{}, fmt.Errorf("invalid TLS_UPSTREAM_INSECURE_SKIP_VERIFY value %q: %w", value, err)
+		}
+		upstream.config.InsecureSkipVerify = skip
+	}
+
+	if value := os.Getenv("TLS_UPSTREAM_AUTODETECT"); value != "" {
+		detect, err := strconv.ParseBool(value)
+		if err != nil {
+			return upstreamTLS{}, fmt.Errorf("invalid TLS_UPSTREAM_AUTODETECT value %q: %w", value, err)
+		}
+		if detect {
+			upstream.detector = newSchemeDetector()
+		}
+	}
+
+	return upstream, nil
+}
+
+// scheme returns the scheme used to reach the backend on port, as far as it
+// is known without probing the backend
+func (u upstreamTLS) scheme(port string) string {
+	if u.ports[port] {
+		return "https"
+	}
+	if u.detector != nil {
+		if scheme, ok := u.detector.cached(port); ok {
+			return scheme
+		}
+	}
+	return "http"
+}
+
+// resolveScheme returns the scheme used to reach the backend of port at
+// address, probing it first when the scheme is auto-detected
+func (u upstreamTLS) resolveScheme(ctx context.Context, port, address string, dialTimeout time.Duration) string {
+	if u.ports[port] || u.detector == nil {
+		return u.scheme(port)
+	}
+	return u.detector.detect(ctx, port, address, dialTimeout)
+}
+
+// recordResult tells auto-detection whether a request to port reached its
+// backend, so a wrong guess is corrected after repeated failures
+func (u upstreamTLS) recordResult(port string, failed bool) {
+	if u.detector != nil {
+		u.detector.recordResult(port, failed)
+	}
+}
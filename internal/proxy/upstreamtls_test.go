@@ -0,0 +1,170 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpstreamTLSFromEnv(t *testing.T) {
+	t.Run("Unset", func(t *testing.T) {
+		upstream, err := upstreamTLSFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if upstream.scheme("30443") != "http" {
+			t.Error("Expected HTTP when TLS_UPSTREAM_PORTS is unset")
+		}
+	})
+
+	t.Run("Ports", func(t *testing.T) {
+		t.Setenv("TLS_UPSTREAM_PORTS", "30443, 31443")
+		upstream, err := upstreamTLSFromEnv()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if upstream.scheme("30443") != "https" || upstream.scheme("31443") != "https" || upstream.scheme("30080") != "http" {
+			t.Errorf("Unexpected port set: %v", upstream.ports)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for key, value := range map[string]string{
+			"TLS_UPSTREAM_PORTS":                "https",
+			"TLS_UPSTREAM_CA_FILE":              "/nonexistent/ca.pem",
+			"TLS_UPSTREAM_INSECURE_SKIP_VERIFY": "maybe",
+			"TLS_UPSTREAM_AUTODETECT":           "sometimes",
+		} {
+			t.Run(key, func(t *testing.T) {
+				t.Setenv(key, value)
+				if _, err := upstreamTLSFromEnv(); err == nil {
+					t.Errorf("Expected error for %s=%q", key, value)
+				}
+			})
+		}
+	})
+}
+
+func TestServeHTTP_HTTPSBackend(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("Failed to write CA file: %v", err)
+	}
+
+	proxyOnce := func(t *testing.T) *httptest.ResponseRecorder {
+		t.Helper()
+		handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil))
+		return w
+	}
+
+	t.Run("TrustedCA", func(t *testing.T) {
+		t.Setenv("TLS_UPSTREAM_PORTS", backendURL.Port())
+		t.Setenv("TLS_UPSTREAM_CA_FILE", caFile)
+
+		w := proxyOnce(t)
+		if w.Code != http.StatusOK || w.Body.String() != "secure" {
+			t.Errorf("Expected 200 secure, got %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("InsecureSkipVerify", func(t *testing.T) {
+		t.Setenv("TLS_UPSTREAM_PORTS", backendURL.Port())
+		t.Setenv("TLS_UPSTREAM_INSECURE_SKIP_VERIFY", "true")
+
+		if w := proxyOnce(t); w.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d", w.Code)
+		}
+	})
+
+	t.Run("UntrustedCertificate", func(t *testing.T) {
+		t.Setenv("TLS_UPSTREAM_PORTS", backendURL.Port())
+
+		if w := proxyOnce(t); w.Code != http.StatusBadGateway {
+			t.Errorf("Expected 502 for an unverified backend certificate, got %d", w.Code)
+		}
+	})
+
+	t.Run("PortNotMarked", func(t *testing.T) {
+		if w := proxyOnce(t); w.Code == http.StatusOK {
+			t.Error("Expected plain HTTP to a TLS backend to fail")
+		}
+	})
+}
+
+func TestServeHTTP_UpstreamAutodetect(t *testing.T) {
+	t.Setenv("TLS_UPSTREAM_AUTODETECT", "true")
+	t.Setenv("TLS_UPSTREAM_INSECURE_SKIP_VERIFY", "true")
+
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer secure.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plain"))
+	}))
+	defer plain.Close()
+
+	handler := NewHandler(namedNodeDiscovery{ip: "127.0.0.1", name: "node-1"}, settingsFromEnv(t))
+
+	for _, tt := range []struct {
+		name       string
+		backend    *httptest.Server
+		wantBody   string
+		wantScheme string
+	}{
+		{name: "TLS", backend: secure, wantBody: "secure", wantScheme: "https"},
+		{name: "Plaintext", backend: plain, wantBody: "plain", wantScheme: "http"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			backendURL, _ := url.Parse(tt.backend.URL)
+			port := backendURL.Port()
+
+			if _, ok := handler.upstreamTLS.detector.cached(port); ok {
+				t.Fatal("Expected no detected scheme before the first request")
+			}
+			// The second request is served from the cached detection
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+"/", nil))
+				if w.Code != http.StatusOK || w.Body.String() != tt.wantBody {
+					t.Fatalf("Expected 200 %s, got %d %q", tt.wantBody, w.Code, w.Body.String())
+				}
+				if scheme, ok := handler.upstreamTLS.detector.cached(port); !ok || scheme != tt.wantScheme {
+					t.Errorf("Expected %s to be cached for port %s, got %q (cached %v)", tt.wantScheme, port, scheme, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemeDetector_ForgetsAfterRepeatedFailures(t *testing.T) {
+	d := newSchemeDetector()
+	d.ports["30443"] = &detectedScheme{scheme: "https"}
+
+	d.recordResult("30443", true)
+	d.recordResult("30443", true)
+	d.recordResult("30443", false)
+	d.recordResult("30443", true)
+	if _, ok := d.cached("30443"); !ok {
+		t.Fatal("Expected a success to reset the failure count")
+	}
+
+	d.recordResult("30443", true)
+	d.recordResult("30443", true)
+	if _, ok := d.cached("30443"); ok {
+		t.Errorf("Expected the scheme to be forgotten after %d failures in a row", schemeDetectionFailures)
+	}
+}
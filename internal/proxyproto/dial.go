@@ -0,0 +1,42 @@
+package proxyproto
+
+import (
+	"context"
+	"net"
+)
+
+// DialFunc matches net.Dialer.DialContext and http.Transport.DialContext
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// addrsKey carries the client connection's addresses to WrapDial
+type addrsKey struct{}
+
+type addrs struct {
+	src, dst net.Addr
+}
+
+// WithAddrs records on ctx the addresses of the client connection a backend
+// connection is dialed for: src is the client, dst the address it connected to
+func WithAddrs(ctx context.Context, src, dst net.Addr) context.Context {
+	return context.WithValue(ctx, addrsKey{}, addrs{src: src, dst: dst})
+}
+
+// WrapDial returns a dial function that starts every connection with a PROXY
+// header in version, naming the addresses WithAddrs recorded on the dial
+// context (or an unknown client when there are none). A header is only right
+// for the client it names, so connections dialed this way must not be reused
+// for other clients' requests.
+func WrapDial(version Version, dial DialFunc) DialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		client, _ := ctx.Value(addrsKey{}).(addrs)
+		if err := WriteHeader(conn, version, client.src, client.dst); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
@@ -0,0 +1,94 @@
+package proxyproto
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+)
+
+func TestWrapDial(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("198.51.100.4"), Port: 50000}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 30080}
+
+	tests := []struct {
+		name    string
+		version Version
+		ctx     context.Context
+		want    string
+	}{
+		{"V1", V1, WithAddrs(context.Background(), src, dst), "PROXY TCP4 198.51.100.4 10.0.0.1 50000 30080\r\n"},
+		{"V1Unknown", V1, context.Background(), "PROXY UNKNOWN\r\n"},
+		{"V1TCP6", V1, WithAddrs(context.Background(),
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::4"), Port: 50000},
+			&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 30080}),
+			"PROXY TCP6 2001:db8::4 2001:db8::1 50000 30080\r\n"},
+		{"V2", V2, WithAddrs(context.Background(), src, dst), string(formatV2(src, dst))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Failed to listen: %v", err)
+			}
+			defer backend.Close()
+			received := make(chan []byte, 1)
+			go func() {
+				conn, err := backend.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				buf := make([]byte, 256)
+				n, _ := conn.Read(buf)
+				received <- buf[:n]
+			}()
+
+			dial := WrapDial(tt.version, (&net.Dialer{}).DialContext)
+			conn, err := dial(tt.ctx, "tcp", backend.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			defer conn.Close()
+
+			if got := string(<-received); got != tt.want {
+				t.Errorf("Expected header %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestWriteHeader_RoundTrip tests that written headers read back as the addresses they carry
+func TestWriteHeader_RoundTrip(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("2001:db8::4"), Port: 50000}
+	dst := &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 30080}
+
+	for _, version := range []Version{V1, V2} {
+		pipeClient, pipeServer := net.Pipe()
+		go func() {
+			WriteHeader(pipeClient, version, src, dst)
+			pipeClient.Close()
+		}()
+
+		gotSrc, gotDst, err := readHeader(bufio.NewReader(pipeServer))
+		pipeServer.Close()
+		if err != nil {
+			t.Fatalf("v%d: failed to read the header back: %v", version, err)
+		}
+		if gotSrc.String() != src.String() || gotDst.String() != dst.String() {
+			t.Errorf("v%d: expected %s -> %s, got %v -> %v", version, src, dst, gotSrc, gotDst)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for value, want := range map[string]Version{"v1": V1, "V2": V2, "2": V2} {
+		if got, err := ParseVersion(value); err != nil || got != want {
+			t.Errorf("ParseVersion(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	if _, err := ParseVersion("v3"); err == nil {
+		t.Error("Expected an error for v3")
+	}
+}
@@ -0,0 +1,249 @@
+// Package proxyproto reads and writes PROXY protocol headers (v1 and v2), which
+// L4 load balancers put at the start of a TCP connection to pass on the
+// address of the client they accepted it from
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Version selects the header format written to backends
+type Version int
+
+const (
+	// V1 is the human-readable text header
+	V1 Version = 1
+	// V2 is the binary header
+	V2 Version = 2
+)
+
+// ParseVersion reads a version as configured, "v1" or "v2"
+func ParseVersion(value string) (Version, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "v1", "1":
+		return V1, nil
+	case "v2", "2":
+		return V2, nil
+	default:
+		return 0, fmt.Errorf("unknown PROXY protocol version %q: must be v1 or v2", value)
+	}
+}
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	// v1MaxLength is the longest v1 line, CRLF included
+	v1MaxLength = 107
+
+	v2HeaderLength = 16
+	v2Version      = 0x20
+	v2CommandLocal = 0x00
+	v2CommandProxy = 0x01
+	v2FamilyTCP4   = 0x11
+	v2FamilyTCP6   = 0x21
+)
+
+// ErrInvalidHeader is returned for a connection that starts like a PROXY
+// header but isn't a valid one
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// ErrMissingHeader is returned for a connection that doesn't start with a
+// PROXY header
+var ErrMissingHeader = errors.New("missing PROXY protocol header")
+
+// readHeader reads the PROXY header that must start r. It returns the source
+// and destination addresses the header carries, or nil addresses when the
+// header doesn't name the client (UNKNOWN in v1, LOCAL in v2, as sent by load
+// balancer health checks).
+func readHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case first[0] == v1Prefix[0] && hasPrefix(r, v1Prefix):
+		return readV1(r)
+	case first[0] == v2Signature[0] && hasPrefix(r, v2Signature):
+		return readV2(r)
+	default:
+		return nil, nil, ErrMissingHeader
+	}
+}
+
+// hasPrefix reports whether r's next bytes are prefix, without consuming them
+func hasPrefix(r *bufio.Reader, prefix []byte) bool {
+	next, _ := r.Peek(len(prefix))
+	return bytes.Equal(next, prefix)
+}
+
+// readV1 reads "PROXY TCP4|TCP6 <src> <dst> <srcport> <dstport>\r\n" or "PROXY UNKNOWN ...\r\n"
+func readV1(r *bufio.Reader) (src, dst net.Addr, err error) {
+	var line []byte
+	for len(line) < v1MaxLength {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("%w: v1 line longer than %d bytes", ErrInvalidHeader, v1MaxLength)
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+	}
+	src, err = v1Address(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err = v1Address(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func v1Address(family, ip, port string) (net.Addr, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || addr.Is4() != (family == "TCP4") {
+		return nil, fmt.Errorf("%w: bad %s address %q", ErrInvalidHeader, family, ip)
+	}
+	number, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad port %q", ErrInvalidHeader, port)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(number))), nil
+}
+
+// readV2 reads the binary header: signature, version and command, address
+// family, length and the addresses. TLVs after the addresses are skipped.
+func readV2(r *bufio.Reader) (src, dst net.Addr, err error) {
+	var header [v2HeaderLength]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, nil, err
+	}
+	if header[12]&0xF0 != v2Version {
+		return nil, nil, fmt.Errorf("%w: unsupported version %#x", ErrInvalidHeader, header[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch header[12] & 0x0F {
+	case v2CommandLocal:
+		// Health checks from the load balancer itself
+		return nil, nil, nil
+	case v2CommandProxy:
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown command %#x", ErrInvalidHeader, header[12]&0x0F)
+	}
+
+	var size int
+	switch header[13] {
+	case v2FamilyTCP4:
+		size = net.IPv4len
+	case v2FamilyTCP6:
+		size = net.IPv6len
+	default:
+		// UDP and Unix sockets don't name a TCP client
+		return nil, nil, nil
+	}
+	if len(payload) < 2*size+4 {
+		return nil, nil, fmt.Errorf("%w: %d address bytes is too short", ErrInvalidHeader, len(payload))
+	}
+	srcIP, _ := netip.AddrFromSlice(payload[:size])
+	dstIP, _ := netip.AddrFromSlice(payload[size : 2*size])
+	srcPort := binary.BigEndian.Uint16(payload[2*size:])
+	dstPort := binary.BigEndian.Uint16(payload[2*size+2:])
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(srcIP, srcPort)),
+		net.TCPAddrFromAddrPort(netip.AddrPortFrom(dstIP, dstPort)), nil
+}
+
+// WriteHeader writes a header in version for a connection from src to dst.
+// When either address isn't TCP, or their IP families differ, the header
+// says the client is unknown.
+func WriteHeader(w io.Writer, version Version, src, dst net.Addr) error {
+	var header []byte
+	if version == V2 {
+		header = formatV2(src, dst)
+	} else {
+		header = formatV1(src, dst)
+	}
+	_, err := w.Write(header)
+	return err
+}
+
+func formatV1(src, dst net.Addr) []byte {
+	srcAddr, dstAddr, ok := tcpAddrPorts(src, dst)
+	if !ok {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	family := "TCP4"
+	if srcAddr.Addr().Is6() {
+		family = "TCP6"
+	}
+	return fmt.Appendf(nil, "PROXY %s %s %s %d %d\r\n",
+		family, srcAddr.Addr(), dstAddr.Addr(), srcAddr.Port(), dstAddr.Port())
+}
+
+func formatV2(src, dst net.Addr) []byte {
+	header := append([]byte(nil), v2Signature...)
+	srcAddr, dstAddr, ok := tcpAddrPorts(src, dst)
+	if !ok {
+		return append(header, v2Version|v2CommandLocal, 0, 0, 0)
+	}
+
+	family := byte(v2FamilyTCP4)
+	if srcAddr.Addr().Is6() {
+		family = v2FamilyTCP6
+	}
+	size := srcAddr.Addr().BitLen() / 8
+	header = append(header, v2Version|v2CommandProxy, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(2*size+4))
+	header = append(header, srcAddr.Addr().AsSlice()...)
+	header = append(header, dstAddr.Addr().AsSlice()...)
+	header = binary.BigEndian.AppendUint16(header, srcAddr.Port())
+	header = binary.BigEndian.AppendUint16(header, dstAddr.Port())
+	return header
+}
+
+// tcpAddrPorts returns src and dst as addresses of the same IP family, with
+// IPv4-mapped IPv6 addresses unmapped
+func tcpAddrPorts(src, dst net.Addr) (netip.AddrPort, netip.AddrPort, bool) {
+	srcTCP, ok := src.(*net.TCPAddr)
+	if !ok || srcTCP == nil {
+		return netip.AddrPort{}, netip.AddrPort{}, false
+	}
+	dstTCP, ok := dst.(*net.TCPAddr)
+	if !ok || dstTCP == nil {
+		return netip.AddrPort{}, netip.AddrPort{}, false
+	}
+	srcAddr, dstAddr := srcTCP.AddrPort(), dstTCP.AddrPort()
+	srcAddr = netip.AddrPortFrom(srcAddr.Addr().Unmap(), srcAddr.Port())
+	dstAddr = netip.AddrPortFrom(dstAddr.Addr().Unmap(), dstAddr.Port())
+	if !srcAddr.Addr().IsValid() || srcAddr.Addr().Is4() != dstAddr.Addr().Is4() {
+		return netip.AddrPort{}, netip.AddrPort{}, false
+	}
+	return srcAddr, dstAddr, true
+}
@@ -0,0 +1,169 @@
+package proxyproto
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Listener accepts connections from the load balancers in front of it, each
+// starting with a PROXY header. Connections from any other peer are closed,
+// since they could name any client in their header. A connection's header is
+// read on its first Read or RemoteAddr call, in the connection's own
+// goroutine, so a slow client doesn't hold up Accept. Its RemoteAddr and
+// LocalAddr then report the addresses from the header. Reads fail on a
+// connection without a valid header.
+type Listener struct {
+	net.Listener
+
+	// headerTimeout bounds reading the header; 0 is no limit
+	headerTimeout time.Duration
+	// trusted are the address ranges of the load balancers
+	trusted []netip.Prefix
+}
+
+// NewListener wraps l to read PROXY headers from peers in trusted, giving each
+// headerTimeout to send its header
+func NewListener(l net.Listener, headerTimeout time.Duration, trusted []netip.Prefix) *Listener {
+	return &Listener{Listener: l, headerTimeout: headerTimeout, trusted: trusted}
+}
+
+// Accept waits for the next connection from a trusted peer
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if !l.trusts(c.RemoteAddr()) {
+			slog.Warn("Closed connection from a peer outside PROXY_PROTOCOL_TRUSTED_CIDRS", "peer", c.RemoteAddr().String())
+			c.Close()
+			continue
+		}
+		return &conn{Conn: c, reader: bufio.NewReader(c), headerTimeout: l.headerTimeout}, nil
+	}
+}
+
+// trusts reports whether addr belongs to a trusted load balancer
+func (l *Listener) trusts(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, ok := netip.AddrFromSlice(tcpAddr.IP)
+	if !ok {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range l.trusted {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedCIDRs parses comma-separated CIDRs or single addresses, e.g.
+// "10.0.0.0/8,192.168.1.5", naming trusted load balancers. It is the one parser
+// for PROXY_PROTOCOL_TRUSTED_CIDRS and TRUSTED_PROXIES, so both accept the same lists.
+func ParseTrustedCIDRs(value string) ([]netip.Prefix, error) {
+	var trusted []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(entry)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid entry %q: must be a CIDR or an IP address", entry)
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	return trusted, nil
+}
+
+// conn is a connection whose PROXY header, if any, has been or will be read
+type conn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once sync.Once
+	// src and dst come from the header; nil when it didn't name the client
+	src, dst net.Addr
+	// err fails reads when the header was missing, invalid or couldn't be read
+	err error
+
+	// readDeadline is the deadline last set by the user of the connection,
+	// restored once the header has been read
+	mu           sync.Mutex
+	readDeadline time.Time
+}
+
+func (c *conn) readHeader() {
+	if c.headerTimeout > 0 {
+		c.mu.Lock()
+		restore := c.readDeadline
+		c.mu.Unlock()
+		deadline := time.Now().Add(c.headerTimeout)
+		if !restore.IsZero() && restore.Before(deadline) {
+			deadline = restore
+		}
+		c.Conn.SetReadDeadline(deadline)
+		defer c.Conn.SetReadDeadline(restore)
+	}
+	c.src, c.dst, c.err = readHeader(c.reader)
+	if c.err != nil {
+		// Nothing is answered to a peer that didn't send a valid header
+		c.Conn.Close()
+	}
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+// RemoteAddr returns the client address from the header, or the peer's
+func (c *conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to from the header, or ours
+func (c *conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.dst != nil {
+		return c.dst
+	}
+	return c.Conn.LocalAddr()
+}
@@ -0,0 +1,182 @@
+package proxyproto
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+)
+
+// loopback trusts the test clients as load balancers
+var loopback = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+
+// acceptWith writes data to a connection accepted by a PROXY protocol
+// listener and returns the accepted connection
+func acceptWith(t *testing.T, data []byte, headerTimeout time.Duration) net.Conn {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	listener := NewListener(inner, headerTimeout, loopback)
+	t.Cleanup(func() { listener.Close() })
+
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	if _, err := client.Write(data); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Failed to accept: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestListener(t *testing.T) {
+	const request = "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+	v2 := func(family byte, addresses ...byte) []byte {
+		header := append([]byte(nil), v2Signature...)
+		header = append(header, v2Version|v2CommandProxy, family, 0, byte(len(addresses)))
+		return append(header, addresses...)
+	}
+
+	tests := []struct {
+		name       string
+		header     []byte
+		wantRemote string
+		wantLocal  string
+	}{
+		{"V1TCP4", []byte("PROXY TCP4 198.51.100.4 10.0.0.1 50000 30080\r\n"), "198.51.100.4:50000", "10.0.0.1:30080"},
+		{"V1TCP6", []byte("PROXY TCP6 2001:db8::4 2001:db8::1 50000 30080\r\n"), "[2001:db8::4]:50000", "[2001:db8::1]:30080"},
+		{"V2TCP4", v2(v2FamilyTCP4, 198, 51, 100, 4, 10, 0, 0, 1, 0xC3, 0x50, 0x75, 0x80), "198.51.100.4:50000", "10.0.0.1:30080"},
+		// A header that doesn't name the client, as in health checks, leaves the peer as the client
+		{"V1Unknown", []byte("PROXY UNKNOWN\r\n"), "", ""},
+		{"V2Local", append(append([]byte(nil), v2Signature...), v2Version|v2CommandLocal, 0, 0, 0), "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accepted := acceptWith(t, append(tt.header, request...), time.Second)
+
+			wantRemote, wantLocal := tt.wantRemote, tt.wantLocal
+			if wantRemote == "" {
+				wantRemote = accepted.(*conn).Conn.RemoteAddr().String()
+				wantLocal = accepted.(*conn).Conn.LocalAddr().String()
+			}
+			if got := accepted.RemoteAddr().String(); got != wantRemote {
+				t.Errorf("Expected remote address %s, got %s", wantRemote, got)
+			}
+			if got := accepted.LocalAddr().String(); got != wantLocal {
+				t.Errorf("Expected local address %s, got %s", wantLocal, got)
+			}
+
+			// The header is consumed; the request follows untouched
+			got := make([]byte, len(request))
+			if _, err := io.ReadFull(accepted, got); err != nil {
+				t.Fatalf("Failed to read the request: %v", err)
+			}
+			if string(got) != request {
+				t.Errorf("Expected the request after the header, got %q", got)
+			}
+		})
+	}
+}
+
+func TestListener_InvalidHeader(t *testing.T) {
+	t.Run("Missing", func(t *testing.T) {
+		// A client that reaches the listener directly is refused, not served as itself
+		conn := acceptWith(t, []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), time.Second)
+		if _, err := conn.Read(make([]byte, 16)); !errors.Is(err, ErrMissingHeader) {
+			t.Errorf("Expected ErrMissingHeader, got %v", err)
+		}
+	})
+
+	for _, header := range []string{
+		"PROXY TCP4 198.51.100.4 10.0.0.1 50000\r\n",
+		"PROXY TCP4 2001:db8::4 10.0.0.1 50000 30080\r\n",
+		"PROXY TCP4 198.51.100.4 10.0.0.1 50000 70000\r\n",
+	} {
+		t.Run(header, func(t *testing.T) {
+			conn := acceptWith(t, []byte(header+"GET / HTTP/1.1\r\n\r\n"), time.Second)
+			if _, err := conn.Read(make([]byte, 16)); !errors.Is(err, ErrInvalidHeader) {
+				t.Errorf("Expected ErrInvalidHeader, got %v", err)
+			}
+		})
+	}
+}
+
+func TestListener_HeaderTimeout(t *testing.T) {
+	// A header that never ends must not hold the connection forever
+	conn := acceptWith(t, []byte("PROXY TCP4 198.51.100.4"), 50*time.Millisecond)
+
+	_, err := conn.Read(make([]byte, 16))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
+
+func TestListener_UntrustedPeer(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	listener := NewListener(inner, time.Second, []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")})
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			accepted <- conn
+		}
+		close(accepted)
+	}()
+
+	// A peer outside the trusted ranges can't choose its address with a header
+	client, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer client.Close()
+	client.Write([]byte("PROXY TCP4 198.51.100.4 10.0.0.1 50000 30080\r\nGET / HTTP/1.1\r\n\r\n"))
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 16)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+
+	listener.Close()
+	if conn, ok := <-accepted; ok {
+		t.Errorf("Expected no connection to be accepted, got one from %s", conn.RemoteAddr())
+	}
+}
+
+func TestParseTrustedCIDRs(t *testing.T) {
+	trusted, err := ParseTrustedCIDRs("10.0.0.0/8, 192.168.1.5,2001:db8::/32")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.5/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if len(trusted) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, trusted)
+	}
+	for i := range want {
+		if trusted[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want[i], trusted[i])
+		}
+	}
+	if _, err := ParseTrustedCIDRs("10.0.0.0/8,lb.example.com"); err == nil {
+		t.Error("Expected an error for a hostname")
+	}
+}
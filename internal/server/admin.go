@@ -0,0 +1,156 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// AdminTokenHeader carries the shared secret that authorizes /admin requests
+const AdminTokenHeader = "X-Admin-Token"
+
+// RequireAdminToken serves next only to requests presenting token in the
+// X-Admin-Token header, as a bearer token, or as the HTTP basic auth password
+// (any username, so browsers can log in to the homepage). With no token
+// configured every request is refused, so admin endpoints are never reachable
+// without a secret.
+func RequireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeProbeResponse(w, http.StatusForbidden, map[string]string{"error": "admin endpoints are disabled; set ADMIN_TOKEN to enable them"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(presentedAdminToken(r)), []byte(token)) != 1 {
+			slog.Warn("Rejected admin request with a missing or invalid token", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Basic realm="k8s-node-proxy"`)
+			writeProbeResponse(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid admin token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// presentedAdminToken returns the token r carries, looking at X-Admin-Token,
+// then a bearer token, then the basic auth password
+func presentedAdminToken(r *http.Request) string {
+	if token := r.Header.Get(AdminTokenHeader); token != "" {
+		return token
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	return ""
+}
+
+// NodeFailoverTrigger forces traffic off the selected node
+type NodeFailoverTrigger interface {
+	NodeNameProvider
+	TriggerFailover() (string, error)
+}
+
+// FailoverAPI serves POST /admin/failover: moves traffic to the next healthy
+// node, e.g. before draining the current one
+type FailoverAPI struct {
+	Nodes NodeFailoverTrigger
+}
+
+func (a FailoverAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeProbeResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+
+	previous := a.Nodes.GetCurrentNodeName()
+	node, err := a.Nodes.TriggerFailover()
+	if err != nil {
+		writeProbeResponse(w, http.StatusConflict, map[string]string{"error": err.Error(), "node": previous})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]string{"previous_node": previous, "node": node})
+}
+
+// NodePinner pins traffic to a chosen node until the pin is cleared
+type NodePinner interface {
+	NodeNameProvider
+	SelectNode(name string) error
+	ClearSelectedNode()
+}
+
+// SelectAPI serves /admin/select: POST ?node=<name> pins traffic to a healthy
+// node, overriding automatic selection until it fails; DELETE clears the pin
+type SelectAPI struct {
+	Nodes NodePinner
+}
+
+func (a SelectAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	previous := a.Nodes.GetCurrentNodeName()
+	switch r.Method {
+	case http.MethodPost:
+		name := r.URL.Query().Get("node")
+		if name == "" {
+			writeProbeResponse(w, http.StatusBadRequest, map[string]string{"error": "missing node query parameter"})
+			return
+		}
+		if err := a.Nodes.SelectNode(name); err != nil {
+			status := http.StatusServiceUnavailable
+			switch {
+			case errors.Is(err, nodes.ErrUnknownNode):
+				status = http.StatusNotFound
+			case errors.Is(err, nodes.ErrNodeNotHealthy):
+				status = http.StatusConflict
+			}
+			writeProbeResponse(w, status, map[string]string{"error": err.Error(), "node": previous})
+			return
+		}
+	case http.MethodDelete:
+		a.Nodes.ClearSelectedNode()
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		writeProbeResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST or DELETE"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]any{
+		"previous_node": previous,
+		"node":          a.Nodes.GetCurrentNodeName(),
+		"pinned":        r.Method == http.MethodPost,
+	})
+}
+
+// DrainAPI serves POST /admin/drain: stops accepting connections on the proxy
+// ports and fails /readyz, so the pod leaves rotation before it is stopped
+type DrainAPI struct {
+	Ports       *PortManager
+	ServicePort int
+}
+
+func (a DrainAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeProbeResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+
+	drained := a.Ports.Drain(a.ServicePort)
+	if drained == nil {
+		drained = []int{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]any{"status": "draining", "drained_ports": drained})
+}
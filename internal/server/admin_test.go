@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+func readyNode(name, ip string, created time.Time) *corev1.Node {
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+		Status: corev1.NodeStatus{
+			Addresses:  []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: ip}},
+			Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}},
+		},
+	}
+}
+
+func TestFailoverAPI(t *testing.T) {
+	now := time.Now()
+	discovery, err := nodes.NewGenericNodeDiscovery(fake.NewClientset(
+		readyNode("node-1", "10.0.1.1", now.Add(-2*time.Hour)),
+		readyNode("node-2", "10.0.1.2", now.Add(-time.Hour)),
+	))
+	if err != nil {
+		t.Fatalf("Failed to create node discovery: %v", err)
+	}
+	defer discovery.StopHealthMonitoring()
+	if _, err := discovery.GetCurrentNodeIP(context.Background()); err != nil {
+		t.Fatalf("Failed to select a node: %v", err)
+	}
+
+	handler := RequireAdminToken("s3cret", FailoverAPI{Nodes: discovery})
+	send := func(method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/admin/failover", nil)
+		if token != "" {
+			req.Header.Set(AdminTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("RejectsMissingToken", func(t *testing.T) {
+		if w := send(http.MethodPost, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", w.Code)
+		}
+		if w := send(http.MethodPost, "wrong"); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for a wrong token, got %d", w.Code)
+		}
+		if discovery.GetCurrentNodeName() != "node-1" {
+			t.Errorf("Expected node-1 to stay selected, got %s", discovery.GetCurrentNodeName())
+		}
+	})
+
+	t.Run("RequiresPost", func(t *testing.T) {
+		if w := send(http.MethodGet, "s3cret"); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected 405, got %d", w.Code)
+		}
+	})
+
+	t.Run("SwitchesNode", func(t *testing.T) {
+		w := send(http.MethodPost, "s3cret")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body["previous_node"] != "node-1" || body["node"] != "node-2" {
+			t.Errorf("Expected failover from node-1 to node-2, got %v", body)
+		}
+		if discovery.GetCurrentNodeName() != "node-2" {
+			t.Errorf("Expected node-2 to be selected, got %s", discovery.GetCurrentNodeName())
+		}
+	})
+}
+
+func TestRequireAdminToken_Disabled(t *testing.T) {
+	called := false
+	handler := RequireAdminToken("", http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/failover", nil)
+	req.Header.Set(AdminTokenHeader, "")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without ADMIN_TOKEN, got %d", w.Code)
+	}
+	if called {
+		t.Error("Expected the admin handler not to run without ADMIN_TOKEN")
+	}
+}
+
+func TestSelectAPI(t *testing.T) {
+	now := time.Now()
+	notReady := readyNode("node-3", "10.0.1.3", now.Add(-3*time.Hour))
+	notReady.Status.Conditions[0].Status = corev1.ConditionFalse
+	discovery, err := nodes.NewGenericNodeDiscovery(fake.NewClientset(
+		readyNode("node-1", "10.0.1.1", now.Add(-2*time.Hour)),
+		readyNode("node-2", "10.0.1.2", now.Add(-time.Hour)),
+		notReady,
+	))
+	if err != nil {
+		t.Fatalf("Failed to create node discovery: %v", err)
+	}
+	defer discovery.StopHealthMonitoring()
+	if _, err := discovery.GetCurrentNodeIP(context.Background()); err != nil {
+		t.Fatalf("Failed to select a node: %v", err)
+	}
+
+	handler := RequireAdminToken("s3cret", SelectAPI{Nodes: discovery})
+	send := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set(AdminTokenHeader, "s3cret")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("PinsHealthyNode", func(t *testing.T) {
+		w := send(http.MethodPost, "/admin/select?node=node-2")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body["previous_node"] != "node-1" || body["node"] != "node-2" || body["pinned"] != true {
+			t.Errorf("Expected node-2 pinned after node-1, got %v", body)
+		}
+		if discovery.GetCurrentNodeName() != "node-2" || discovery.PinnedNode() != "node-2" {
+			t.Errorf("Expected node-2 selected and pinned, got %s (pinned %q)", discovery.GetCurrentNodeName(), discovery.PinnedNode())
+		}
+	})
+
+	t.Run("RejectsUnknownNode", func(t *testing.T) {
+		if w := send(http.MethodPost, "/admin/select?node=node-9"); w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d: %s", w.Code, w.Body.String())
+		}
+		if discovery.GetCurrentNodeName() != "node-2" {
+			t.Errorf("Expected node-2 to stay selected, got %s", discovery.GetCurrentNodeName())
+		}
+	})
+
+	t.Run("RejectsUnhealthyNode", func(t *testing.T) {
+		if w := send(http.MethodPost, "/admin/select?node=node-3"); w.Code != http.StatusConflict {
+			t.Errorf("Expected 409, got %d: %s", w.Code, w.Body.String())
+		}
+		if discovery.GetCurrentNodeName() != "node-2" {
+			t.Errorf("Expected node-2 to stay selected, got %s", discovery.GetCurrentNodeName())
+		}
+	})
+
+	t.Run("RequiresNode", func(t *testing.T) {
+		if w := send(http.MethodPost, "/admin/select"); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", w.Code)
+		}
+	})
+
+	t.Run("ClearsPin", func(t *testing.T) {
+		if w := send(http.MethodDelete, "/admin/select"); w.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		if discovery.PinnedNode() != "" {
+			t.Errorf("Expected no pinned node, got %q", discovery.PinnedNode())
+		}
+		if discovery.GetCurrentNodeName() != "node-2" {
+			t.Errorf("Expected node-2 to stay selected while healthy, got %s", discovery.GetCurrentNodeName())
+		}
+	})
+}
+
+func TestDrainAPI(t *testing.T) {
+	servicePort, proxyPort := 8105, 8106
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+
+	readiness := Readiness{Ports: pm, ServicePort: servicePort}
+	if err := pm.StartPort(servicePort, readiness); err != nil {
+		t.Fatalf("Failed to start service port: %v", err)
+	}
+	slowHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+		io.WriteString(w, "done")
+	})
+	if err := pm.StartPort(proxyPort, slowHandler); err != nil {
+		t.Fatalf("Failed to start proxy port: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if ready, reason := readiness.Check(); !ready {
+		t.Fatalf("Expected ready before draining, got %q", reason)
+	}
+
+	inFlight := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", proxyPort))
+		if err == nil {
+			var body []byte
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err == nil && string(body) != "done" {
+				err = fmt.Errorf("unexpected body %q", body)
+			}
+		}
+		inFlight <- err
+	}()
+	// Let the request reach the handler before draining
+	time.Sleep(100 * time.Millisecond)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/drain", nil)
+	req.Header.Set(AdminTokenHeader, "s3cret")
+	w := httptest.NewRecorder()
+	RequireAdminToken("s3cret", DrainAPI{Ports: pm, ServicePort: servicePort}).ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var body struct {
+		Status       string `json:"status"`
+		DrainedPorts []int  `json:"drained_ports"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Status != "draining" || len(body.DrainedPorts) != 1 || body.DrainedPorts[0] != proxyPort {
+		t.Errorf("Expected port %d drained, got %+v", proxyPort, body)
+	}
+
+	// New connections are refused while the in-flight request still completes
+	if conn, err := net.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", proxyPort), time.Second); err == nil {
+		conn.Close()
+		t.Error("Expected new connections to the drained port to be refused")
+	}
+	if err := <-inFlight; err != nil {
+		t.Errorf("Expected the in-flight request to complete, got %v", err)
+	}
+
+	// The service port keeps answering probes, now with 503
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/readyz", servicePort))
+	if err != nil {
+		t.Fatalf("Expected the service port to stay open: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz 503 while draining, got %d", resp.StatusCode)
+	}
+	if _, reason := readiness.Check(); reason != "draining" {
+		t.Errorf("Expected reason draining, got %q", reason)
+	}
+
+	// Reloads can't bring ports back
+	if err := pm.StartPort(8107, slowHandler); !errors.Is(err, ErrDraining) {
+		t.Errorf("Expected ErrDraining starting a port while draining, got %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import "net/http"
+
+// unauthenticatedPaths stay open so Kubernetes probes work without credentials;
+// they expose no cluster details
+var unauthenticatedPaths = map[string]bool{
+	"/livez":  true,
+	"/readyz": true,
+}
+
+// RequireManagementAuth puts the whole management interface behind the admin
+// token, checked by RequireAdminToken, except the probe paths. An empty token
+// leaves the interface open; the /admin endpoints still refuse every request then.
+func RequireManagementAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	protected := RequireAdminToken(token, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unauthenticatedPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireManagementAuth(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RequireManagementAuth("s3cret", ok)
+
+	tests := []struct {
+		name      string
+		path      string
+		authorize func(r *http.Request)
+		want      int
+	}{
+		{"NoCredentials", "/", func(*http.Request) {}, http.StatusUnauthorized},
+		{"AdminTokenHeader", "/status", func(r *http.Request) { r.Header.Set(AdminTokenHeader, "s3cret") }, http.StatusOK},
+		{"BearerToken", "/status", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, http.StatusOK},
+		{"WrongBearerToken", "/status", func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		{"BasicAuth", "/", func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") }, http.StatusOK},
+		{"WrongBasicAuth", "/metrics", func(r *http.Request) { r.SetBasicAuth("admin", "guess") }, http.StatusUnauthorized},
+		{"HealthNeedsCredentials", "/health", func(*http.Request) {}, http.StatusUnauthorized},
+		{"LivezIsOpen", "/livez", func(*http.Request) {}, http.StatusOK},
+		{"ReadyzIsOpen", "/readyz", func(*http.Request) {}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			tt.authorize(req)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, w.Code)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+
+	t.Run("DisabledWithoutToken", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		RequireManagementAuth("", ok).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 without ADMIN_TOKEN, got %d", w.Code)
+		}
+	})
+}
+
+// TestRequireAdminToken_BearerToken tests that admin endpoints accept the
+// token the rest of the management interface is logged in with
+func TestRequireAdminToken_BearerToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RequireAdminToken("s3cret", ok)
+
+	for token, want := range map[string]int{"s3cret": http.StatusOK, "guess": http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/failover", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("Expected status %d for bearer token %q, got %d", want, token, w.Code)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+// redactedSecret stands in for configured secrets in /admin/config
+const redactedSecret = "REDACTED"
+
+// RedactSecret hides a configured secret, keeping whether it is set visible
+func RedactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return redactedSecret
+}
+
+// Config is the effective configuration reported by /admin/config: what the
+// proxy resolved from its environment, after defaults were applied. Secrets
+// are redacted.
+type Config struct {
+	Platform             string              `json:"platform"`
+	Cluster              string              `json:"cluster,omitempty"`
+	Namespace            string              `json:"namespace"`
+	TargetMode           services.TargetMode `json:"target_mode"`
+	IncludeClusterIP     bool                `json:"include_clusterip"`
+	ServicePort          int                 `json:"service_port"`
+	ManagementPathPrefix string              `json:"management_path_prefix,omitempty"`
+	LiveUpdates          bool                `json:"homepage_live_updates"`
+	MaxListeners         int                 `json:"max_listeners"`
+	HostRoutingDomain    string              `json:"host_routing_domain,omitempty"`
+	HostRoutingPort      int                 `json:"host_routing_port,omitempty"`
+	EventWebhookURL      string              `json:"event_webhook_url,omitempty"`
+	KubeEvents           bool                `json:"emit_k8s_events"`
+	AdminToken           string              `json:"admin_token"`
+
+	// Filled in by ConfigAPI when served
+	ListeningPorts []int                    `json:"listening_ports"`
+	ProxyTimeouts  ProxyTimeouts            `json:"proxy_timeouts"`
+	ServerTimeouts map[string]string        `json:"server_timeouts"`
+	NodeSelection  *nodes.SelectionSettings `json:"node_selection,omitempty"`
+}
+
+// ProxyTimeouts are the upstream timeouts, formatted like PROXY_TIMEOUT
+type ProxyTimeouts struct {
+	Global  string            `json:"global"`
+	Dial    string            `json:"dial"`
+	Schemes map[string]string `json:"schemes"`
+	Ports   map[string]string `json:"ports"`
+}
+
+// ProxyTimeoutProvider reports the timeouts a proxy handler applies
+type ProxyTimeoutProvider interface {
+	Timeouts() proxy.TimeoutConfig
+}
+
+// SelectionSettingsProvider reports the node selection settings in effect
+type SelectionSettingsProvider interface {
+	SelectionSettings() nodes.SelectionSettings
+}
+
+// ConfigAPI serves GET /admin/config. Nodes is nil when node selection is not
+// used (TARGET_MODE=clusterip).
+type ConfigAPI struct {
+	Config Config
+	Ports  *PortManager
+	Proxy  ProxyTimeoutProvider
+	Nodes  SelectionSettingsProvider
+}
+
+func (a ConfigAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeProbeResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "use GET"})
+		return
+	}
+
+	cfg := a.Config
+	cfg.ListeningPorts = a.Ports.GetListeningPorts()
+	if cfg.ListeningPorts == nil {
+		cfg.ListeningPorts = []int{}
+	}
+	timeouts := a.Ports.timeouts
+	cfg.ServerTimeouts = map[string]string{
+		"read_header": timeouts.readHeader.String(),
+		"read":        timeouts.read.String(),
+		"write":       timeouts.write.String(),
+		"idle":        timeouts.idle.String(),
+		"shutdown":    timeouts.shutdown.String(),
+	}
+	if a.Proxy != nil {
+		cfg.ProxyTimeouts = proxyTimeouts(a.Proxy.Timeouts())
+	}
+	if a.Nodes != nil {
+		settings := a.Nodes.SelectionSettings()
+		cfg.NodeSelection = &settings
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(cfg)
+}
+
+// proxyTimeouts formats the upstream timeouts for display
+func proxyTimeouts(cfg proxy.TimeoutConfig) ProxyTimeouts {
+	return ProxyTimeouts{
+		Global:  cfg.Global.String(),
+		Dial:    cfg.Dial.String(),
+		Schemes: durationStrings(cfg.Schemes),
+		Ports:   durationStrings(cfg.Ports),
+	}
+}
+
+// durationStrings formats each duration in durations
+func durationStrings(durations map[string]time.Duration) map[string]string {
+	formatted := make(map[string]string, len(durations))
+	for key, d := range durations {
+		formatted[key] = d.String()
+	}
+	return formatted
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"k8s-node-proxy/internal/services"
+)
+
+// NodePortLister discovers the ports the proxy listens on
+type NodePortLister interface {
+	DiscoverNodePorts(ctx context.Context) ([]int, error)
+}
+
+// InitialNodeSelector selects the node traffic is forwarded to
+type InitialNodeSelector interface {
+	NodeNameProvider
+	GetCurrentNodeIP(ctx context.Context) (string, error)
+}
+
+// DryRunPlan is what the proxy would act on
+type DryRunPlan struct {
+	TargetMode  services.TargetMode
+	ServicePort int
+	// Ports are the proxy ports that would be opened, sorted, without the service port
+	Ports    []int
+	Services []services.ServiceInfo
+	// NodeName and NodeIP are the node traffic would go to; empty in clusterip mode
+	NodeName string
+	NodeIP   string
+}
+
+// PlanDryRun discovers the proxy ports and selects a node without opening any
+// listener or starting health monitoring, and logs the resulting plan. nodes is
+// nil when node selection is disabled (TARGET_MODE=clusterip). A failure to
+// discover ports or select a node is returned, so DRY_RUN also validates
+// credentials and RBAC.
+func PlanDryRun(ctx context.Context, ports NodePortLister, nodes InitialNodeSelector, serviceInfos []services.ServiceInfo, targetMode services.TargetMode, servicePort int) (DryRunPlan, error) {
+	plan := DryRunPlan{
+		TargetMode:  targetMode,
+		ServicePort: servicePort,
+		Services:    serviceInfos,
+	}
+
+	discovered, err := ports.DiscoverNodePorts(ctx)
+	if err != nil {
+		return plan, fmt.Errorf("failed to discover ports: %w", err)
+	}
+	for _, port := range ValidPorts(discovered) {
+		if port != servicePort && !slices.Contains(plan.Ports, port) {
+			plan.Ports = append(plan.Ports, port)
+		}
+	}
+	slices.Sort(plan.Ports)
+
+	if nodes != nil {
+		nodeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		if plan.NodeIP, err = nodes.GetCurrentNodeIP(nodeCtx); err != nil {
+			return plan, fmt.Errorf("failed to select a node: %w", err)
+		}
+		plan.NodeName = nodes.GetCurrentNodeName()
+	}
+
+	plan.log()
+	return plan, nil
+}
+
+// log writes the plan as structured log records
+func (p DryRunPlan) log() {
+	slog.Info("Dry run: no listeners will be opened",
+		"target_mode", p.TargetMode,
+		"service_port", p.ServicePort,
+		"proxy_ports", p.Ports)
+	for _, service := range p.Services {
+		slog.Info("Dry run: would proxy service",
+			"service", service.Namespace+"/"+service.Name,
+			"listen_port", service.ListenPort(),
+			"node_port", service.NodePort,
+			"port", service.Port,
+			"cluster_ip", service.ClusterIP,
+			"protocol", service.Protocol)
+	}
+	if p.NodeName != "" {
+		slog.Info("Dry run: would forward to node", "node", p.NodeName, "ip", p.NodeIP)
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+const (
+	// eventStreamKeepAlive is how often an idle stream gets a comment line, so
+	// proxies and load balancers in between don't close it
+	eventStreamKeepAlive = 15 * time.Second
+
+	// eventStreamBuffer is how many messages a slow client may fall behind by
+	// before further messages are dropped for it
+	eventStreamBuffer = 8
+
+	// StatusStreamEvent is the event type of the snapshot sent when a client connects
+	StatusStreamEvent = "status"
+)
+
+// StreamEvent is the data of each /events message. Node events carry the node
+// names; every event carries the /status body as of when it was sent, so a
+// client can redraw from any single message.
+type StreamEvent struct {
+	Type    string          `json:"type"`
+	Time    time.Time       `json:"time"`
+	OldNode string          `json:"old_node,omitempty"`
+	NewNode string          `json:"new_node,omitempty"`
+	Status  *statusResponse `json:"status,omitempty"`
+}
+
+// EventStream serves /events: node events as Server-Sent Events, each with a
+// fresh status snapshot. Clients come and go while one node event subscription
+// feeds them all.
+type EventStream struct {
+	data HomepageDataSource
+
+	mu      sync.Mutex
+	clients map[chan []byte]struct{}
+}
+
+// NewEventStream creates an event stream taking its snapshots from data
+func NewEventStream(data HomepageDataSource) *EventStream {
+	return &EventStream{
+		data:    data,
+		clients: make(map[chan []byte]struct{}),
+	}
+}
+
+// ForwardNodeEvents streams every node event to the connected clients until
+// the channel is closed; run it in its own goroutine with a channel from the
+// node discovery's Subscribe
+func (s *EventStream) ForwardNodeEvents(events <-chan nodes.NodeEvent) {
+	for event := range events {
+		s.broadcast(s.message(context.Background(), StreamEvent{
+			Type:    string(event.Type),
+			Time:    event.Time,
+			OldNode: event.OldNode,
+			NewNode: event.NewNode,
+		}))
+	}
+}
+
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// The stream stays open, so SERVER_WRITE_TIMEOUT must not cut it off
+	rc.SetWriteDeadline(time.Time{})
+
+	// Register before the snapshot so no event falls in between
+	messages := s.register()
+	defer s.unregister(messages)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	w.Write(s.message(r.Context(), StreamEvent{Type: StatusStreamEvent, Time: time.Now()}))
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case message := <-messages:
+			_, err = w.Write(message)
+		case <-keepAlive.C:
+			_, err = io.WriteString(w, ": keepalive\n\n")
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// message formats event as an SSE message, adding the current status when it
+// can be gathered
+func (s *EventStream) message(ctx context.Context, event StreamEvent) []byte {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if data, err := s.data(ctx); err == nil {
+		status := newStatusResponse(data)
+		event.Status = &status
+	} else {
+		slog.Debug("Streaming event without status", "type", event.Type, "error", err)
+	}
+	body, _ := json.Marshal(event)
+	return fmt.Appendf(nil, "event: %s\ndata: %s\n\n", event.Type, body)
+}
+
+func (s *EventStream) register() chan []byte {
+	ch := make(chan []byte, eventStreamBuffer)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[ch] = struct{}{}
+	return ch
+}
+
+func (s *EventStream) unregister(ch chan []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, ch)
+}
+
+// broadcast queues message for every client, dropping it for full ones
+func (s *EventStream) broadcast(message []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.clients {
+		select {
+		case ch <- message:
+		default:
+			slog.Warn("Dropped /events message, client is not keeping up")
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// readStreamEvent reads the next SSE message, skipping keepalive comments
+func readStreamEvent(t *testing.T, reader *bufio.Reader) (string, StreamEvent) {
+	t.Helper()
+	var eventType string
+	var event StreamEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read from /events: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("Failed to decode event data: %v", err)
+			}
+		case line == "" && eventType != "":
+			return eventType, event
+		}
+	}
+}
+
+func TestEventStream_PushesFailover(t *testing.T) {
+	now := time.Now()
+	discovery, err := nodes.NewGenericNodeDiscovery(fake.NewClientset(
+		readyNode("node-1", "10.0.1.1", now.Add(-2*time.Hour)),
+		readyNode("node-2", "10.0.1.2", now.Add(-time.Hour)),
+	))
+	if err != nil {
+		t.Fatalf("Failed to create node discovery: %v", err)
+	}
+	defer discovery.StopHealthMonitoring()
+	if _, err := discovery.GetCurrentNodeIP(context.Background()); err != nil {
+		t.Fatalf("Failed to select a node: %v", err)
+	}
+
+	stream := NewEventStream(func(ctx context.Context) (HomepageData, error) {
+		allNodes, err := discovery.GetAllNodes(ctx)
+		if err != nil {
+			return HomepageData{}, err
+		}
+		ip, _ := discovery.GetCurrentNodeIP(ctx)
+		return HomepageData{
+			CurrentNode: &CurrentNodeInfo{Name: discovery.GetCurrentNodeName(), IP: ip, Status: "healthy"},
+			AllNodes:    allNodes,
+		}, nil
+	})
+	go stream.ForwardNodeEvents(discovery.Subscribe())
+
+	server := httptest.NewServer(stream)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect to /events: %v", err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %q", contentType)
+	}
+	reader := bufio.NewReader(resp.Body)
+
+	// A snapshot first, so the page is current even if it was rendered a while ago
+	eventType, event := readStreamEvent(t, reader)
+	if eventType != StatusStreamEvent || event.Status == nil || event.Status.CurrentNode == nil || event.Status.CurrentNode.Name != "node-1" {
+		t.Fatalf("Expected a status event with node-1 current, got %s %+v", eventType, event)
+	}
+	if len(event.Status.Nodes) != 2 {
+		t.Errorf("Expected 2 nodes in the snapshot, got %d", len(event.Status.Nodes))
+	}
+
+	if _, err := discovery.TriggerFailover(); err != nil {
+		t.Fatalf("Failover failed: %v", err)
+	}
+
+	eventType, event = readStreamEvent(t, reader)
+	if eventType != string(nodes.NodeFailover) {
+		t.Fatalf("Expected a %s event, got %s", nodes.NodeFailover, eventType)
+	}
+	if event.OldNode != "node-1" || event.NewNode != "node-2" {
+		t.Errorf("Expected failover from node-1 to node-2, got %+v", event)
+	}
+	if event.Status == nil || event.Status.CurrentNode == nil || event.Status.CurrentNode.Name != "node-2" {
+		t.Errorf("Expected the pushed status to show node-2 current, got %+v", event.Status)
+	}
+}
+
+func TestEventStream_UnregistersClosedClients(t *testing.T) {
+	stream := NewEventStream(func(ctx context.Context) (HomepageData, error) {
+		return HomepageData{}, ErrServerInfoNotCollected
+	})
+	server := httptest.NewServer(stream)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to connect to /events: %v", err)
+	}
+	// Without server info the snapshot still arrives, just without status
+	if eventType, event := readStreamEvent(t, bufio.NewReader(resp.Body)); eventType != StatusStreamEvent || event.Status != nil {
+		t.Errorf("Expected a status event without status, got %s %+v", eventType, event)
+	}
+	resp.Body.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stream.mu.Lock()
+		clients := len(stream.clients)
+		stream.mu.Unlock()
+		if clients == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the closed client to be unregistered, %d remain", clients)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
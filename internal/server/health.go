@@ -0,0 +1,139 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// NodeNameProvider reports the name of the currently selected node
+type NodeNameProvider interface {
+	GetCurrentNodeName() string
+}
+
+// NodeHealthProvider reports the selected node and the cached health of the cluster's nodes
+type NodeHealthProvider interface {
+	NodeNameProvider
+	GetCurrentNodeStatus() nodes.NodeStatus
+	GetHealthyNodeCount() int
+	GetUnavailableReason() string
+}
+
+// healthResponse is the /health JSON body
+type healthResponse struct {
+	ProxyServer       string `json:"proxy_server"`
+	CurrentNodeName   string `json:"current_node_name"`
+	CurrentNodeStatus string `json:"current_node_status"`
+	HealthyNodes      int    `json:"healthy_nodes"`
+	Reason            string `json:"reason,omitempty"`
+}
+
+// Health serves /health from cached discovery data only - NO API calls, NO blocking
+type Health struct {
+	// Nodes is nil when node selection is disabled (TARGET_MODE=clusterip)
+	Nodes NodeHealthProvider
+	// Startup is nil when the caller doesn't track startup phases
+	Startup *StartupState
+}
+
+// ServeHTTP reports the proxy as starting until startup completes, then as
+// degraded while the selected node isn't healthy
+func (h Health) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	proxyStatus := "healthy"
+	currentNodeName := ""
+	currentNodeStatus := nodes.NodeUnknown
+	healthyNodes := 0
+	reason := ""
+
+	if h.Nodes != nil {
+		currentNodeName = h.Nodes.GetCurrentNodeName()
+		currentNodeStatus = h.Nodes.GetCurrentNodeStatus()
+		healthyNodes = h.Nodes.GetHealthyNodeCount()
+		reason = h.Nodes.GetUnavailableReason()
+		if currentNodeStatus != nodes.NodeHealthy || reason != "" {
+			proxyStatus = "degraded"
+		}
+	}
+	if h.Startup != nil && h.Startup.Phase() != PhaseReady {
+		proxyStatus = "starting"
+	}
+
+	response, err := json.Marshal(healthResponse{
+		ProxyServer:       proxyStatus,
+		CurrentNodeName:   currentNodeName,
+		CurrentNodeStatus: currentNodeStatus.String(),
+		HealthyNodes:      healthyNodes,
+		Reason:            reason,
+	})
+	if err != nil {
+		http.Error(w, "Failed to encode health response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// Readiness decides whether the proxy is ready to receive traffic: startup has
+// finished, a node has been selected and at least one proxy port (other than
+// the service port) is listening
+type Readiness struct {
+	// Nodes is nil when node selection is disabled (TARGET_MODE=clusterip)
+	Nodes       NodeNameProvider
+	Ports       *PortManager
+	ServicePort int
+	// Startup is nil when the caller doesn't track startup phases
+	Startup *StartupState
+}
+
+// Check returns whether the proxy is ready and, if not, why
+func (r Readiness) Check() (bool, string) {
+	if r.Startup != nil {
+		if phase := r.Startup.Phase(); phase != PhaseReady {
+			return false, "startup phase " + phase.String()
+		}
+	}
+	if r.Ports.Draining() {
+		return false, "draining"
+	}
+	if r.Nodes != nil && r.Nodes.GetCurrentNodeName() == "" {
+		return false, "no node selected"
+	}
+
+	for _, port := range r.Ports.GetListeningPorts() {
+		if port != r.ServicePort {
+			return true, ""
+		}
+	}
+	return false, "no proxy ports listening"
+}
+
+// ServeHTTP handles /readyz: 200 once ready, 503 until then
+func (r Readiness) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	ready, reason := r.Check()
+	body := map[string]string{"status": "ready"}
+	if r.Startup != nil {
+		body["phase"] = r.Startup.Phase().String()
+	}
+	if !ready {
+		body["status"] = "not_ready"
+		body["reason"] = reason
+		writeProbeResponse(w, http.StatusServiceUnavailable, body)
+		return
+	}
+	writeProbeResponse(w, http.StatusOK, body)
+}
+
+// HandleLivez handles /livez: 200 whenever the process is running
+func HandleLivez(w http.ResponseWriter, _ *http.Request) {
+	writeProbeResponse(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+func writeProbeResponse(w http.ResponseWriter, status int, body map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
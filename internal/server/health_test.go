@@ -0,0 +1,89 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type fakeNodeNames struct {
+	mu   sync.Mutex
+	name string
+}
+
+func (f *fakeNodeNames) GetCurrentNodeName() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.name
+}
+
+func (f *fakeNodeNames) set(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.name = name
+}
+
+func serveProbe(h http.Handler, path string) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w.Code
+}
+
+func TestHandleLivez(t *testing.T) {
+	if code := serveProbe(http.HandlerFunc(HandleLivez), "/livez"); code != http.StatusOK {
+		t.Errorf("Expected /livez status 200, got %d", code)
+	}
+}
+
+func TestReadiness_Transitions(t *testing.T) {
+	const servicePort = 8090
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+
+	nodes := &fakeNodeNames{}
+	readiness := Readiness{Nodes: nodes, Ports: pm, ServicePort: servicePort}
+
+	if code := serveProbe(readiness, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before node selection, got %d", code)
+	}
+
+	// The management port alone does not make the proxy ready
+	if err := pm.StartPort(servicePort, handler); err != nil {
+		t.Fatalf("Failed to start service port: %v", err)
+	}
+	nodes.set("node-1")
+	if ready, reason := readiness.Check(); ready || reason != "no proxy ports listening" {
+		t.Errorf("Expected not ready with no proxy ports, got ready=%v reason=%q", ready, reason)
+	}
+
+	if err := pm.StartPort(8091, handler); err != nil {
+		t.Fatalf("Failed to start proxy port: %v", err)
+	}
+	if code := serveProbe(readiness, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected 200 once a node is selected and a proxy port listens, got %d", code)
+	}
+
+	// Losing the selected node makes the proxy not ready again
+	nodes.set("")
+	if ready, reason := readiness.Check(); ready || reason != "no node selected" {
+		t.Errorf("Expected not ready without a node, got ready=%v reason=%q", ready, reason)
+	}
+}
+
+func TestReadiness_WithoutNodeSelection(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+
+	// ClusterIP target mode has no node selection, so only ports matter
+	readiness := Readiness{Ports: pm, ServicePort: 8092}
+	if err := pm.StartPort(8093, handler); err != nil {
+		t.Fatalf("Failed to start proxy port: %v", err)
+	}
+
+	if code := serveProbe(readiness, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected 200 without node selection, got %d", code)
+	}
+}
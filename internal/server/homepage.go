@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"errors"
 	"html/template"
 	"net/http"
 	"time"
@@ -44,6 +45,7 @@ const HomepageTemplate = `
 
     <div class="section">
         <h2>Current Active Node</h2>
+        <div id="current-node">
         {{if .CurrentNode}}
         <table>
             <tr><th>Property</th><th>Value</th></tr>
@@ -54,16 +56,21 @@ const HomepageTemplate = `
         {{else}}
         <p>No current node selected</p>
         {{end}}
+        </div>
         <div class="info-text">
-            Node behavior: Health checks every 15 seconds. Failover after 3 consecutive failures to oldest healthy node (max 45 seconds).
+            Node behavior: Health checks every {{.HealthCheckInterval}}. Failover after {{.FailureThreshold}} consecutive failures to oldest healthy node (max {{.MaxFailoverTime}}).
             Node list refreshes every 2 minutes for display only - active node remains stable unless unhealthy.
         </div>
     </div>
 
     <div class="section">
         <h2>All Cluster Nodes</h2>
+        {{if .NodesStale}}
+        <p><span class="status-unknown">Stale</span> The Kubernetes API has been unreachable since {{.NodesStaleSince.Format "15:04:05"}}; showing the last known nodes.</p>
+        {{end}}
         <table>
-            <tr><th>Node Name</th><th>IP Address</th><th>Status</th><th>Age</th><th>Last Check</th></tr>
+            <thead><tr><th>Node Name</th><th>IP Address</th><th>Status</th><th>Age</th><th>Last Check</th></tr></thead>
+            <tbody id="node-rows">
             {{range .AllNodes}}
             <tr>
                 <td>{{.Name}}</td>
@@ -75,11 +82,15 @@ const HomepageTemplate = `
                 <td>{{.LastCheck.Format "15:04:05"}}</td>
             </tr>
             {{end}}
+            </tbody>
         </table>
     </div>
 
     <div class="section">
         <h2>NodePort Services ({{.Namespace}} namespace)</h2>
+        {{if .SkippedPorts}}
+        <p><span class="status-unknown">Skipped</span> MAX_LISTENERS reached; not listening on ports {{range $i, $port := .SkippedPorts}}{{if $i}}, {{end}}{{$port}}{{end}}.</p>
+        {{end}}
         <table>
             <tr><th>Service</th><th>Namespace</th><th>NodePort</th><th>TargetPort</th><th>Protocol</th></tr>
             {{range .Services}}
@@ -96,8 +107,60 @@ const HomepageTemplate = `
 
     <div class="section">
         <p><strong>Proxy Status:</strong> Active and forwarding traffic to current cluster nodes</p>
-        <p><strong>Health Check:</strong> <a href="/health">/health</a></p>
+        <p><strong>Health Check:</strong> <a href="health">/health</a></p>
     </div>
+    {{if .LiveUpdates}}
+    <script>
+    // Redraw the current node and node table from /events; without JavaScript the page stays as rendered
+    (function () {
+        if (!window.EventSource) { return; }
+        function cell(row, text) { row.insertCell().textContent = text; }
+        function badge(status) {
+            var span = document.createElement("span");
+            span.className = "status-" + status;
+            span.textContent = status.charAt(0).toUpperCase() + status.slice(1);
+            return span;
+        }
+        function render(status) {
+            var current = document.getElementById("current-node");
+            current.replaceChildren();
+            if (status.current_node) {
+                var table = document.createElement("table");
+                var header = table.insertRow();
+                header.innerHTML = "<th>Property</th><th>Value</th>";
+                [["Node Name", status.current_node.name], ["IP Address", status.current_node.ip], ["Status", status.current_node.status]].forEach(function (field) {
+                    var row = table.insertRow();
+                    cell(row, field[0]);
+                    cell(row, field[1]);
+                });
+                current.appendChild(table);
+            } else {
+                var none = document.createElement("p");
+                none.textContent = "No current node selected";
+                current.appendChild(none);
+            }
+
+            var rows = document.getElementById("node-rows");
+            rows.replaceChildren();
+            status.nodes.forEach(function (node) {
+                var row = rows.insertRow();
+                cell(row, node.name);
+                cell(row, node.ip);
+                row.insertCell().appendChild(badge(node.status));
+                cell(row, Math.round((Date.now() - Date.parse(node.creation_time)) / 3600000) + "h");
+                cell(row, new Date(node.last_check).toTimeString().slice(0, 8));
+            });
+        }
+        var events = new EventSource("events");
+        ["status", "node_selected", "node_failover", "node_recovered", "node_ip_changed"].forEach(function (type) {
+            events.addEventListener(type, function (e) {
+                var event = JSON.parse(e.data);
+                if (event.status) { render(event.status); }
+            });
+        });
+    })();
+    </script>
+    {{end}}
 </body>
 </html>
 `
@@ -114,27 +177,69 @@ type CurrentNodeInfo struct {
 }
 
 type HomepageData struct {
-	PlatformName string
-	ClusterInfo  []ClusterInfoField
-	Namespace    string
-	CurrentNode  *CurrentNodeInfo
-	AllNodes     []nodes.NodeInfo
-	Services     []services.ServiceInfo
+	PlatformName        string
+	ClusterInfo         []ClusterInfoField
+	Namespace           string
+	CurrentNode         *CurrentNodeInfo
+	AllNodes            []nodes.NodeInfo
+	Services            []services.ServiceInfo
+	HealthCheckInterval time.Duration
+	FailureThreshold    int
+	// NodesStaleSince is when AllNodes stopped being refreshed because the
+	// Kubernetes API was unreachable; zero while it is fresh
+	NodesStaleSince time.Time
+	// LiveUpdates adds the script that follows /events
+	LiveUpdates bool
+	// SkippedPorts were discovered but have no listener because of MAX_LISTENERS
+	SkippedPorts []int
+}
+
+// NodesStale reports whether AllNodes is the last known node list rather than a fresh one
+func (d HomepageData) NodesStale() bool {
+	return !d.NodesStaleSince.IsZero()
+}
+
+// MaxFailoverTime is the longest an unhealthy node keeps serving before failover
+func (d HomepageData) MaxFailoverTime() time.Duration {
+	return d.HealthCheckInterval * time.Duration(d.FailureThreshold)
 }
 
 func (s *Server) handleHomepage(w http.ResponseWriter, r *http.Request) {
-	if s.serverInfo == nil {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	data, err := s.homepageData(ctx)
+	if errors.Is(err, ErrServerInfoNotCollected) {
 		http.Error(w, "Server info not yet collected", http.StatusServiceUnavailable)
 		return
 	}
+	if err != nil {
+		http.Error(w, "Failed to get current node data", http.StatusInternalServerError)
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-	defer cancel()
+	tmpl, err := template.New("homepage").Parse(HomepageTemplate)
+	if err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.Execute(w, &data); err != nil {
+		http.Error(w, "Template execution error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// homepageData gathers the data shared by the homepage and /status
+func (s *Server) homepageData(ctx context.Context) (HomepageData, error) {
+	if s.serverInfo == nil {
+		return HomepageData{}, ErrServerInfoNotCollected
+	}
 
 	allNodes, err := s.nodeIPDiscovery.GetAllNodes(ctx)
 	if err != nil {
-		http.Error(w, "Failed to get current node data", http.StatusInternalServerError)
-		return
+		return HomepageData{}, err
 	}
 
 	currentNodeName := s.nodeIPDiscovery.GetCurrentNodeName()
@@ -149,32 +254,28 @@ func (s *Server) handleHomepage(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// The cluster changes when the current one fails over to the next preferred cluster
+	cluster := s.nodeDiscovery.GetClusterInfo()
 	clusterInfo := []ClusterInfoField{
 		{Key: "Project ID", Value: s.serverInfo.ProjectID},
-		{Key: "Cluster Name", Value: s.serverInfo.ClusterName},
-		{Key: "Cluster Location", Value: s.serverInfo.ClusterLocation},
-		{Key: "Kubernetes Endpoint", Value: s.serverInfo.K8sEndpoint},
+		{Key: "Cluster Name", Value: cluster.Name},
+		{Key: "Cluster Location", Value: cluster.Location},
+		{Key: "Kubernetes Endpoint", Value: cluster.Endpoint},
 		{Key: "Target Namespace", Value: s.serverInfo.Namespace},
 	}
 
-	data := HomepageData{
+	return HomepageData{
 		PlatformName: "GKE",
 		ClusterInfo:  clusterInfo,
 		Namespace:    s.serverInfo.Namespace,
 		CurrentNode:  currentNodeInfo,
 		AllNodes:     allNodes,
-		Services:     s.serverInfo.Services,
-	}
+		Services:     s.reloader.Services(),
 
-	tmpl, err := template.New("homepage").Parse(HomepageTemplate)
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/html")
-	if err := tmpl.Execute(w, &data); err != nil {
-		http.Error(w, "Template execution error", http.StatusInternalServerError)
-		return
-	}
+		HealthCheckInterval: s.nodeIPDiscovery.HealthCheckInterval(),
+		FailureThreshold:    s.nodeIPDiscovery.FailureThreshold(),
+		NodesStaleSince:     s.nodeIPDiscovery.NodeListStaleSince(),
+		LiveUpdates:         s.events != nil,
+		SkippedPorts:        s.reloader.SkippedPorts(),
+	}, nil
 }
\ No newline at end of file
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"html/template"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHomepageTemplate_HealthCheckSettings(t *testing.T) {
+	tmpl, err := template.New("homepage").Parse(HomepageTemplate)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	data := HomepageData{
+		PlatformName:        "GKE",
+		HealthCheckInterval: 30 * time.Second,
+		FailureThreshold:    2,
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, &data); err != nil {
+		t.Fatalf("Failed to execute template: %v", err)
+	}
+
+	want := "Health checks every 30s. Failover after 2 consecutive failures to oldest healthy node (max 1m0s)."
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("Expected homepage to contain %q", want)
+	}
+}
+
+func TestHomepageTemplate_LiveUpdates(t *testing.T) {
+	tmpl, err := template.New("homepage").Parse(HomepageTemplate)
+	if err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+
+	for _, live := range []bool{true, false} {
+		var out strings.Builder
+		if err := tmpl.Execute(&out, &HomepageData{LiveUpdates: live}); err != nil {
+			t.Fatalf("Failed to execute template: %v", err)
+		}
+		// The static tables render either way; the script only follows /events
+		if !strings.Contains(out.String(), `id="node-rows"`) {
+			t.Error("Expected the node table to be rendered")
+		}
+		if got := strings.Contains(out.String(), `new EventSource("events")`); got != live {
+			t.Errorf("LiveUpdates=%v: expected EventSource script present=%v", live, live)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+// hostRouter serves every proxied service on one listener, picking the
+// service by the request's Host header (HOST_ROUTING_DOMAIN): <service>.<domain>
+// reaches the service's first port and <port>.<service>.<domain> its port
+// numbered port. Requests are then proxied as if they had arrived on the
+// service's own listener. The routes are rebuilt on every discovery.
+type hostRouter struct {
+	port     int
+	domain   string
+	handlers *portHandlers
+
+	// routes maps host names to the listen port of their service
+	routes atomic.Pointer[map[string]int]
+}
+
+func newHostRouter(port int, domain string, handlers *portHandlers, serviceInfos []services.ServiceInfo) *hostRouter {
+	h := &hostRouter{port: port, domain: domain, handlers: handlers}
+	h.update(serviceInfos)
+	return h
+}
+
+// update rebuilds the routes from the discovered services
+func (h *hostRouter) update(serviceInfos []services.ServiceInfo) {
+	routes := make(map[string]int)
+	for _, service := range serviceInfos {
+		port := service.ListenPort()
+		if port == 0 {
+			continue
+		}
+		name := service.Name + "." + h.domain
+		if _, ok := routes[name]; !ok {
+			routes[name] = port
+		}
+		routes[strconv.Itoa(int(service.Port))+"."+name] = port
+	}
+
+	if previous := h.routes.Swap(&routes); previous == nil || !maps.Equal(*previous, routes) {
+		slog.Info("Updated host routes", "port", h.port, "domain", h.domain, "hosts", len(routes))
+	}
+}
+
+// route returns the listen port of the service host names
+func (h *hostRouter) route(host string) (int, bool) {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	port, ok := (*h.routes.Load())[strings.ToLower(strings.TrimSuffix(host, "."))]
+	return port, ok
+}
+
+func (h *hostRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	port, ok := h.route(r.Host)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Not Found - No service for host %q, use <service>.%s", r.Host, h.domain), http.StatusNotFound)
+		return
+	}
+	r = r.WithContext(proxy.WithListenerPort(r.Context(), port))
+	h.handlers.handler(port).ServeHTTP(w, r)
+}
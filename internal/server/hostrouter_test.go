@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+// backendService starts a backend answering with name and returns it as a
+// NodePort service of the loopback node
+func backendService(t *testing.T, name string) services.ServiceInfo {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, name)
+	}))
+	t.Cleanup(backend.Close)
+	u, _ := url.Parse(backend.URL)
+	port, _ := strconv.Atoi(u.Port())
+	return services.ServiceInfo{Name: name, Namespace: "default", Port: 80, NodePort: int32(port)}
+}
+
+func TestHostRouter(t *testing.T) {
+	const servicePort, routingPort = 8114, 8115
+
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+	api, web := backendService(t, "api"), backendService(t, "web")
+	lister := &fakeServiceLister{services: []services.ServiceInfo{api, web}}
+	reloader := NewReloader(pm, lister, nil, proxy.NewHandler(loopbackNode{}, proxySettingsFromEnv(t)), servicePort, lister.services)
+	reloader.RouteHosts(routingPort, "proxy.internal")
+
+	ports := reloader.ListenPorts([]int{int(api.NodePort), int(web.NodePort)})
+	if !slices.Equal(ports, []int{routingPort}) {
+		t.Fatalf("Expected only the routing port %d, got %v", routingPort, ports)
+	}
+	if err := pm.StartPort(routingPort, reloader.ProxyHandler(routingPort)); err != nil {
+		t.Fatalf("Failed to start the routing port: %v", err)
+	}
+	// Give it a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	get := func(host string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", routingPort), nil)
+		req.Host = host
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request for %s failed: %v", host, err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	for host, want := range map[string]string{
+		"api.proxy.internal":       "api",
+		"web.proxy.internal":       "web",
+		"WEB.Proxy.Internal.:8115": "web",
+		"80.api.proxy.internal":    "api",
+	} {
+		if status, body := get(host); status != http.StatusOK || body != want {
+			t.Errorf("Expected %s to reach %s, got %d %q", host, want, status, body)
+		}
+	}
+	if status, _ := get("unknown.proxy.internal"); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown host, got %d", status)
+	}
+
+	t.Run("ReloadUpdatesRoutes", func(t *testing.T) {
+		admin := backendService(t, "admin")
+		lister.services = []services.ServiceInfo{api, admin}
+		if err := reloader.Reload(context.Background()); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+
+		if status, body := get("admin.proxy.internal"); status != http.StatusOK || body != "admin" {
+			t.Errorf("Expected the new service to be routed, got %d %q", status, body)
+		}
+		if status, _ := get("web.proxy.internal"); status != http.StatusNotFound {
+			t.Errorf("Expected the removed service to be gone, got %d", status)
+		}
+		if got := listeningPorts(pm); !slices.Equal(got, []int{routingPort}) {
+			t.Errorf("Expected only the routing port to listen, got %v", got)
+		}
+	})
+}
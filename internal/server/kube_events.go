@@ -0,0 +1,142 @@
+package server
+
+import (
+	"log/slog"
+	"sync/atomic"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/services"
+)
+
+// kubeEventsComponent is the source reported on the recorded Events
+const kubeEventsComponent = "k8s-node-proxy"
+
+// Reasons of the Events recorded on the proxy pod
+const (
+	ReasonNodeSelected   = "NodeSelected"
+	ReasonNodeFailover   = "NodeFailover"
+	ReasonNodeRecovered  = "NodeRecovered"
+	ReasonNodeIPChanged  = "NodeIPChanged"
+	ReasonServiceAdded   = "ServiceAdded"
+	ReasonServiceRemoved = "ServiceRemoved"
+)
+
+// KubeEvents records node and service events as Kubernetes Events on the
+// proxy's pod, so they show up in kubectl get events and kubectl describe pod
+// (EMIT_K8S_EVENTS). Like the webhook, recording is best-effort and never
+// blocks the caller. When the service account may not create events, the
+// first rejected Event logs a warning and recording stops.
+type KubeEvents struct {
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	pod         *corev1.ObjectReference
+
+	// forbidden is set once the API server rejected an Event for lack of permission
+	forbidden atomic.Bool
+}
+
+// NewKubeEvents starts recording Events about the pod namespace/name (with
+// uid, when known) through clientset until Close
+func NewKubeEvents(clientset kubernetes.Interface, namespace, name, uid string) *KubeEvents {
+	e := &KubeEvents{
+		broadcaster: record.NewBroadcaster(),
+		pod: &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  namespace,
+			Name:       name,
+			UID:        types.UID(uid),
+		},
+	}
+	e.broadcaster.StartRecordingToSink(&kubeEventSink{
+		EventSink: &typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events(namespace)},
+		forbidden: &e.forbidden,
+	})
+	e.recorder = e.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: kubeEventsComponent})
+	return e
+}
+
+// Close stops recording; Events not yet written are dropped
+func (e *KubeEvents) Close() {
+	e.broadcaster.Shutdown()
+}
+
+// ForwardNodeEvents records every node event until the channel is closed; run
+// it in its own goroutine with a channel from the node discovery's Subscribe
+func (e *KubeEvents) ForwardNodeEvents(events <-chan nodes.NodeEvent) {
+	for event := range events {
+		switch event.Type {
+		case nodes.NodeSelected:
+			if event.OldNode == "" {
+				e.record(corev1.EventTypeNormal, ReasonNodeSelected, "Selected node %s", event.NewNode)
+			} else {
+				e.record(corev1.EventTypeNormal, ReasonNodeSelected, "Switched from node %s to node %s", event.OldNode, event.NewNode)
+			}
+		case nodes.NodeFailover:
+			e.record(corev1.EventTypeWarning, ReasonNodeFailover, "Failed over from node %s to node %s", event.OldNode, event.NewNode)
+		case nodes.NodeRecovered:
+			e.record(corev1.EventTypeNormal, ReasonNodeRecovered, "Node %s recovered", event.NewNode)
+		case nodes.NodeIPChanged:
+			e.record(corev1.EventTypeNormal, ReasonNodeIPChanged, "Node %s changed its IP", event.NewNode)
+		}
+	}
+}
+
+// ServicesChanged records an Event per port that started or stopped being
+// proxied; pass it to Reloader.OnServicesChanged
+func (e *KubeEvents) ServicesChanged(change ServiceChange) {
+	names := services.ServiceNamesByPort(change.Services)
+	for _, port := range change.PortsAdded {
+		e.record(corev1.EventTypeNormal, ReasonServiceAdded, "Started proxying port %d (%s)", port, names[port])
+	}
+	for _, port := range change.PortsRemoved {
+		e.record(corev1.EventTypeNormal, ReasonServiceRemoved, "Stopped proxying port %d", port)
+	}
+}
+
+func (e *KubeEvents) record(eventType, reason, format string, args ...any) {
+	if e.forbidden.Load() {
+		return
+	}
+	e.recorder.Eventf(e.pod, eventType, reason, format, args...)
+}
+
+// kubeEventSink writes Events through the API, noticing when the service
+// account may not create them
+type kubeEventSink struct {
+	record.EventSink
+	forbidden *atomic.Bool
+}
+
+func (s *kubeEventSink) Create(event *corev1.Event) (*corev1.Event, error) {
+	created, err := s.EventSink.Create(event)
+	s.checkForbidden(err)
+	return created, err
+}
+
+func (s *kubeEventSink) Update(event *corev1.Event) (*corev1.Event, error) {
+	updated, err := s.EventSink.Update(event)
+	s.checkForbidden(err)
+	return updated, err
+}
+
+func (s *kubeEventSink) Patch(event *corev1.Event, data []byte) (*corev1.Event, error) {
+	patched, err := s.EventSink.Patch(event, data)
+	s.checkForbidden(err)
+	return patched, err
+}
+
+func (s *kubeEventSink) checkForbidden(err error) {
+	if apierrors.IsForbidden(err) && s.forbidden.CompareAndSwap(false, true) {
+		slog.Warn("Not allowed to create Kubernetes Events, no longer recording them; grant the proxy's service account create on events",
+			"error", err)
+	}
+}
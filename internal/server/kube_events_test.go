@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/services"
+)
+
+// recordedEvent waits for an Event with the given reason in namespace
+func recordedEvent(t *testing.T, clientset *fake.Clientset, namespace, reason string) corev1.Event {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		events, err := clientset.CoreV1().Events(namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatalf("Failed to list events: %v", err)
+		}
+		for _, event := range events.Items {
+			if event.Reason == reason {
+				return event
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for a %s event", reason)
+	return corev1.Event{}
+}
+
+func TestKubeEvents_Failover(t *testing.T) {
+	now := time.Now()
+	clientset := fake.NewClientset(
+		readyNode("node-1", "10.0.1.1", now.Add(-2*time.Hour)),
+		readyNode("node-2", "10.0.1.2", now.Add(-time.Hour)),
+	)
+	kubeEvents := NewKubeEvents(clientset, "proxy", "k8s-node-proxy-7d9f", "0b7e6b2c")
+	defer kubeEvents.Close()
+
+	discovery, err := nodes.NewGenericNodeDiscovery(clientset)
+	if err != nil {
+		t.Fatalf("Failed to create node discovery: %v", err)
+	}
+	defer discovery.StopHealthMonitoring()
+	go kubeEvents.ForwardNodeEvents(discovery.Subscribe())
+
+	if _, err := discovery.GetCurrentNodeIP(context.Background()); err != nil {
+		t.Fatalf("Failed to select a node: %v", err)
+	}
+	if _, err := discovery.TriggerFailover(); err != nil {
+		t.Fatalf("Failover failed: %v", err)
+	}
+
+	event := recordedEvent(t, clientset, "proxy", ReasonNodeFailover)
+	if event.Type != corev1.EventTypeWarning {
+		t.Errorf("Expected a Warning event, got %s", event.Type)
+	}
+	if event.Message != "Failed over from node node-1 to node node-2" {
+		t.Errorf("Unexpected message %q", event.Message)
+	}
+	object := event.InvolvedObject
+	if object.Kind != "Pod" || object.Namespace != "proxy" || object.Name != "k8s-node-proxy-7d9f" || object.UID != "0b7e6b2c" {
+		t.Errorf("Expected the event on the proxy pod, got %+v", object)
+	}
+	if event.Source.Component != "k8s-node-proxy" {
+		t.Errorf("Expected source k8s-node-proxy, got %q", event.Source.Component)
+	}
+	recordedEvent(t, clientset, "proxy", ReasonNodeSelected)
+}
+
+func TestKubeEvents_ServicesChanged(t *testing.T) {
+	clientset := fake.NewClientset()
+	kubeEvents := NewKubeEvents(clientset, "proxy", "k8s-node-proxy-7d9f", "")
+	defer kubeEvents.Close()
+
+	kubeEvents.ServicesChanged(ServiceChange{
+		PortsAdded:   []int{30080},
+		PortsRemoved: []int{30081},
+		Services:     []services.ServiceInfo{{Name: "api", Namespace: "default", NodePort: 30080}},
+	})
+
+	if event := recordedEvent(t, clientset, "proxy", ReasonServiceAdded); event.Message != "Started proxying port 30080 (default/api)" {
+		t.Errorf("Unexpected message %q", event.Message)
+	}
+	if event := recordedEvent(t, clientset, "proxy", ReasonServiceRemoved); event.Message != "Stopped proxying port 30081" {
+		t.Errorf("Unexpected message %q", event.Message)
+	}
+}
+
+func TestKubeEvents_Forbidden(t *testing.T) {
+	clientset := fake.NewClientset()
+	var creates atomic.Int32
+	clientset.PrependReactor("create", "events", func(k8stesting.Action) (bool, runtime.Object, error) {
+		creates.Add(1)
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "events"}, "", nil)
+	})
+	kubeEvents := NewKubeEvents(clientset, "proxy", "k8s-node-proxy-7d9f", "")
+	defer kubeEvents.Close()
+
+	kubeEvents.ServicesChanged(ServiceChange{PortsRemoved: []int{30081}})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !kubeEvents.forbidden.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !kubeEvents.forbidden.Load() {
+		t.Fatal("Expected the rejected event to stop recording")
+	}
+
+	// Later events are dropped instead of being sent to be rejected again
+	kubeEvents.ServicesChanged(ServiceChange{PortsRemoved: []int{30082}})
+	time.Sleep(100 * time.Millisecond)
+	if n := creates.Load(); n != 1 {
+		t.Errorf("Expected a single create attempt, got %d", n)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval is how often the certificate files are checked for rotation
+const certReloadInterval = 30 * time.Second
+
+// listenerTLS terminates client TLS on the configured ports
+type listenerTLS struct {
+	// ports served over HTTPS; empty means every port
+	ports map[int]bool
+	certs *certReloader
+}
+
+// newListenerTLS loads the certificate in certFile and keyFile, served on
+// ports or on every port when ports is empty. It returns nil when no
+// certificate is configured.
+func newListenerTLS(certFile, keyFile string, ports map[int]bool) (*listenerTLS, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	certs, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &listenerTLS{ports: ports, certs: certs}, nil
+}
+
+// serves reports whether port is served over HTTPS
+func (t *listenerTLS) serves(port int) bool {
+	return t != nil && (len(t.ports) == 0 || t.ports[port])
+}
+
+func (t *listenerTLS) config() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: t.certs.getCertificate,
+	}
+}
+
+// certReloader serves a certificate loaded once and reloaded when its files
+// change, so rotated certificates (e.g. an updated Kubernetes Secret) are
+// picked up without restarting. Changes are noticed on the first handshake
+// after certReloadInterval.
+type certReloader struct {
+	certFile, keyFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load reads the key pair and records the newest modification time of its files
+func (r *certReloader) load() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert, r.modTime, r.lastCheck = &cert, modTime, time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to stat TLS certificate file: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reloadIfChanged reloads the certificate when its files changed since the last
+// load. A failed reload keeps serving the previous certificate.
+func (r *certReloader) reloadIfChanged() {
+	r.mu.Lock()
+	r.lastCheck = time.Now()
+	loaded := r.modTime
+	r.mu.Unlock()
+
+	modTime, err := r.latestModTime()
+	if err != nil {
+		slog.Warn("Failed to check TLS certificate for rotation", "error", err)
+		return
+	}
+	if modTime.Equal(loaded) {
+		return
+	}
+	if err := r.load(); err != nil {
+		slog.Error("Failed to reload rotated TLS certificate, keeping the previous one", "error", err)
+		return
+	}
+	slog.Info("Reloaded rotated TLS certificate", "cert_file", r.certFile)
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	due := time.Since(r.lastCheck) >= certReloadInterval
+	r.mu.RUnlock()
+	if due {
+		r.reloadIfChanged()
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/proxy"
+)
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key to dir
+func writeSelfSignedCert(t *testing.T, dir, commonName string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile, cert
+}
+
+type staticNodeIP string
+
+func (ip staticNodeIP) GetCurrentNodeIP(context.Context) (string, error) { return string(ip), nil }
+
+func TestStartPort_TLS(t *testing.T) {
+	const port = 8092
+	certFile, keyFile, cert := writeSelfSignedCert(t, t.TempDir(), "proxy")
+	t.Setenv("LISTEN_ADDRESS", "127.0.0.1")
+	t.Setenv("TLS_CERT_FILE", certFile)
+	t.Setenv("TLS_KEY_FILE", keyFile)
+
+	// The proxy forwards to the same port on the node, so the backend listens on another loopback address
+	backendListener, err := net.Listen("tcp", "127.0.0.2:8092")
+	if err != nil {
+		t.Skipf("127.0.0.2 is not available: %v", err)
+	}
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.Path))
+	}))
+	backend.Listener = backendListener
+	backend.Start()
+	defer backend.Close()
+
+	pm := NewPortManager(listenersFromEnv(t))
+	if err := pm.StartPort(port, proxy.NewHandler(staticNodeIP("127.0.0.2"), proxySettingsFromEnv(t))); err != nil {
+		t.Fatalf("Failed to start port: %v", err)
+	}
+	defer pm.StopAll()
+	time.Sleep(100 * time.Millisecond)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	resp, err := client.Get("https://127.0.0.1:8092/hello")
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "proxied /hello" {
+		t.Errorf("Expected 200 proxied /hello, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestStartPort_InvalidTLS(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "/nonexistent/tls.crt")
+	t.Setenv("TLS_KEY_FILE", "/nonexistent/tls.key")
+	pm := NewPortManager(listenersFromEnv(t))
+
+	if err := pm.StartPort(8093, http.NotFoundHandler()); err == nil {
+		pm.StopAll()
+		t.Error("Expected StartPort to fail when the certificate can't be loaded")
+	}
+}
+
+func TestNewListenerTLS(t *testing.T) {
+	certFile, keyFile, _ := writeSelfSignedCert(t, t.TempDir(), "proxy")
+
+	t.Run("Unset", func(t *testing.T) {
+		listenerTLS, err := newListenerTLS("", "", nil)
+		if err != nil || listenerTLS != nil {
+			t.Errorf("Expected no TLS when unset, got %v, %v", listenerTLS, err)
+		}
+		if listenerTLS.serves(8080) {
+			t.Error("Expected plain HTTP when unset")
+		}
+	})
+
+	t.Run("AllPorts", func(t *testing.T) {
+		listenerTLS, err := newListenerTLS(certFile, keyFile, map[int]bool{})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !listenerTLS.serves(80) || !listenerTLS.serves(30080) {
+			t.Error("Expected every port served over HTTPS without TLS_PORTS")
+		}
+	})
+
+	t.Run("SelectedPorts", func(t *testing.T) {
+		listenerTLS, err := newListenerTLS(certFile, keyFile, map[int]bool{30443: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !listenerTLS.serves(30443) || listenerTLS.serves(80) {
+			t.Errorf("Unexpected port set: %v", listenerTLS.ports)
+		}
+	})
+}
+
+func TestCertReloader_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, _ := writeSelfSignedCert(t, dir, "original")
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load certificate: %v", err)
+	}
+
+	commonName := func() string {
+		cert, _ := reloader.getCertificate(nil)
+		parsed, _ := x509.ParseCertificate(cert.Certificate[0])
+		return parsed.Subject.CommonName
+	}
+	if name := commonName(); name != "original" {
+		t.Fatalf("Expected original certificate, got %s", name)
+	}
+
+	writeSelfSignedCert(t, dir, "rotated")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	reloader.reloadIfChanged()
+	if name := commonName(); name != "rotated" {
+		t.Errorf("Expected rotated certificate after reload, got %s", name)
+	}
+
+	// A broken rotation keeps the last good certificate
+	os.WriteFile(certFile, []byte("garbage"), 0o600)
+	later := future.Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+
+	reloader.reloadIfChanged()
+	if name := commonName(); name != "rotated" {
+		t.Errorf("Expected previous certificate after a failed reload, got %s", name)
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ShareServicePort serves management for paths under prefix, with the prefix
+// stripped so management sees its usual paths (/health, /readyz, ...), and
+// passes every other request to proxy. The bare prefix without its trailing
+// slash redirects to the management homepage.
+func ShareServicePort(prefix string, management, proxy http.Handler) http.Handler {
+	base := strings.TrimSuffix(prefix, "/")
+	stripped := http.StripPrefix(base, management)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == base:
+			http.Redirect(w, r, prefix, http.StatusMovedPermanently)
+		case strings.HasPrefix(r.URL.Path, prefix):
+			stripped.ServeHTTP(w, r)
+		default:
+			proxy.ServeHTTP(w, r)
+		}
+	})
+}
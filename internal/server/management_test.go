@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"k8s-node-proxy/internal/proxy"
+)
+
+// loopbackNode always selects 127.0.0.1
+type loopbackNode struct{}
+
+func (loopbackNode) GetCurrentNodeIP(context.Context) (string, error) {
+	return "127.0.0.1", nil
+}
+
+func TestShareServicePort(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend " + r.URL.Path))
+	}))
+	defer backend.Close()
+	backendURL, _ := url.Parse(backend.URL)
+
+	management := http.NewServeMux()
+	management.HandleFunc("/livez", HandleLivez)
+	management.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("management status"))
+	})
+	management.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("management " + r.URL.Path))
+	})
+	handler := ShareServicePort("/_np/", RequireManagementAuth("s3cret", management), proxy.NewHandler(loopbackNode{}, proxySettingsFromEnv(t)))
+
+	send := func(path string, authorize bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://"+backendURL.Host+path, nil)
+		if authorize {
+			req.Header.Set("Authorization", "Bearer s3cret")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		authorize bool
+		status    int
+		body      string
+	}{
+		{"ManagementHomepage", "/_np/", true, http.StatusOK, "management /"},
+		{"ManagementStatus", "/_np/status", true, http.StatusOK, "management status"},
+		{"ManagementNeedsAuth", "/_np/status", false, http.StatusUnauthorized, "{\"error\":\"missing or invalid admin token\"}\n"},
+		{"ProbeStaysOpen", "/_np/livez", false, http.StatusOK, "{\"status\":\"alive\"}\n"},
+		{"ProxiedRoot", "/", false, http.StatusOK, "backend /"},
+		{"ProxiedPath", "/api/users", false, http.StatusOK, "backend /api/users"},
+		{"ProxiedLookalike", "/_npx/status", false, http.StatusOK, "backend /_npx/status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.path, tt.authorize)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if body, _ := io.ReadAll(w.Body); string(body) != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, body)
+			}
+		})
+	}
+
+	t.Run("BarePrefixRedirects", func(t *testing.T) {
+		w := send("/_np", false)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/_np/" {
+			t.Errorf("Expected a redirect to /_np/, got %d %q", w.Code, w.Header().Get("Location"))
+		}
+	})
+}
@@ -0,0 +1,20 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// LogNodeEvents logs every event from the node discovery in one consistent
+// format until the channel is closed; run it in its own goroutine
+func LogNodeEvents(events <-chan nodes.NodeEvent) {
+	for event := range events {
+		slog.Info("Node event",
+			"type", event.Type,
+			"old_node", event.OldNode,
+			"new_node", event.NewNode,
+			"time", event.Time.Format(time.RFC3339))
+	}
+}
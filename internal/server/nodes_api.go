@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+// NodeListProvider reports every discovered node and their recent health-check failures
+type NodeListProvider interface {
+	NodeNameProvider
+	GetAllNodes(ctx context.Context) ([]nodes.NodeInfo, error)
+	GetNodeFailureScores() map[string]float64
+}
+
+// nodeResponse is one entry of the /api/nodes JSON body
+type nodeResponse struct {
+	Name         string    `json:"name"`
+	IP           string    `json:"ip"`
+	Status       string    `json:"status"`
+	CreationTime time.Time `json:"creation_time"`
+	LastCheck    time.Time `json:"last_check"`
+	Current      bool      `json:"current"`
+	Pinned       bool      `json:"pinned,omitempty"`
+	FailureScore float64   `json:"failure_score"`
+}
+
+// PinnedNodeProvider reports the node pinned through /admin/select, if any
+type PinnedNodeProvider interface {
+	PinnedNode() string
+}
+
+// NodesAPI serves /api/nodes: the discovered nodes with their recent-failure scores
+type NodesAPI struct {
+	Nodes NodeListProvider
+}
+
+func (a NodesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	allNodes, err := a.Nodes.GetAllNodes(ctx)
+	if err != nil {
+		writeProbeResponse(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+
+	current := a.Nodes.GetCurrentNodeName()
+	scores := a.Nodes.GetNodeFailureScores()
+	var pinned string
+	if provider, ok := a.Nodes.(PinnedNodeProvider); ok {
+		pinned = provider.PinnedNode()
+	}
+
+	response := struct {
+		Nodes []nodeResponse `json:"nodes"`
+	}{Nodes: make([]nodeResponse, 0, len(allNodes))}
+	for _, node := range allNodes {
+		response.Nodes = append(response.Nodes, nodeResponse{
+			Name:         node.Name,
+			IP:           node.IP,
+			Status:       node.Status.String(),
+			CreationTime: node.CreationTime,
+			LastCheck:    node.LastCheck,
+			Current:      node.Name == current,
+			Pinned:       node.Name == pinned,
+			FailureScore: scores[node.Name],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+type fakeNodeList struct {
+	fakeNodeNames
+	nodes  []nodes.NodeInfo
+	scores map[string]float64
+	err    error
+}
+
+func (f *fakeNodeList) GetAllNodes(context.Context) ([]nodes.NodeInfo, error) {
+	return f.nodes, f.err
+}
+
+func (f *fakeNodeList) GetNodeFailureScores() map[string]float64 {
+	return f.scores
+}
+
+func TestNodesAPI(t *testing.T) {
+	provider := &fakeNodeList{
+		nodes: []nodes.NodeInfo{
+			{Name: "node-1", IP: "10.0.1.1", Status: nodes.NodeHealthy},
+			{Name: "node-2", IP: "10.0.1.2", Status: nodes.NodeUnhealthy},
+		},
+		scores: map[string]float64{"node-2": 1.5},
+	}
+	provider.set("node-1")
+
+	w := httptest.NewRecorder()
+	NodesAPI{Nodes: provider}.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/nodes", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var body struct {
+		Nodes []nodeResponse `json:"nodes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode /api/nodes: %v", err)
+	}
+	if len(body.Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %d", len(body.Nodes))
+	}
+	if n := body.Nodes[0]; !n.Current || n.FailureScore != 0 || n.Status != "healthy" {
+		t.Errorf("Unexpected node-1 entry: %+v", n)
+	}
+	if n := body.Nodes[1]; n.Current || n.FailureScore != 1.5 || n.Status != "unhealthy" {
+		t.Errorf("Unexpected node-2 entry: %+v", n)
+	}
+}
+
+func TestNodesAPI_DiscoveryError(t *testing.T) {
+	provider := &fakeNodeList{err: errors.New("api unavailable")}
+
+	if code := serveProbe(NodesAPI{Nodes: provider}, "/api/nodes"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", code)
+	}
+}
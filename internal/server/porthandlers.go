@@ -0,0 +1,87 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+// portHandlers gives each proxy listener a handler configured by the
+// annotations of the service that owns its port (see proxy.PortConfig). Ports
+// without overrides share the base handler. A port's handler is built on its
+// first request and kept, with its rate limit state, until a reload changes
+// the port's annotations.
+type portHandlers struct {
+	base *proxy.Handler
+
+	mu    sync.Mutex
+	ports map[int]*portHandler
+}
+
+type portHandler struct {
+	config  proxy.PortConfig
+	handler *proxy.Handler // nil until the port's first request
+}
+
+func newPortHandlers(base *proxy.Handler, serviceInfos []services.ServiceInfo) *portHandlers {
+	p := &portHandlers{base: base, ports: map[int]*portHandler{}}
+	p.update(serviceInfos)
+	return p
+}
+
+// update reads the port configs from the services' annotations. A service
+// with invalid annotations is proxied with the shared settings.
+func (p *portHandlers) update(serviceInfos []services.ServiceInfo) {
+	configs := make(map[int]proxy.PortConfig)
+	for _, service := range serviceInfos {
+		config, err := proxy.PortConfigFromAnnotations(service.Annotations)
+		if err != nil {
+			slog.Warn("Invalid proxy annotations, using the shared proxy settings",
+				"service", service.Name, "namespace", service.Namespace, "error", err)
+			continue
+		}
+		if config != (proxy.PortConfig{}) {
+			configs[service.ListenPort()] = config
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for port, current := range p.ports {
+		if config, ok := configs[port]; !ok || config != current.config {
+			delete(p.ports, port)
+		}
+	}
+	for port, config := range configs {
+		if _, ok := p.ports[port]; !ok {
+			p.ports[port] = &portHandler{config: config}
+			slog.Info("Proxying port with its service's settings", "port", port, "config", config)
+		}
+	}
+}
+
+// handler returns the handler requests to port are served by
+func (p *portHandlers) handler(port int) *proxy.Handler {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current, ok := p.ports[port]
+	if !ok {
+		return p.base
+	}
+	if current.handler == nil {
+		current.handler = p.base.ForPort(port, current.config)
+	}
+	return current.handler
+}
+
+// forPort returns the handler to start port's listener with. It looks the
+// port's handler up per request, so reloads that change the annotations apply
+// without restarting the listener.
+func (p *portHandlers) forPort(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.handler(port).ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+func TestPortHandlers(t *testing.T) {
+	base := proxy.NewHandler(nil, proxySettingsFromEnv(t))
+	serviceInfos := []services.ServiceInfo{
+		{Name: "api", Namespace: "default", NodePort: 30080, Annotations: map[string]string{proxy.AnnotationTimeout: "5s"}},
+		{Name: "reports", Namespace: "default", NodePort: 30081, Annotations: map[string]string{proxy.AnnotationTimeout: "10m"}},
+		{Name: "web", Namespace: "default", NodePort: 30082},
+		{Name: "broken", Namespace: "default", NodePort: 30083, Annotations: map[string]string{proxy.AnnotationTimeout: "soon"}},
+	}
+	handlers := newPortHandlers(base, serviceInfos)
+
+	timeout := func(port int) time.Duration {
+		return handlers.handler(port).Timeouts().Resolve("http", strconv.Itoa(port))
+	}
+	if got := timeout(30080); got != 5*time.Second {
+		t.Errorf("Expected 5s on port 30080, got %v", got)
+	}
+	if got := timeout(30081); got != 10*time.Minute {
+		t.Errorf("Expected 10m on port 30081, got %v", got)
+	}
+	for _, port := range []int{30082, 30083} {
+		if handlers.handler(port) != base {
+			t.Errorf("Expected port %d to use the shared handler", port)
+		}
+	}
+
+	t.Run("ReloadKeepsUnchangedHandlers", func(t *testing.T) {
+		api := handlers.handler(30080)
+		serviceInfos[1].Annotations = map[string]string{proxy.AnnotationTimeout: "1m"}
+		handlers.update(serviceInfos)
+
+		if handlers.handler(30080) != api {
+			t.Error("Expected port 30080 to keep its handler")
+		}
+		if got := timeout(30081); got != time.Minute {
+			t.Errorf("Expected the changed annotation to apply to port 30081, got %v", got)
+		}
+	})
+
+	t.Run("ReloadDropsRemovedAnnotations", func(t *testing.T) {
+		serviceInfos[0].Annotations = nil
+		handlers.update(serviceInfos)
+
+		if handlers.handler(30080) != base {
+			t.Error("Expected port 30080 to fall back to the shared handler")
+		}
+	})
+}
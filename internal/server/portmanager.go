@@ -5,47 +5,188 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"k8s-node-proxy/internal/config"
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/proxyproto"
 )
 
 type PortListener struct {
 	port     int
 	server   *http.Server
+	https    bool
 	shutdown chan struct{}
 	done     chan struct{}
+
+	// proxyProtocol are the load balancers whose PROXY headers must start every
+	// connection (PROXY_PROTOCOL); nil serves connections directly
+	proxyProtocol []netip.Prefix
+
+	// shutdownTimeout is how long open connections may finish before they are closed
+	shutdownTimeout time.Duration
+	// conns counts open client connections; forced is how many were still open
+	// when shutdownTimeout passed, set before done is closed
+	conns  atomic.Int64
+	forced int
+
+	// mu guards the listening socket, which drain closes while the server keeps
+	// serving the connections it already accepted
+	mu       sync.Mutex
+	listener net.Listener
+	draining bool
 }
 
 type PortManager struct {
+	mu        sync.RWMutex
 	listeners map[int]*PortListener
+
+	// keepAlives controls HTTP keep-alive on proxy port connections (PROXY_DISABLE_KEEPALIVE)
+	keepAlives bool
+
+	// proxyProtocol takes client addresses from PROXY headers sent by the L4
+	// load balancers in these ranges (PROXY_PROTOCOL, PROXY_PROTOCOL_TRUSTED_CIDRS);
+	// nil when off. directPorts are served without it.
+	proxyProtocol []netip.Prefix
+	directPorts   map[int]bool
+
+	// listenAddress is the host every port binds to, empty for all interfaces (LISTEN_ADDRESS)
+	listenAddress string
+
+	// timeouts bound how long a client connection may take, guarding against slow clients
+	timeouts serverTimeouts
+
+	// tls terminates client TLS when a certificate is configured (TLS_CERT_FILE/TLS_KEY_FILE)
+	tls *listenerTLS
+	// tlsErr is returned by StartPort when the certificate can't be loaded, so
+	// ports meant for HTTPS are never served in plain text
+	tlsErr error
+
+	// draining is set by Drain; no ports are started afterwards
+	draining bool
 }
 
-func NewPortManager() *PortManager {
+// ErrDraining is returned by StartPort once the port manager is draining
+var ErrDraining = errors.New("port manager is draining")
+
+// serverTimeouts are the http.Server timeouts applied to every port. Zero means
+// no limit, except for shutdown where it closes connections immediately.
+type serverTimeouts struct {
+	readHeader time.Duration
+	read       time.Duration
+	write      time.Duration
+	idle       time.Duration
+	shutdown   time.Duration
+}
+
+// NewPortManager creates a port manager serving ports as listeners configures.
+// The TLS certificate is loaded here; if that fails, StartPort returns the error.
+func NewPortManager(listeners config.Listeners) *PortManager {
+	listenerTLS, tlsErr := newListenerTLS(listeners.TLSCertFile, listeners.TLSKeyFile, listeners.TLSPorts)
+	if tlsErr != nil {
+		slog.Error("Failed to load the TLS certificate, no ports will be started", "error", tlsErr)
+	}
+
 	return &PortManager{
-		listeners: make(map[int]*PortListener),
+		listeners:     make(map[int]*PortListener),
+		keepAlives:    listeners.KeepAlives,
+		proxyProtocol: listeners.ProxyProtocol,
+		directPorts:   make(map[int]bool),
+		listenAddress: listeners.Address,
+		timeouts: serverTimeouts{
+			readHeader: listeners.ReadHeaderTimeout,
+			read:       listeners.ReadTimeout,
+			write:      listeners.WriteTimeout,
+			idle:       listeners.IdleTimeout,
+			shutdown:   listeners.ShutdownTimeout,
+		},
+		tls:    listenerTLS,
+		tlsErr: tlsErr,
 	}
 }
 
+// ServeWithoutProxyProtocol serves port's connections directly even when
+// PROXY_PROTOCOL is on. The management port needs it for kubelet probes, which
+// come from the node rather than through the load balancer. Call it before
+// the port is started.
+func (pm *PortManager) ServeWithoutProxyProtocol(port int) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.directPorts[port] = true
+}
+
 func (pm *PortManager) StartPort(port int, handler http.Handler) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if err := ValidatePort(port); err != nil {
+		return err
+	}
+
+	if pm.tlsErr != nil {
+		return pm.tlsErr
+	}
+
+	if pm.draining {
+		return ErrDraining
+	}
 	if _, exists := pm.listeners[port]; exists {
 		return fmt.Errorf("port %d already listening", port)
 	}
 
 	listener := &PortListener{
-		port:     port,
-		server:   &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: handler},
+		port: port,
+		server: &http.Server{
+			Addr:              net.JoinHostPort(pm.listenAddress, strconv.Itoa(port)),
+			Handler:           handler,
+			ReadHeaderTimeout: pm.timeouts.readHeader,
+			ReadTimeout:       pm.timeouts.read,
+			WriteTimeout:      pm.timeouts.write,
+			IdleTimeout:       pm.timeouts.idle,
+		},
+		https:    pm.tls.serves(port),
 		shutdown: make(chan struct{}),
 		done:     make(chan struct{}),
+
+		shutdownTimeout: pm.timeouts.shutdown,
+	}
+	if !pm.directPorts[port] {
+		listener.proxyProtocol = pm.proxyProtocol
+	}
+	listener.server.ConnState = listener.trackConn
+	// The proxy handler routes by the listener's port, not the Host header
+	listener.server.BaseContext = func(net.Listener) context.Context {
+		return proxy.WithListenerPort(context.Background(), port)
+	}
+	listener.server.ConnContext = proxy.WithClientConn
+	listener.server.SetKeepAlivesEnabled(pm.keepAlives)
+	// Cleartext HTTP/2 (h2c) lets gRPC clients reach the proxy without TLS
+	listener.server.Protocols = new(http.Protocols)
+	listener.server.Protocols.SetHTTP1(true)
+	listener.server.Protocols.SetHTTP2(true)
+	listener.server.Protocols.SetUnencryptedHTTP2(true)
+	if listener.https {
+		listener.server.TLSConfig = pm.tls.config()
 	}
 
 	go listener.start()
 	pm.listeners[port] = listener
-	slog.Info("Started listening on port", "port", port)
+	slog.Info("Started listening on port", "port", port, "address", listener.server.Addr, "tls", listener.https)
 	return nil
 }
 
+// StopPort stops listening on port, giving in-flight requests SHUTDOWN_TIMEOUT to finish
 func (pm *PortManager) StopPort(port int) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
 	listener, exists := pm.listeners[port]
 	if !exists {
 		return fmt.Errorf("port %d not listening", port)
@@ -58,7 +199,56 @@ func (pm *PortManager) StopPort(port int) error {
 	return nil
 }
 
+// Reconcile makes the listening ports match ports: it starts the missing ones
+// with the handler handlerFor returns for them and stops those no longer wanted, leaving listeners on ports that
+// stay untouched. The keep ports (such as the service port) are never stopped.
+// It returns the ports it started and stopped.
+func (pm *PortManager) Reconcile(ports []int, handlerFor func(port int) http.Handler, keep ...int) (started, stopped []int) {
+	wanted := make(map[int]bool, len(ports)+len(keep))
+	for _, port := range keep {
+		wanted[port] = true
+	}
+
+	current := make(map[int]bool)
+	for _, port := range pm.GetListeningPorts() {
+		current[port] = true
+	}
+
+	for _, port := range ports {
+		if wanted[port] {
+			continue
+		}
+		wanted[port] = true
+		if current[port] {
+			continue
+		}
+		if err := pm.StartPort(port, handlerFor(port)); err != nil {
+			slog.Error("Failed to start port listener", "port", port, "error", err)
+			continue
+		}
+		started = append(started, port)
+	}
+
+	for port := range current {
+		if wanted[port] {
+			continue
+		}
+		if err := pm.StopPort(port); err != nil {
+			slog.Error("Failed to stop port listener", "port", port, "error", err)
+			continue
+		}
+		stopped = append(stopped, port)
+	}
+
+	slices.Sort(started)
+	slices.Sort(stopped)
+	return started, stopped
+}
+
 func (pm *PortManager) GetListeningPorts() []int {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
 	var ports []int
 	for port := range pm.listeners {
 		ports = append(ports, port)
@@ -66,7 +256,13 @@ func (pm *PortManager) GetListeningPorts() []int {
 	return ports
 }
 
-func (pm *PortManager) StopAll() {
+// StopAll stops every port in parallel, giving in-flight requests
+// SHUTDOWN_TIMEOUT to finish. It returns how many connections were still
+// active when the timeout passed and had to be closed.
+func (pm *PortManager) StopAll() int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
 	var wg sync.WaitGroup
 	for port, listener := range pm.listeners {
 		wg.Add(1)
@@ -78,24 +274,130 @@ func (pm *PortManager) StopAll() {
 		}(port, listener)
 	}
 	wg.Wait()
+
+	forced := 0
+	for _, listener := range pm.listeners {
+		forced += listener.forced
+	}
 	pm.listeners = make(map[int]*PortListener)
+	return forced
+}
+
+// Drain stops accepting connections on every port except keep (such as the
+// service port, which still answers probes), for taking the proxy out of
+// rotation before it is stopped. Requests on connections already accepted
+// finish, keep-alive is turned off so those connections close afterwards, and
+// no ports are started from now on. It returns the ports it drained.
+func (pm *PortManager) Drain(keep ...int) []int {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.draining {
+		return nil
+	}
+	pm.draining = true
+
+	var drained []int
+	for port, listener := range pm.listeners {
+		if slices.Contains(keep, port) {
+			continue
+		}
+		listener.drain()
+		drained = append(drained, port)
+	}
+	slices.Sort(drained)
+	slog.Info("Draining: stopped accepting connections", "ports", drained)
+	return drained
+}
+
+// Draining reports whether Drain has been called
+func (pm *PortManager) Draining() bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.draining
 }
 
 func (l *PortListener) start() {
 	defer close(l.done)
 
 	go func() {
-		if err := l.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		if err := l.serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			slog.Error("Port server error", "port", l.port, "error", err)
 		}
 	}()
 
 	<-l.shutdown
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), l.shutdownTimeout)
 	defer cancel()
 
 	if err := l.server.Shutdown(ctx); err != nil {
-		slog.Error("Port forced shutdown", "port", l.port, "error", err)
+		// Shutdown only waits; connections still busy must be closed explicitly
+		l.forced = int(l.conns.Load())
+		slog.Warn("Shutdown timeout reached, closing active connections",
+			"port", l.port, "timeout", l.shutdownTimeout, "active_connections", l.forced)
+		l.server.Close()
+	}
+}
+
+// serve listens on the port and serves it until the server shuts down or the
+// listener is drained
+func (l *PortListener) serve() error {
+	listener, err := net.Listen("tcp", l.server.Addr)
+	if err != nil {
+		return err
+	}
+	if l.proxyProtocol != nil {
+		// The header comes before the TLS handshake, so it is read from the raw connection
+		listener = proxyproto.NewListener(listener, l.server.ReadHeaderTimeout, l.proxyProtocol)
+	}
+
+	l.mu.Lock()
+	if l.draining {
+		l.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	l.listener = listener
+	l.mu.Unlock()
+
+	if l.https {
+		// The certificate comes from TLSConfig.GetCertificate
+		err = l.server.ServeTLS(listener, "", "")
+	} else {
+		err = l.server.Serve(listener)
+	}
+	if errors.Is(err, net.ErrClosed) && l.isDraining() {
+		return nil
+	}
+	return err
+}
+
+// drain closes the listening socket so new connections are refused, while the
+// server keeps serving the connections it has
+func (l *PortListener) drain() {
+	l.server.SetKeepAlivesEnabled(false)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.draining = true
+	if l.listener != nil {
+		l.listener.Close()
+	}
+}
+
+func (l *PortListener) isDraining() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.draining
+}
+
+// trackConn counts open connections so a forced shutdown can report how many it cut
+func (l *PortListener) trackConn(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		l.conns.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		l.conns.Add(-1)
 	}
 }
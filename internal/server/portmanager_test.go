@@ -1,13 +1,39 @@
 package server
 
 import (
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"testing"
 	"time"
+
+	"k8s-node-proxy/internal/config"
+	"k8s-node-proxy/internal/proxy"
 )
 
+// listenersFromEnv reads the listener settings the test's environment configures
+func listenersFromEnv(t testing.TB) config.Listeners {
+	t.Helper()
+	listeners, err := config.ListenersFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to read the listener settings: %v", err)
+	}
+	return listeners
+}
+
+// proxySettingsFromEnv reads the proxy settings the test's environment configures
+func proxySettingsFromEnv(t testing.TB) proxy.Settings {
+	t.Helper()
+	settings, err := proxy.SettingsFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to read the proxy settings: %v", err)
+	}
+	return settings
+}
+
 func TestNewPortManager(t *testing.T) {
-	pm := NewPortManager()
+	pm := NewPortManager(listenersFromEnv(t))
 
 	if pm == nil {
 		t.Fatal("Expected PortManager, got nil")
@@ -18,7 +44,7 @@ func TestNewPortManager(t *testing.T) {
 }
 
 func TestGetListeningPorts_Empty(t *testing.T) {
-	pm := NewPortManager()
+	pm := NewPortManager(listenersFromEnv(t))
 
 	ports := pm.GetListeningPorts()
 	if len(ports) != 0 {
@@ -28,7 +54,7 @@ func TestGetListeningPorts_Empty(t *testing.T) {
 
 func TestStartPort_DuplicatePort(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-	pm := NewPortManager()
+	pm := NewPortManager(listenersFromEnv(t))
 
 	// Start first port
 	err := pm.StartPort(8080, handler)
@@ -53,7 +79,7 @@ func TestStartPort_DuplicatePort(t *testing.T) {
 }
 
 func TestStopPort_NonExistentPort(t *testing.T) {
-	pm := NewPortManager()
+	pm := NewPortManager(listenersFromEnv(t))
 
 	err := pm.StopPort(9999)
 	if err == nil {
@@ -66,7 +92,7 @@ func TestStopPort_NonExistentPort(t *testing.T) {
 
 func TestGetListeningPorts_WithPorts(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-	pm := NewPortManager()
+	pm := NewPortManager(listenersFromEnv(t))
 
 	// Start some ports
 	ports := []int{8081, 8082, 8083}
@@ -103,7 +129,7 @@ func TestGetListeningPorts_WithPorts(t *testing.T) {
 
 func TestStopAll(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-	pm := NewPortManager()
+	pm := NewPortManager(listenersFromEnv(t))
 
 	// Start multiple ports
 	ports := []int{8084, 8085, 8086}
@@ -135,7 +161,7 @@ func TestStopAll(t *testing.T) {
 
 func TestStartStop_SinglePort(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
-	pm := NewPortManager()
+	pm := NewPortManager(listenersFromEnv(t))
 
 	port := 8087
 
@@ -168,4 +194,265 @@ func TestStartStop_SinglePort(t *testing.T) {
 	if len(listeningPorts) != 0 {
 		t.Errorf("Expected 0 listening ports after stop, got %d", len(listeningPorts))
 	}
-}
\ No newline at end of file
+}
+func TestStartPort_KeepAliveDisabled(t *testing.T) {
+	t.Setenv("PROXY_DISABLE_KEEPALIVE", "true")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	pm := NewPortManager(listenersFromEnv(t))
+
+	port := 8088
+	if err := pm.StartPort(port, handler); err != nil {
+		t.Fatalf("Failed to start port %d: %v", port, err)
+	}
+	defer pm.StopAll()
+
+	// Give it a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/", port))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if !resp.Close {
+		t.Error("Expected the connection to be closed with PROXY_DISABLE_KEEPALIVE=true")
+	}
+}
+
+func TestStartPort_ListenAddress(t *testing.T) {
+	t.Setenv("LISTEN_ADDRESS", "127.0.0.1")
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	pm := NewPortManager(listenersFromEnv(t))
+
+	port := 8089
+	if err := pm.StartPort(port, handler); err != nil {
+		t.Fatalf("Failed to start port %d: %v", port, err)
+	}
+	defer pm.StopAll()
+
+	if addr := pm.listeners[port].server.Addr; addr != "127.0.0.1:8089" {
+		t.Errorf("Expected listener address 127.0.0.1:8089, got %s", addr)
+	}
+
+	// Give it a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/", port))
+	if err != nil {
+		t.Fatalf("Expected port to be reachable on 127.0.0.1: %v", err)
+	}
+	resp.Body.Close()
+}
+
+// TestStartPort_ReadHeaderTimeout tests that a client dribbling its request
+// headers is disconnected once the header timeout passes
+func TestStartPort_ReadHeaderTimeout(t *testing.T) {
+	t.Setenv("SERVER_READ_HEADER_TIMEOUT", "200ms")
+
+	pm := NewPortManager(listenersFromEnv(t))
+	port := 8091
+	if err := pm.StartPort(port, http.NotFoundHandler()); err != nil {
+		t.Fatalf("Failed to start port %d: %v", port, err)
+	}
+	defer pm.StopAll()
+
+	// Give it a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	// Send an incomplete request and never finish the headers
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n")); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("Expected the server to close the connection, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected disconnect after about 200ms, took %v", elapsed)
+	}
+}
+
+// TestStopAll_ShutdownTimeout tests that in-flight requests get SHUTDOWN_TIMEOUT
+// to finish and connections still busy after it are closed and counted
+func TestStopAll_ShutdownTimeout(t *testing.T) {
+	t.Setenv("SHUTDOWN_TIMEOUT", "1s")
+
+	// Answers after the delay in the query, e.g. /?delay=300ms
+	slowHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, _ := time.ParseDuration(r.URL.Query().Get("delay"))
+		time.Sleep(delay)
+		io.WriteString(w, "done")
+	})
+
+	startSlowRequest := func(port int, delay string) <-chan error {
+		result := make(chan error, 1)
+		go func() {
+			resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/?delay=%s", port, delay))
+			if err == nil {
+				_, err = io.ReadAll(resp.Body)
+				resp.Body.Close()
+			}
+			result <- err
+		}()
+		// Let the request reach the handler before shutting down
+		time.Sleep(100 * time.Millisecond)
+		return result
+	}
+
+	t.Run("FinishesWithinGrace", func(t *testing.T) {
+		pm := NewPortManager(listenersFromEnv(t))
+		port := 8094
+		if err := pm.StartPort(port, slowHandler); err != nil {
+			t.Fatalf("Failed to start port %d: %v", port, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		result := startSlowRequest(port, "500ms")
+		if forced := pm.StopAll(); forced != 0 {
+			t.Errorf("Expected no connections to be cut, got %d", forced)
+		}
+		if err := <-result; err != nil {
+			t.Errorf("Expected the in-flight request to complete, got %v", err)
+		}
+	})
+
+	t.Run("ClosedAfterGrace", func(t *testing.T) {
+		pm := NewPortManager(listenersFromEnv(t))
+		port := 8095
+		if err := pm.StartPort(port, slowHandler); err != nil {
+			t.Fatalf("Failed to start port %d: %v", port, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		result := startSlowRequest(port, "5s")
+		start := time.Now()
+		forced := pm.StopAll()
+		elapsed := time.Since(start)
+
+		if forced != 1 {
+			t.Errorf("Expected 1 connection to be cut, got %d", forced)
+		}
+		if elapsed < 800*time.Millisecond || elapsed > 3*time.Second {
+			t.Errorf("Expected shutdown to wait about 1s, took %v", elapsed)
+		}
+		if err := <-result; err == nil {
+			t.Error("Expected the request to fail once its connection was closed")
+		}
+	})
+}
+
+func TestStartPort_ListenerPortInContext(t *testing.T) {
+	got := make(chan int, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		port, _ := proxy.ListenerPort(r.Context())
+		got <- port
+	})
+	pm := NewPortManager(listenersFromEnv(t))
+
+	port := 8100
+	if err := pm.StartPort(port, handler); err != nil {
+		t.Fatalf("Failed to start port %d: %v", port, err)
+	}
+	defer pm.StopAll()
+
+	// Give it a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	// A load balancer in front rewrote Host to a standard port
+	req, _ := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/", port), nil)
+	req.Host = "app.example.com"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if listenerPort := <-got; listenerPort != port {
+		t.Errorf("Expected listener port %d in the request context, got %d", port, listenerPort)
+	}
+}
+
+func TestStartPort_ProxyProtocol(t *testing.T) {
+	t.Setenv("PROXY_PROTOCOL", "true")
+	t.Setenv("PROXY_PROTOCOL_TRUSTED_CIDRS", "127.0.0.1")
+	got := make(chan string, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.RemoteAddr
+	})
+	pm := NewPortManager(listenersFromEnv(t))
+
+	port := 8113
+	if err := pm.StartPort(port, handler); err != nil {
+		t.Fatalf("Failed to start port %d: %v", port, err)
+	}
+	defer pm.StopAll()
+
+	// Give it a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	// An L4 load balancer puts the client's address in front of the request
+	fmt.Fprintf(conn, "PROXY TCP4 198.51.100.4 10.0.0.1 50000 %d\r\nGET / HTTP/1.1\r\nHost: app.example.com\r\n\r\n", port)
+
+	select {
+	case remoteAddr := <-got:
+		if remoteAddr != "198.51.100.4:50000" {
+			t.Errorf("Expected the client address from the PROXY header, got %s", remoteAddr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the request")
+	}
+}
+
+// TestStartPort_ProxyProtocolRequired tests that with PROXY_PROTOCOL on, a
+// connection without a header is refused, except on the management port
+func TestStartPort_ProxyProtocolRequired(t *testing.T) {
+	t.Setenv("PROXY_PROTOCOL", "true")
+	t.Setenv("PROXY_PROTOCOL_TRUSTED_CIDRS", "127.0.0.1")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.RemoteAddr)
+	})
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+
+	const proxyPort, managementPort = 8116, 8117
+	pm.ServeWithoutProxyProtocol(managementPort)
+	for _, port := range []int{proxyPort, managementPort} {
+		if err := pm.StartPort(port, handler); err != nil {
+			t.Fatalf("Failed to start port %d: %v", port, err)
+		}
+	}
+
+	// Give it a moment to start
+	time.Sleep(10 * time.Millisecond)
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	if resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", proxyPort)); err == nil {
+		resp.Body.Close()
+		t.Errorf("Expected a request without a PROXY header to be refused, got %s", resp.Status)
+	}
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/", managementPort))
+	if err != nil {
+		t.Fatalf("Expected the management port to serve requests without a header: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 from the management port, got %d", resp.StatusCode)
+	}
+}
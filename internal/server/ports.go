@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// ValidatePort rejects ports a listener can't bind: anything outside 1-65535
+func ValidatePort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("port %d is out of range 1-65535", port)
+	}
+	return nil
+}
+
+// ValidPorts returns the discovered ports that can be listened on, warning
+// about and skipping the rest so one malformed service doesn't stop startup.
+// A port discovered more than once is listened on once.
+func ValidPorts(ports []int) []int {
+	valid := make([]int, 0, len(ports))
+	seen := make(map[int]bool, len(ports))
+	for _, port := range ports {
+		if err := ValidatePort(port); err != nil {
+			slog.Warn("Skipping invalid discovered port", "port", port, "error", err)
+			continue
+		}
+		if seen[port] {
+			slog.Warn("Skipping duplicate discovered port", "port", port)
+			continue
+		}
+		seen[port] = true
+		valid = append(valid, port)
+	}
+	return valid
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestValidatePort(t *testing.T) {
+	tests := []struct {
+		port    int
+		wantErr bool
+	}{
+		{-1, true},
+		{0, true},
+		{1, false},
+		{80, false},
+		{65535, false},
+		{65536, true},
+		{70000, true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidatePort(tt.port); (err != nil) != tt.wantErr {
+			t.Errorf("ValidatePort(%d): expected error %v, got %v", tt.port, tt.wantErr, err)
+		}
+	}
+}
+
+func TestValidPorts(t *testing.T) {
+	got := ValidPorts([]int{0, 30001, 65536, 65535, -5, 1, 30001})
+	if want := []int{30001, 65535, 1}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestStartPort_OutOfRange(t *testing.T) {
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+
+	for _, port := range []int{0, 70000} {
+		if err := pm.StartPort(port, http.NotFoundHandler()); err == nil {
+			t.Errorf("Expected an error starting port %d", port)
+		}
+	}
+	if ports := pm.GetListeningPorts(); len(ports) != 0 {
+		t.Errorf("Expected no listeners, got %v", ports)
+	}
+}
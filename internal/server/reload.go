@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+// ServiceLister discovers the services whose ports are proxied
+type ServiceLister interface {
+	DiscoverServices(ctx context.Context) ([]services.ServiceInfo, error)
+}
+
+// NodeReselector re-runs node selection against a fresh node list
+type NodeReselector interface {
+	Rediscover(ctx context.Context) (string, error)
+	SetProbePorts(ports []int)
+}
+
+// Reloader re-discovers services and nodes without a restart, as on SIGHUP.
+// Listeners on ports whose services remain keep serving their connections.
+type Reloader struct {
+	ports       *PortManager
+	services    ServiceLister
+	nodes       NodeReselector // nil when node selection is disabled (TARGET_MODE=clusterip)
+	handler     *proxy.Handler
+	servicePort int
+
+	// portHandlers applies the services' annotations to the listeners of their ports
+	portHandlers *portHandlers
+	// hosts serves every service on one listener when routing by Host; nil otherwise
+	hosts *hostRouter
+
+	// maxListeners caps the proxy listeners besides the service port (MAX_LISTENERS); 0 is no limit
+	maxListeners int
+
+	mu      sync.RWMutex
+	current []services.ServiceInfo
+	// skipped are the discovered ports left without a listener by maxListeners
+	skipped []int
+
+	// onChange are told about reloads that changed the proxied services
+	onChange []func(ServiceChange)
+
+	// endpoints routes ClusterIP services to their pods; nil unless INCLUDE_CLUSTERIP is set
+	endpoints *services.EndpointRouter
+}
+
+// ServiceChange describes a reload that changed the set of proxied services
+type ServiceChange struct {
+	PortsAdded   []int
+	PortsRemoved []int
+	Services     []services.ServiceInfo
+}
+
+// NewReloader creates a Reloader for the proxy listeners started with handler,
+// starting from the services discovered at startup
+func NewReloader(ports *PortManager, lister ServiceLister, nodes NodeReselector, handler *proxy.Handler, servicePort int, initial []services.ServiceInfo) *Reloader {
+	return &Reloader{
+		ports:       ports,
+		services:    lister,
+		nodes:       nodes,
+		handler:     handler,
+		servicePort: servicePort,
+		current:     initial,
+
+		portHandlers: newPortHandlers(handler, initial),
+	}
+}
+
+// ProxyHandler returns the handler to start the proxy listener of port with:
+// the shared handler, with any overrides from the annotations of the service
+// owning the port applied as of the latest reload
+func (r *Reloader) ProxyHandler(port int) http.Handler {
+	if r.hosts != nil && port == r.hosts.port {
+		return r.hosts
+	}
+	return r.portHandlers.forPort(port)
+}
+
+// RouteHosts serves every service on the single listener of port, routed by
+// the Host header under domain, instead of a listener per service port. Call
+// it before ports are started.
+func (r *Reloader) RouteHosts(port int, domain string) {
+	r.hosts = newHostRouter(port, domain, r.portHandlers, r.current)
+}
+
+// ListenPorts returns the proxy ports to listen on for the discovered ports:
+// the host routing port when routing by Host, otherwise the valid ports
+// within MAX_LISTENERS
+func (r *Reloader) ListenPorts(ports []int) []int {
+	if r.hosts != nil {
+		return []int{r.hosts.port}
+	}
+	return r.CapListeners(ValidPorts(ports))
+}
+
+// OnServicesChanged registers fn to be called after each reload that changed
+// the proxied services. Call it before reloads start; fn must not block.
+func (r *Reloader) OnServicesChanged(fn func(ServiceChange)) {
+	r.onChange = append(r.onChange, fn)
+}
+
+// RouteEndpoints keeps router's endpoint-routed services in step with each
+// reload. Call it before reloads start.
+func (r *Reloader) RouteEndpoints(router *services.EndpointRouter) {
+	r.endpoints = router
+}
+
+// LimitListeners caps the proxy listeners at max, not counting the service
+// port; 0 is no limit. Call it before ports are started.
+func (r *Reloader) LimitListeners(max int) {
+	r.maxListeners = max
+}
+
+// CapListeners returns the ports to listen on out of the discovered ports,
+// leaving out those beyond MAX_LISTENERS with a warning. Ports that already
+// have a listener are kept first, so a reload doesn't trade running listeners
+// for new ones; then the lowest ports are taken. The service port is always
+// kept and not counted.
+func (r *Reloader) CapListeners(ports []int) []int {
+	if r.maxListeners <= 0 {
+		r.mu.Lock()
+		r.skipped = nil
+		r.mu.Unlock()
+		return ports
+	}
+
+	listening := make(map[int]bool)
+	for _, port := range r.ports.GetListeningPorts() {
+		listening[port] = true
+	}
+	var kept, candidates []int
+	seen := make(map[int]bool)
+	for _, port := range ports {
+		if seen[port] {
+			continue
+		}
+		seen[port] = true
+		if port == r.servicePort {
+			kept = append(kept, port)
+			continue
+		}
+		candidates = append(candidates, port)
+	}
+	slices.SortFunc(candidates, func(a, b int) int {
+		if listening[a] != listening[b] {
+			if listening[a] {
+				return -1
+			}
+			return 1
+		}
+		return a - b
+	})
+
+	n := min(len(candidates), r.maxListeners)
+	kept = append(kept, candidates[:n]...)
+	skipped := slices.Clone(candidates[n:])
+	slices.Sort(kept)
+	slices.Sort(skipped)
+
+	r.mu.Lock()
+	r.skipped = skipped
+	r.mu.Unlock()
+	if len(skipped) > 0 {
+		slog.Warn("MAX_LISTENERS reached, not listening on some discovered ports; raise MAX_LISTENERS or narrow the proxied services",
+			"max_listeners", r.maxListeners,
+			"discovered_ports", len(candidates),
+			"skipped_ports", skipped)
+	}
+	return kept
+}
+
+// SkippedPorts returns the discovered ports left without a listener by MAX_LISTENERS
+func (r *Reloader) SkippedPorts() []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.skipped
+}
+
+// Services returns the services found by the latest discovery
+func (r *Reloader) Services() []services.ServiceInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
+// Reload lists the services again, re-selects the node and reconciles the
+// proxy listeners with the services' ports. When listing fails nothing changes.
+func (r *Reloader) Reload(ctx context.Context) error {
+	discovered, err := r.services.DiscoverServices(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to discover services: %w", err)
+	}
+
+	var ports []int
+	for _, service := range discovered {
+		ports = append(ports, service.ListenPort())
+	}
+	ports = r.ListenPorts(ports)
+
+	// Name and route new ports before their listeners accept connections
+	r.handler.SetServiceNames(services.ServiceNamesByPort(discovered))
+	r.portHandlers.update(discovered)
+	if r.hosts != nil {
+		r.hosts.update(discovered)
+	}
+	if r.endpoints != nil {
+		r.endpoints.SetServices(discovered)
+	}
+	if r.nodes == nil {
+		r.handler.SetClusterIPTargets(services.ClusterIPTargets(discovered))
+	} else {
+		// Probe only the ports nodes serve, not the endpoint-routed ones
+		r.nodes.SetProbePorts(ValidPorts(services.NodePorts(discovered)))
+		if _, err := r.nodes.Rediscover(ctx); err != nil {
+			slog.Warn("Node re-selection failed, will retry via health monitoring", "error", err)
+		}
+	}
+
+	started, stopped := r.ports.Reconcile(ports, r.ProxyHandler, r.servicePort)
+
+	r.mu.Lock()
+	previous := r.current
+	r.current = discovered
+	r.mu.Unlock()
+
+	changed := len(started) > 0 || len(stopped) > 0 ||
+		!maps.Equal(services.ServiceNamesByPort(previous), services.ServiceNamesByPort(discovered))
+	if changed {
+		change := ServiceChange{PortsAdded: started, PortsRemoved: stopped, Services: discovered}
+		for _, fn := range r.onChange {
+			fn(change)
+		}
+	}
+
+	slog.Info("Reloaded services and nodes",
+		"services", len(discovered),
+		"ports_added", started,
+		"ports_removed", stopped)
+	return nil
+}
+
+// ReloadUntil reloads on every SIGHUP until a signal arrives on quit
+func (r *Reloader) ReloadUntil(ctx context.Context, quit <-chan os.Signal) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-hup:
+			slog.Info("Received SIGHUP, re-discovering services and nodes")
+			if err := r.Reload(ctx); err != nil {
+				slog.Error("Reload failed, keeping current listeners", "error", err)
+			}
+		case <-quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+// fakeServiceLister returns a fixed service list
+type fakeServiceLister struct {
+	services []services.ServiceInfo
+	err      error
+}
+
+func (f *fakeServiceLister) DiscoverServices(context.Context) ([]services.ServiceInfo, error) {
+	return f.services, f.err
+}
+
+// fakeReselector records node re-selections and probe ports
+type fakeReselector struct {
+	reselections int
+	probePorts   []int
+}
+
+func (f *fakeReselector) Rediscover(context.Context) (string, error) {
+	f.reselections++
+	return "10.0.1.1", nil
+}
+
+func (f *fakeReselector) SetProbePorts(ports []int) {
+	f.probePorts = ports
+}
+
+func nodePortServices(ports ...int32) []services.ServiceInfo {
+	var infos []services.ServiceInfo
+	for _, port := range ports {
+		infos = append(infos, services.ServiceInfo{Name: "svc", Namespace: "default", Port: 80, NodePort: port})
+	}
+	return infos
+}
+
+func listeningPorts(pm *PortManager) []int {
+	ports := pm.GetListeningPorts()
+	slices.Sort(ports)
+	return ports
+}
+
+func TestReload(t *testing.T) {
+	const servicePort = 8096
+
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+	handler := proxy.NewHandler(nil, proxySettingsFromEnv(t))
+	if err := pm.StartPort(servicePort, handler); err != nil {
+		t.Fatalf("Failed to start service port: %v", err)
+	}
+	if err := pm.StartPort(8097, handler); err != nil {
+		t.Fatalf("Failed to start proxy port: %v", err)
+	}
+	kept := pm.listeners[8097]
+
+	lister := &fakeServiceLister{services: nodePortServices(8097, 8098)}
+	reselector := &fakeReselector{}
+	reloader := NewReloader(pm, lister, reselector, handler, servicePort, nodePortServices(8097))
+
+	t.Run("NewPortsAppear", func(t *testing.T) {
+		if err := reloader.Reload(context.Background()); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+
+		if got := listeningPorts(pm); !slices.Equal(got, []int{8096, 8097, 8098}) {
+			t.Errorf("Expected ports [8096 8097 8098], got %v", got)
+		}
+		if pm.listeners[8097] != kept {
+			t.Error("Expected the listener on a port that stays to be left running")
+		}
+		if len(reloader.Services()) != 2 {
+			t.Errorf("Expected 2 services after reload, got %d", len(reloader.Services()))
+		}
+		if reselector.reselections != 1 {
+			t.Errorf("Expected node re-selection, got %d", reselector.reselections)
+		}
+		if !slices.Equal(reselector.probePorts, []int{8097, 8098}) {
+			t.Errorf("Expected probe ports [8097 8098], got %v", reselector.probePorts)
+		}
+	})
+
+	t.Run("RemovedPortsStop", func(t *testing.T) {
+		lister.services = nodePortServices(8098)
+		if err := reloader.Reload(context.Background()); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+
+		// The service port is never a proxy port, so it keeps running
+		if got := listeningPorts(pm); !slices.Equal(got, []int{8096, 8098}) {
+			t.Errorf("Expected ports [8096 8098], got %v", got)
+		}
+	})
+
+	t.Run("DiscoveryErrorKeepsListeners", func(t *testing.T) {
+		lister.err = errors.New("api unavailable")
+		if err := reloader.Reload(context.Background()); err == nil {
+			t.Error("Expected an error when discovery fails")
+		}
+
+		if got := listeningPorts(pm); !slices.Equal(got, []int{8096, 8098}) {
+			t.Errorf("Expected ports [8096 8098] to keep running, got %v", got)
+		}
+		if len(reloader.Services()) != 1 {
+			t.Errorf("Expected the previous services to be kept, got %d", len(reloader.Services()))
+		}
+	})
+}
+
+// TestReconcile_KeepPortsNeverStarted tests that a kept port listed among the
+// proxy ports isn't started a second time with the proxy handler
+func TestReconcile_KeepPortsNeverStarted(t *testing.T) {
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+
+	started, stopped := pm.Reconcile([]int{8099, 8099}, func(int) http.Handler { return proxy.NewHandler(nil, proxySettingsFromEnv(t)) }, 8099)
+	if len(started) != 0 || len(stopped) != 0 {
+		t.Errorf("Expected no changes, got started %v, stopped %v", started, stopped)
+	}
+	if got := pm.GetListeningPorts(); len(got) != 0 {
+		t.Errorf("Expected no listeners, got %v", got)
+	}
+}
+
+// TestReloadNodeSelectionDisabled tests that ClusterIP mode reloads without a
+// node selector
+func TestReloadNodeSelectionDisabled(t *testing.T) {
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+
+	lister := &fakeServiceLister{services: []services.ServiceInfo{
+		{Name: "api", Namespace: "default", ClusterIP: "10.96.0.10", Port: 8099},
+	}}
+	reloader := NewReloader(pm, lister, nil, proxy.NewClusterIPHandler(nil, proxySettingsFromEnv(t)), 8096, nil)
+	if err := reloader.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got := pm.GetListeningPorts(); !slices.Equal(got, []int{8099}) {
+		t.Errorf("Expected port 8099, got %v", got)
+	}
+}
+
+// TestReload_MaxListeners tests that ports discovered beyond MAX_LISTENERS are
+// skipped and logged, and that a reload keeps the ports already listening
+func TestReload_MaxListeners(t *testing.T) {
+	const servicePort = 8108
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(previous)
+
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+	lister := &fakeServiceLister{services: nodePortServices(8111, 8109, 8110, 8112)}
+	reloader := NewReloader(pm, lister, &fakeReselector{}, proxy.NewHandler(nil, proxySettingsFromEnv(t)), servicePort, nil)
+	reloader.LimitListeners(2)
+
+	// The service port is always listened on and doesn't count
+	ports := reloader.CapListeners([]int{servicePort, 8111, 8109, 8110, 8112})
+	if !slices.Equal(ports, []int{servicePort, 8109, 8110}) {
+		t.Errorf("Expected ports [8108 8109 8110], got %v", ports)
+	}
+	if got := reloader.SkippedPorts(); !slices.Equal(got, []int{8111, 8112}) {
+		t.Errorf("Expected ports [8111 8112] to be skipped, got %v", got)
+	}
+	if !strings.Contains(logs.String(), "MAX_LISTENERS reached") || !strings.Contains(logs.String(), "skipped_ports=\"[8111 8112]\"") {
+		t.Errorf("Expected a warning naming the skipped ports, got %q", logs.String())
+	}
+
+	t.Run("ReloadKeepsListeningPorts", func(t *testing.T) {
+		if err := pm.StartPort(8112, proxy.NewHandler(nil, proxySettingsFromEnv(t))); err != nil {
+			t.Fatalf("Failed to start proxy port: %v", err)
+		}
+		if err := reloader.Reload(context.Background()); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+
+		if got := listeningPorts(pm); !slices.Equal(got, []int{8109, 8112}) {
+			t.Errorf("Expected ports [8109 8112], got %v", got)
+		}
+		if got := reloader.SkippedPorts(); !slices.Equal(got, []int{8110, 8111}) {
+			t.Errorf("Expected ports [8110 8111] to be skipped, got %v", got)
+		}
+	})
+
+	t.Run("NoLimit", func(t *testing.T) {
+		reloader.LimitListeners(0)
+		if err := reloader.Reload(context.Background()); err != nil {
+			t.Fatalf("Reload failed: %v", err)
+		}
+		if got := listeningPorts(pm); !slices.Equal(got, []int{8109, 8110, 8111, 8112}) {
+			t.Errorf("Expected all discovered ports, got %v", got)
+		}
+		if got := reloader.SkippedPorts(); len(got) != 0 {
+			t.Errorf("Expected no skipped ports, got %v", got)
+		}
+	})
+}
@@ -10,7 +10,13 @@ import (
 	"syscall"
 	"time"
 
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/option"
+
 	"k8s-node-proxy/internal/assets"
+	"k8s-node-proxy/internal/config"
+	"k8s-node-proxy/internal/discovery"
+	"k8s-node-proxy/internal/metrics"
 	"k8s-node-proxy/internal/nodes"
 	"k8s-node-proxy/internal/proxy"
 	"k8s-node-proxy/internal/services"
@@ -20,75 +26,208 @@ type Server struct {
 	projectID       string
 	servicePort     int
 	portManager     *PortManager
-	nodeDiscovery   *services.NodePortDiscovery
-	nodeIPDiscovery *nodes.NodeDiscovery
+	nodeDiscovery   discovery.ServiceDiscoverer
+	nodeIPDiscovery discovery.NodeDiscoverer
 	serverInfo      *ServerInfo
+	reloader        *Reloader
+	startup         StartupState
+	events          *EventStream
+	config          ConfigAPI
+	cfg             *config.Config
 }
 
-func New(projectID string, servicePort int) (*Server, error) {
+// New creates a server for the GKE project in cfg
+func New(cfg *config.Config) (*Server, error) {
+	projectID, servicePort := cfg.ProjectID, cfg.ServicePort
 	slog.Info("Initializing k8s-node-proxy server", "project", projectID, "service_port", servicePort)
 
-	nodeIPDiscovery, err := nodes.New(projectID)
+	// Node and NodePort discovery share the preferred clusters, so a failover
+	// to the next cluster moves both
+	ctx := context.Background()
+	containerSvc, err := container.NewService(ctx, option.WithScopes(container.CloudPlatformScope))
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create container service: %w", err)
+	}
+	clusters, err := services.ConnectGKEClusters(ctx, containerSvc, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build K8s config: %w", err)
 	}
 
-	nodePortDiscovery, err := services.NewNodePortDiscovery(projectID)
+	nodeIPDiscovery, err := nodes.New(projectID, clusters)
 	if err != nil {
 		return nil, err
 	}
 
-	server := &Server{
-		projectID:       projectID,
-		servicePort:     servicePort,
-		nodeDiscovery:   nodePortDiscovery,
-		nodeIPDiscovery: nodeIPDiscovery,
-		serverInfo:      nil, // Will be populated during Run()
+	nodePortDiscovery, err := services.NewNodePortDiscoveryForClusters(projectID, clusters)
+	if err != nil {
+		return nil, err
 	}
+	nodePortDiscovery.SetDiscoveryOptions(cfg.Discovery)
 
-	// Create port manager
-	portManager := NewPortManager()
-	server.portManager = portManager
-
+	server := newServer(cfg, nodePortDiscovery, nodeIPDiscovery)
 	slog.Info("Server initialization completed successfully")
 	return server, nil
 }
 
+// newServer creates a server running on the given service and node discoveries
+func newServer(cfg *config.Config, nodeDiscovery discovery.ServiceDiscoverer, nodeIPDiscovery discovery.NodeDiscoverer) *Server {
+	return &Server{
+		projectID:       cfg.ProjectID,
+		servicePort:     cfg.ServicePort,
+		cfg:             cfg,
+		portManager:     NewPortManager(cfg.Listeners),
+		nodeDiscovery:   nodeDiscovery,
+		nodeIPDiscovery: nodeIPDiscovery,
+		serverInfo:      nil, // Will be populated during Run()
+	}
+}
+
 func (s *Server) Run() error {
 	ctx := context.Background()
 
+	targetMode := s.cfg.Discovery.TargetMode
+	includeClusterIP := s.cfg.Discovery.IncludeClusterIP
+	managementPrefix := s.cfg.ManagementPathPrefix
+	var webhook *EventWebhook
+	if s.cfg.EventWebhookURL != "" {
+		webhook = NewEventWebhook(s.cfg.EventWebhookURL, s.cfg.EventWebhookTimeout)
+		defer webhook.Close()
+	}
+	var kubeEvents *KubeEvents
+	if s.cfg.KubeEvents {
+		kubeEvents = NewKubeEvents(s.nodeDiscovery.GetClientset(), s.cfg.PodNamespace, s.cfg.PodName, s.cfg.PodUID)
+		defer kubeEvents.Close()
+	}
+
 	// Collect server info
 	if err := s.collectServerInfo(ctx); err != nil {
 		return fmt.Errorf("failed to collect server info: %w", err)
 	}
 
+	if s.cfg.DryRun {
+		// Report what would be proxied, then exit without listening or monitoring
+		var selector InitialNodeSelector
+		if targetMode == services.TargetModeNodePort {
+			selector = s.nodeIPDiscovery
+		}
+		_, err := PlanDryRun(ctx, s.nodeDiscovery, selector, s.serverInfo.Services, targetMode, s.servicePort)
+		return err
+	}
+
 	// Create handlers
-	serviceHandler := s.createServiceHandler()
-	proxyHandler := proxy.NewHandler(s.nodeIPDiscovery)
+	if s.cfg.LiveUpdates {
+		s.events = NewEventStream(s.homepageData)
+	}
+	proxyHandler := proxy.NewHandler(s.nodeIPDiscovery, s.cfg.Proxy)
+	if targetMode == services.TargetModeClusterIP {
+		// Forward straight to ClusterIP:port - node selection is not used
+		slog.Info("Running in ClusterIP target mode, node selection disabled")
+		proxyHandler = proxy.NewClusterIPHandler(services.ClusterIPTargets(s.serverInfo.Services), s.cfg.Proxy)
+	}
+	s.config = ConfigAPI{
+		Config: Config{
+			Platform:             "gcp",
+			Cluster:              s.serverInfo.ClusterName,
+			Namespace:            s.serverInfo.Namespace,
+			TargetMode:           targetMode,
+			IncludeClusterIP:     includeClusterIP,
+			ServicePort:          s.servicePort,
+			ManagementPathPrefix: managementPrefix,
+			LiveUpdates:          s.cfg.LiveUpdates,
+			MaxListeners:         s.cfg.MaxListeners,
+			HostRoutingDomain:    s.cfg.HostRoutingDomain,
+			HostRoutingPort:      s.cfg.HostRoutingPort,
+			EventWebhookURL:      webhook.RedactedURL(),
+			KubeEvents:           kubeEvents != nil,
+			AdminToken:           RedactSecret(s.cfg.AdminToken),
+		},
+		Ports: s.portManager,
+		Proxy: proxyHandler,
+	}
+	if targetMode == services.TargetModeNodePort {
+		s.config.Nodes = s.nodeIPDiscovery
+	}
+	serviceHandler := s.createServiceHandler(targetMode)
+	proxyHandler.SetServiceNames(services.ServiceNamesByPort(s.serverInfo.Services))
+	if managementPrefix != "" {
+		// The service port proxies too, with management moved under the prefix
+		slog.Info("Serving management under a path prefix, proxying the rest of the service port", "prefix", managementPrefix)
+		serviceHandler = ShareServicePort(managementPrefix, serviceHandler, proxyHandler)
+	}
 
-	// Start the configured service port for homepage
+	// SIGHUP re-discovers services and nodes, reusing the proxy handler
+	var reselector NodeReselector
+	if targetMode == services.TargetModeNodePort {
+		reselector = s.nodeIPDiscovery
+	}
+	s.reloader = NewReloader(s.portManager, s.nodeDiscovery, reselector, proxyHandler, s.servicePort, s.serverInfo.Services)
+	s.reloader.LimitListeners(s.cfg.MaxListeners)
+	if s.cfg.HostRoutingDomain != "" {
+		slog.Info("Routing services by Host on a single listener", "port", s.cfg.HostRoutingPort, "domain", s.cfg.HostRoutingDomain)
+		s.reloader.RouteHosts(s.cfg.HostRoutingPort, s.cfg.HostRoutingDomain)
+	}
+	if includeClusterIP && targetMode == services.TargetModeNodePort {
+		// ClusterIP services go straight to their pods instead of through the selected node
+		slog.Info("Routing ClusterIP services to their endpoints")
+		endpoints := services.NewEndpointRouter(s.nodeDiscovery.GetClientset())
+		endpoints.SetServices(s.serverInfo.Services)
+		proxyHandler.SetEndpointResolver(endpoints)
+		s.reloader.RouteEndpoints(endpoints)
+	}
+	if webhook != nil {
+		s.reloader.OnServicesChanged(webhook.ServicesChanged)
+	}
+	if kubeEvents != nil {
+		s.reloader.OnServicesChanged(kubeEvents.ServicesChanged)
+	}
+
+	// Start the configured service port for homepage. Kubelet probes reach it
+	// directly, not through a load balancer sending PROXY headers.
+	s.portManager.ServeWithoutProxyProtocol(s.servicePort)
 	if err := s.portManager.StartPort(s.servicePort, serviceHandler); err != nil {
 		slog.Error("Failed to start homepage service port", "port", s.servicePort, "error", err)
 	}
 
-	// Trigger initial node selection (with timeout to prevent hanging)
-	nodeCtx, nodeCancel := context.WithTimeout(ctx, 10*time.Second)
-	if _, err := s.nodeIPDiscovery.GetCurrentNodeIP(nodeCtx); err != nil {
-		slog.Warn("Failed to select initial node, will retry via health monitoring", "error", err)
-	} else {
-		slog.Info("Initial node selected", "node", s.nodeIPDiscovery.GetCurrentNodeName())
-	}
-	nodeCancel()
+	// Not ready until a node is selected and the proxy listeners are up
+	s.startup.Advance(PhaseDiscovering)
 
-	// Start health monitoring for node IP discovery
-	s.nodeIPDiscovery.StartHealthMonitoring()
-	slog.Info("Started node health monitoring")
+	if targetMode == services.TargetModeNodePort {
+		// Subscribe before the initial selection so its event is logged too
+		go LogNodeEvents(s.nodeIPDiscovery.Subscribe())
+		if webhook != nil {
+			go webhook.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		if kubeEvents != nil {
+			go kubeEvents.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		if s.events != nil {
+			go s.events.ForwardNodeEvents(s.nodeIPDiscovery.Subscribe())
+		}
+		go proxyHandler.DrainOnFailover(s.nodeIPDiscovery.Subscribe())
+
+		// Trigger initial node selection (with timeout to prevent hanging)
+		nodeCtx, nodeCancel := context.WithTimeout(ctx, 10*time.Second)
+		if _, err := s.nodeIPDiscovery.GetCurrentNodeIP(nodeCtx); err != nil {
+			slog.Warn("Failed to select initial node, will retry via health monitoring", "error", err)
+		} else {
+			slog.Info("Initial node selected", "node", s.nodeIPDiscovery.GetCurrentNodeName())
+		}
+		nodeCancel()
+
+		// Start health monitoring for node IP discovery
+		s.nodeIPDiscovery.StartHealthMonitoring()
+		slog.Info("Started node health monitoring")
+	}
 
 	// Discover NodePorts once at startup
 	ports, err := s.nodeDiscovery.DiscoverNodePorts(ctx)
 	if err != nil {
 		return err
 	}
+	ports = s.reloader.ListenPorts(ports)
+	if targetMode == services.TargetModeNodePort {
+		s.nodeIPDiscovery.SetProbePorts(ValidPorts(services.NodePorts(s.serverInfo.Services)))
+	}
 
 	slog.Info("Starting proxy listeners", "port_count", len(ports))
 
@@ -97,22 +236,25 @@ func (s *Server) Run() error {
 		if port == s.servicePort {
 			continue // Already started above
 		}
-		if err := s.portManager.StartPort(port, proxyHandler); err != nil {
+		if err := s.portManager.StartPort(port, s.reloader.ProxyHandler(port)); err != nil {
 			slog.Error("Failed to start port listener", "port", port, "error", err)
 		}
 	}
 
 	slog.Info("All proxy listeners started successfully")
+	s.startup.Advance(PhaseReady)
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	s.reloader.ReloadUntil(ctx, quit)
 
 	slog.Info("Shutting down server...")
 	slog.Info("Stopping health monitoring...")
 	s.nodeIPDiscovery.StopHealthMonitoring()
 	slog.Info("Health monitoring stopped, stopping port listeners...")
-	s.portManager.StopAll()
+	if forced := s.portManager.StopAll(); forced > 0 {
+		slog.Warn("Closed connections still active after SHUTDOWN_TIMEOUT", "connections", forced)
+	}
 	slog.Info("Server shutdown complete")
 	return nil
 }
@@ -120,17 +262,17 @@ func (s *Server) Run() error {
 func (s *Server) collectServerInfo(ctx context.Context) error {
 	slog.Info("Collecting server information")
 
-	// Get cluster info
-	clusterInfo := s.nodeDiscovery.GetClusterInfo()
-
 	// Get services info
 	services, err := s.nodeDiscovery.DiscoverServices(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to discover services: %w", err)
 	}
 
+	// Get cluster info, after the first API call may have failed over to another preferred cluster
+	clusterInfo := s.nodeDiscovery.GetClusterInfo()
+
 	// Get node IPs
-	nodeIPs, err := s.getAllNodeIPs(ctx)
+	nodeIPs, err := s.nodeIPDiscovery.GetAllNodeIPs(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get node IPs: %w", err)
 	}
@@ -159,7 +301,7 @@ func (s *Server) collectServerInfo(ctx context.Context) error {
 		ClusterName:     clusterInfo.Name,
 		ClusterLocation: clusterInfo.Location,
 		K8sEndpoint:     clusterInfo.Endpoint,
-		Namespace:       os.Getenv("NAMESPACE"),
+		Namespace:       s.cfg.Discovery.Namespace,
 		NodeIPs:         nodeIPs,
 		Services:        services,
 		CurrentNode:     currentNodeInfo,
@@ -170,18 +312,31 @@ func (s *Server) collectServerInfo(ctx context.Context) error {
 	return nil
 }
 
-func (s *Server) getAllNodeIPs(ctx context.Context) ([]string, error) {
-	// For now, just get the current node IP
-	// Could be enhanced to get all node IPs
-	nodeIP, err := s.nodeIPDiscovery.GetCurrentNodeIP(ctx)
-	if err != nil {
-		return nil, err
+func (s *Server) createServiceHandler(targetMode services.TargetMode) http.Handler {
+	mux := http.NewServeMux()
+
+	health := Health{Startup: &s.startup}
+	readiness := Readiness{Ports: s.portManager, ServicePort: s.servicePort, Startup: &s.startup}
+	if targetMode == services.TargetModeNodePort {
+		health.Nodes = s.nodeIPDiscovery
+		readiness.Nodes = s.nodeIPDiscovery
 	}
-	return []string{nodeIP}, nil
-}
 
-func (s *Server) createServiceHandler() http.Handler {
-	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/livez", HandleLivez)
+	mux.Handle("/readyz", readiness)
+	if targetMode == services.TargetModeNodePort {
+		mux.Handle("/api/nodes", NodesAPI{Nodes: s.nodeIPDiscovery})
+		mux.Handle("/admin/failover", RequireAdminToken(s.cfg.AdminToken, FailoverAPI{Nodes: s.nodeIPDiscovery}))
+		mux.Handle("/admin/nodes", RequireAdminToken(s.cfg.AdminToken, NodesAPI{Nodes: s.nodeIPDiscovery}))
+		mux.Handle("/admin/select", RequireAdminToken(s.cfg.AdminToken, SelectAPI{Nodes: s.nodeIPDiscovery}))
+	}
+	mux.Handle("/admin/drain", RequireAdminToken(s.cfg.AdminToken, DrainAPI{Ports: s.portManager, ServicePort: s.servicePort}))
+	mux.Handle("/admin/config", RequireAdminToken(s.cfg.AdminToken, s.config))
+	mux.Handle("/status", StatusAPI{Data: s.homepageData})
+	if s.events != nil {
+		mux.Handle("/events", s.events)
+	}
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
@@ -196,7 +351,7 @@ func (s *Server) createServiceHandler() http.Handler {
 			return
 		}
 		if path == "/health" {
-			s.handleHealth(w, r)
+			health.ServeHTTP(w, r)
 			return
 		}
 
@@ -204,20 +359,5 @@ func (s *Server) createServiceHandler() http.Handler {
 		http.Error(w, fmt.Sprintf("Not Found - This is the management interface on port %d", s.servicePort), http.StatusNotFound)
 	})
 
-	return mux
-}
-
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	// Use ONLY cached data - NO API calls, NO blocking
-	currentNodeName := s.nodeIPDiscovery.GetCurrentNodeName()
-
-	// Build simple response with cached info only
-	response := fmt.Sprintf(`{
-		"proxy_server": "healthy",
-		"current_node_name": "%s"
-	}`, currentNodeName)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(response))
+	return RequireManagementAuth(s.cfg.AdminToken, mux)
 }
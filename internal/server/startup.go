@@ -0,0 +1,58 @@
+package server
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// StartupPhase is how far the server has got through its startup sequence
+type StartupPhase int32
+
+const (
+	// PhaseInitializing covers collecting cluster information before any port listens
+	PhaseInitializing StartupPhase = iota
+	// PhaseDiscovering covers initial node selection, NodePort discovery and
+	// starting the proxy listeners; the management port is already serving
+	PhaseDiscovering
+	// PhaseReady is reached once every proxy listener has been started
+	PhaseReady
+)
+
+func (p StartupPhase) String() string {
+	switch p {
+	case PhaseInitializing:
+		return "initializing"
+	case PhaseDiscovering:
+		return "discovering"
+	case PhaseReady:
+		return "ready"
+	default:
+		return "unknown"
+	}
+}
+
+// StartupState tracks the startup phase; its zero value is PhaseInitializing.
+// It is safe for concurrent use, so probes can read it while Run advances it.
+type StartupState struct {
+	phase atomic.Int32
+}
+
+// Phase returns the current startup phase
+func (s *StartupState) Phase() StartupPhase {
+	return StartupPhase(s.phase.Load())
+}
+
+// Advance moves to phase. Startup only moves forward: advancing to the current
+// or an earlier phase does nothing and returns false.
+func (s *StartupState) Advance(phase StartupPhase) bool {
+	for {
+		current := s.phase.Load()
+		if int32(phase) <= current {
+			return false
+		}
+		if s.phase.CompareAndSwap(current, int32(phase)) {
+			slog.Info("Startup phase changed", "from", StartupPhase(current).String(), "to", phase.String())
+			return true
+		}
+	}
+}
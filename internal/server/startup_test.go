@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStartupState_Transitions(t *testing.T) {
+	var state StartupState
+	if state.Phase() != PhaseInitializing {
+		t.Fatalf("Expected to start in %s, got %s", PhaseInitializing, state.Phase())
+	}
+
+	if !state.Advance(PhaseDiscovering) || state.Phase() != PhaseDiscovering {
+		t.Errorf("Expected to advance to %s, got %s", PhaseDiscovering, state.Phase())
+	}
+	if state.Advance(PhaseDiscovering) {
+		t.Error("Expected advancing to the current phase to do nothing")
+	}
+	if !state.Advance(PhaseReady) || state.Phase() != PhaseReady {
+		t.Errorf("Expected to advance to %s, got %s", PhaseReady, state.Phase())
+	}
+	if state.Advance(PhaseInitializing) || state.Phase() != PhaseReady {
+		t.Errorf("Expected startup never to move backwards, got %s", state.Phase())
+	}
+}
+
+func TestReadiness_StartupPhases(t *testing.T) {
+	const servicePort = 8102
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+
+	var startup StartupState
+	readiness := Readiness{Nodes: &fakeNodeNames{name: "node-1"}, Ports: pm, ServicePort: servicePort, Startup: &startup}
+	if err := pm.StartPort(8103, handler); err != nil {
+		t.Fatalf("Failed to start proxy port: %v", err)
+	}
+
+	readyz := func() (int, map[string]string) {
+		w := httptest.NewRecorder()
+		readiness.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode /readyz response: %v", err)
+		}
+		return w.Code, body
+	}
+
+	// A node and a listener alone are not enough while startup is still running
+	startup.Advance(PhaseDiscovering)
+	code, body := readyz()
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 during %s, got %d", PhaseDiscovering, code)
+	}
+	if body["phase"] != "discovering" {
+		t.Errorf("Expected phase discovering, got %q", body["phase"])
+	}
+
+	startup.Advance(PhaseReady)
+	code, body = readyz()
+	if code != http.StatusOK || body["phase"] != "ready" {
+		t.Errorf("Expected 200 in phase ready, got %d %v", code, body)
+	}
+}
+
+func TestHealth_Starting(t *testing.T) {
+	var startup StartupState
+	health := Health{Startup: &startup}
+
+	status := func() string {
+		w := httptest.NewRecorder()
+		health.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var body healthResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Failed to decode /health response: %v", err)
+		}
+		return body.ProxyServer
+	}
+
+	if got := status(); got != "starting" {
+		t.Errorf("Expected proxy_server starting before startup completes, got %q", got)
+	}
+	startup.Advance(PhaseReady)
+	if got := status(); got != "healthy" {
+		t.Errorf("Expected proxy_server healthy once ready, got %q", got)
+	}
+}
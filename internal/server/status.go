@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrServerInfoNotCollected is returned by homepage data sources until startup
+// has gathered the cluster information
+var ErrServerInfoNotCollected = errors.New("server info not yet collected")
+
+// HomepageDataSource gathers the data shown on the homepage and served by /status
+type HomepageDataSource func(ctx context.Context) (HomepageData, error)
+
+// statusResponse is the /status JSON body
+type statusResponse struct {
+	Platform            string             `json:"platform"`
+	ClusterInfo         []statusField      `json:"cluster_info"`
+	Namespace           string             `json:"namespace"`
+	CurrentNode         *statusCurrentNode `json:"current_node"`
+	Nodes               []statusNode       `json:"nodes"`
+	NodesStale          bool               `json:"nodes_stale"`
+	NodesStaleSince     *time.Time         `json:"nodes_stale_since,omitempty"`
+	Services            []statusService    `json:"services"`
+	SkippedPorts        []int              `json:"skipped_ports,omitempty"`
+	HealthCheckInterval string             `json:"health_check_interval"`
+	FailureThreshold    int                `json:"failure_threshold"`
+	MaxFailoverTime     string             `json:"max_failover_time"`
+}
+
+type statusField struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type statusCurrentNode struct {
+	Name   string `json:"name"`
+	IP     string `json:"ip"`
+	Status string `json:"status"`
+}
+
+type statusNode struct {
+	Name         string    `json:"name"`
+	IP           string    `json:"ip"`
+	Status       string    `json:"status"`
+	CreationTime time.Time `json:"creation_time"`
+	LastCheck    time.Time `json:"last_check"`
+}
+
+type statusService struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	NodePort   int32  `json:"node_port"`
+	Port       int32  `json:"port"`
+	PortName   string `json:"port_name,omitempty"`
+	ClusterIP  string `json:"cluster_ip"`
+	TargetPort int32  `json:"target_port"`
+	Protocol   string `json:"protocol"`
+	Endpoints  bool   `json:"endpoints,omitempty"`
+}
+
+// StatusAPI serves /status: the homepage data as JSON
+type StatusAPI struct {
+	Data HomepageDataSource
+}
+
+func (a StatusAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	data, err := a.Data(ctx)
+	if errors.Is(err, ErrServerInfoNotCollected) {
+		writeProbeResponse(w, http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeProbeResponse(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(newStatusResponse(data))
+}
+
+func newStatusResponse(data HomepageData) statusResponse {
+	response := statusResponse{
+		Platform:            data.PlatformName,
+		ClusterInfo:         make([]statusField, 0, len(data.ClusterInfo)),
+		Namespace:           data.Namespace,
+		Nodes:               make([]statusNode, 0, len(data.AllNodes)),
+		Services:            make([]statusService, 0, len(data.Services)),
+		SkippedPorts:        data.SkippedPorts,
+		HealthCheckInterval: data.HealthCheckInterval.String(),
+		FailureThreshold:    data.FailureThreshold,
+		MaxFailoverTime:     data.MaxFailoverTime().String(),
+	}
+	for _, field := range data.ClusterInfo {
+		response.ClusterInfo = append(response.ClusterInfo, statusField{Key: field.Key, Value: field.Value})
+	}
+	if data.NodesStale() {
+		response.NodesStale = true
+		response.NodesStaleSince = &data.NodesStaleSince
+	}
+	if data.CurrentNode != nil {
+		response.CurrentNode = &statusCurrentNode{
+			Name:   data.CurrentNode.Name,
+			IP:     data.CurrentNode.IP,
+			Status: data.CurrentNode.Status,
+		}
+	}
+	for _, node := range data.AllNodes {
+		response.Nodes = append(response.Nodes, statusNode{
+			Name:         node.Name,
+			IP:           node.IP,
+			Status:       node.Status.String(),
+			CreationTime: node.CreationTime,
+			LastCheck:    node.LastCheck,
+		})
+	}
+	for _, svc := range data.Services {
+		// Annotations are left out; they may hold more than the proxy settings
+		response.Services = append(response.Services, statusService{
+			Name:       svc.Name,
+			Namespace:  svc.Namespace,
+			NodePort:   svc.NodePort,
+			Port:       svc.Port,
+			PortName:   svc.PortName,
+			ClusterIP:  svc.ClusterIP,
+			TargetPort: svc.TargetPort,
+			Protocol:   svc.Protocol,
+			Endpoints:  svc.Endpoints,
+		})
+	}
+
+	return response
+}
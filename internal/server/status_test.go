@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/services"
+)
+
+func TestStatusAPI(t *testing.T) {
+	data := HomepageData{
+		PlatformName: "GKE",
+		ClusterInfo:  []ClusterInfoField{{Key: "Cluster Name", Value: "prod"}},
+		Namespace:    "default",
+		CurrentNode:  &CurrentNodeInfo{Name: "node-1", IP: "10.0.1.1", Status: "healthy"},
+		AllNodes: []nodes.NodeInfo{
+			{Name: "node-1", IP: "10.0.1.1", Status: nodes.NodeHealthy},
+			{Name: "node-2", IP: "10.0.1.2", Status: nodes.NodeUnhealthy},
+		},
+		Services:            []services.ServiceInfo{{Name: "web", Namespace: "default", NodePort: 30080, Protocol: "TCP"}},
+		HealthCheckInterval: 15 * time.Second,
+		FailureThreshold:    2,
+	}
+	api := StatusAPI{Data: func(context.Context) (HomepageData, error) { return data, nil }}
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected application/json, got %q", ct)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode /status: %v", err)
+	}
+	for _, field := range []string{"platform", "cluster_info", "namespace", "current_node", "nodes", "services", "health_check_interval", "failure_threshold", "max_failover_time"} {
+		if _, ok := body[field]; !ok {
+			t.Errorf("Expected field %q in /status", field)
+		}
+	}
+
+	var status statusResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode /status: %v", err)
+	}
+	if status.CurrentNode == nil || status.CurrentNode.Name != "node-1" {
+		t.Errorf("Unexpected current node: %+v", status.CurrentNode)
+	}
+	if len(status.Nodes) != 2 || status.Nodes[0].Status != "healthy" || status.Nodes[1].Status != "unhealthy" {
+		t.Errorf("Expected readable node statuses, got %+v", status.Nodes)
+	}
+	if len(status.Services) != 1 || status.Services[0].NodePort != 30080 {
+		t.Errorf("Unexpected services: %+v", status.Services)
+	}
+	if status.MaxFailoverTime != "30s" {
+		t.Errorf("Expected max failover time 30s, got %q", status.MaxFailoverTime)
+	}
+}
+
+func TestStatusAPI_StaleNodes(t *testing.T) {
+	staleSince := time.Now().Add(-time.Minute).UTC()
+	api := StatusAPI{Data: func(context.Context) (HomepageData, error) {
+		return HomepageData{
+			AllNodes:        []nodes.NodeInfo{{Name: "node-1", IP: "10.0.1.1", Status: nodes.NodeHealthy}},
+			NodesStaleSince: staleSince,
+		}, nil
+	}}
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	var status statusResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to decode /status: %v", err)
+	}
+	if !status.NodesStale {
+		t.Error("Expected nodes_stale to be true")
+	}
+	if status.NodesStaleSince == nil || !status.NodesStaleSince.Equal(staleSince) {
+		t.Errorf("Expected nodes_stale_since %v, got %v", staleSince, status.NodesStaleSince)
+	}
+}
+
+func TestStatusAPI_NotCollected(t *testing.T) {
+	api := StatusAPI{Data: func(context.Context) (HomepageData, error) {
+		return HomepageData{}, ErrServerInfoNotCollected
+	}}
+
+	if code := serveProbe(api, "/status"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", code)
+	}
+}
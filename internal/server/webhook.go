@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+)
+
+const (
+	// defaultWebhookTimeout bounds one delivery attempt
+	defaultWebhookTimeout = 5 * time.Second
+
+	// webhookQueueSize is how many undelivered events may wait before further
+	// events are dropped
+	webhookQueueSize = 64
+
+	// ServicesChangedEvent is the webhook event type for a reload that changed the proxied services
+	ServicesChangedEvent = "services_changed"
+)
+
+// WebhookEvent is the JSON body POSTed to EVENT_WEBHOOK_URL. Node events carry
+// the node names; services_changed carries the ports and the services now proxied.
+type WebhookEvent struct {
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	OldNode      string    `json:"old_node,omitempty"`
+	NewNode      string    `json:"new_node,omitempty"`
+	PortsAdded   []int     `json:"ports_added,omitempty"`
+	PortsRemoved []int     `json:"ports_removed,omitempty"`
+	Services     []string  `json:"services,omitempty"`
+}
+
+// EventWebhook delivers node and service events to an external HTTP endpoint.
+// Delivery is best-effort: events are queued without blocking the caller, sent
+// one at a time with a timeout, and dropped when the queue is full or the
+// endpoint fails.
+type EventWebhook struct {
+	url    string
+	client *http.Client
+	queue  chan WebhookEvent
+	stop   context.CancelFunc
+}
+
+// NewEventWebhook starts delivering events to endpoint until Close
+func NewEventWebhook(endpoint string, timeout time.Duration) *EventWebhook {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &EventWebhook{
+		url:    endpoint,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan WebhookEvent, webhookQueueSize),
+		stop:   cancel,
+	}
+	go w.deliver(ctx)
+	return w
+}
+
+// RedactedURL returns the webhook URL without its password and query, which
+// may carry credentials; empty for a nil webhook
+func (w *EventWebhook) RedactedURL() string {
+	if w == nil {
+		return ""
+	}
+	u, err := url.Parse(w.url)
+	if err != nil {
+		return redactedSecret
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redactedSecret
+	}
+	return u.Redacted()
+}
+
+// Close stops delivery; events still queued are dropped
+func (w *EventWebhook) Close() {
+	w.stop()
+}
+
+// ForwardNodeEvents sends every node event to the webhook until the channel is
+// closed; run it in its own goroutine with a channel from the node discovery's Subscribe
+func (w *EventWebhook) ForwardNodeEvents(events <-chan nodes.NodeEvent) {
+	for event := range events {
+		w.Send(WebhookEvent{
+			Type:    string(event.Type),
+			Time:    event.Time,
+			OldNode: event.OldNode,
+			NewNode: event.NewNode,
+		})
+	}
+}
+
+// ServicesChanged sends a services_changed event; pass it to Reloader.OnServicesChanged
+func (w *EventWebhook) ServicesChanged(change ServiceChange) {
+	names := make([]string, 0, len(change.Services))
+	for _, service := range change.Services {
+		names = append(names, service.Namespace+"/"+service.Name)
+	}
+	w.Send(WebhookEvent{
+		Type:         ServicesChangedEvent,
+		Time:         time.Now(),
+		PortsAdded:   change.PortsAdded,
+		PortsRemoved: change.PortsRemoved,
+		Services:     names,
+	})
+}
+
+// Send queues event for delivery without blocking
+func (w *EventWebhook) Send(event WebhookEvent) {
+	select {
+	case w.queue <- event:
+	default:
+		slog.Warn("Dropped webhook event, delivery is not keeping up", "type", event.Type)
+	}
+}
+
+func (w *EventWebhook) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-w.queue:
+			if err := w.post(ctx, event); err != nil {
+				slog.Warn("Failed to deliver webhook event", "type", event.Type, "error", err)
+			}
+		}
+	}
+}
+
+func (w *EventWebhook) post(ctx context.Context, event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/proxy"
+)
+
+// webhookReceiver collects the events POSTed to it
+func webhookReceiver(t *testing.T) (string, <-chan WebhookEvent) {
+	received := make(chan WebhookEvent, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected a JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		var event WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode webhook body: %v", err)
+		}
+		received <- event
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver.URL, received
+}
+
+// nextEvent waits for the first received event of the given type
+func nextEvent(t *testing.T, received <-chan WebhookEvent, eventType string) WebhookEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-received:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for a %s event", eventType)
+		}
+	}
+}
+
+func TestEventWebhook_Failover(t *testing.T) {
+	url, received := webhookReceiver(t)
+	webhook := NewEventWebhook(url, time.Second)
+	defer webhook.Close()
+
+	now := time.Now()
+	discovery, err := nodes.NewGenericNodeDiscovery(fake.NewClientset(
+		readyNode("node-1", "10.0.1.1", now.Add(-2*time.Hour)),
+		readyNode("node-2", "10.0.1.2", now.Add(-time.Hour)),
+	))
+	if err != nil {
+		t.Fatalf("Failed to create node discovery: %v", err)
+	}
+	defer discovery.StopHealthMonitoring()
+	go webhook.ForwardNodeEvents(discovery.Subscribe())
+
+	if _, err := discovery.GetCurrentNodeIP(context.Background()); err != nil {
+		t.Fatalf("Failed to select a node: %v", err)
+	}
+	if _, err := discovery.TriggerFailover(); err != nil {
+		t.Fatalf("Failover failed: %v", err)
+	}
+
+	event := nextEvent(t, received, string(nodes.NodeFailover))
+	if event.OldNode != "node-1" || event.NewNode != "node-2" {
+		t.Errorf("Expected failover from node-1 to node-2, got %+v", event)
+	}
+	if event.Time.IsZero() {
+		t.Error("Expected the event time to be set")
+	}
+}
+
+func TestEventWebhook_ServicesChanged(t *testing.T) {
+	url, received := webhookReceiver(t)
+	webhook := NewEventWebhook(url, time.Second)
+	defer webhook.Close()
+
+	pm := NewPortManager(listenersFromEnv(t))
+	defer pm.StopAll()
+	lister := &fakeServiceLister{services: nodePortServices(8104)}
+	reloader := NewReloader(pm, lister, &fakeReselector{}, proxy.NewHandler(nil, proxySettingsFromEnv(t)), 8090, nil)
+	reloader.OnServicesChanged(webhook.ServicesChanged)
+
+	if err := reloader.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	event := nextEvent(t, received, ServicesChangedEvent)
+	if !slices.Equal(event.PortsAdded, []int{8104}) || len(event.PortsRemoved) != 0 {
+		t.Errorf("Expected port 8104 added, got %+v", event)
+	}
+	if !slices.Equal(event.Services, []string{"default/svc"}) {
+		t.Errorf("Expected services [default/svc], got %v", event.Services)
+	}
+
+	// A reload that changes nothing sends nothing
+	if err := reloader.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	select {
+	case event := <-received:
+		t.Errorf("Expected no event for an unchanged reload, got %+v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestEventWebhook_SendDoesNotBlock(t *testing.T) {
+	// The receiver never answers, so deliveries pile up behind the first one
+	stuck := make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stuck
+	}))
+	defer receiver.Close()
+	defer close(stuck)
+
+	webhook := NewEventWebhook(receiver.URL, time.Minute)
+	defer webhook.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for range webhookQueueSize * 2 {
+			webhook.Send(WebhookEvent{Type: ServicesChangedEvent})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Send not to block when the queue is full")
+	}
+}
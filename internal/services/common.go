@@ -0,0 +1,248 @@
+package services
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// listTimeoutSeconds bounds how long the API server works on a List before
+// giving up, independent of the client-side context
+const listTimeoutSeconds int64 = 30
+
+// serviceListOptions returns the options for listing the namespace's services
+func serviceListOptions() metav1.ListOptions {
+	timeout := listTimeoutSeconds
+	return metav1.ListOptions{TimeoutSeconds: &timeout}
+}
+
+// TargetMode controls which services are discovered and where traffic is sent
+type TargetMode string
+
+const (
+	// TargetModeNodePort proxies NodePort services to the selected node (default)
+	TargetModeNodePort TargetMode = "nodeport"
+	// TargetModeClusterIP proxies ClusterIP services directly to ClusterIP:port,
+	// for in-cluster deployments where no node selection is needed
+	TargetModeClusterIP TargetMode = "clusterip"
+)
+
+// TargetModeFromEnv reads TARGET_MODE (nodeport or clusterip, default nodeport)
+func TargetModeFromEnv() (TargetMode, error) {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("TARGET_MODE")))
+	switch TargetMode(value) {
+	case "", TargetModeNodePort:
+		return TargetModeNodePort, nil
+	case TargetModeClusterIP:
+		return TargetModeClusterIP, nil
+	default:
+		return "", fmt.Errorf("invalid TARGET_MODE value %q: must be nodeport or clusterip", value)
+	}
+}
+
+// DiscoveryOptions select the services a discovery reports
+type DiscoveryOptions struct {
+	// Namespace the services are listed in (NAMESPACE, required)
+	Namespace string
+	// TargetMode picks NodePort or ClusterIP services (TARGET_MODE)
+	TargetMode TargetMode
+	// IncludeClusterIP adds ClusterIP services in nodeport mode (INCLUDE_CLUSTERIP)
+	IncludeClusterIP bool
+}
+
+// DiscoveryOptionsFromEnv reads NAMESPACE, TARGET_MODE and INCLUDE_CLUSTERIP
+func DiscoveryOptionsFromEnv() (DiscoveryOptions, error) {
+	opts := DiscoveryOptions{Namespace: os.Getenv("NAMESPACE")}
+	var err error
+	if opts.TargetMode, err = TargetModeFromEnv(); err != nil {
+		return opts, err
+	}
+	if opts.IncludeClusterIP, err = IncludeClusterIPFromEnv(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// resolveDiscoveryOptions returns opts, or the environment's options for a
+// discovery that was not given any
+func resolveDiscoveryOptions(opts *DiscoveryOptions) (DiscoveryOptions, error) {
+	if opts == nil {
+		fromEnv, err := DiscoveryOptionsFromEnv()
+		if err != nil {
+			return DiscoveryOptions{}, err
+		}
+		opts = &fromEnv
+	}
+	resolved := *opts
+	if resolved.Namespace == "" {
+		return resolved, fmt.Errorf("NAMESPACE environment variable is required")
+	}
+	if resolved.TargetMode == "" {
+		resolved.TargetMode = TargetModeNodePort
+	}
+	return resolved, nil
+}
+
+// IncludeClusterIPFromEnv reads INCLUDE_CLUSTERIP (default false). In nodeport
+// mode it also proxies ClusterIP services, sending their traffic straight to
+// the service's ready pods as listed in its EndpointSlices.
+func IncludeClusterIPFromEnv() (bool, error) {
+	value := os.Getenv("INCLUDE_CLUSTERIP")
+	if value == "" {
+		return false, nil
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid INCLUDE_CLUSTERIP value %q: must be true or false", value)
+	}
+	return include, nil
+}
+
+// ListenPort returns the port the proxy should listen on for this service:
+// the NodePort in nodeport mode, or the service port in clusterip mode
+func (s ServiceInfo) ListenPort() int {
+	if s.NodePort != 0 {
+		return int(s.NodePort)
+	}
+	return int(s.Port)
+}
+
+// NodePorts lists the services' NodePorts, leaving out services that are not
+// reached through a node
+func NodePorts(serviceInfos []ServiceInfo) []int {
+	var ports []int
+	for _, service := range serviceInfos {
+		if service.NodePort != 0 {
+			ports = append(ports, int(service.NodePort))
+		}
+	}
+	return ports
+}
+
+// ClusterIPTargets maps each service port to its ClusterIP for clusterip mode routing
+func ClusterIPTargets(serviceInfos []ServiceInfo) map[int]string {
+	targets := make(map[int]string)
+	for _, service := range serviceInfos {
+		if service.ClusterIP == "" || service.Port == 0 {
+			continue
+		}
+		if _, ok := targets[int(service.Port)]; !ok {
+			targets[int(service.Port)] = service.ClusterIP
+		}
+	}
+	return targets
+}
+
+// ServiceNamesByPort maps each listen port to the "namespace/name" of its service
+// for access logs and metrics. A port keeps the first service that claimed it,
+// like discovery does.
+func ServiceNamesByPort(serviceInfos []ServiceInfo) map[int]string {
+	names := make(map[int]string)
+	for _, service := range serviceInfos {
+		port := service.ListenPort()
+		if port == 0 {
+			continue
+		}
+		if _, ok := names[port]; !ok {
+			names[port] = service.Namespace + "/" + service.Name
+		}
+	}
+	return names
+}
+
+// uniqueListenPorts drops the services whose listen port is already taken by
+// an earlier service, warning about each. One listener can only reach one
+// service, so the first service to claim a port keeps it.
+func uniqueListenPorts(serviceInfos []ServiceInfo) []ServiceInfo {
+	owners := make(map[int]ServiceInfo)
+	unique := serviceInfos[:0]
+	for _, service := range serviceInfos {
+		port := service.ListenPort()
+		if owner, ok := owners[port]; ok {
+			slog.Warn("Skipping service port already used by another service",
+				"port", port,
+				"service", service.Namespace+"/"+service.Name,
+				"used_by", owner.Namespace+"/"+owner.Name)
+			continue
+		}
+		owners[port] = service
+		unique = append(unique, service)
+	}
+	return unique
+}
+
+// collectServiceInfos extracts proxyable service ports for the given target mode;
+// includeClusterIP adds ClusterIP services routed to their pods in nodeport mode.
+func collectServiceInfos(services []corev1.Service, mode TargetMode, includeClusterIP bool) []ServiceInfo {
+	var serviceInfos []ServiceInfo
+	for _, service := range services {
+		switch {
+		case mode == TargetModeClusterIP && service.Spec.Type == corev1.ServiceTypeClusterIP:
+			// Headless services have no virtual IP to forward to
+			if service.Spec.ClusterIP == "" || service.Spec.ClusterIP == corev1.ClusterIPNone {
+				continue
+			}
+			for _, port := range service.Spec.Ports {
+				serviceInfos = append(serviceInfos, ServiceInfo{
+					Name:        service.Name,
+					Namespace:   service.Namespace,
+					Port:        port.Port,
+					ClusterIP:   service.Spec.ClusterIP,
+					TargetPort:  port.TargetPort.IntVal,
+					Protocol:    string(port.Protocol),
+					Annotations: service.Annotations,
+				})
+				slog.Info("Found ClusterIP service",
+					"service", service.Name,
+					"namespace", service.Namespace,
+					"clusterIP", service.Spec.ClusterIP,
+					"port", port.Port)
+			}
+		case mode == TargetModeNodePort && service.Spec.Type == corev1.ServiceTypeNodePort:
+			for _, port := range service.Spec.Ports {
+				if port.NodePort != 0 {
+					serviceInfos = append(serviceInfos, ServiceInfo{
+						Name:        service.Name,
+						Namespace:   service.Namespace,
+						NodePort:    port.NodePort,
+						Port:        port.Port,
+						ClusterIP:   service.Spec.ClusterIP,
+						TargetPort:  port.TargetPort.IntVal,
+						Protocol:    string(port.Protocol),
+						Annotations: service.Annotations,
+					})
+					slog.Info("Found NodePort service",
+						"service", service.Name,
+						"namespace", service.Namespace,
+						"nodePort", port.NodePort,
+						"targetPort", port.TargetPort.IntVal)
+				}
+			}
+		case mode == TargetModeNodePort && includeClusterIP && service.Spec.Type == corev1.ServiceTypeClusterIP:
+			// Pods are reached directly, so headless services work too
+			for _, port := range service.Spec.Ports {
+				serviceInfos = append(serviceInfos, ServiceInfo{
+					Name:        service.Name,
+					Namespace:   service.Namespace,
+					Port:        port.Port,
+					PortName:    port.Name,
+					ClusterIP:   service.Spec.ClusterIP,
+					TargetPort:  port.TargetPort.IntVal,
+					Protocol:    string(port.Protocol),
+					Endpoints:   true,
+					Annotations: service.Annotations,
+				})
+				slog.Info("Found ClusterIP service, routing to its endpoints",
+					"service", service.Name,
+					"namespace", service.Namespace,
+					"port", port.Port)
+			}
+		}
+	}
+	return serviceInfos
+}
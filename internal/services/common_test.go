@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestService(name, serviceType, clusterIP string, port, nodePort int32) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceType(serviceType),
+			ClusterIP: clusterIP,
+			Ports: []corev1.ServicePort{
+				{Port: port, NodePort: nodePort, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+}
+
+func TestTargetModeFromEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    TargetMode
+		wantErr bool
+	}{
+		{"", TargetModeNodePort, false},
+		{"nodeport", TargetModeNodePort, false},
+		{"clusterip", TargetModeClusterIP, false},
+		{"ClusterIP", TargetModeClusterIP, false},
+		{"loadbalancer", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TARGET_MODE", tt.value)
+			mode, err := TargetModeFromEnv()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, mode)
+		})
+	}
+}
+
+func TestDiscoverServices_ClusterIPMode(t *testing.T) {
+	t.Setenv("NAMESPACE", "default")
+	t.Setenv("TARGET_MODE", "clusterip")
+
+	clientset := fake.NewClientset(
+		newTestService("api", "ClusterIP", "10.96.0.10", 8080, 0),
+		newTestService("headless", "ClusterIP", corev1.ClusterIPNone, 9090, 0),
+		newTestService("web", "NodePort", "10.96.0.20", 80, 30001),
+	)
+	discovery := &GenericNodePortDiscovery{k8sClientset: clientset}
+
+	serviceInfos, err := discovery.DiscoverServices(context.Background())
+	require.NoError(t, err)
+	require.Len(t, serviceInfos, 1)
+	assert.Equal(t, "api", serviceInfos[0].Name)
+	assert.Equal(t, "10.96.0.10", serviceInfos[0].ClusterIP)
+	assert.Equal(t, int32(8080), serviceInfos[0].Port)
+
+	ports, err := discovery.DiscoverNodePorts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int{8080}, ports)
+
+	assert.Equal(t, map[int]string{8080: "10.96.0.10"}, ClusterIPTargets(serviceInfos))
+}
+
+func TestDiscoverServices_NodePortModeIgnoresClusterIP(t *testing.T) {
+	t.Setenv("NAMESPACE", "default")
+	t.Setenv("TARGET_MODE", "")
+
+	clientset := fake.NewClientset(
+		newTestService("api", "ClusterIP", "10.96.0.10", 8080, 0),
+		newTestService("web", "NodePort", "10.96.0.20", 80, 30001),
+	)
+	discovery := &GenericNodePortDiscovery{k8sClientset: clientset}
+
+	ports, err := discovery.DiscoverNodePorts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int{30001}, ports)
+}
+
+func TestDiscoverServices_IncludeClusterIP(t *testing.T) {
+	t.Setenv("NAMESPACE", "default")
+	t.Setenv("TARGET_MODE", "")
+	t.Setenv("INCLUDE_CLUSTERIP", "true")
+
+	clientset := fake.NewClientset(
+		newTestService("api", "ClusterIP", "10.96.0.10", 8080, 0),
+		newTestService("headless", "ClusterIP", corev1.ClusterIPNone, 9090, 0),
+		newTestService("web", "NodePort", "10.96.0.20", 80, 30001),
+	)
+	discovery := &GenericNodePortDiscovery{k8sClientset: clientset}
+
+	ports, err := discovery.DiscoverNodePorts(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int{8080, 9090, 30001}, ports)
+
+	serviceInfos, err := discovery.DiscoverServices(context.Background())
+	require.NoError(t, err)
+	for _, service := range serviceInfos {
+		assert.Equal(t, service.Name != "web", service.Endpoints, service.Name)
+	}
+	// Nodes are only probed on the ports they serve
+	assert.Equal(t, []int{30001}, NodePorts(serviceInfos))
+}
+
+func TestServiceNamesByPort(t *testing.T) {
+	names := ServiceNamesByPort([]ServiceInfo{
+		{Name: "web", Namespace: "shop", NodePort: 30080, Port: 80},
+		{Name: "api", Namespace: "shop", NodePort: 30081, Port: 80},
+		{Name: "cache", Namespace: "infra", Port: 6379},
+		{Name: "web-alt", Namespace: "shop", NodePort: 30080, Port: 8080},
+	})
+
+	assert.Equal(t, map[int]string{
+		30080: "shop/web",
+		30081: "shop/api",
+		6379:  "infra/cache",
+	}, names)
+}
+
+// TestDiscoverServices_SamePort tests that of two services on one port only
+// the first is proxied, so the port's listener and names agree on the service
+func TestDiscoverServices_SamePort(t *testing.T) {
+	t.Setenv("NAMESPACE", "default")
+	t.Setenv("TARGET_MODE", "clusterip")
+
+	clientset := fake.NewClientset(
+		newTestService("api", "ClusterIP", "10.96.0.10", 8080, 0),
+		newTestService("api-canary", "ClusterIP", "10.96.0.11", 8080, 0),
+		newTestService("web", "ClusterIP", "10.96.0.20", 80, 0),
+	)
+	discovery := &GenericNodePortDiscovery{k8sClientset: clientset}
+
+	serviceInfos, err := discovery.DiscoverServices(context.Background())
+	require.NoError(t, err)
+	require.Len(t, serviceInfos, 2)
+	assert.Equal(t, "api", serviceInfos[0].Name)
+	assert.Equal(t, "web", serviceInfos[1].Name)
+
+	ports, err := discovery.DiscoverNodePorts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []int{8080, 80}, ports)
+
+	assert.Equal(t, map[int]string{8080: "10.96.0.10", 80: "10.96.0.20"}, ClusterIPTargets(serviceInfos))
+	assert.Equal(t, map[int]string{8080: "default/api", 80: "default/web"}, ServiceNamesByPort(serviceInfos))
+}
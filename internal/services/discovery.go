@@ -2,26 +2,29 @@ package services
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
 	"log/slog"
-	"os"
 
-	"golang.org/x/oauth2/google"
 	"google.golang.org/api/container/v1"
 	"google.golang.org/api/option"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 )
 
 type ServiceInfo struct {
 	Name       string
 	Namespace  string
 	NodePort   int32
+	Port       int32
+	PortName   string
+	ClusterIP  string
 	TargetPort int32
 	Protocol   string
+	// Endpoints is set for ClusterIP services proxied to their pods in nodeport
+	// mode (INCLUDE_CLUSTERIP); their traffic bypasses node selection
+	Endpoints bool
+	// Annotations of the service, which may override proxy settings for its ports
+	Annotations map[string]string
 }
 
 type ClusterInfo struct {
@@ -32,9 +35,11 @@ type ClusterInfo struct {
 
 type NodePortDiscovery struct {
 	projectID    string
-	containerSvc *container.Service
-	k8sClientset *kubernetes.Clientset
-	clusterInfo  *ClusterInfo
+	k8sClientset kubernetes.Interface
+	clusters     *GKEClusters
+
+	// options select the discovered services; nil reads them from the environment
+	options *DiscoveryOptions
 }
 
 func NewNodePortDiscovery(projectID string) (*NodePortDiscovery, error) {
@@ -46,12 +51,17 @@ func NewNodePortDiscovery(projectID string) (*NodePortDiscovery, error) {
 		return nil, fmt.Errorf("failed to create container service: %w", err)
 	}
 
-	config, clusterInfo, err := buildK8sConfig(ctx, containerSvc, projectID)
+	clusters, err := ConnectGKEClusters(ctx, containerSvc, projectID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build K8s config: %w", err)
 	}
+	return NewNodePortDiscoveryForClusters(projectID, clusters)
+}
 
-	k8sClientset, err := kubernetes.NewForConfig(config)
+// NewNodePortDiscoveryForClusters creates a NodePort discovery on the preferred
+// clusters, e.g. ones shared with node discovery
+func NewNodePortDiscoveryForClusters(projectID string, clusters *GKEClusters) (*NodePortDiscovery, error) {
+	k8sClientset, err := kubernetes.NewForConfig(clusters.RestConfig())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create K8s clientset: %w", err)
 	}
@@ -59,74 +69,11 @@ func NewNodePortDiscovery(projectID string) (*NodePortDiscovery, error) {
 	slog.Info("NodePort discovery initialized successfully")
 	return &NodePortDiscovery{
 		projectID:    projectID,
-		containerSvc: containerSvc,
 		k8sClientset: k8sClientset,
-		clusterInfo:  clusterInfo,
+		clusters:     clusters,
 	}, nil
 }
 
-func buildK8sConfig(ctx context.Context, containerSvc *container.Service, projectID string) (*rest.Config, *ClusterInfo, error) {
-	slog.Info("Building Kubernetes client configuration")
-
-	// Get the first cluster in the project
-	clusters, err := containerSvc.Projects.Locations.Clusters.List(
-		fmt.Sprintf("projects/%s/locations/-", projectID)).Context(ctx).Do()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list clusters: %w", err)
-	}
-
-	if len(clusters.Clusters) == 0 {
-		return nil, nil, fmt.Errorf("no clusters found in project %s", projectID)
-	}
-
-	cluster := clusters.Clusters[0]
-	slog.Info("Using cluster for K8s API access", "cluster", cluster.Name, "location", cluster.Location)
-
-	// Use private endpoint for internal VPC connectivity
-	if cluster.PrivateClusterConfig == nil || cluster.PrivateClusterConfig.PrivateEndpoint == "" {
-		return nil, nil, fmt.Errorf("cluster %s does not have a private endpoint configured", cluster.Name)
-	}
-	endpoint := cluster.PrivateClusterConfig.PrivateEndpoint
-	slog.Info("Using private cluster endpoint", "endpoint", endpoint)
-
-	// Create cluster info
-	clusterInfo := &ClusterInfo{
-		Name:     cluster.Name,
-		Location: cluster.Location,
-		Endpoint: endpoint,
-	}
-
-	// Decode cluster CA certificate
-	caCert, err := base64.StdEncoding.DecodeString(cluster.MasterAuth.ClusterCaCertificate)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to decode cluster CA certificate: %w", err)
-	}
-
-	// Get Google default token source (uses ADC)
-	tokenSource, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get default token source: %w", err)
-	}
-
-	// Get a token to use for authentication
-	token, err := tokenSource.Token()
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get token: %w", err)
-	}
-
-	// Build Kubernetes config
-	config := &rest.Config{
-		Host: "https://" + endpoint,
-		TLSClientConfig: rest.TLSClientConfig{
-			CAData: caCert,
-		},
-		BearerToken: token.AccessToken,
-	}
-
-	slog.Info("Kubernetes configuration built successfully", "endpoint", endpoint)
-	return config, clusterInfo, nil
-}
-
 func (d *NodePortDiscovery) DiscoverNodePorts(ctx context.Context) ([]int, error) {
 	services, err := d.DiscoverServices(ctx)
 	if err != nil {
@@ -135,7 +82,7 @@ func (d *NodePortDiscovery) DiscoverNodePorts(ctx context.Context) ([]int, error
 
 	var ports []int
 	for _, service := range services {
-		ports = append(ports, int(service.NodePort))
+		ports = append(ports, service.ListenPort())
 	}
 
 	return ports, nil
@@ -144,46 +91,41 @@ func (d *NodePortDiscovery) DiscoverNodePorts(ctx context.Context) ([]int, error
 func (d *NodePortDiscovery) DiscoverServices(ctx context.Context) ([]ServiceInfo, error) {
 	slog.Info("Obtaining available node ports")
 
-	// Get namespace from environment variable - required
-	namespace := os.Getenv("NAMESPACE")
-	if namespace == "" {
-		return nil, fmt.Errorf("NAMESPACE environment variable is required")
+	opts, err := resolveDiscoveryOptions(d.options)
+	if err != nil {
+		return nil, err
 	}
+	namespace := opts.Namespace
 
-	slog.Info("Discovering services in namespace", "namespace", namespace)
+	slog.Info("Discovering services in namespace", "namespace", namespace, "target_mode", opts.TargetMode)
 
-	services, err := d.k8sClientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	// Services are converted page by page, so only their infos are kept
+	serviceInfos, err := ListAll(ctx, serviceListOptions(), d.k8sClientset.CoreV1().Services(namespace).List,
+		func(page *corev1.ServiceList) []ServiceInfo {
+			return collectServiceInfos(page.Items, opts.TargetMode, opts.IncludeClusterIP)
+		})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list services: %w", err)
-	}
-
-	var serviceInfos []ServiceInfo
-	for _, service := range services.Items {
-		if service.Spec.Type == corev1.ServiceTypeNodePort {
-			for _, port := range service.Spec.Ports {
-				if port.NodePort != 0 {
-					serviceInfo := ServiceInfo{
-						Name:       service.Name,
-						Namespace:  service.Namespace,
-						NodePort:   port.NodePort,
-						TargetPort: port.TargetPort.IntVal,
-						Protocol:   string(port.Protocol),
-					}
-					serviceInfos = append(serviceInfos, serviceInfo)
-					slog.Info("Found NodePort service",
-						"service", service.Name,
-						"namespace", service.Namespace,
-						"nodePort", port.NodePort,
-						"targetPort", port.TargetPort.IntVal)
-				}
-			}
-		}
+		return nil, fmt.Errorf("failed to list services: %w", CheckPermission(err, "list", "services", namespace))
 	}
+	serviceInfos = uniqueListenPorts(serviceInfos)
 
 	slog.Info("NodePort discovery completed", "total_services", len(serviceInfos))
 	return serviceInfos, nil
 }
 
+// SetDiscoveryOptions makes the discovery use opts instead of reading them
+// from the environment on each discovery
+func (d *NodePortDiscovery) SetDiscoveryOptions(opts DiscoveryOptions) {
+	d.options = &opts
+}
+
+// GetClientset returns the Kubernetes clientset used by this discovery
+func (d *NodePortDiscovery) GetClientset() kubernetes.Interface {
+	return d.k8sClientset
+}
+
+// GetClusterInfo returns the cluster discovery currently talks to, which
+// changes after a failover to another preferred cluster
 func (d *NodePortDiscovery) GetClusterInfo() *ClusterInfo {
-	return d.clusterInfo
+	return d.clusters.Current()
 }
@@ -15,7 +15,7 @@ type EKSNodePortDiscovery struct {
 	region       string
 	clusterName  string
 	eksClient    interface{} // *eks.Client - will be concrete type in Phase 2
-	k8sClientset *kubernetes.Clientset
+	k8sClientset kubernetes.Interface
 	clusterInfo  *ClusterInfo
 }
 
@@ -68,7 +68,7 @@ func (d *EKSNodePortDiscovery) DiscoverNodePorts(ctx context.Context) ([]int, er
 
 	var ports []int
 	for _, service := range services {
-		ports = append(ports, int(service.NodePort))
+		ports = append(ports, service.ListenPort())
 	}
 
 	return ports, nil
@@ -100,7 +100,7 @@ func (d *EKSNodePortDiscovery) GetClusterInfo() *ClusterInfo {
 }
 
 // GetClientset returns the Kubernetes clientset for node discovery
-func (d *EKSNodePortDiscovery) GetClientset() *kubernetes.Clientset {
+func (d *EKSNodePortDiscovery) GetClientset() kubernetes.Interface {
 	return d.k8sClientset
 }
 
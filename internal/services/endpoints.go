@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// EndpointRouter sends traffic for ClusterIP services straight to their pods
+// (INCLUDE_CLUSTERIP), without kube-proxy or a NodePort in between. Each
+// request picks the next ready endpoint of the service's EndpointSlices in
+// turn. Slices are watched per namespace, starting with the first service
+// routed there, so clusters that don't use the option need no extra RBAC.
+type EndpointRouter struct {
+	clientset kubernetes.Interface
+	stop      chan struct{}
+
+	// routes maps listen ports to the services routed to their endpoints
+	routes atomic.Pointer[map[int]ServiceInfo]
+	next   atomic.Uint64
+
+	mu       sync.Mutex
+	watchers map[string]*endpointSliceWatcher
+}
+
+// endpointSliceWatcher caches one namespace's EndpointSlices
+type endpointSliceWatcher struct {
+	informer cache.SharedIndexInformer
+	lister   discoverylisters.EndpointSliceLister
+}
+
+// NewEndpointRouter creates a router resolving endpoints through clientset
+func NewEndpointRouter(clientset kubernetes.Interface) *EndpointRouter {
+	r := &EndpointRouter{
+		clientset: clientset,
+		stop:      make(chan struct{}),
+		watchers:  make(map[string]*endpointSliceWatcher),
+	}
+	r.routes.Store(&map[int]ServiceInfo{})
+	return r
+}
+
+// SetServices replaces the routed services with those in serviceInfos marked
+// Endpoints. It may be called again while requests are being routed.
+func (r *EndpointRouter) SetServices(serviceInfos []ServiceInfo) {
+	routes := make(map[int]ServiceInfo)
+	for _, service := range serviceInfos {
+		if !service.Endpoints || service.Port == 0 {
+			continue
+		}
+		r.watch(service.Namespace)
+		routes[service.ListenPort()] = service
+	}
+	r.routes.Store(&routes)
+}
+
+// Stop ends the EndpointSlice watches
+func (r *EndpointRouter) Stop() {
+	close(r.stop)
+}
+
+func (r *EndpointRouter) watch(namespace string) *endpointSliceWatcher {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if w, ok := r.watchers[namespace]; ok {
+		return w
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(r.clientset, 0, informers.WithNamespace(namespace))
+	sliceInformer := factory.Discovery().V1().EndpointSlices()
+	w := &endpointSliceWatcher{
+		informer: sliceInformer.Informer(),
+		lister:   sliceInformer.Lister(),
+	}
+	factory.Start(r.stop)
+	r.watchers[namespace] = w
+	return w
+}
+
+// ResolveEndpoint returns the "ip:port" of a ready pod behind the service
+// routed on port. routed is false for ports not routed to endpoints, which
+// go through the selected node as usual.
+func (r *EndpointRouter) ResolveEndpoint(_ context.Context, port int) (address string, routed bool, err error) {
+	service, ok := (*r.routes.Load())[port]
+	if !ok {
+		return "", false, nil
+	}
+
+	w := r.watch(service.Namespace)
+	if !w.informer.HasSynced() {
+		return "", true, fmt.Errorf("endpoints of service %s/%s are not loaded yet", service.Namespace, service.Name)
+	}
+	endpointSlices, err := w.lister.EndpointSlices(service.Namespace).List(labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: service.Name,
+	}))
+	if err != nil {
+		return "", true, err
+	}
+
+	addresses := readyEndpoints(endpointSlices, service.PortName)
+	if len(addresses) == 0 {
+		return "", true, fmt.Errorf("service %s/%s has no ready endpoints for port %d", service.Namespace, service.Name, service.Port)
+	}
+	return addresses[r.next.Add(1)%uint64(len(addresses))], true, nil
+}
+
+// readyEndpoints lists "ip:port" for each ready endpoint address serving the
+// service port named portName, sorted so the rotation is stable
+func readyEndpoints(endpointSlices []*discoveryv1.EndpointSlice, portName string) []string {
+	var addresses []string
+	for _, slice := range endpointSlices {
+		if slice.AddressType == discoveryv1.AddressTypeFQDN {
+			continue
+		}
+		var targetPort int32
+		for _, port := range slice.Ports {
+			name := ""
+			if port.Name != nil {
+				name = *port.Name
+			}
+			if name == portName && port.Port != nil {
+				targetPort = *port.Port
+				break
+			}
+		}
+		if targetPort == 0 {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			// An unset Ready condition means ready
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+			for _, ip := range endpoint.Addresses {
+				addresses = append(addresses, net.JoinHostPort(ip, strconv.Itoa(int(targetPort))))
+			}
+		}
+	}
+	slices.Sort(addresses)
+	return addresses
+}
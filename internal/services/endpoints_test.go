@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+func newTestEndpointSlice(name, service string, port int32, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports:       []discoveryv1.EndpointPort{{Name: ptr.To("http"), Port: ptr.To(port)}},
+	}
+}
+
+func newTestEndpoint(ip string, ready bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{ip},
+		Conditions: discoveryv1.EndpointConditions{Ready: ptr.To(ready)},
+	}
+}
+
+func TestEndpointRouter_RoundRobinOverReadyPods(t *testing.T) {
+	router := NewEndpointRouter(fake.NewClientset(
+		newTestEndpointSlice("api-a", "api", 8080,
+			newTestEndpoint("10.0.0.1", true),
+			newTestEndpoint("10.0.0.2", false)),
+		newTestEndpointSlice("api-b", "api", 8080,
+			newTestEndpoint("10.0.0.3", true)),
+		newTestEndpointSlice("other-a", "other", 8080,
+			newTestEndpoint("10.0.0.9", true)),
+	))
+	defer router.Stop()
+	router.SetServices([]ServiceInfo{
+		{Name: "api", Namespace: "default", Port: 80, PortName: "http", Endpoints: true},
+		{Name: "web", Namespace: "default", NodePort: 30080, Port: 80},
+	})
+
+	require.Eventually(t, func() bool {
+		_, _, err := router.ResolveEndpoint(context.Background(), 80)
+		return err == nil
+	}, time.Second, time.Millisecond)
+
+	seen := make(map[string]int)
+	for range 4 {
+		address, routed, err := router.ResolveEndpoint(context.Background(), 80)
+		require.NoError(t, err)
+		require.True(t, routed)
+		seen[address]++
+	}
+	assert.Equal(t, map[string]int{"10.0.0.1:8080": 2, "10.0.0.3:8080": 2}, seen)
+
+	_, routed, err := router.ResolveEndpoint(context.Background(), 30080)
+	require.NoError(t, err)
+	assert.False(t, routed, "NodePort services are not routed to endpoints")
+}
+
+func TestEndpointRouter_NoReadyEndpoints(t *testing.T) {
+	router := NewEndpointRouter(fake.NewClientset(
+		newTestEndpointSlice("api-a", "api", 8080, newTestEndpoint("10.0.0.1", false)),
+	))
+	defer router.Stop()
+	router.SetServices([]ServiceInfo{
+		{Name: "api", Namespace: "default", Port: 80, PortName: "http", Endpoints: true},
+	})
+
+	require.Eventually(t, func() bool {
+		_, _, err := router.ResolveEndpoint(context.Background(), 80)
+		return err != nil && err.Error() == "service default/api has no ready endpoints for port 80"
+	}, time.Second, time.Millisecond)
+}
@@ -2,16 +2,22 @@ package services
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
+	"time"
 
+	"golang.org/x/oauth2"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/transport"
 )
 
 // GenericNodePortDiscovery implements service discovery for any Kubernetes cluster using kubeconfig
@@ -20,29 +26,67 @@ type GenericNodePortDiscovery struct {
 	k8sEndpoint  string
 	k8sToken     string
 	k8sCACert    string
-	k8sClientset *kubernetes.Clientset
+	k8sClientset kubernetes.Interface
 	clusterInfo  *ClusterInfo
+
+	// options select the discovered services; nil reads them from the environment
+	options *DiscoveryOptions
 }
 
-// NewGenericNodePortDiscovery creates a new generic Kubernetes service discovery instance
+// NewGenericNodePortDiscovery creates a new generic Kubernetes service discovery
+// instance, with credentials from the environment
 func NewGenericNodePortDiscovery() (*GenericNodePortDiscovery, error) {
+	return NewGenericNodePortDiscoveryWithCredentials(GenericCredentialsFromEnv())
+}
+
+// GenericCredentials select how a generic cluster is reached: a kubeconfig
+// file, else the API server settings if all are set, else the pod's
+// in-cluster service account. The *File variants take precedence over the
+// inline values.
+type GenericCredentials struct {
+	Kubeconfig string
+	Endpoint   string
+	Token      string
+	TokenFile  string
+	CACert     string
+	CACertFile string
+}
+
+// GenericCredentialsFromEnv reads KUBECONFIG and the K8S_* variables
+func GenericCredentialsFromEnv() GenericCredentials {
+	return GenericCredentials{
+		Kubeconfig: os.Getenv("KUBECONFIG"),
+		Endpoint:   os.Getenv("K8S_ENDPOINT"),
+		Token:      os.Getenv("K8S_TOKEN"),
+		TokenFile:  os.Getenv("K8S_TOKEN_FILE"),
+		CACert:     os.Getenv("K8S_CA_CERT"),
+		CACertFile: os.Getenv("K8S_CA_CERT_FILE"),
+	}
+}
+
+// NewGenericNodePortDiscoveryWithCredentials creates a generic Kubernetes
+// service discovery connecting with credentials
+func NewGenericNodePortDiscoveryWithCredentials(credentials GenericCredentials) (*GenericNodePortDiscovery, error) {
 	slog.Info("Initializing Generic Kubernetes NodePort discovery")
 
 	// Try kubeconfig first
-	kubeconfig := os.Getenv("KUBECONFIG")
-	if kubeconfig != "" {
-		slog.Info("Using kubeconfig for authentication", "path", kubeconfig)
-		return newGenericDiscoveryFromKubeconfig(kubeconfig)
+	if credentials.Kubeconfig != "" {
+		slog.Info("Using kubeconfig for authentication", "path", credentials.Kubeconfig)
+		return newGenericDiscoveryFromKubeconfig(credentials.Kubeconfig)
 	}
 
 	// Try individual environment variables
-	k8sEndpoint := os.Getenv("K8S_ENDPOINT")
-	k8sToken := os.Getenv("K8S_TOKEN")
-	k8sCACert := os.Getenv("K8S_CA_CERT")
+	creds := envCredentials{
+		endpoint:   credentials.Endpoint,
+		token:      credentials.Token,
+		tokenFile:  credentials.TokenFile,
+		caCert:     credentials.CACert,
+		caCertFile: credentials.CACertFile,
+	}
 
-	if k8sEndpoint != "" && k8sToken != "" && k8sCACert != "" {
+	if creds.complete() {
 		slog.Info("Using environment variables for authentication")
-		return newGenericDiscoveryFromEnv(k8sEndpoint, k8sToken, k8sCACert)
+		return newGenericDiscoveryFromEnv(creds)
 	}
 
 	// Try in-cluster configuration (when running as a pod)
@@ -50,9 +94,22 @@ func NewGenericNodePortDiscovery() (*GenericNodePortDiscovery, error) {
 	return newGenericDiscoveryFromInCluster()
 }
 
+// NewGenericNodePortDiscoveryWithClientset creates a generic service discovery
+// for an existing clientset, e.g. one shared with node discovery
+func NewGenericNodePortDiscoveryWithClientset(k8sClientset kubernetes.Interface, clusterInfo *ClusterInfo) *GenericNodePortDiscovery {
+	return &GenericNodePortDiscovery{
+		k8sClientset: k8sClientset,
+		clusterInfo:  clusterInfo,
+	}
+}
+
 // newGenericDiscoveryFromKubeconfig creates discovery using kubeconfig file
 func newGenericDiscoveryFromKubeconfig(kubeconfigPath string) (*GenericNodePortDiscovery, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
+	kubeconfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
+	}
+	config, err := clientcmd.NewDefaultClientConfig(*kubeconfig, &clientcmd.ConfigOverrides{}).ClientConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build config from kubeconfig: %w", err)
 	}
@@ -62,14 +119,12 @@ func newGenericDiscoveryFromKubeconfig(kubeconfigPath string) (*GenericNodePortD
 		return nil, fmt.Errorf("failed to create K8s clientset: %w", err)
 	}
 
-	// Extract cluster info from config
-	clusterInfo := &ClusterInfo{
-		Name:     "generic-cluster", // Could be extracted from kubeconfig if needed
-		Location: "generic",
-		Endpoint: config.Host,
-	}
+	clusterInfo := kubeconfigClusterInfo(kubeconfig, config.Host)
 
-	slog.Info("Generic Kubernetes discovery initialized with kubeconfig", "endpoint", config.Host)
+	slog.Info("Generic Kubernetes discovery initialized with kubeconfig",
+		"endpoint", config.Host,
+		"cluster", clusterInfo.Name,
+		"context", clusterInfo.Location)
 	return &GenericNodePortDiscovery{
 		kubeconfig:   kubeconfigPath,
 		k8sClientset: k8sClientset,
@@ -77,25 +132,46 @@ func newGenericDiscoveryFromKubeconfig(kubeconfigPath string) (*GenericNodePortD
 	}, nil
 }
 
-// newGenericDiscoveryFromEnv creates discovery using environment variables
-func newGenericDiscoveryFromEnv(endpoint, token, caCert string) (*GenericNodePortDiscovery, error) {
-	// Decode base64 CA certificate if needed
-	caCertBytes := []byte(caCert)
-	if len(caCert) > 0 && caCert[:10] != "-----BEGIN" {
-		// Assume it's base64 encoded
-		decoded, err := base64.StdEncoding.DecodeString(caCert)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode CA certificate: %w", err)
-		}
-		caCertBytes = decoded
+// kubeconfigClusterInfo names the cluster after the kubeconfig's current
+// context: its cluster entry as the name and the context itself as the
+// location. Missing entries fall back to the generic placeholders.
+func kubeconfigClusterInfo(kubeconfig *clientcmdapi.Config, endpoint string) *ClusterInfo {
+	clusterInfo := &ClusterInfo{
+		Name:     "generic-cluster",
+		Location: "generic",
+		Endpoint: endpoint,
+	}
+	kubeContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return clusterInfo
 	}
+	clusterInfo.Location = kubeconfig.CurrentContext
+	if kubeContext.Cluster != "" {
+		clusterInfo.Name = kubeContext.Cluster
+	}
+	return clusterInfo
+}
 
-	config := &rest.Config{
-		Host:        endpoint,
-		BearerToken: token,
-		TLSClientConfig: rest.TLSClientConfig{
-			CAData: caCertBytes,
-		},
+// envCredentials holds the K8S_* environment variables for connecting to an
+// API server directly. The *File variants take precedence over the inline values.
+type envCredentials struct {
+	endpoint   string
+	token      string
+	tokenFile  string
+	caCert     string
+	caCertFile string
+}
+
+// complete reports whether an endpoint, a token and a CA certificate are all set
+func (c envCredentials) complete() bool {
+	return c.endpoint != "" && (c.token != "" || c.tokenFile != "") && (c.caCert != "" || c.caCertFile != "")
+}
+
+// newGenericDiscoveryFromEnv creates discovery using environment variables
+func newGenericDiscoveryFromEnv(creds envCredentials) (*GenericNodePortDiscovery, error) {
+	config, err := envRestConfig(creds)
+	if err != nil {
+		return nil, err
 	}
 
 	k8sClientset, err := kubernetes.NewForConfig(config)
@@ -106,19 +182,114 @@ func newGenericDiscoveryFromEnv(endpoint, token, caCert string) (*GenericNodePor
 	clusterInfo := &ClusterInfo{
 		Name:     "generic-cluster",
 		Location: "generic",
-		Endpoint: endpoint,
+		Endpoint: creds.endpoint,
 	}
 
-	slog.Info("Generic Kubernetes discovery initialized with env vars", "endpoint", endpoint)
+	slog.Info("Generic Kubernetes discovery initialized with env vars", "endpoint", creds.endpoint)
 	return &GenericNodePortDiscovery{
-		k8sEndpoint:  endpoint,
-		k8sToken:     token,
-		k8sCACert:    caCert,
+		k8sEndpoint:  creds.endpoint,
+		k8sToken:     creds.token,
+		k8sCACert:    creds.caCert,
 		k8sClientset: k8sClientset,
 		clusterInfo:  clusterInfo,
 	}, nil
 }
 
+// envRestConfig builds the client config for creds. A CA file is handed to
+// client-go, which reads it once. A token file is re-read every
+// tokenFileRefreshPeriod, and straight after the API server answers 401, so
+// rotated projected service-account tokens keep working.
+func envRestConfig(creds envCredentials) (*rest.Config, error) {
+	config := &rest.Config{Host: creds.endpoint}
+
+	if creds.tokenFile != "" {
+		source := tokenFileSource{path: creds.tokenFile}
+		if _, err := source.Token(); err != nil {
+			return nil, err
+		}
+		config.WrapTransport = transport.ResettableTokenSourceWrapTransport(transport.NewCachedTokenSource(source))
+	} else {
+		config.BearerToken = creds.token
+	}
+
+	if creds.caCertFile != "" {
+		if err := validateCACertFile(creds.caCertFile); err != nil {
+			return nil, err
+		}
+		config.TLSClientConfig.CAFile = creds.caCertFile
+		return config, nil
+	}
+
+	// Decode base64 CA certificate if needed
+	caCertBytes := []byte(creds.caCert)
+	if !strings.HasPrefix(creds.caCert, "-----BEGIN") {
+		// Assume it's base64 encoded
+		decoded, err := base64.StdEncoding.DecodeString(creds.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode CA certificate: %w", err)
+		}
+		caCertBytes = decoded
+	}
+	config.TLSClientConfig.CAData = caCertBytes
+	return config, nil
+}
+
+// tokenFileRefreshPeriod is how long a token read from K8S_TOKEN_FILE is used
+// before the file is read again. The kubelet rotates projected tokens well
+// before they expire, so a minute is plenty.
+var tokenFileRefreshPeriod = time.Minute
+
+// tokenFileSource reads the bearer token from a file on every call
+type tokenFileSource struct {
+	path string
+}
+
+// Token implements oauth2.TokenSource. The expiry tells the caching wrapper
+// when to read the file again; it is not the token's real expiry.
+func (s tokenFileSource) Token() (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read K8S_TOKEN_FILE: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("K8S_TOKEN_FILE %s is empty", s.path)
+	}
+	return &oauth2.Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(tokenFileRefreshPeriod),
+	}, nil
+}
+
+// validateCACertFile checks that path holds at least one PEM certificate, so a
+// missing or wrong mount fails at startup rather than on the first API call
+func validateCACertFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read K8S_CA_CERT_FILE: %w", err)
+	}
+	found := false
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("invalid certificate in K8S_CA_CERT_FILE %s: %w", path, err)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("K8S_CA_CERT_FILE %s contains no PEM certificate", path)
+	}
+	return nil
+}
+
 // newGenericDiscoveryFromInCluster creates discovery using in-cluster configuration
 func newGenericDiscoveryFromInCluster() (*GenericNodePortDiscovery, error) {
 	config, err := rest.InClusterConfig()
@@ -153,7 +324,7 @@ func (d *GenericNodePortDiscovery) DiscoverNodePorts(ctx context.Context) ([]int
 
 	var ports []int
 	for _, service := range services {
-		ports = append(ports, int(service.NodePort))
+		ports = append(ports, service.ListenPort())
 	}
 
 	return ports, nil
@@ -163,48 +334,36 @@ func (d *GenericNodePortDiscovery) DiscoverNodePorts(ctx context.Context) ([]int
 func (d *GenericNodePortDiscovery) DiscoverServices(ctx context.Context) ([]ServiceInfo, error) {
 	slog.Info("Discovering Generic Kubernetes NodePort services")
 
-	// Get namespace from environment variable - required
-	namespace := os.Getenv("NAMESPACE")
-	if namespace == "" {
-		return nil, fmt.Errorf("NAMESPACE environment variable is required")
+	opts, err := resolveDiscoveryOptions(d.options)
+	if err != nil {
+		return nil, err
 	}
+	namespace := opts.Namespace
 
-	slog.Info("Discovering services in namespace", "namespace", namespace)
+	slog.Info("Discovering services in namespace", "namespace", namespace, "target_mode", opts.TargetMode)
 
-	services, err := d.k8sClientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	// Services are converted page by page, so only their infos are kept
+	serviceInfos, err := ListAll(ctx, serviceListOptions(), d.k8sClientset.CoreV1().Services(namespace).List,
+		func(page *corev1.ServiceList) []ServiceInfo {
+			return collectServiceInfos(page.Items, opts.TargetMode, opts.IncludeClusterIP)
+		})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list services: %w", err)
-	}
-
-	var serviceInfos []ServiceInfo
-	for _, service := range services.Items {
-		if service.Spec.Type == corev1.ServiceTypeNodePort {
-			for _, port := range service.Spec.Ports {
-				if port.NodePort != 0 {
-					serviceInfo := ServiceInfo{
-						Name:       service.Name,
-						Namespace:  service.Namespace,
-						NodePort:   port.NodePort,
-						TargetPort: port.TargetPort.IntVal,
-						Protocol:   string(port.Protocol),
-					}
-					serviceInfos = append(serviceInfos, serviceInfo)
-					slog.Info("Found NodePort service",
-						"service", service.Name,
-						"namespace", service.Namespace,
-						"nodePort", port.NodePort,
-						"targetPort", port.TargetPort.IntVal)
-				}
-			}
-		}
+		return nil, fmt.Errorf("failed to list services: %w", CheckPermission(err, "list", "services", namespace))
 	}
+	serviceInfos = uniqueListenPorts(serviceInfos)
 
 	slog.Info("Generic Kubernetes NodePort discovery completed", "total_services", len(serviceInfos))
 	return serviceInfos, nil
 }
 
+// SetDiscoveryOptions makes the discovery use opts instead of reading them
+// from the environment on each discovery
+func (d *GenericNodePortDiscovery) SetDiscoveryOptions(opts DiscoveryOptions) {
+	d.options = &opts
+}
+
 // GetClientset returns the Kubernetes clientset used by this discovery
-func (d *GenericNodePortDiscovery) GetClientset() *kubernetes.Clientset {
+func (d *GenericNodePortDiscovery) GetClientset() kubernetes.Interface {
 	return d.k8sClientset
 }
 
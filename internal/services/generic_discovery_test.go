@@ -1,10 +1,18 @@
 package services
 
 import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes"
 )
 
 // TestNewGenericNodePortDiscovery_Kubeconfig tests initialization with KUBECONFIG (T030)
@@ -36,6 +44,44 @@ func TestNewGenericNodePortDiscovery_Kubeconfig(t *testing.T) {
 	assert.Contains(t, err.Error(), "failed to build config from kubeconfig")
 }
 
+// TestNewGenericNodePortDiscovery_KubeconfigClusterName tests that the current
+// context's cluster and context names show up in the cluster info
+func TestNewGenericNodePortDiscovery_KubeconfigClusterName(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: staging-east
+  cluster:
+    server: https://staging.example.com:6443
+- name: production-west
+  cluster:
+    server: https://production.example.com:6443
+contexts:
+- name: staging
+  context:
+    cluster: staging-east
+    user: proxy
+- name: production
+  context:
+    cluster: production-west
+    user: proxy
+current-context: production
+users:
+- name: proxy
+  user:
+    token: test-token
+`), 0o600))
+
+	discovery, err := newGenericDiscoveryFromKubeconfig(kubeconfig)
+	require.NoError(t, err)
+
+	info := discovery.GetClusterInfo()
+	assert.Equal(t, "production-west", info.Name)
+	assert.Equal(t, "production", info.Location)
+	assert.Equal(t, "https://production.example.com:6443", info.Endpoint)
+}
+
 // TestNewGenericNodePortDiscovery_EnvVars tests initialization with environment variables (T031)
 func TestNewGenericNodePortDiscovery_EnvVars(t *testing.T) {
 	// Save original env vars
@@ -101,6 +147,130 @@ func TestNewGenericNodePortDiscovery_NoConfig(t *testing.T) {
 	assert.Contains(t, err.Error(), "in-cluster")
 }
 
+// TestEnvRestConfig_CACertFile tests that K8S_CA_CERT_FILE is trusted and takes precedence over K8S_CA_CERT
+func TestEnvRestConfig_CACertFile(t *testing.T) {
+	apiServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"major":"1","minor":"34","gitVersion":"v1.34.1"}`))
+	}))
+	defer apiServer.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: apiServer.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	// The inline value is not a certificate at all, so it must be ignored
+	config, err := envRestConfig(envCredentials{endpoint: apiServer.URL, token: "token", caCert: "not-a-cert", caCertFile: caFile})
+	require.NoError(t, err)
+	assert.Equal(t, caFile, config.TLSClientConfig.CAFile)
+	assert.Empty(t, config.TLSClientConfig.CAData)
+
+	clientset, err := kubernetes.NewForConfig(config)
+	require.NoError(t, err)
+	version, err := clientset.Discovery().ServerVersion()
+	require.NoError(t, err, "the API server certificate should be trusted through the CA file")
+	assert.Equal(t, "v1.34.1", version.GitVersion)
+}
+
+// TestEnvRestConfig_InvalidCACertFile tests that a missing or malformed CA file fails at startup
+func TestEnvRestConfig_InvalidCACertFile(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := envRestConfig(envCredentials{endpoint: "https://k8s.example.com:6443", token: "token", caCertFile: filepath.Join(dir, "missing.crt")})
+	assert.ErrorContains(t, err, "failed to read K8S_CA_CERT_FILE")
+
+	notPEM := filepath.Join(dir, "not-pem.crt")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+	_, err = envRestConfig(envCredentials{endpoint: "https://k8s.example.com:6443", token: "token", caCertFile: notPEM})
+	assert.ErrorContains(t, err, "contains no PEM certificate")
+
+	badCert := filepath.Join(dir, "bad.crt")
+	require.NoError(t, os.WriteFile(badCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}), 0o600))
+	_, err = envRestConfig(envCredentials{endpoint: "https://k8s.example.com:6443", token: "token", caCertFile: badCert})
+	assert.ErrorContains(t, err, "invalid certificate in K8S_CA_CERT_FILE")
+}
+
+// TestEnvRestConfig_TokenFileRotation tests that a rotated K8S_TOKEN_FILE is used for later requests
+func TestEnvRestConfig_TokenFileRotation(t *testing.T) {
+	var mu sync.Mutex
+	validToken := "token-1"
+	var seen []string
+	apiServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer "+validToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"major":"1","minor":"34","gitVersion":"v1.34.1"}`))
+	}))
+	defer apiServer.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: apiServer.Certificate().Raw}), 0o600))
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token-1\n"), 0o600))
+
+	// The file takes precedence over the inline token
+	config, err := envRestConfig(envCredentials{endpoint: apiServer.URL, token: "inline", tokenFile: tokenFile, caCertFile: caFile})
+	require.NoError(t, err)
+	clientset, err := kubernetes.NewForConfig(config)
+	require.NoError(t, err)
+	serverVersion := func() error {
+		_, err := clientset.Discovery().ServerVersion()
+		return err
+	}
+	rotate := func(token string) {
+		mu.Lock()
+		validToken = token
+		mu.Unlock()
+		require.NoError(t, os.WriteFile(tokenFile, []byte(token+"\n"), 0o600))
+	}
+	lastSeen := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen[len(seen)-1]
+	}
+
+	require.NoError(t, serverVersion())
+	assert.Equal(t, "Bearer token-1", lastSeen())
+
+	// The old token is rejected once; the 401 forces a re-read for the next request
+	rotate("token-2")
+	assert.Error(t, serverVersion())
+	require.NoError(t, serverVersion())
+	assert.Equal(t, "Bearer token-2", lastSeen())
+
+	// Without a 401 the file is re-read once the refresh period has passed.
+	// token-3 is read with the short period so that it expires from the cache.
+	original := tokenFileRefreshPeriod
+	tokenFileRefreshPeriod = 10 * time.Millisecond
+	defer func() { tokenFileRefreshPeriod = original }()
+	rotate("token-3")
+	assert.Error(t, serverVersion())
+	require.NoError(t, serverVersion())
+	rotate("token-4")
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, serverVersion())
+	assert.Equal(t, "Bearer token-4", lastSeen())
+}
+
+// TestEnvRestConfig_InvalidTokenFile tests that a missing or empty token file fails at startup
+func TestEnvRestConfig_InvalidTokenFile(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := envRestConfig(envCredentials{endpoint: "https://k8s.example.com:6443", tokenFile: filepath.Join(dir, "missing")})
+	assert.ErrorContains(t, err, "failed to read K8S_TOKEN_FILE")
+
+	empty := filepath.Join(dir, "empty")
+	require.NoError(t, os.WriteFile(empty, []byte("\n"), 0o600))
+	_, err = envRestConfig(envCredentials{endpoint: "https://k8s.example.com:6443", tokenFile: empty})
+	assert.ErrorContains(t, err, "is empty")
+}
+
 // restoreEnv is a helper to restore environment variables
 func restoreEnv(key, value string) {
 	if value == "" {
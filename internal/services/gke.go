@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/container/v1"
+)
+
+// gkeUsePrivateEndpointFromEnv reads GKE_USE_PRIVATE_ENDPOINT (default true)
+func gkeUsePrivateEndpointFromEnv() (bool, error) {
+	value := os.Getenv("GKE_USE_PRIVATE_ENDPOINT")
+	if value == "" {
+		return true, nil
+	}
+	usePrivate, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid GKE_USE_PRIVATE_ENDPOINT value %q: must be true or false", value)
+	}
+	return usePrivate, nil
+}
+
+// GKEClusterEndpoint returns the address of the cluster's API server. The
+// private endpoint is preferred for internal VPC connectivity; clusters without
+// one, or GKE_USE_PRIVATE_ENDPOINT=false, use the public endpoint. Node and
+// NodePort discovery both connect through it.
+func GKEClusterEndpoint(cluster *container.Cluster) (string, error) {
+	usePrivate, err := gkeUsePrivateEndpointFromEnv()
+	if err != nil {
+		return "", err
+	}
+
+	if usePrivate && cluster.PrivateClusterConfig != nil && cluster.PrivateClusterConfig.PrivateEndpoint != "" {
+		return cluster.PrivateClusterConfig.PrivateEndpoint, nil
+	}
+	if cluster.Endpoint == "" {
+		return "", fmt.Errorf("cluster %s has no usable endpoint", cluster.Name)
+	}
+	return cluster.Endpoint, nil
+}
+
+// gkeClusterNamesFromEnv reads CLUSTER_NAME: one cluster name, or an ordered,
+// comma-separated list of preferred clusters for failover
+func gkeClusterNamesFromEnv() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("CLUSTER_NAME"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// FindGKECluster returns the project's cluster the proxy serves: the one named
+// by CLUSTER_NAME (optionally narrowed by CLUSTER_LOCATION), or the first
+// cluster listed when CLUSTER_NAME is unset. With several preferred clusters
+// it returns the most preferred one.
+func FindGKECluster(ctx context.Context, containerSvc *container.Service, projectID string) (*container.Cluster, error) {
+	clusters, err := FindGKEClusters(ctx, containerSvc, projectID)
+	if err != nil {
+		return nil, err
+	}
+	return clusters[0], nil
+}
+
+// FindGKEClusters returns the clusters named by CLUSTER_NAME in order of
+// preference. Preferred clusters that don't exist are skipped with a warning
+// as long as one of them does.
+func FindGKEClusters(ctx context.Context, containerSvc *container.Service, projectID string) ([]*container.Cluster, error) {
+	names := gkeClusterNamesFromEnv()
+	location := os.Getenv("CLUSTER_LOCATION")
+
+	parentLocation := location
+	if parentLocation == "" {
+		parentLocation = "-"
+	}
+	clusters, err := containerSvc.Projects.Locations.Clusters.List(
+		fmt.Sprintf("projects/%s/locations/%s", projectID, parentLocation)).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list clusters: %w", err)
+	}
+
+	return selectGKEClusters(clusters.Clusters, projectID, names, location)
+}
+
+// selectGKEClusters picks the cluster for each preferred name, in order. No
+// names means the first cluster listed.
+func selectGKEClusters(clusters []*container.Cluster, projectID string, names []string, location string) ([]*container.Cluster, error) {
+	if len(names) <= 1 {
+		name := ""
+		if len(names) == 1 {
+			name = names[0]
+		}
+		cluster, err := selectGKECluster(clusters, projectID, name, location)
+		if err != nil {
+			return nil, err
+		}
+		return []*container.Cluster{cluster}, nil
+	}
+
+	var selected []*container.Cluster
+	var errs []error
+	for _, name := range names {
+		cluster, err := selectGKECluster(clusters, projectID, name, location)
+		if err != nil {
+			slog.Warn("Skipping preferred cluster", "cluster", name, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		selected = append(selected, cluster)
+	}
+	if len(selected) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return selected, nil
+}
+
+// selectGKECluster picks the cluster matching name and location from the listed
+// clusters; empty values match any cluster
+func selectGKECluster(clusters []*container.Cluster, projectID, name, location string) (*container.Cluster, error) {
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no clusters found in project %s", projectID)
+	}
+
+	var matches []*container.Cluster
+	for _, cluster := range clusters {
+		if (name == "" || cluster.Name == name) && (location == "" || cluster.Location == location) {
+			matches = append(matches, cluster)
+		}
+	}
+
+	switch {
+	case len(matches) == 0:
+		var available []string
+		for _, cluster := range clusters {
+			available = append(available, cluster.Name+" ("+cluster.Location+")")
+		}
+		return nil, fmt.Errorf("cluster %q not found in project %s (CLUSTER_LOCATION=%q); available clusters: %s",
+			name, projectID, location, strings.Join(available, ", "))
+	case name == "":
+		// Without CLUSTER_NAME the first cluster is used, as before
+		return matches[0], nil
+	case len(matches) > 1:
+		return nil, fmt.Errorf("cluster %q exists in several locations of project %s; set CLUSTER_LOCATION", name, projectID)
+	}
+	return matches[0], nil
+}
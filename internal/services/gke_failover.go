@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/container/v1"
+	"k8s.io/client-go/rest"
+)
+
+// GKEClusters sends Kubernetes API requests to one of the preferred clusters
+// (CLUSTER_NAME, in order). Requests go to the first cluster until it can't be
+// connected to; then they move on to the next cluster in the list and stay
+// there, so an active/standby pair fails over without a restart. Node and
+// NodePort discovery share one GKEClusters so they always talk to the same
+// cluster.
+type GKEClusters struct {
+	targets []gkeClusterTarget
+	current atomic.Int32
+}
+
+// gkeClusterTarget is one preferred cluster and the authenticated transport to its API server
+type gkeClusterTarget struct {
+	info      ClusterInfo
+	host      string
+	transport http.RoundTripper
+}
+
+// ConnectGKEClusters prepares API access to the project's preferred clusters,
+// skipping (with a warning) any whose access can't be set up
+func ConnectGKEClusters(ctx context.Context, containerSvc *container.Service, projectID string) (*GKEClusters, error) {
+	clusters, err := FindGKEClusters(ctx, containerSvc, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get Google default token source (uses ADC)
+	tokenSource, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get default token source: %w", err)
+	}
+	return newGKEClusters(clusters, tokenSource)
+}
+
+func newGKEClusters(clusters []*container.Cluster, tokenSource oauth2.TokenSource) (*GKEClusters, error) {
+	c := &GKEClusters{}
+	var errs []error
+	for _, cluster := range clusters {
+		target, err := newGKEClusterTarget(cluster, tokenSource)
+		if err != nil {
+			slog.Warn("Skipping cluster, failed to set up API access", "cluster", cluster.Name, "location", cluster.Location, "error", err)
+			errs = append(errs, fmt.Errorf("cluster %s: %w", cluster.Name, err))
+			continue
+		}
+		slog.Info("Using cluster for K8s API access", "cluster", cluster.Name, "location", cluster.Location, "endpoint", target.info.Endpoint, "preference", len(c.targets)+1)
+		c.targets = append(c.targets, target)
+	}
+	if len(c.targets) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	return c, nil
+}
+
+func newGKEClusterTarget(cluster *container.Cluster, tokenSource oauth2.TokenSource) (gkeClusterTarget, error) {
+	endpoint, err := GKEClusterEndpoint(cluster)
+	if err != nil {
+		return gkeClusterTarget{}, err
+	}
+
+	var caCert []byte
+	if cluster.MasterAuth != nil {
+		caCert, err = base64.StdEncoding.DecodeString(cluster.MasterAuth.ClusterCaCertificate)
+		if err != nil {
+			return gkeClusterTarget{}, fmt.Errorf("failed to decode cluster CA certificate: %w", err)
+		}
+	}
+
+	transport, err := rest.TransportFor(&rest.Config{
+		Host: "https://" + endpoint,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData: caCert,
+		},
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return &oauth2.Transport{
+				Source: tokenSource,
+				Base:   rt,
+			}
+		},
+	})
+	if err != nil {
+		return gkeClusterTarget{}, fmt.Errorf("failed to create transport: %w", err)
+	}
+
+	return gkeClusterTarget{
+		info: ClusterInfo{
+			Name:     cluster.Name,
+			Location: cluster.Location,
+			Endpoint: endpoint,
+		},
+		host:      endpoint,
+		transport: transport,
+	}, nil
+}
+
+// RestConfig returns the client config for building clientsets on top of c
+func (c *GKEClusters) RestConfig() *rest.Config {
+	// Requests are re-addressed to the current cluster in RoundTrip; Host
+	// only has to be a valid base URL
+	return &rest.Config{
+		Host:      "https://" + c.targets[0].host,
+		Transport: c,
+	}
+}
+
+// Current returns the cluster requests currently go to
+func (c *GKEClusters) Current() *ClusterInfo {
+	info := c.targets[c.current.Load()].info
+	return &info
+}
+
+// RoundTrip sends req to the current cluster. When that cluster can't be
+// connected to, the request is tried on the following clusters in order, and
+// the first one that answers becomes current.
+func (c *GKEClusters) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := int(c.current.Load())
+	var lastErr error
+	for i := range c.targets {
+		index := (start + i) % len(c.targets)
+		target := c.targets[index]
+
+		attempt := req.Clone(req.Context())
+		attempt.URL.Scheme = "https"
+		attempt.URL.Host = target.host
+		attempt.Host = ""
+		if i > 0 && req.Body != nil {
+			// The request never reached the failed cluster, but its body may have been read
+			if req.GetBody == nil {
+				return nil, lastErr
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, lastErr
+			}
+			attempt.Body = body
+		}
+
+		resp, err := target.transport.RoundTrip(attempt)
+		if err == nil {
+			if index != start && c.current.CompareAndSwap(int32(start), int32(index)) {
+				failed := c.targets[start].info
+				slog.Warn("Kubernetes API unreachable, failed over to the next preferred cluster",
+					"old_cluster", failed.Name,
+					"new_cluster", target.info.Name,
+					"error", lastErr)
+			}
+			return resp, nil
+		}
+		if !connectFailed(err) || req.Context().Err() != nil {
+			return nil, err
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// connectFailed reports whether err means no connection to the API server
+// could be made, so the request was never sent and may go elsewhere
+func connectFailed(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
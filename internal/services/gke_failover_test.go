@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/container/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// mockGKECluster serves the namespace's services like a cluster's API server
+// and describes itself as a GKE cluster
+func mockGKECluster(t *testing.T, name string, requests *atomic.Int32) *container.Cluster {
+	t.Helper()
+	apiServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer gke-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(corev1.ServiceList{
+			TypeMeta: metav1.TypeMeta{Kind: "ServiceList", APIVersion: "v1"},
+			Items: []corev1.Service{{
+				ObjectMeta: metav1.ObjectMeta{Name: name + "-web", Namespace: "default"},
+				Spec: corev1.ServiceSpec{
+					Type:  corev1.ServiceTypeNodePort,
+					Ports: []corev1.ServicePort{{Port: 80, NodePort: 30080, Protocol: corev1.ProtocolTCP}},
+				},
+			}},
+		})
+	}))
+	t.Cleanup(apiServer.Close)
+
+	return &container.Cluster{
+		Name:     name,
+		Location: "us-central1",
+		Endpoint: strings.TrimPrefix(apiServer.URL, "https://"),
+		MasterAuth: &container.MasterAuth{ClusterCaCertificate: base64.StdEncoding.EncodeToString(
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: apiServer.Certificate().Raw}))},
+	}
+}
+
+// unreachableGKECluster describes a cluster whose API server refuses connections
+func unreachableGKECluster(t *testing.T, name string, ca string) *container.Cluster {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	endpoint := listener.Addr().String()
+	listener.Close()
+
+	return &container.Cluster{
+		Name:       name,
+		Location:   "us-central1",
+		Endpoint:   endpoint,
+		MasterAuth: &container.MasterAuth{ClusterCaCertificate: ca},
+	}
+}
+
+// TestGKEClusters_Failover tests that discovery moves on from a preferred
+// cluster that can't be set up or reached to the next one, and stays there
+func TestGKEClusters_Failover(t *testing.T) {
+	t.Setenv("NAMESPACE", "default")
+	t.Setenv("GKE_USE_PRIVATE_ENDPOINT", "false")
+
+	var standbyRequests atomic.Int32
+	standby := mockGKECluster(t, "standby", &standbyRequests)
+	broken := &container.Cluster{
+		Name:       "broken",
+		Endpoint:   "10.0.0.1",
+		MasterAuth: &container.MasterAuth{ClusterCaCertificate: "not base64!"},
+	}
+	primary := unreachableGKECluster(t, "primary", standby.MasterAuth.ClusterCaCertificate)
+
+	clusters, err := newGKEClusters([]*container.Cluster{broken, primary, standby},
+		oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "gke-token"}))
+	require.NoError(t, err)
+	require.Len(t, clusters.targets, 2, "the cluster with a broken CA is skipped")
+	assert.Equal(t, "primary", clusters.Current().Name)
+
+	discovery, err := NewNodePortDiscoveryForClusters("test-project", clusters)
+	require.NoError(t, err)
+
+	services, err := discovery.DiscoverServices(context.Background())
+	require.NoError(t, err)
+	require.Len(t, services, 1)
+	assert.Equal(t, "standby-web", services[0].Name)
+	assert.Equal(t, "standby", discovery.GetClusterInfo().Name)
+	assert.Equal(t, int32(1), standbyRequests.Load())
+
+	// Later requests go straight to the standby
+	_, err = discovery.DiscoverServices(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "standby", discovery.GetClusterInfo().Name)
+	assert.Equal(t, int32(2), standbyRequests.Load())
+}
+
+// TestGKEClusters_NoneUsable tests that setting up fails when no preferred cluster can be used
+func TestGKEClusters_NoneUsable(t *testing.T) {
+	_, err := newGKEClusters([]*container.Cluster{{
+		Name:       "broken",
+		Endpoint:   "10.0.0.1",
+		MasterAuth: &container.MasterAuth{ClusterCaCertificate: "not base64!"},
+	}}, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "gke-token"}))
+	assert.ErrorContains(t, err, "cluster broken: failed to decode cluster CA certificate")
+}
+
+// TestSelectGKEClusters tests that a comma-separated CLUSTER_NAME keeps its
+// order and skips clusters that don't exist
+func TestSelectGKEClusters(t *testing.T) {
+	clusters := []*container.Cluster{
+		{Name: "standby", Location: "us-east1"},
+		{Name: "primary", Location: "us-central1"},
+	}
+
+	t.Setenv("CLUSTER_NAME", " primary, retired ,standby")
+	names := gkeClusterNamesFromEnv()
+	assert.Equal(t, []string{"primary", "retired", "standby"}, names)
+
+	selected, err := selectGKEClusters(clusters, "test-project", names, "")
+	require.NoError(t, err)
+	require.Len(t, selected, 2)
+	assert.Equal(t, "primary", selected[0].Name)
+	assert.Equal(t, "standby", selected[1].Name)
+
+	_, err = selectGKEClusters(clusters, "test-project", []string{"dev", "qa"}, "")
+	assert.ErrorContains(t, err, `cluster "dev" not found`)
+	assert.ErrorContains(t, err, `cluster "qa" not found`)
+
+	// A single name keeps the single-cluster behavior
+	selected, err = selectGKEClusters(clusters, "test-project", nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "standby", selected[0].Name)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/container/v1"
+)
+
+// TestGKEClusterEndpoint tests that public clusters fall back to their public
+// endpoint and GKE_USE_PRIVATE_ENDPOINT picks between the two
+func TestGKEClusterEndpoint(t *testing.T) {
+	privateCluster := &container.Cluster{
+		Name:                 "private-cluster",
+		Endpoint:             "34.123.45.67",
+		PrivateClusterConfig: &container.PrivateClusterConfig{PrivateEndpoint: "10.0.0.1"},
+	}
+	publicCluster := &container.Cluster{
+		Name:     "public-cluster",
+		Endpoint: "34.123.45.68",
+	}
+
+	tests := []struct {
+		name       string
+		usePrivate string
+		cluster    *container.Cluster
+		want       string
+	}{
+		{"PrivatePreferredByDefault", "", privateCluster, "10.0.0.1"},
+		{"PublicClusterWithoutPrivateEndpoint", "", publicCluster, "34.123.45.68"},
+		{"EmptyPrivateEndpoint", "true", &container.Cluster{
+			Name:                 "public-cluster",
+			Endpoint:             "34.123.45.68",
+			PrivateClusterConfig: &container.PrivateClusterConfig{},
+		}, "34.123.45.68"},
+		{"PrivateDisabled", "false", privateCluster, "34.123.45.67"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GKE_USE_PRIVATE_ENDPOINT", tt.usePrivate)
+
+			endpoint, err := GKEClusterEndpoint(tt.cluster)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, endpoint)
+		})
+	}
+
+	t.Run("NoEndpoint", func(t *testing.T) {
+		_, err := GKEClusterEndpoint(&container.Cluster{Name: "broken-cluster"})
+		assert.ErrorContains(t, err, "broken-cluster")
+	})
+
+	t.Run("InvalidValue", func(t *testing.T) {
+		t.Setenv("GKE_USE_PRIVATE_ENDPOINT", "maybe")
+		_, err := GKEClusterEndpoint(privateCluster)
+		assert.Error(t, err)
+	})
+}
+
+// TestSelectGKECluster tests that CLUSTER_NAME and CLUSTER_LOCATION pick one of
+// several clusters and that the first cluster is only used when they are unset
+func TestSelectGKECluster(t *testing.T) {
+	clusters := []*container.Cluster{
+		{Name: "staging", Location: "us-central1"},
+		{Name: "production", Location: "us-central1"},
+		{Name: "production", Location: "europe-west1"},
+	}
+
+	tests := []struct {
+		name         string
+		clusterName  string
+		location     string
+		wantLocation string
+		wantName     string
+		wantErr      string
+	}{
+		{name: "FirstWhenUnset", wantName: "staging", wantLocation: "us-central1"},
+		{name: "ByName", clusterName: "staging", wantName: "staging", wantLocation: "us-central1"},
+		{name: "ByNameAndLocation", clusterName: "production", location: "europe-west1", wantName: "production", wantLocation: "europe-west1"},
+		{name: "FirstInLocation", location: "europe-west1", wantName: "production", wantLocation: "europe-west1"},
+		{name: "NotFound", clusterName: "dev", wantErr: `cluster "dev" not found`},
+		{name: "WrongLocation", clusterName: "staging", location: "europe-west1", wantErr: `cluster "staging" not found`},
+		{name: "Ambiguous", clusterName: "production", wantErr: "set CLUSTER_LOCATION"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, err := selectGKECluster(clusters, "test-project", tt.clusterName, tt.location)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantName, cluster.Name)
+			assert.Equal(t, tt.wantLocation, cluster.Location)
+		})
+	}
+
+	t.Run("NoClusters", func(t *testing.T) {
+		_, err := selectGKECluster(nil, "test-project", "", "")
+		assert.ErrorContains(t, err, "no clusters found")
+	})
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ListPageSize is how many objects each List request asks for. Large clusters
+// are listed in pages of this size instead of in one response.
+const ListPageSize int64 = 500
+
+// ListAll lists every object across the pages of a paginated List, following
+// Continue tokens. items takes what's needed from each page as it arrives, so
+// only that is kept and not the pages themselves. If a Continue token expires
+// before the last page, the objects are listed again in a single request.
+func ListAll[L metav1.ListInterface, T any](ctx context.Context, opts metav1.ListOptions, list func(context.Context, metav1.ListOptions) (L, error), items func(L) []T) ([]T, error) {
+	opts.Limit = ListPageSize
+	opts.Continue = ""
+
+	var all []T
+	for {
+		page, err := list(ctx, opts)
+		if err != nil {
+			if opts.Continue == "" || !apierrors.IsResourceExpired(err) {
+				return nil, err
+			}
+			slog.Warn("List continue token expired, listing again without pagination", "listed", len(all), "error", err)
+			opts.Limit, opts.Continue = 0, ""
+			if page, err = list(ctx, opts); err != nil {
+				return nil, err
+			}
+			return items(page), nil
+		}
+		all = append(all, items(page)...)
+		if opts.Continue = page.GetContinue(); opts.Continue == "" {
+			return all, nil
+		}
+	}
+}
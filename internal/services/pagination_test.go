@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// nodePortService builds a NodePort service named after its NodePort
+func nodePortService(nodePort int32) corev1.Service {
+	return corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("svc-%d", nodePort), Namespace: "apps"},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{{Port: 80, NodePort: nodePort, Protocol: corev1.ProtocolTCP}},
+		},
+	}
+}
+
+// pagedServices serves services like the API server does: Limit objects per
+// page, continuing after the offset in the Continue token
+func pagedServices(services []corev1.Service, calls *[]metav1.ListOptions) func(context.Context, metav1.ListOptions) (*corev1.ServiceList, error) {
+	return func(_ context.Context, opts metav1.ListOptions) (*corev1.ServiceList, error) {
+		*calls = append(*calls, opts)
+		start, _ := strconv.Atoi(opts.Continue)
+		end := len(services)
+		if opts.Limit > 0 {
+			end = min(start+int(opts.Limit), end)
+		}
+		list := &corev1.ServiceList{Items: services[start:end]}
+		if end < len(services) {
+			list.Continue = strconv.Itoa(end)
+		}
+		return list, nil
+	}
+}
+
+func TestListAll(t *testing.T) {
+	var services []corev1.Service
+	for i := range 1100 {
+		services = append(services, nodePortService(int32(30000+i)))
+	}
+	names := func(page *corev1.ServiceList) []string {
+		var names []string
+		for _, service := range page.Items {
+			names = append(names, service.Name)
+		}
+		return names
+	}
+
+	t.Run("FollowsContinueTokens", func(t *testing.T) {
+		var calls []metav1.ListOptions
+		got, err := ListAll(context.Background(), metav1.ListOptions{LabelSelector: "app=web"}, pagedServices(services, &calls), names)
+		require.NoError(t, err)
+
+		require.Len(t, got, len(services))
+		assert.Equal(t, "svc-30000", got[0])
+		assert.Equal(t, "svc-31099", got[len(got)-1])
+		require.Len(t, calls, 3)
+		assert.Equal(t, []string{"", "500", "1000"}, []string{calls[0].Continue, calls[1].Continue, calls[2].Continue})
+		for _, call := range calls {
+			assert.Equal(t, ListPageSize, call.Limit)
+			assert.Equal(t, "app=web", call.LabelSelector, "every page keeps the caller's options")
+		}
+	})
+
+	t.Run("ExpiredContinueListsAgain", func(t *testing.T) {
+		var calls []metav1.ListOptions
+		paged := pagedServices(services, &calls)
+		list := func(ctx context.Context, opts metav1.ListOptions) (*corev1.ServiceList, error) {
+			if opts.Continue == "1000" {
+				calls = append(calls, opts)
+				return nil, apierrors.NewResourceExpired("continue token expired")
+			}
+			return paged(ctx, opts)
+		}
+
+		got, err := ListAll(context.Background(), metav1.ListOptions{}, list, names)
+		require.NoError(t, err)
+
+		assert.Len(t, got, len(services), "the pages listed before the expiry are not counted twice")
+		require.Len(t, calls, 4)
+		assert.Zero(t, calls[3].Limit, "the list is retried without pagination")
+	})
+}
+
+// TestDiscoverServices_Paginated tests that services on every page are discovered
+func TestDiscoverServices_Paginated(t *testing.T) {
+	var services []corev1.Service
+	for i := range 1200 {
+		services = append(services, nodePortService(int32(30000+i)))
+	}
+
+	// The fake clientset ignores Limit and Continue, so serve the pages in turn
+	clientset := fake.NewClientset()
+	var page int
+	clientset.PrependReactor("list", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		start := page * int(ListPageSize)
+		end := min(start+int(ListPageSize), len(services))
+		list := &corev1.ServiceList{Items: services[start:end]}
+		if page++; end < len(services) {
+			list.Continue = fmt.Sprintf("page-%d", page)
+		}
+		return true, list, nil
+	})
+	discovery := NewGenericNodePortDiscoveryWithClientset(clientset, &ClusterInfo{Name: "test"})
+	discovery.SetDiscoveryOptions(DiscoveryOptions{Namespace: "apps", TargetMode: TargetModeNodePort})
+
+	serviceInfos, err := discovery.DiscoverServices(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, serviceInfos, len(services))
+	assert.Equal(t, int32(31199), serviceInfos[len(serviceInfos)-1].NodePort)
+	assert.Equal(t, 3, page, "1200 services are listed in pages of 500")
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// PermissionError is returned when the Kubernetes API refuses a call for lack
+// of RBAC permission. It names what to grant and to whom.
+type PermissionError struct {
+	// Verb and Resource are the missing permission, e.g. "list" and "nodes"
+	Verb     string
+	Resource string
+	// Namespace is where the permission is needed; empty for cluster-scoped resources
+	Namespace string
+	// User is the identity the API server refused, e.g.
+	// "system:serviceaccount:default:k8s-node-proxy"; empty if it didn't say
+	User string
+	Err  error
+}
+
+func (e *PermissionError) Error() string {
+	who := "the proxy's service account"
+	if e.User != "" {
+		who = fmt.Sprintf("%q", e.User)
+	}
+	if e.Namespace == "" {
+		return fmt.Sprintf("missing RBAC permission: %s cannot %s %s at the cluster scope; bind it to a ClusterRole granting %q on %q: %v",
+			who, e.Verb, e.Resource, e.Verb, e.Resource, e.Err)
+	}
+	return fmt.Sprintf("missing RBAC permission: %s cannot %s %s in namespace %q; bind it to a Role in that namespace granting %q on %q: %v",
+		who, e.Verb, e.Resource, e.Namespace, e.Verb, e.Resource, e.Err)
+}
+
+func (e *PermissionError) Unwrap() error {
+	return e.Err
+}
+
+// forbiddenUser extracts the refused identity from the API server's Forbidden
+// message: `nodes is forbidden: User "system:serviceaccount:ns:name" cannot list ...`
+var forbiddenUser = regexp.MustCompile(`User "([^"]+)"`)
+
+// CheckPermission turns a Forbidden error from verb on resource into a
+// *PermissionError and returns any other error unchanged
+func CheckPermission(err error, verb, resource, namespace string) error {
+	if !apierrors.IsForbidden(err) {
+		return err
+	}
+	var permissionErr *PermissionError
+	if errors.As(err, &permissionErr) {
+		return err
+	}
+	permissionErr = &PermissionError{Verb: verb, Resource: resource, Namespace: namespace, Err: err}
+	if match := forbiddenUser.FindStringSubmatch(err.Error()); match != nil {
+		permissionErr.User = match[1]
+	}
+	return permissionErr
+}
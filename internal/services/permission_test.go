@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestDiscoverServices_Forbidden tests that a missing services.list permission
+// is reported as a PermissionError naming the namespace and the service account
+func TestDiscoverServices_Forbidden(t *testing.T) {
+	t.Setenv("NAMESPACE", "apps")
+
+	clientset := fake.NewClientset()
+	clientset.PrependReactor("list", "services", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "services"}, "",
+			errors.New(`User "system:serviceaccount:apps:k8s-node-proxy" cannot list resource "services" in API group "" in the namespace "apps"`))
+	})
+	discovery := NewGenericNodePortDiscoveryWithClientset(clientset, &ClusterInfo{Name: "test"})
+
+	_, err := discovery.DiscoverServices(context.Background())
+	require.Error(t, err)
+
+	var permissionErr *PermissionError
+	require.ErrorAs(t, err, &permissionErr)
+	assert.Equal(t, "list", permissionErr.Verb)
+	assert.Equal(t, "services", permissionErr.Resource)
+	assert.Equal(t, "apps", permissionErr.Namespace)
+	assert.Equal(t, "system:serviceaccount:apps:k8s-node-proxy", permissionErr.User)
+	assert.Contains(t, err.Error(), `"system:serviceaccount:apps:k8s-node-proxy" cannot list services in namespace "apps"; bind it to a Role in that namespace granting "list" on "services"`)
+	assert.True(t, apierrors.IsForbidden(err))
+}
+
+// TestCheckPermission tests that only Forbidden errors are converted
+func TestCheckPermission(t *testing.T) {
+	assert.NoError(t, CheckPermission(nil, "list", "nodes", ""))
+
+	unavailable := apierrors.NewServiceUnavailable("apiserver down")
+	assert.Same(t, unavailable, CheckPermission(unavailable, "list", "nodes", ""))
+
+	// Without a user in the message the account is described generically
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "nodes"}, "", errors.New("denied"))
+	err := CheckPermission(forbidden, "list", "nodes", "")
+	assert.Contains(t, err.Error(), "missing RBAC permission: the proxy's service account cannot list nodes at the cluster scope")
+
+	// Already converted errors are left alone
+	assert.Same(t, err, CheckPermission(err, "get", "nodes", ""))
+}
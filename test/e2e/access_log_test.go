@@ -0,0 +1,56 @@
+package e2e
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"k8s-node-proxy/internal/proxy"
+)
+
+// TestAccessLogNodePort tests that the access log and metrics name the target NodePort and service
+func TestAccessLogNodePort(t *testing.T) {
+	t.Setenv("PROXY_METRICS_NODEPORT_LABELS", "true")
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	backendHostPort := extractHostPort(backend.URL)
+	nodePort := extractPort(backendHostPort)
+	port, _ := strconv.Atoi(nodePort)
+
+	proxyHandler := proxy.NewHandler(&MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}, proxySettingsFromEnv(t))
+	proxyHandler.SetServiceNames(map[int]string{port: "shop/web"})
+
+	var logs bytes.Buffer
+	original := log.Writer()
+	log.SetOutput(&logs)
+	defer log.SetOutput(original)
+
+	series := `k8s_node_proxy_node_port_requests_total{node_port="` + nodePort + `",service="shop/web"}`
+	before := scrapeMetric(t, series)
+
+	req := httptest.NewRequest(http.MethodGet, "/cart", nil)
+	req.Host = "localhost:" + nodePort
+	w := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	line := logs.String()
+	if !strings.Contains(line, "node_port="+nodePort) || !strings.Contains(line, "service=shop/web") {
+		t.Errorf("Expected access log to include node_port=%s and service=shop/web, got %q", nodePort, line)
+	}
+
+	if after := scrapeMetric(t, series); after != before+1 {
+		t.Errorf("Expected %s to increment from %v, got %v", series, before, after)
+	}
+}
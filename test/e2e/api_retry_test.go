@@ -0,0 +1,79 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/test/mocks"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// failingTransport answers the first failures requests with 503 Service
+// Unavailable, as an API server does during an etcd leader election
+type failingTransport struct {
+	next     http.RoundTripper
+	failures int32
+	calls    atomic.Int32
+}
+
+func (t *failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.calls.Add(1) <= t.failures {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "503 Service Unavailable",
+			Header:     http.Header{"Content-Type": []string{"text/plain"}},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	}
+	return t.next.RoundTrip(req)
+}
+
+// TestNodeDiscovery_RetriesTransientAPIErrors tests that node discovery rides out
+// a short API server outage instead of failing
+func TestNodeDiscovery_RetriesTransientAPIErrors(t *testing.T) {
+	k8sAPI := mocks.NewMockKubernetesAPI([]mocks.MockK8sNode{
+		{
+			Name:         "node-1",
+			InternalIP:   "10.0.1.1",
+			IsHealthy:    true,
+			CreationTime: time.Now().Add(-24 * time.Hour),
+		},
+	}, nil)
+	defer k8sAPI.Close()
+
+	transport := &failingTransport{failures: 2}
+	clientset, err := kubernetes.NewForConfig(&rest.Config{
+		Host: k8sAPI.URL,
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			transport.next = rt
+			return transport
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create clientset: %v", err)
+	}
+
+	discovery, err := nodes.NewGenericNodeDiscovery(clientset)
+	if err != nil {
+		t.Fatalf("Failed to create discovery: %v", err)
+	}
+	defer discovery.StopHealthMonitoring()
+
+	ip, err := discovery.GetCurrentNodeIP(context.Background())
+	if err != nil {
+		t.Fatalf("Expected discovery to recover from transient API errors, got %v", err)
+	}
+	if ip != "10.0.1.1" {
+		t.Errorf("Expected 10.0.1.1, got %s", ip)
+	}
+	if calls := transport.calls.Load(); calls <= transport.failures {
+		t.Errorf("Expected the node list to be retried, got %d calls", calls)
+	}
+}
@@ -0,0 +1,60 @@
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/services"
+)
+
+// TestClusterIPTargetMode tests that clusterip mode forwards to the service ClusterIP:port
+func TestClusterIPTargetMode(t *testing.T) {
+	t.Run("ForwardsToClusterIP", func(t *testing.T) {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Hello from ClusterIP service"))
+		}))
+		defer backend.Close()
+
+		backendHostPort := extractHostPort(backend.URL)
+		backendPort, _ := strconv.Atoi(extractPort(backendHostPort))
+
+		// The backend stands in for the service's ClusterIP:port
+		serviceInfos := []services.ServiceInfo{
+			{Name: "api", Namespace: "default", ClusterIP: extractHost(backendHostPort), Port: int32(backendPort)},
+		}
+		proxyHandler := proxy.NewClusterIPHandler(services.ClusterIPTargets(serviceInfos), proxySettingsFromEnv(t))
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Host = "localhost:" + strconv.Itoa(backendPort)
+		w := httptest.NewRecorder()
+
+		proxyHandler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		body, _ := io.ReadAll(w.Result().Body)
+		if string(body) != "Hello from ClusterIP service" {
+			t.Errorf("Unexpected body: %q", string(body))
+		}
+	})
+
+	t.Run("UnknownPortIsUnavailable", func(t *testing.T) {
+		proxyHandler := proxy.NewClusterIPHandler(map[int]string{8080: "10.96.0.10"}, proxySettingsFromEnv(t))
+
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Host = "localhost:9090"
+		w := httptest.NewRecorder()
+
+		proxyHandler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503 for unmapped port, got %d", w.Code)
+		}
+	})
+}
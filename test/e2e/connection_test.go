@@ -0,0 +1,69 @@
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s-node-proxy/internal/proxy"
+)
+
+// TestClientConnectionSemantics tests that the client's Connection header decides
+// whether its connection is kept alive, independent of the backend connection
+func TestClientConnectionSemantics(t *testing.T) {
+	newProxy := func(t *testing.T, backend http.HandlerFunc) (*httptest.Server, string) {
+		t.Helper()
+		backendServer := httptest.NewServer(backend)
+		t.Cleanup(backendServer.Close)
+
+		backendHostPort := extractHostPort(backendServer.URL)
+		proxyServer := httptest.NewServer(proxy.NewHandler(&MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}, proxySettingsFromEnv(t)))
+		t.Cleanup(proxyServer.Close)
+		return proxyServer, "localhost:" + extractPort(backendHostPort)
+	}
+
+	do := func(t *testing.T, proxyURL, host string, closeConn bool) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, proxyURL+"/", nil)
+		req.Host = host
+		req.Close = closeConn
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Run("ClientConnectionClose", func(t *testing.T) {
+		proxyServer, host := newProxy(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+
+		resp := do(t, proxyServer.URL, host, true)
+		// resp.Close reflects the Connection: close the proxy sent back
+		if !resp.Close {
+			t.Error("Expected the proxy to close a Connection: close client connection")
+		}
+	})
+
+	t.Run("ClientKeepAlive", func(t *testing.T) {
+		// The backend closing its own connection must not close the client's
+		proxyServer, host := newProxy(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			w.Header().Set("Keep-Alive", "timeout=1")
+			w.Write([]byte("ok"))
+		})
+
+		resp := do(t, proxyServer.URL, host, false)
+		if resp.Close {
+			t.Error("Expected the client connection to stay open when the backend closes its connection")
+		}
+		if got := resp.Header.Get("Keep-Alive"); got != "" {
+			t.Errorf("Expected backend Keep-Alive header to be dropped, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/internal/proxy"
+)
+
+// TestFailoverDrainsInFlightRequests tests that a request in flight to the old
+// node when a failover happens is allowed to finish, and is cancelled once it
+// outlives PROXY_DRAIN_TIMEOUT
+func TestFailoverDrainsInFlightRequests(t *testing.T) {
+	// slowRequest starts a request through a proxy whose backend answers only when
+	// release is closed, fails over mid-flight, and returns the response status and body
+	slowRequest := func(t *testing.T, release <-chan struct{}) (int, string) {
+		t.Helper()
+		started := make(chan struct{})
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			select {
+			case <-release:
+				w.Write([]byte("done"))
+			case <-r.Context().Done():
+			}
+		}))
+		t.Cleanup(backend.Close)
+
+		backendHostPort := extractHostPort(backend.URL)
+		discovery := &MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}
+		handler := proxy.NewHandler(discovery, proxySettingsFromEnv(t))
+		proxyServer := httptest.NewServer(handler)
+		t.Cleanup(proxyServer.Close)
+
+		events := make(chan nodes.NodeEvent, 1)
+		t.Cleanup(func() { close(events) })
+		go handler.DrainOnFailover(events)
+
+		type result struct {
+			status int
+			body   string
+			err    error
+		}
+		results := make(chan result, 1)
+		go func() {
+			req, _ := http.NewRequest(http.MethodGet, proxyServer.URL+"/slow", nil)
+			req.Host = "localhost:" + extractPort(backendHostPort)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				results <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			results <- result{status: resp.StatusCode, body: string(body)}
+		}()
+
+		<-started
+		discovery.mu.Lock()
+		discovery.nodeIP = "127.0.0.2"
+		discovery.mu.Unlock()
+		events <- nodes.NodeEvent{Type: nodes.NodeFailover, OldNode: "node-1", NewNode: "node-2",
+			OldIP: extractHost(backendHostPort), NewIP: "127.0.0.2", Time: time.Now()}
+
+		select {
+		case res := <-results:
+			if res.err != nil {
+				t.Fatalf("Request failed: %v", res.err)
+			}
+			return res.status, res.body
+		case <-time.After(5 * time.Second):
+			t.Fatal("Request did not complete")
+			return 0, ""
+		}
+	}
+
+	t.Run("InFlightRequestCompletes", func(t *testing.T) {
+		release := make(chan struct{})
+		time.AfterFunc(200*time.Millisecond, func() { close(release) })
+
+		status, body := slowRequest(t, release)
+		if status != http.StatusOK || body != "done" {
+			t.Errorf("Expected the in-flight request to finish on the old node, got %d %q", status, body)
+		}
+	})
+
+	t.Run("DrainTimeoutCancels", func(t *testing.T) {
+		t.Setenv("PROXY_DRAIN_TIMEOUT", "100ms")
+		release := make(chan struct{}) // never released
+
+		status, _ := slowRequest(t, release)
+		if status != http.StatusBadGateway {
+			t.Errorf("Expected a request outliving the drain timeout to be cancelled with 502, got %d", status)
+		}
+	})
+}
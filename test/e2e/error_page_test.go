@@ -0,0 +1,83 @@
+package e2e
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"k8s-node-proxy/internal/proxy"
+)
+
+// TestSuppressBackendErrorBody tests that configured backend error bodies are replaced
+func TestSuppressBackendErrorBody(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(status)
+		w.Write([]byte("panic: internal stack trace"))
+	}))
+	defer backend.Close()
+
+	backendHostPort := extractHostPort(backend.URL)
+
+	proxyStatus := func(t *testing.T, status int) (*http.Response, string) {
+		t.Helper()
+		proxyHandler := proxy.NewHandler(&MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}, proxySettingsFromEnv(t))
+
+		req := httptest.NewRequest(http.MethodGet, "/?status="+strconv.Itoa(status), nil)
+		req.Host = "localhost:" + extractPort(backendHostPort)
+		w := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != status {
+			t.Fatalf("Expected status %d to be preserved, got %d", status, resp.StatusCode)
+		}
+		return resp, string(body)
+	}
+
+	t.Run("ConfiguredStatusReplaced", func(t *testing.T) {
+		t.Setenv("PROXY_SUPPRESS_BACKEND_ERROR_BODY", "502,503")
+
+		resp, body := proxyStatus(t, http.StatusServiceUnavailable)
+		if body != "503 Service Unavailable\n" {
+			t.Errorf("Expected default error page, got %q", body)
+		}
+		if got := resp.Header.Get("Retry-After"); got != "30" {
+			t.Errorf("Expected non-body headers to be kept, got Retry-After %q", got)
+		}
+	})
+
+	t.Run("OtherStatusPreserved", func(t *testing.T) {
+		t.Setenv("PROXY_SUPPRESS_BACKEND_ERROR_BODY", "502,503")
+
+		for _, status := range []int{http.StatusOK, http.StatusInternalServerError} {
+			if _, body := proxyStatus(t, status); body != "panic: internal stack trace" {
+				t.Errorf("Expected backend body for status %d, got %q", status, body)
+			}
+		}
+	})
+
+	t.Run("CustomErrorPage", func(t *testing.T) {
+		page := filepath.Join(t.TempDir(), "error.html")
+		if err := os.WriteFile(page, []byte("<h1>Please try again later</h1>"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("PROXY_SUPPRESS_BACKEND_ERROR_BODY", "502")
+		t.Setenv("PROXY_ERROR_PAGE_FILE", page)
+
+		resp, body := proxyStatus(t, http.StatusBadGateway)
+		if body != "<h1>Please try again later</h1>" {
+			t.Errorf("Expected custom error page, got %q", body)
+		}
+		if got := resp.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+			t.Errorf("Expected HTML content type, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+package e2e
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/proxy"
+)
+
+// countingReader records whether the client transport ever read the upload body
+type countingReader struct {
+	r    io.Reader
+	read atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.read.Add(int64(n))
+	return n, err
+}
+
+// TestExpectContinue tests that Expect: 100-continue uploads are coordinated with the backend
+func TestExpectContinue(t *testing.T) {
+	// Long enough that a passing test proves the 100 Continue was relayed,
+	// rather than the client giving up waiting and sending the body anyway
+	const clientWait = 10 * time.Second
+
+	newClient := func() *http.Client {
+		return &http.Client{Transport: &http.Transport{ExpectContinueTimeout: clientWait}}
+	}
+
+	t.Run("UploadProceeds", func(t *testing.T) {
+		var sawExpect atomic.Bool
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sawExpect.Store(r.Header.Get("Expect") == "100-continue")
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(strconv.Itoa(len(body))))
+		}))
+		defer backend.Close()
+
+		backendHostPort := extractHostPort(backend.URL)
+		proxyServer := httptest.NewServer(proxy.NewHandler(&MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}, proxySettingsFromEnv(t)))
+		defer proxyServer.Close()
+
+		payload := bytes.Repeat([]byte("x"), 1<<20)
+		req, _ := http.NewRequest(http.MethodPut, proxyServer.URL+"/upload", bytes.NewReader(payload))
+		req.Host = "localhost:" + extractPort(backendHostPort)
+		req.Header.Set("Expect", "100-continue")
+
+		start := time.Now()
+		resp, err := newClient().Do(req)
+		if err != nil {
+			t.Fatalf("Upload failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != strconv.Itoa(len(payload)) {
+			t.Errorf("Expected backend to receive %d bytes, got %s", len(payload), body)
+		}
+		if !sawExpect.Load() {
+			t.Error("Expected Expect: 100-continue to be forwarded to the backend")
+		}
+		if elapsed := time.Since(start); elapsed >= clientWait {
+			t.Errorf("Upload waited %v; 100 Continue was not relayed to the client", elapsed)
+		}
+	})
+
+	t.Run("ExplicitInterimResponse", func(t *testing.T) {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Send the interim response before touching the body, as non-Go backends do
+			w.WriteHeader(http.StatusContinue)
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(strconv.Itoa(len(body))))
+		}))
+		defer backend.Close()
+
+		backendHostPort := extractHostPort(backend.URL)
+		proxyServer := httptest.NewServer(proxy.NewHandler(&MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}, proxySettingsFromEnv(t)))
+		defer proxyServer.Close()
+
+		payload := bytes.Repeat([]byte("x"), 1<<20)
+		req, _ := http.NewRequest(http.MethodPut, proxyServer.URL+"/upload", bytes.NewReader(payload))
+		req.Host = "localhost:" + extractPort(backendHostPort)
+		req.Header.Set("Expect", "100-continue")
+
+		start := time.Now()
+		resp, err := newClient().Do(req)
+		if err != nil {
+			t.Fatalf("Upload failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d", resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != strconv.Itoa(len(payload)) {
+			t.Errorf("Expected backend to receive %d bytes, got %s", len(payload), body)
+		}
+		if elapsed := time.Since(start); elapsed >= clientWait {
+			t.Errorf("Upload waited %v; 100 Continue was not relayed to the client", elapsed)
+		}
+	})
+
+	t.Run("RejectedBeforeBodyIsSent", func(t *testing.T) {
+		backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Reject on headers alone without reading the body
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}))
+		defer backend.Close()
+
+		backendHostPort := extractHostPort(backend.URL)
+		proxyServer := httptest.NewServer(proxy.NewHandler(&MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}, proxySettingsFromEnv(t)))
+		defer proxyServer.Close()
+
+		upload := &countingReader{r: bytes.NewReader(bytes.Repeat([]byte("x"), 1<<20))}
+		req, _ := http.NewRequest(http.MethodPut, proxyServer.URL+"/upload", upload)
+		req.ContentLength = 1 << 20
+		req.Host = "localhost:" + extractPort(backendHostPort)
+		req.Header.Set("Expect", "100-continue")
+
+		resp, err := newClient().Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status 413, got %d", resp.StatusCode)
+		}
+		if n := upload.read.Load(); n != 0 {
+			t.Errorf("Expected the client body to be withheld, but %d bytes were read", n)
+		}
+	})
+}
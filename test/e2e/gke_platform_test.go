@@ -6,6 +6,9 @@ import (
 	"testing"
 	"time"
 
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/option"
+
 	"k8s-node-proxy/internal/platform"
 	"k8s-node-proxy/internal/services"
 	"k8s-node-proxy/test/mocks"
@@ -209,3 +212,65 @@ func TestGKEClusterInfoStructure(t *testing.T) {
 		t.Logf("Cluster info: %+v", clusterInfo)
 	})
 }
+
+// TestGKEClusterSelectionWithMock tests that CLUSTER_NAME and CLUSTER_LOCATION
+// pick the cluster from the Container API's list
+func TestGKEClusterSelectionWithMock(t *testing.T) {
+	staging := mocks.NewDefaultMockGKECluster()
+	staging.Name = "staging"
+	production := mocks.NewDefaultMockGKECluster()
+	production.Name = "production"
+	production.PrivateClusterConfig.PrivateEndpoint = "10.0.0.2"
+	productionEU := mocks.NewDefaultMockGKECluster()
+	productionEU.Name = "production"
+	productionEU.Location = "europe-west1"
+	productionEU.PrivateClusterConfig.PrivateEndpoint = "10.0.0.3"
+
+	mockServer := mocks.NewMockGKEContainerAPI([]mocks.GKECluster{staging, production, productionEU})
+	defer mockServer.Close()
+
+	ctx := context.Background()
+	containerSvc, err := container.NewService(ctx, option.WithEndpoint(mockServer.URL), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("Failed to create container service: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		clusterName  string
+		location     string
+		wantEndpoint string
+		wantErr      bool
+	}{
+		{name: "FirstClusterWhenUnset", wantEndpoint: "10.0.0.1"},
+		{name: "NamedCluster", clusterName: "production", location: "us-central1", wantEndpoint: "10.0.0.2"},
+		{name: "NamedClusterInLocation", clusterName: "production", location: "europe-west1", wantEndpoint: "10.0.0.3"},
+		{name: "UnknownCluster", clusterName: "dev", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CLUSTER_NAME", tt.clusterName)
+			t.Setenv("CLUSTER_LOCATION", tt.location)
+
+			cluster, err := services.FindGKECluster(ctx, containerSvc, "test-project-12345")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error for cluster %q, got %s", tt.clusterName, cluster.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to find cluster: %v", err)
+			}
+
+			endpoint, err := services.GKEClusterEndpoint(cluster)
+			if err != nil {
+				t.Fatalf("Failed to resolve endpoint: %v", err)
+			}
+			if endpoint != tt.wantEndpoint {
+				t.Errorf("Expected endpoint %s, got %s", tt.wantEndpoint, endpoint)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package e2e
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/server"
+)
+
+// TestGRPCProxy tests that unary and streaming gRPC calls pass through a proxy
+// port over cleartext HTTP/2, trailers included
+func TestGRPCProxy(t *testing.T) {
+	t.Setenv("LISTEN_ADDRESS", "127.0.0.1")
+
+	// The "node" is a second loopback address, so the proxy can listen on the
+	// backend's NodePort itself
+	backendListener, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("shop", healthpb.HealthCheckResponse_SERVING)
+	grpcServer := grpc.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	go grpcServer.Serve(backendListener)
+	defer grpcServer.Stop()
+	backendPort := backendListener.Addr().(*net.TCPAddr).Port
+
+	proxyPort := backendPort
+	pm := server.NewPortManager(listenersFromEnv(t))
+	if err := pm.StartPort(proxyPort, proxy.NewHandler(&MockNodeDiscovery{nodeIP: "127.0.0.2"}, proxySettingsFromEnv(t))); err != nil {
+		t.Fatalf("Failed to start proxy port: %v", err)
+	}
+	defer pm.StopAll()
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := grpc.NewClient("127.0.0.1:"+strconv.Itoa(proxyPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create gRPC client: %v", err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("Unary", func(t *testing.T) {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "shop"})
+		if err != nil {
+			t.Fatalf("Unary call through the proxy failed: %v", err)
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected SERVING, got %v", resp.Status)
+		}
+	})
+
+	t.Run("StatusFromTrailers", func(t *testing.T) {
+		// Unknown services fail with NotFound, carried in the grpc-status trailer
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "missing"})
+		if code := status.Code(err); code != codes.NotFound {
+			t.Errorf("Expected NotFound, got %v (%v)", code, err)
+		}
+	})
+
+	t.Run("ServerStreaming", func(t *testing.T) {
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{Service: "shop"})
+		if err != nil {
+			t.Fatalf("Streaming call through the proxy failed: %v", err)
+		}
+
+		first, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Failed to receive the first stream message: %v", err)
+		}
+		if first.Status != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("Expected SERVING, got %v", first.Status)
+		}
+
+		// Each update must arrive while the stream stays open
+		healthServer.SetServingStatus("shop", healthpb.HealthCheckResponse_NOT_SERVING)
+		second, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Failed to receive the streamed update: %v", err)
+		}
+		if second.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("Expected NOT_SERVING, got %v", second.Status)
+		}
+	})
+}
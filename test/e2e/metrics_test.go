@@ -0,0 +1,82 @@
+package e2e
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"k8s-node-proxy/internal/metrics"
+	"k8s-node-proxy/internal/proxy"
+)
+
+// TestMetricsEndpoint tests that proxied requests show up in the /metrics scrape
+func TestMetricsEndpoint(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer backend.Close()
+
+	backendHostPort := extractHostPort(backend.URL)
+	proxyHandler := proxy.NewHandler(&MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}, proxySettingsFromEnv(t))
+
+	const series = `k8s_node_proxy_requests_total{code="202",method="PATCH"}`
+	before := scrapeMetric(t, series)
+
+	req := httptest.NewRequest(http.MethodPatch, "/resource", nil)
+	req.Host = "localhost:" + extractPort(backendHostPort)
+	w := httptest.NewRecorder()
+	proxyHandler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+
+	after := scrapeMetric(t, series)
+	if after != before+1 {
+		t.Errorf("Expected %s to increment from %v, got %v", series, before, after)
+	}
+
+	for _, name := range []string{
+		"k8s_node_proxy_request_duration_seconds_count",
+		"k8s_node_proxy_backend_errors_total",
+		"k8s_node_proxy_failovers_total",
+	} {
+		if !strings.Contains(scrape(t), name) {
+			t.Errorf("Expected %s in /metrics output", name)
+		}
+	}
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected /metrics status 200, got %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+// scrapeMetric returns the value of series from /metrics, or 0 if it is not present yet
+func scrapeMetric(t *testing.T, series string) float64 {
+	t.Helper()
+
+	scanner := bufio.NewScanner(strings.NewReader(scrape(t)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, found := strings.CutPrefix(line, series+" "); found {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", line, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
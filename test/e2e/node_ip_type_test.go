@@ -0,0 +1,81 @@
+package e2e
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s-node-proxy/internal/nodes"
+	"k8s-node-proxy/test/mocks"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// TestNodeIPType tests that NODE_IP_TYPE picks the node address forwarded to
+func TestNodeIPType(t *testing.T) {
+	now := time.Now()
+	k8sAPI := mocks.NewMockKubernetesAPI([]mocks.MockK8sNode{
+		{
+			Name:         "node-internal-only",
+			InternalIP:   "10.0.1.1",
+			IsHealthy:    true,
+			CreationTime: now.Add(-48 * time.Hour),
+		},
+		{
+			Name:         "node-dual",
+			InternalIP:   "10.0.1.2",
+			ExternalIP:   "203.0.113.2",
+			IsHealthy:    true,
+			CreationTime: now.Add(-24 * time.Hour),
+		},
+	}, nil)
+	defer k8sAPI.Close()
+
+	newDiscovery := func(t *testing.T) *nodes.GenericNodeDiscovery {
+		t.Helper()
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: k8sAPI.URL})
+		if err != nil {
+			t.Fatalf("Failed to create clientset: %v", err)
+		}
+		discovery, err := nodes.NewGenericNodeDiscovery(clientset)
+		if err != nil {
+			t.Fatalf("Failed to create discovery: %v", err)
+		}
+		t.Cleanup(discovery.StopHealthMonitoring)
+		return discovery
+	}
+
+	tests := []struct {
+		ipType   string
+		wantNode string
+		wantIP   string
+	}{
+		{"", "node-internal-only", "10.0.1.1"},
+		{"internal", "node-internal-only", "10.0.1.1"},
+		// Nodes without an external address are skipped
+		{"external", "node-dual", "203.0.113.2"},
+	}
+	for _, tt := range tests {
+		t.Run("Type="+tt.ipType, func(t *testing.T) {
+			t.Setenv("NODE_IP_TYPE", tt.ipType)
+			discovery := newDiscovery(t)
+
+			ip, err := discovery.GetCurrentNodeIP(context.Background())
+			if err != nil {
+				t.Fatalf("Expected a node to be selected, got %v", err)
+			}
+			if ip != tt.wantIP || discovery.GetCurrentNodeName() != tt.wantNode {
+				t.Errorf("Expected %s (%s), got %s (%s)", tt.wantNode, tt.wantIP, discovery.GetCurrentNodeName(), ip)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Setenv("NODE_IP_TYPE", "public")
+		clientset, _ := kubernetes.NewForConfig(&rest.Config{Host: k8sAPI.URL})
+		if _, err := nodes.NewGenericNodeDiscovery(clientset); err == nil {
+			t.Error("Expected an error for an invalid NODE_IP_TYPE")
+		}
+	})
+}
@@ -2,6 +2,7 @@ package e2e
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,8 +13,10 @@ import (
 	"testing"
 	"time"
 
+	"k8s-node-proxy/internal/config"
 	"k8s-node-proxy/internal/nodes"
 	"k8s-node-proxy/internal/proxy"
+	"k8s-node-proxy/internal/server"
 )
 
 // TestProxyRequestForwarding tests that proxy forwards requests correctly
@@ -36,7 +39,7 @@ func TestProxyRequestForwarding(t *testing.T) {
 		}
 
 		// Create proxy handler
-		proxyHandler := proxy.NewHandler(mockDiscovery)
+		proxyHandler := proxy.NewHandler(mockDiscovery, proxySettingsFromEnv(t))
 
 		// Create test request with the backend port in the Host header
 		req := httptest.NewRequest(http.MethodGet, "/test", nil)
@@ -83,7 +86,7 @@ func TestProxyRequestForwarding(t *testing.T) {
 			nodeIP: backendHost,
 		}
 
-		proxyHandler := proxy.NewHandler(mockDiscovery)
+		proxyHandler := proxy.NewHandler(mockDiscovery, proxySettingsFromEnv(t))
 
 		req := httptest.NewRequest(http.MethodGet, "/test", nil)
 		req.Host = "localhost:" + backendPort
@@ -207,7 +210,7 @@ func TestConcurrentRequests(t *testing.T) {
 			nodeIP: backendHost,
 		}
 
-		proxyHandler := proxy.NewHandler(mockDiscovery)
+		proxyHandler := proxy.NewHandler(mockDiscovery, proxySettingsFromEnv(t))
 
 		// Execute 1000 concurrent requests
 		numRequests := 1000
@@ -293,11 +296,34 @@ func TestConcurrentRequests(t *testing.T) {
 	})
 }
 
+// listenersFromEnv reads the listener settings the test's environment configures
+func listenersFromEnv(t testing.TB) config.Listeners {
+	t.Helper()
+	listeners, err := config.ListenersFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to read the listener settings: %v", err)
+	}
+	return listeners
+}
+
+// proxySettingsFromEnv reads the proxy settings the test's environment configures
+func proxySettingsFromEnv(t testing.TB) proxy.Settings {
+	t.Helper()
+	settings, err := proxy.SettingsFromEnv()
+	if err != nil {
+		t.Fatalf("Failed to read the proxy settings: %v", err)
+	}
+	return settings
+}
+
 // MockNodeDiscovery is a simple mock implementation for testing
 type MockNodeDiscovery struct {
-	mu       sync.RWMutex
-	nodeIP   string
-	nodeName string
+	mu                sync.RWMutex
+	nodeIP            string
+	nodeName          string
+	nodeStatus        nodes.NodeStatus
+	healthyNodes      int
+	unavailableReason string
 }
 
 func (m *MockNodeDiscovery) GetCurrentNodeIP(ctx context.Context) (string, error) {
@@ -319,7 +345,7 @@ func (m *MockNodeDiscovery) GetAllNodes(ctx context.Context) ([]nodes.NodeInfo,
 		{
 			Name:         m.nodeName,
 			IP:           m.nodeIP,
-			Status:       nodes.NodeHealthy,
+			Status:       m.nodeStatus,
 			Age:          1 * time.Hour,
 			CreationTime: time.Now().Add(-1 * time.Hour),
 			LastCheck:    time.Now(),
@@ -341,6 +367,24 @@ func (m *MockNodeDiscovery) GetCurrentNodeName() string {
 	return m.nodeName
 }
 
+func (m *MockNodeDiscovery) GetCurrentNodeStatus() nodes.NodeStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.nodeStatus
+}
+
+func (m *MockNodeDiscovery) GetHealthyNodeCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.healthyNodes
+}
+
+func (m *MockNodeDiscovery) GetUnavailableReason() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.unavailableReason
+}
+
 // extractHostPort extracts host:port from a URL
 func extractHostPort(rawURL string) string {
 	// Parse URL properly
@@ -376,18 +420,13 @@ func TestHealthEndpoint(t *testing.T) {
 	t.Run("HealthEndpointReturnsJSON", func(t *testing.T) {
 		// Create mock discovery
 		mockDiscovery := &MockNodeDiscovery{
-			nodeIP:   "10.0.0.1",
-			nodeName: "test-node-1",
+			nodeIP:       "10.0.0.1",
+			nodeName:     "test-node-1",
+			nodeStatus:   nodes.NodeHealthy,
+			healthyNodes: 3,
 		}
 
-		// Create a simple handler that mimics the health endpoint
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			nodeName := mockDiscovery.GetCurrentNodeName()
-			response := fmt.Sprintf(`{"proxy_server": "healthy", "current_node_name": "%s"}`, nodeName)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(response))
-		})
+		handler := server.Health{Nodes: mockDiscovery}
 
 		// Test the endpoint
 		req := httptest.NewRequest(http.MethodGet, "/health", nil)
@@ -406,16 +445,86 @@ func TestHealthEndpoint(t *testing.T) {
 		}
 
 		body := w.Body.String()
-		if !strings.Contains(body, "proxy_server") {
-			t.Errorf("Response missing 'proxy_server' field: %s", body)
+		response := decodeHealth(t, body)
+		if response["proxy_server"] != "healthy" {
+			t.Errorf("Response missing healthy 'proxy_server' field: %s", body)
 		}
-		if !strings.Contains(body, "test-node-1") {
+		if response["current_node_name"] != "test-node-1" {
 			t.Errorf("Response missing node name: %s", body)
 		}
+		if response["current_node_status"] != "healthy" {
+			t.Errorf("Response missing healthy node status: %s", body)
+		}
+		if response["healthy_nodes"] != float64(3) {
+			t.Errorf("Response missing healthy node count: %s", body)
+		}
 
 		t.Logf("Health endpoint response: %s", body)
 	})
 
+	t.Run("HealthEndpointReportsUnhealthyNode", func(t *testing.T) {
+		mockDiscovery := &MockNodeDiscovery{
+			nodeIP:       "10.0.0.1",
+			nodeName:     "test-node-1",
+			nodeStatus:   nodes.NodeUnhealthy,
+			healthyNodes: 2,
+		}
+
+		handler := server.Health{Nodes: mockDiscovery}
+
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		body := w.Body.String()
+		response := decodeHealth(t, body)
+		if response["current_node_status"] != "unhealthy" {
+			t.Errorf("Expected unhealthy node status: %s", body)
+		}
+		if response["proxy_server"] != "degraded" {
+			t.Errorf("Expected degraded proxy status: %s", body)
+		}
+		if response["healthy_nodes"] != float64(2) {
+			t.Errorf("Expected healthy node count 2: %s", body)
+		}
+	})
+
+	t.Run("HealthEndpointReportsUnavailableReason", func(t *testing.T) {
+		for _, reason := range []string{nodes.ReasonNoNodes, nodes.ReasonNoHealthyNodes} {
+			handler := server.Health{Nodes: &MockNodeDiscovery{
+				nodeStatus:        nodes.NodeUnknown,
+				unavailableReason: reason,
+			}}
+
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			body := w.Body.String()
+			if decodeHealth(t, body)["reason"] != reason {
+				t.Errorf("Expected reason %q in response: %s", reason, body)
+			}
+		}
+	})
+
+	t.Run("HealthEndpointEscapesNodeName", func(t *testing.T) {
+		// Node names from CRDs/virtual nodes may contain characters that need escaping
+		nodeName := `evil", "proxy_server": "injected\`
+		handler := server.Health{Nodes: &MockNodeDiscovery{nodeName: nodeName}}
+
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		response := decodeHealth(t, w.Body.String())
+		if response["current_node_name"] != nodeName {
+			t.Errorf("Expected node name %q to round-trip, got %q", nodeName, response["current_node_name"])
+		}
+		if response["proxy_server"] == "injected" {
+			t.Errorf("Node name injected a field: %s", w.Body.String())
+		}
+	})
+
 	t.Run("HealthEndpointFastResponse", func(t *testing.T) {
 		// Verify health endpoint doesn't block
 		mockDiscovery := &MockNodeDiscovery{
@@ -423,14 +532,8 @@ func TestHealthEndpoint(t *testing.T) {
 			nodeName: "test-node",
 		}
 
-		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Should use ONLY cached data, no API calls
-			nodeName := mockDiscovery.GetCurrentNodeName()
-			response := fmt.Sprintf(`{"proxy_server": "healthy", "current_node_name": "%s"}`, nodeName)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write([]byte(response))
-		})
+		// Should use ONLY cached data, no API calls
+		handler := server.Health{Nodes: mockDiscovery}
 
 		start := time.Now()
 		req := httptest.NewRequest(http.MethodGet, "/health", nil)
@@ -445,3 +548,14 @@ func TestHealthEndpoint(t *testing.T) {
 		t.Logf("Health endpoint responded in %v", duration)
 	})
 }
+
+// decodeHealth parses a /health response body, failing the test if it isn't valid JSON
+func decodeHealth(t *testing.T, body string) map[string]any {
+	t.Helper()
+
+	var response map[string]any
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("Health response is not valid JSON: %v\n%s", err, body)
+	}
+	return response
+}
@@ -0,0 +1,65 @@
+package e2e
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s-node-proxy/internal/proxy"
+)
+
+// TestResponseHeaderAllowlist tests strict-mode filtering of backend response headers
+func TestResponseHeaderAllowlist(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "abc123")
+		w.Header().Set("X-Internal-Debug", "secret")
+		w.Header().Set("Server", "backend/1.0")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer backend.Close()
+
+	backendHostPort := extractHostPort(backend.URL)
+
+	proxyRequest := func(t *testing.T) http.Header {
+		t.Helper()
+		proxyHandler := proxy.NewHandler(&MockNodeDiscovery{nodeIP: extractHost(backendHostPort)}, proxySettingsFromEnv(t))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = "localhost:" + extractPort(backendHostPort)
+		w := httptest.NewRecorder()
+		proxyHandler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		return w.Result().Header
+	}
+
+	t.Run("AllHeadersByDefault", func(t *testing.T) {
+		header := proxyRequest(t)
+		for _, key := range []string{"X-Request-Id", "X-Internal-Debug", "Server"} {
+			if header.Get(key) == "" {
+				t.Errorf("Expected %s to be copied without an allowlist", key)
+			}
+		}
+	})
+
+	t.Run("StrictMode", func(t *testing.T) {
+		t.Setenv("PROXY_RESPONSE_HEADER_ALLOWLIST", "x-request-id")
+
+		header := proxyRequest(t)
+		if got := header.Get("X-Request-Id"); got != "abc123" {
+			t.Errorf("Expected allowlisted X-Request-Id to pass, got %q", got)
+		}
+		if got := header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Expected required Content-Type to pass, got %q", got)
+		}
+		for _, key := range []string{"X-Internal-Debug", "Server"} {
+			if got := header.Get(key); got != "" {
+				t.Errorf("Expected %s to be dropped in strict mode, got %q", key, got)
+			}
+		}
+	})
+}
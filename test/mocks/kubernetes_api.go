@@ -15,6 +15,7 @@ import (
 type MockK8sNode struct {
 	Name         string
 	InternalIP   string
+	ExternalIP   string // optional
 	IsHealthy    bool
 	CreationTime time.Time
 }
@@ -83,7 +84,7 @@ func createK8sNode(mockNode MockK8sNode) corev1.Node {
 		nodeStatus = corev1.ConditionFalse
 	}
 
-	return corev1.Node{
+	node := corev1.Node{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Node",
 			APIVersion: "v1",
@@ -107,6 +108,15 @@ func createK8sNode(mockNode MockK8sNode) corev1.Node {
 			},
 		},
 	}
+
+	if mockNode.ExternalIP != "" {
+		node.Status.Addresses = append(node.Status.Addresses, corev1.NodeAddress{
+			Type:    corev1.NodeExternalIP,
+			Address: mockNode.ExternalIP,
+		})
+	}
+
+	return node
 }
 
 // NewDefaultMockNodes creates a set of mock nodes for testing
@@ -1,16 +1,18 @@
 package mocks
 
 import (
-	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"sync"
 	"time"
 )
 
 // STSAPI mocks the AWS STS (Security Token Service) API
-// Used for testing IAM authentication and token generation
+// Used for testing IAM authentication and token generation. Responses use the
+// XML query protocol of the real service, so AWS SDK clients can talk to it.
 type STSAPI struct {
 	server      *httptest.Server
 	mu          sync.RWMutex
@@ -19,69 +21,109 @@ type STSAPI struct {
 	arn         string
 	shouldFail  bool
 	failureCode int
+
+	// credentialLifetime is how long issued credentials stay valid
+	credentialLifetime time.Duration
+	// calls counts requests per action
+	calls map[string]int
+	// lastForm holds the parameters of the latest request per action
+	lastForm map[string]url.Values
 }
 
+// stsNamespace is the XML namespace of STS responses
+const stsNamespace = "https://sts.amazonaws.com/doc/2011-06-15/"
+
 // GetCallerIdentityResponse represents the response from GetCallerIdentity
 type GetCallerIdentityResponse struct {
-	GetCallerIdentityResult GetCallerIdentityResult `json:"GetCallerIdentityResult"`
-	ResponseMetadata        ResponseMetadata        `json:"ResponseMetadata"`
+	XMLName                 xml.Name                `json:"-" xml:"GetCallerIdentityResponse"`
+	Namespace               string                  `json:"-" xml:"xmlns,attr"`
+	GetCallerIdentityResult GetCallerIdentityResult `json:"GetCallerIdentityResult" xml:"GetCallerIdentityResult"`
+	ResponseMetadata        ResponseMetadata        `json:"ResponseMetadata" xml:"ResponseMetadata"`
 }
 
 // GetCallerIdentityResult contains the identity information
 type GetCallerIdentityResult struct {
-	Account string `json:"Account"`
-	UserID  string `json:"UserId"`
-	ARN     string `json:"Arn"`
+	Account string `json:"Account" xml:"Account"`
+	UserID  string `json:"UserId" xml:"UserId"`
+	ARN     string `json:"Arn" xml:"Arn"`
 }
 
 // ResponseMetadata contains request metadata
 type ResponseMetadata struct {
-	RequestID string `json:"RequestId"`
+	RequestID string `json:"RequestId" xml:"RequestId"`
 }
 
 // AssumeRoleResponse represents the response from AssumeRole
 type AssumeRoleResponse struct {
-	AssumeRoleResult AssumeRoleResult `json:"AssumeRoleResult"`
-	ResponseMetadata ResponseMetadata `json:"ResponseMetadata"`
+	XMLName          xml.Name         `json:"-" xml:"AssumeRoleResponse"`
+	Namespace        string           `json:"-" xml:"xmlns,attr"`
+	AssumeRoleResult AssumeRoleResult `json:"AssumeRoleResult" xml:"AssumeRoleResult"`
+	ResponseMetadata ResponseMetadata `json:"ResponseMetadata" xml:"ResponseMetadata"`
 }
 
 // AssumeRoleResult contains the assumed role credentials
 type AssumeRoleResult struct {
-	Credentials      *Credentials     `json:"Credentials"`
-	AssumedRoleUser  *AssumedRoleUser `json:"AssumedRoleUser"`
-	PackedPolicySize int              `json:"PackedPolicySize,omitempty"`
+	Credentials      *Credentials     `json:"Credentials" xml:"Credentials"`
+	AssumedRoleUser  *AssumedRoleUser `json:"AssumedRoleUser" xml:"AssumedRoleUser"`
+	PackedPolicySize int              `json:"PackedPolicySize,omitempty" xml:"PackedPolicySize,omitempty"`
+}
+
+// AssumeRoleWithWebIdentityResponse represents the response from
+// AssumeRoleWithWebIdentity, the call behind IAM roles for service accounts
+type AssumeRoleWithWebIdentityResponse struct {
+	XMLName                         xml.Name                        `json:"-" xml:"AssumeRoleWithWebIdentityResponse"`
+	Namespace                       string                          `json:"-" xml:"xmlns,attr"`
+	AssumeRoleWithWebIdentityResult AssumeRoleWithWebIdentityResult `json:"AssumeRoleWithWebIdentityResult" xml:"AssumeRoleWithWebIdentityResult"`
+	ResponseMetadata                ResponseMetadata                `json:"ResponseMetadata" xml:"ResponseMetadata"`
+}
+
+// AssumeRoleWithWebIdentityResult contains the credentials issued for a web identity
+type AssumeRoleWithWebIdentityResult struct {
+	Credentials                 *Credentials     `json:"Credentials" xml:"Credentials"`
+	AssumedRoleUser             *AssumedRoleUser `json:"AssumedRoleUser" xml:"AssumedRoleUser"`
+	SubjectFromWebIdentityToken string           `json:"SubjectFromWebIdentityToken" xml:"SubjectFromWebIdentityToken"`
 }
 
 // Credentials contains temporary security credentials
 type Credentials struct {
-	AccessKeyID     string    `json:"AccessKeyId"`
-	SecretAccessKey string    `json:"SecretAccessKey"`
-	SessionToken    string    `json:"SessionToken"`
-	Expiration      time.Time `json:"Expiration"`
+	AccessKeyID     string    `json:"AccessKeyId" xml:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey" xml:"SecretAccessKey"`
+	SessionToken    string    `json:"SessionToken" xml:"SessionToken"`
+	Expiration      time.Time `json:"Expiration" xml:"Expiration"`
 }
 
 // AssumedRoleUser contains information about the assumed role user
 type AssumedRoleUser struct {
-	AssumedRoleID string `json:"AssumedRoleId"`
-	ARN           string `json:"Arn"`
+	AssumedRoleID string `json:"AssumedRoleId" xml:"AssumedRoleId"`
+	ARN           string `json:"Arn" xml:"Arn"`
 }
 
 // STSErrorResponse represents an error response from STS
 type STSErrorResponse struct {
-	Error struct {
-		Type    string `json:"Type"`
-		Code    string `json:"Code"`
-		Message string `json:"Message"`
-	} `json:"Error"`
-	RequestID string `json:"RequestId"`
+	XMLName xml.Name `json:"-" xml:"ErrorResponse"`
+	Error   struct {
+		Type    string `json:"Type" xml:"Type"`
+		Code    string `json:"Code" xml:"Code"`
+		Message string `json:"Message" xml:"Message"`
+	} `json:"Error" xml:"Error"`
+	RequestID string `json:"RequestId" xml:"RequestId"`
 }
 
+// Credentials issued by the mock; the access key tells the issuing action apart
+const (
+	MockAssumedAccessKeyID     = "ASIAMOCKASSUMEDKEY123"
+	MockWebIdentityAccessKeyID = "ASIAMOCKWEBIDENTITY12"
+)
+
 // NewSTSAPI creates a new mock STS API server
 func NewSTSAPI() *STSAPI {
 	mock := &STSAPI{
-		account: "123456789012",
-		userID:  "AIDACKCEVSQ6C2EXAMPLE",
-		arn:     "arn:aws:iam::123456789012:user/test-user",
+		account:            "123456789012",
+		userID:             "AIDACKCEVSQ6C2EXAMPLE",
+		arn:                "arn:aws:iam::123456789012:user/test-user",
+		credentialLifetime: time.Hour,
+		calls:              make(map[string]int),
+		lastForm:           make(map[string]url.Values),
 	}
 
 	mux := http.NewServeMux()
@@ -132,6 +174,27 @@ func (m *STSAPI) SetShouldFail(fail bool, code int) {
 	m.failureCode = code
 }
 
+// SetCredentialLifetime sets how long issued credentials stay valid
+func (m *STSAPI) SetCredentialLifetime(lifetime time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.credentialLifetime = lifetime
+}
+
+// Calls returns how many requests were made for action
+func (m *STSAPI) Calls(action string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.calls[action]
+}
+
+// LastRequest returns the parameters of the latest request for action
+func (m *STSAPI) LastRequest(action string) url.Values {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.lastForm[action]
+}
+
 // handleRequest routes requests based on the Action parameter
 func (m *STSAPI) handleRequest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost && r.Method != http.MethodGet {
@@ -139,8 +202,8 @@ func (m *STSAPI) handleRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	if m.shouldFail {
 		m.writeErrorResponse(w, m.failureCode, "ServiceUnavailable", "STS service is temporarily unavailable")
@@ -158,12 +221,16 @@ func (m *STSAPI) handleRequest(w http.ResponseWriter, r *http.Request) {
 		m.writeErrorResponse(w, http.StatusBadRequest, "MissingAction", "Action parameter is required")
 		return
 	}
+	m.calls[action]++
+	m.lastForm[action] = r.Form
 
 	switch action {
 	case "GetCallerIdentity":
 		m.handleGetCallerIdentity(w, r)
 	case "AssumeRole":
 		m.handleAssumeRole(w, r)
+	case "AssumeRoleWithWebIdentity":
+		m.handleAssumeRoleWithWebIdentity(w, r)
 	default:
 		m.writeErrorResponse(w, http.StatusBadRequest, "InvalidAction", fmt.Sprintf("Unknown action: %s", action))
 	}
@@ -172,6 +239,7 @@ func (m *STSAPI) handleRequest(w http.ResponseWriter, r *http.Request) {
 // handleGetCallerIdentity handles the GetCallerIdentity API call
 func (m *STSAPI) handleGetCallerIdentity(w http.ResponseWriter, r *http.Request) {
 	response := GetCallerIdentityResponse{
+		Namespace: stsNamespace,
 		GetCallerIdentityResult: GetCallerIdentityResult{
 			Account: m.account,
 			UserID:  m.userID,
@@ -182,9 +250,7 @@ func (m *STSAPI) handleGetCallerIdentity(w http.ResponseWriter, r *http.Request)
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	m.writeResponse(w, response)
 }
 
 // handleAssumeRole handles the AssumeRole API call
@@ -203,12 +269,13 @@ func (m *STSAPI) handleAssumeRole(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := AssumeRoleResponse{
+		Namespace: stsNamespace,
 		AssumeRoleResult: AssumeRoleResult{
 			Credentials: &Credentials{
-				AccessKeyID:     "ASIAMOCKASSUMEDKEY123",
+				AccessKeyID:     MockAssumedAccessKeyID,
 				SecretAccessKey: "mockAssumedSecretKey1234567890abcdefghij",
 				SessionToken:    "mockAssumedSessionToken1234567890abcdefghijklmnopqrstuvwxyz",
-				Expiration:      time.Now().Add(1 * time.Hour),
+				Expiration:      time.Now().Add(m.credentialLifetime).UTC(),
 			},
 			AssumedRoleUser: &AssumedRoleUser{
 				AssumedRoleID: fmt.Sprintf("%s:%s", m.userID, roleSessionName),
@@ -220,14 +287,54 @@ func (m *STSAPI) handleAssumeRole(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	m.writeResponse(w, response)
+}
+
+// handleAssumeRoleWithWebIdentity handles the AssumeRoleWithWebIdentity API call
+func (m *STSAPI) handleAssumeRoleWithWebIdentity(w http.ResponseWriter, r *http.Request) {
+	roleArn := r.Form.Get("RoleArn")
+	roleSessionName := r.Form.Get("RoleSessionName")
+
+	for name, value := range map[string]string{"RoleArn": roleArn, "RoleSessionName": roleSessionName, "WebIdentityToken": r.Form.Get("WebIdentityToken")} {
+		if value == "" {
+			m.writeErrorResponse(w, http.StatusBadRequest, "MissingParameter", name+" parameter is required")
+			return
+		}
+	}
+
+	response := AssumeRoleWithWebIdentityResponse{
+		Namespace: stsNamespace,
+		AssumeRoleWithWebIdentityResult: AssumeRoleWithWebIdentityResult{
+			Credentials: &Credentials{
+				AccessKeyID:     MockWebIdentityAccessKeyID,
+				SecretAccessKey: "mockWebIdentitySecretKey1234567890abcdef",
+				SessionToken:    "mockWebIdentitySessionToken1234567890abcdefghijklmnopqrstuv",
+				Expiration:      time.Now().Add(m.credentialLifetime).UTC(),
+			},
+			AssumedRoleUser: &AssumedRoleUser{
+				AssumedRoleID: fmt.Sprintf("%s:%s", m.userID, roleSessionName),
+				ARN:           fmt.Sprintf("%s/assumed-role/%s", roleArn, roleSessionName),
+			},
+			SubjectFromWebIdentityToken: "system:serviceaccount:default:k8s-node-proxy",
+		},
+		ResponseMetadata: ResponseMetadata{
+			RequestID: generateRequestID(),
+		},
+	}
+
+	m.writeResponse(w, response)
+}
+
+// writeResponse writes a successful STS response
+func (m *STSAPI) writeResponse(w http.ResponseWriter, response any) {
+	w.Header().Set("Content-Type", "text/xml")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	xml.NewEncoder(w).Encode(response)
 }
 
 // writeErrorResponse writes an STS-formatted error response
 func (m *STSAPI) writeErrorResponse(w http.ResponseWriter, statusCode int, errorCode, message string) {
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", "text/xml")
 	w.WriteHeader(statusCode)
 
 	errorResp := STSErrorResponse{
@@ -237,7 +344,7 @@ func (m *STSAPI) writeErrorResponse(w http.ResponseWriter, statusCode int, error
 	errorResp.Error.Code = errorCode
 	errorResp.Error.Message = message
 
-	json.NewEncoder(w).Encode(errorResp)
+	xml.NewEncoder(w).Encode(errorResp)
 }
 
 // generateRequestID generates a mock AWS request ID